@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// agentsAnalysisPrompt asks the model to study the repository and write
+// AGENTS.md. It is sent by /agents generate along with the repository overview.
+const agentsAnalysisPrompt = "Analyze this codebase and write an AGENTS.md file for coding agents working in it. " +
+	"Start from the file tree and key files provided as context, then read the build files, " +
+	"CI configuration and a few representative source and test files with your tools. " +
+	"Cover: the commands to build, lint and run the tests (including a single test); " +
+	"the code style and conventions the code actually follows (naming, error handling, imports, test layout); " +
+	"and an architecture overview of the main packages or modules and how they fit together. " +
+	"If an AGENTS.md is already in context, keep what is still accurate and correct what is not. " +
+	"Be concise and specific to this repository, about 20-40 lines of markdown. " +
+	"Reply with the file content only, without a code fence or any text around it."
+
+// agentsGeneratedMsg carries the AGENTS.md proposed by /agents generate
+type agentsGeneratedMsg struct {
+	content string
+	err     error
+}
+
+// generateAgentsFile runs the analysis prompt in a fresh read-only session,
+// so the model can explore the repository without changing it, and returns
+// the proposed AGENTS.md content
+func generateAgentsFile(ctx context.Context, cfg Config, newClient func(*Config) (llms.Model, error)) (string, error) {
+	cfg.LLM.ReadOnly = true
+	llm, err := newClient(&cfg)
+	if err != nil {
+		return "", err
+	}
+	sess, err := NewSession(llm, &cfg, func(any) {})
+	if err != nil {
+		return "", err
+	}
+	for path, content := range gatherRepoOverview(".", explainContextLimit) {
+		sess.AddContextFile(path, content)
+	}
+	response, err := sess.Ask(ctx, agentsAnalysisPrompt)
+	if err != nil {
+		return "", err
+	}
+	content := stripMarkdownFence(response)
+	if content == "" {
+		return "", fmt.Errorf("model returned an empty AGENTS.md")
+	}
+	return content + "\n", nil
+}
+
+// stripMarkdownFence removes a code fence wrapped around the whole text,
+// which models add despite being asked not to
+func stripMarkdownFence(text string) string {
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "```") || !strings.HasSuffix(text, "```") {
+		return text
+	}
+	first := strings.Index(text, "\n")
+	if first < 0 {
+		return text
+	}
+	return strings.TrimSpace(text[first+1 : len(text)-3])
+}
+
+// withSessionNotes carries the Session Notes section of the existing
+// AGENTS.md over to the generated one, as /summary appended them by hand
+func withSessionNotes(existing, generated string) string {
+	i := strings.Index(existing, sessionNotesHeading)
+	if i < 0 || strings.Contains(generated, sessionNotesHeading) {
+		return generated
+	}
+	return strings.TrimRight(generated, "\n") + "\n\n" + strings.TrimRight(existing[i:], "\n") + "\n"
+}
+
+// writeAgentsFile replaces AGENTS.md in the current directory
+func writeAgentsFile(content string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(wd, "AGENTS.md"), []byte(content), 0o644)
+}
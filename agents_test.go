@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/fake"
+)
+
+func TestAgentsGenerate(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	existing := "# Old notes\n\nRun make.\n\n## Session Notes\n\n### 2026-01-02 10:00\n\nFixed the parser.\n"
+	require.NoError(t, os.WriteFile("AGENTS.md", []byte(existing), 0o644))
+
+	var readOnly bool
+	newClient := func(c *Config) (llms.Model, error) {
+		readOnly = c.LLM.ReadOnly
+		return fake.NewFakeLLM([]string{"```markdown\n# Project\n\nRun `go test ./...`.\n```"}), nil
+	}
+	cfg := Config{LLM: LLMConfig{Provider: "fake", Model: "model-a"}}
+	content, err := generateAgentsFile(context.Background(), cfg, newClient)
+	require.NoError(t, err)
+	assert.True(t, readOnly, "the analysis runs in a read-only session")
+	assert.Equal(t, "# Project\n\nRun `go test ./...`.\n", content, "the code fence is stripped")
+
+	// The diff is shown and nothing is written before the user agrees
+	model, _ := newTestModel(t)
+	updated, _ := model.Update(agentsGeneratedMsg{content: content})
+	m := updated.(TUIModel)
+	require.NotNil(t, m.confirm)
+	last := m.chat.Messages[len(m.chat.Messages)-1]
+	assert.Contains(t, last, "- Run make.")
+	assert.Contains(t, last, "+ Run `go test ./...`.")
+	data, err := os.ReadFile("AGENTS.md")
+	require.NoError(t, err)
+	require.Equal(t, existing, string(data))
+
+	updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	require.NotNil(t, cmd)
+	m = updated.(TUIModel)
+	data, err = os.ReadFile("AGENTS.md")
+	require.NoError(t, err)
+	// Session notes appended by /summary survive the rewrite
+	assert.Equal(t, "# Project\n\nRun `go test ./...`.\n\n## Session Notes\n\n### 2026-01-02 10:00\n\nFixed the parser.\n", string(data))
+	assert.Equal(t, string(data), m.session.ContextFiles["AGENTS.md"])
+
+	// Generating the same content again has nothing to ask
+	updated, _ = m.Update(agentsGeneratedMsg{content: content})
+	assert.Nil(t, updated.(TUIModel).confirm)
+}
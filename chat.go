@@ -1,13 +1,16 @@
 package main
 
 import (
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/muesli/reflow/wordwrap"
+	"github.com/muesli/reflow/wrap"
 )
 
 // ChatComponent represents the chat view
@@ -19,6 +22,8 @@ type ChatComponent struct {
 	Style        lipgloss.Style
 	AutoScroll   bool // Track if auto-scrolling is enabled
 	UserScrolled bool // Track if user has manually scrolled
+	ScrollLock   bool // Keep the view in place while the user is scrolled up, even as messages arrive
+	newBelow     bool // Content arrived below the view while the user was scrolled up
 
 	// Touch gesture support
 	TouchStartY      int  // Y coordinate where touch/drag started
@@ -27,6 +32,28 @@ type ChatComponent struct {
 
 	// Markdown rendering
 	markdownRenderer *glamour.TermRenderer
+
+	// HideReasoning collapses thinking blocks to a single line. The reasoning
+	// stays in Messages so it can be shown again.
+	HideReasoning bool
+
+	// ShowTimestamps prints the time each message was added above it
+	ShowTimestamps bool
+	timestamps     []time.Time // Parallel to Messages
+
+	// Plain renders messages as wrapped text without markdown, color or
+	// unicode decoration
+	Plain bool
+
+	// Compact drops the rule between turns and starts responses on the
+	// "Asimi:" line
+	Compact bool
+
+	// Tool call results, keyed by message index. Collapsed unless expanded.
+	toolResults  map[int]string
+	toolDetails  map[int][]string // Summary lines shown above an expanded result
+	toolExpanded map[int]bool
+	focusedTool  int // Message index of the focused tool call, -1 when none
 }
 
 // NewChatComponent creates a new chat component
@@ -37,6 +64,7 @@ func NewChatComponent(width, height int) ChatComponent {
 	return ChatComponent{
 		Viewport:         vp,
 		Messages:         []string{"Welcome to Asimi CLI! Send a message to start chatting."},
+		timestamps:       []time.Time{time.Now()},
 		Width:            width,
 		Height:           height,
 		AutoScroll:       true,  // Enable auto-scroll by default
@@ -45,6 +73,10 @@ func NewChatComponent(width, height int) ChatComponent {
 		TouchDragging:    false,
 		TouchScrollSpeed: 3,   // Lines to scroll per touch movement unit
 		markdownRenderer: nil, // Will be initialized asynchronously via message
+		toolResults:      make(map[int]string),
+		toolDetails:      make(map[int][]string),
+		toolExpanded:     make(map[int]bool),
+		focusedTool:      -1,
 		Style: lipgloss.NewStyle().
 			Background(lipgloss.Color("#11051E")). // Terminal7 chat background
 			Width(width).
@@ -75,16 +107,51 @@ func (c *ChatComponent) SetHeight(height int) {
 // AddMessage adds a new message to the chat component
 func (c *ChatComponent) AddMessage(message string) {
 	c.Messages = append(c.Messages, message)
+	c.timestamps = append(c.timestamps, time.Now())
+	// Follow new messages unless the user scrolled up to read, but always
+	// show the message they just sent
+	if !c.ScrollLock || strings.HasPrefix(message, "You:") {
+		c.AutoScroll = true
+		c.UserScrolled = false
+		c.newBelow = false
+	}
 	c.UpdateContent()
-	// Reset auto-scroll when new message is added
-	c.AutoScroll = true
-	c.UserScrolled = false
+	c.newBelow = c.newBelow || c.UserScrolled
 }
 
 // Replace last message
 func (c *ChatComponent) ReplaceLastMessage(message string) {
 	c.Messages[len(c.Messages)-1] = message
 	c.UpdateContent()
+	c.newBelow = c.newBelow || c.UserScrolled
+}
+
+// ScrollHalfPage scrolls half a page up when dir is negative and down
+// otherwise, resuming auto-scrolling on reaching the bottom
+func (c *ChatComponent) ScrollHalfPage(dir int) {
+	if dir < 0 {
+		c.Viewport.HalfPageUp()
+	} else {
+		c.Viewport.HalfPageDown()
+	}
+	c.UserScrolled = true
+	if c.Viewport.AtBottom() {
+		c.ScrollToBottom()
+	}
+}
+
+// ScrollToTop jumps to the first message, holding the view there
+func (c *ChatComponent) ScrollToTop() {
+	c.Viewport.GotoTop()
+	c.UserScrolled = !c.Viewport.AtBottom()
+}
+
+// ScrollToBottom jumps to the latest message and resumes auto-scrolling
+func (c *ChatComponent) ScrollToBottom() {
+	c.Viewport.GotoBottom()
+	c.AutoScroll = true
+	c.UserScrolled = false
+	c.newBelow = false
 }
 
 // TruncateTo keeps only the first count messages and refreshes the viewport
@@ -96,9 +163,29 @@ func (c *ChatComponent) TruncateTo(count int) {
 		count = len(c.Messages)
 	}
 	c.Messages = append([]string(nil), c.Messages[:count]...)
+	if count < len(c.timestamps) {
+		c.timestamps = c.timestamps[:count]
+	}
+	for idx := range c.toolResults {
+		if idx >= count {
+			delete(c.toolResults, idx)
+			delete(c.toolDetails, idx)
+			delete(c.toolExpanded, idx)
+		}
+	}
+	if c.focusedTool >= count {
+		c.focusedTool = -1
+	}
 	c.UpdateContent()
 }
 
+// ClearView empties the display, leaving marker as the only message. The
+// conversation itself is not the chat's to change.
+func (c *ChatComponent) ClearView(marker string) {
+	c.TruncateTo(0)
+	c.AddMessage(marker)
+}
+
 // AppendToLastMessage appends text to the last message (for streaming)
 func (c *ChatComponent) AppendToLastMessage(text string) {
 	if len(c.Messages) == 0 {
@@ -109,19 +196,111 @@ func (c *ChatComponent) AppendToLastMessage(text string) {
 	c.UpdateContent()
 }
 
+// SetToolResult stores the full output of the tool call shown at message index idx,
+// with the tool's summary details, and focuses it, so the most recent tool call is
+// the one toggled by default
+func (c *ChatComponent) SetToolResult(idx int, result string, details ...string) {
+	if idx < 0 || idx >= len(c.Messages) || strings.TrimSpace(result) == "" {
+		return
+	}
+	if c.toolResults == nil {
+		c.toolResults = make(map[int]string)
+		c.toolDetails = make(map[int][]string)
+		c.toolExpanded = make(map[int]bool)
+	}
+	c.toolResults[idx] = result
+	c.toolDetails[idx] = details
+	c.focusedTool = idx
+	c.UpdateContent()
+}
+
+// ToggleToolExpansion expands or collapses the focused tool call
+func (c *ChatComponent) ToggleToolExpansion() bool {
+	if _, ok := c.toolResults[c.focusedTool]; !ok {
+		return false
+	}
+	c.toolExpanded[c.focusedTool] = !c.toolExpanded[c.focusedTool]
+	c.UpdateContent()
+	return true
+}
+
+// FocusTool moves the tool call focus to the previous (dir < 0) or next (dir > 0) tool call
+func (c *ChatComponent) FocusTool(dir int) {
+	for idx := c.focusedTool + dir; idx >= 0 && idx < len(c.Messages); idx += dir {
+		if _, ok := c.toolResults[idx]; ok {
+			c.focusedTool = idx
+			c.UpdateContent()
+			return
+		}
+	}
+}
+
+// renderToolResult renders the hidden-output indicator or the expanded output of a tool call
+func (c *ChatComponent) renderToolResult(idx int) string {
+	result, ok := c.toolResults[idx]
+	if !ok {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
+	marker := "▸"
+	if idx == c.focusedTool {
+		marker = "▶"
+	}
+	if !c.toolExpanded[idx] {
+		hint := ""
+		if idx == c.focusedTool {
+			hint = " (ctrl+x to expand)"
+		}
+		return fmt.Sprintf("\n     %s %d lines hidden%s", marker, len(lines), hint)
+	}
+	const indent = "       "
+	lines = append(append([]string(nil), c.toolDetails[idx]...), lines...)
+	for i := range lines {
+		lines[i] = indent + lines[i]
+	}
+	return fmt.Sprintf("\n     %s output (ctrl+x to collapse)\n%s", marker, strings.Join(lines, "\n"))
+}
+
 // UpdateContent updates the viewport content based on the messages
 func (c *ChatComponent) UpdateContent() {
 	var messageViews []string
-	for _, message := range c.Messages {
+	metaStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#373702")) // Terminal7 dark border
+	if c.Plain {
+		c.Viewport.SetContent(c.plainContent(c.Messages))
+		if c.AutoScroll && !c.UserScrolled {
+			c.Viewport.GotoBottom()
+		}
+		return
+	}
+	for i, message := range c.Messages {
 		var messageStyle lipgloss.Style
 
+		// Separate turns with a subtle rule before each user message
+		if i > 0 && strings.HasPrefix(message, "You:") && c.Width > 0 && !c.Compact {
+			messageViews = append(messageViews, metaStyle.Render(strings.Repeat("─", c.Width)))
+		}
+		if c.ShowTimestamps && i < len(c.timestamps) {
+			messageViews = append(messageViews, metaStyle.Render(c.timestamps[i].Format("15:04:05")))
+		}
+
+		if strings.HasPrefix(message, responseDetailsPrefix) {
+			messageViews = append(messageViews, metaStyle.Padding(0, 1).Render(wrapLines(message, c.Width-2)))
+			continue
+		}
+
 		// Check if this is a thinking message
 		if strings.Contains(message, "<thinking>") && strings.Contains(message, "</thinking>") {
 			// Extract thinking content and regular content
 			thinkingContent, regularContent := extractThinkingContent(message)
 
 			// Style thinking content differently
-			if thinkingContent != "" {
+			if thinkingContent != "" && c.HideReasoning {
+				hiddenStyle := lipgloss.NewStyle().
+					Foreground(lipgloss.Color("#004444")). // Terminal7 text-error color
+					Italic(true).
+					Padding(0, 1)
+				messageViews = append(messageViews, hiddenStyle.Render("💭 Reasoning hidden (/reasoning show)"))
+			} else if thinkingContent != "" {
 				thinkingStyle := lipgloss.NewStyle().
 					Foreground(lipgloss.Color("#004444")). // Terminal7 text-error color
 					Italic(true).
@@ -129,7 +308,7 @@ func (c *ChatComponent) UpdateContent() {
 					Border(lipgloss.RoundedBorder()).
 					BorderForeground(lipgloss.Color("#373702")) // Terminal7 dark border
 
-				wrappedThinking := wordwrap.String("💭 Thinking: "+thinkingContent, c.Width-4)
+				wrappedThinking := wrapLines("💭 Thinking: "+thinkingContent, c.Width-4)
 				messageViews = append(messageViews, thinkingStyle.Render(wrappedThinking))
 			}
 
@@ -155,7 +334,7 @@ func (c *ChatComponent) UpdateContent() {
 					wrapWidth = 1
 				}
 
-				wrapped := wordwrap.String(userContent, wrapWidth)
+				wrapped := wrapLines(userContent, wrapWidth)
 				indent := strings.Repeat(" ", indentSpaces)
 				lines := strings.Split(wrapped, "\n")
 				for i := range lines {
@@ -174,14 +353,18 @@ func (c *ChatComponent) UpdateContent() {
 					Foreground(lipgloss.Color("#01FAFA")). // Terminal7 text color
 					Bold(true).
 					Render("Asimi: ")
-				messageViews = append(messageViews, asimiPrefix+"\n"+rendered)
+				if c.Compact {
+					messageViews = append(messageViews, asimiPrefix+rendered)
+				} else {
+					messageViews = append(messageViews, asimiPrefix+"\n"+rendered)
+				}
 			} else {
 				// Other messages (system, tool calls, etc.)
 				messageStyle = lipgloss.NewStyle().
 					Foreground(lipgloss.Color("#01FAFA")). // Terminal7 text color
 					Padding(0, 1)
 				messageViews = append(messageViews,
-					messageStyle.Render(wordwrap.String(message, c.Width)))
+					messageStyle.Render(wrapLines(message+c.renderToolResult(i), c.Width-2)))
 			}
 		}
 	}
@@ -194,20 +377,47 @@ func (c *ChatComponent) UpdateContent() {
 	}
 }
 
+// plainContent renders messages as wrapped text for plain mode
+func (c *ChatComponent) plainContent(messages []string) string {
+	views := make([]string, 0, len(messages))
+	for _, message := range messages {
+		if strings.Contains(message, "<thinking>") && strings.Contains(message, "</thinking>") {
+			thinking, regular := extractThinkingContent(message)
+			message = regular
+			if thinking != "" && !c.HideReasoning {
+				message = "Thinking: " + thinking + "\n" + regular
+			}
+		}
+		views = append(views, wrapLines(message, c.Width))
+	}
+	return strings.Join(views, "\n\n")
+}
+
 // renderMarkdown renders markdown content with glamour
 func (c *ChatComponent) renderMarkdown(content string) string {
 	if c.markdownRenderer == nil {
 		// Fallback to plain text if renderer is not available
-		return content
+		return wrapLines(content, c.Width)
 	}
 
 	rendered, err := c.markdownRenderer.Render(content)
 	if err != nil {
 		// Fallback to plain text on error
-		return content
+		return wrapLines(content, c.Width)
 	}
 
-	return strings.TrimSpace(rendered)
+	// glamour wraps prose but leaves code blocks at their own width, so hard wrap
+	// whatever still overflows the viewport
+	return strings.TrimSpace(wrap.String(rendered, c.Width))
+}
+
+// wrapLines word-wraps s at width and hard-wraps words that are still too long,
+// such as URLs and paths. Both passes keep ANSI styling intact.
+func wrapLines(s string, width int) string {
+	if width < 1 {
+		return s
+	}
+	return wrap.String(wordwrap.String(s, width), width)
 }
 
 // extractThinkingContent separates thinking content from regular content
@@ -259,7 +469,10 @@ func (c ChatComponent) Update(msg tea.Msg) (ChatComponent, tea.Cmd) {
 			c.UserScrolled = true // User manually scrolled
 		case tea.MouseLeft:
 			// Start of touch/drag gesture
-			if msg.Action == tea.MouseActionPress {
+			if msg.Action == tea.MouseActionPress && c.newBelow && msg.Y == c.Height-1 {
+				// Clicked the new messages hint
+				c.ScrollToBottom()
+			} else if msg.Action == tea.MouseActionPress {
 				c.TouchStartY = msg.Y
 				c.TouchDragging = true
 			} else if msg.Action == tea.MouseActionRelease {
@@ -309,19 +522,23 @@ func (c ChatComponent) Update(msg tea.Msg) (ChatComponent, tea.Cmd) {
 			c.Viewport.GotoTop()
 			c.UserScrolled = true
 		case "end":
-			c.Viewport.GotoBottom()
-			// If user scrolls to bottom, re-enable auto-scroll
-			c.UserScrolled = false
-			c.AutoScroll = true
+			c.ScrollToBottom()
 		}
 	}
 	c.Viewport, cmd = c.Viewport.Update(msg)
+	// Scrolling back down to the bottom resumes auto-scrolling
+	if c.UserScrolled && c.Viewport.AtBottom() {
+		c.ScrollToBottom()
+	}
 	return c, cmd
 }
 
 // View renders the chat component
 func (c ChatComponent) View() string {
 	content := lipgloss.JoinVertical(lipgloss.Left, c.Viewport.View())
+	if c.UserScrolled && c.newBelow {
+		content = c.withNewMessagesHint(content)
+	}
 
 	// Adjust height
 	c.Style = c.Style.Height(c.Height)
@@ -329,3 +546,22 @@ func (c ChatComponent) View() string {
 
 	return c.Style.Render(content)
 }
+
+// newMessagesHint replaces the bottom line of the chat while messages arrive
+// out of view
+const newMessagesHint = "↓ new messages (ctrl+n or click to jump)"
+
+// responseDetailsPrefix marks the muted footer /verbose adds under responses
+const responseDetailsPrefix = "⋯ "
+
+// withNewMessagesHint replaces the last line of the rendered viewport with
+// the new messages hint
+func (c ChatComponent) withNewMessagesHint(content string) string {
+	lines := strings.Split(content, "\n")
+	lines[len(lines)-1] = lipgloss.NewStyle().
+		Width(c.Width).
+		Align(lipgloss.Center).
+		Reverse(true).
+		Render(newMessagesHint)
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// sessionCheckpoint is a save point set with /checkpoint. Files holds the
+// content at the checkpoint of every file the agent changed since, copied
+// the first time each is touched.
+type sessionCheckpoint struct {
+	Messages int                    // Message snapshot when it was set
+	Chat     int                    // Chat messages shown when it was set
+	Files    map[string]*string     // Content at the checkpoint, nil for files that didn't exist
+	Modes    map[string]os.FileMode // Permissions at the checkpoint of the files that existed
+	Created  time.Time
+}
+
+// SetCheckpoint replaces the checkpoint with one at the current state.
+// chat is the number of chat messages the TUI shows.
+func (s *Session) SetCheckpoint(chat int) *sessionCheckpoint {
+	s.checkpoint = &sessionCheckpoint{
+		Messages: s.GetMessageSnapshot(),
+		Chat:     chat,
+		Files:    make(map[string]*string),
+		Modes:    make(map[string]os.FileMode),
+		Created:  time.Now(),
+	}
+	return s.checkpoint
+}
+
+// recordFileModes stores the permissions of each path not yet in modes,
+// skipping files that don't exist
+func recordFileModes(modes map[string]os.FileMode, paths []string) {
+	for _, path := range paths {
+		path = projectRelPath(resolveFileRef(path))
+		if _, seen := modes[path]; seen {
+			continue
+		}
+		if info, err := os.Stat(resolveFileRef(path)); err == nil {
+			modes[path] = info.Mode().Perm()
+		}
+	}
+}
+
+// Checkpoint returns the last checkpoint, nil when none was set
+func (s *Session) Checkpoint() *sessionCheckpoint {
+	return s.checkpoint
+}
+
+// RestoreCheckpoint rolls the conversation and the files changed since the
+// checkpoint back to it, deleting files created since. It returns the paths
+// it restored. The checkpoint stays set so it can be restored again.
+func (s *Session) RestoreCheckpoint() ([]string, error) {
+	cp := s.checkpoint
+	if cp == nil {
+		return nil, fmt.Errorf("no checkpoint set")
+	}
+	// Check every path before touching anything
+	targets := make(map[string]string, len(cp.Files))
+	for path := range cp.Files {
+		full, err := checkWritePath(path)
+		if err != nil {
+			return nil, err
+		}
+		targets[path] = full
+	}
+	var restored []string
+	for path, content := range cp.Files {
+		full := targets[path]
+		if content == nil {
+			if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+				return restored, fmt.Errorf("failed to remove %s: %w", path, err)
+			}
+		} else {
+			if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", path, err)
+			}
+			mode, ok := cp.Modes[path]
+			if !ok {
+				mode = 0o644
+			}
+			if err := os.WriteFile(full, []byte(*content), mode); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", path, err)
+			}
+			// WriteFile only sets the mode of files it creates
+			if err := os.Chmod(full, mode); err != nil {
+				return restored, fmt.Errorf("failed to restore %s: %w", path, err)
+			}
+		}
+		restored = append(restored, path)
+	}
+	sort.Strings(restored)
+
+	s.RollbackTo(cp.Messages)
+	s.readCache = nil
+	s.turnFiles = nil
+	// The agent's view of the files is back to the checkpoint's
+	s.fileTimes = nil
+	return restored, nil
+}
@@ -1,7 +1,16 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 )
@@ -11,6 +20,9 @@ type Command struct {
 	Name        string
 	Description string
 	Handler     func(*TUIModel, []string) tea.Cmd
+	// Complete offers values for the last of the arguments typed so far,
+	// which may be partial or empty. Nil when the command has no completions.
+	Complete func(*TUIModel, []string) []string
 }
 
 // CommandRegistry holds all available commands
@@ -27,16 +39,78 @@ func NewCommandRegistry() CommandRegistry {
 
 	// Register built-in commands
 	registry.RegisterCommand("/help", "Show help information", handleHelpCommand)
-	registry.RegisterCommand("/new", "Start a new session", handleNewSessionCommand)
+	registry.RegisterCommand("/new", "Start a new session, optionally with a GitHub issue as context and a first prompt (usage: /new [--issue <n>] [prompt])", handleNewSessionCommand)
 	registry.RegisterCommand("/quit", "Quit the application", handleQuitCommand)
 	registry.RegisterCommand("/login", "Login with OAuth provider selection", handleLoginCommand)
-	registry.RegisterCommand("/models", "Select AI model", handleModelsCommand)
+	registry.RegisterCommand("/model", "Select AI model", handleModelsCommand)
+	registry.RegisterCommand("/models", "List available models with their capabilities", handleListModelsCommand)
 	registry.RegisterCommand("/context", "Show context usage details", handleContextCommand)
+	registry.RegisterCommand("/think-budget", "Show the tokens spent thinking versus answering", handleThinkBudgetCommand)
+	registry.RegisterCommand("/window", "Break down what fills the context window and drop staged files (usage: /window [drop <file>|clear])", handleWindowCommand)
 	registry.RegisterCommand("/vi", "Toggle vi mode (use : for commands)", handleViCommand)
+	registry.RegisterCommand("/mouse", "Capture the mouse for scrolling, or release it to select text with the terminal (usage: /mouse [on|off])", handleMouseCommand)
+	registry.RegisterCommand("/clear-view", "Clear the chat display, keeping the conversation the model sees", handleClearViewCommand)
 	registry.RegisterCommand("/clear-history", "Clear all prompt history", handleClearHistoryCommand)
 	registry.RegisterCommand("/resume", "Resume a previous session", handleResumeCommand)
+	registry.RegisterCommand("/sessions", "List saved sessions, or rebuild their index from disk (usage: /sessions [rebuild])", handleSessionsCommand)
+	registry.RegisterCommand("/image", "Attach an image to the next prompt (usage: /image <path>)", handleImageCommand)
+	registry.RegisterCommand("/replay", "Re-run a tool call from this turn without asking the model (usage: /replay <n>)", handleReplayCommand)
+	registry.RegisterCommand("/rerun", "Re-run the last shell command the agent ran", handleRerunCommand)
+	registry.RegisterCommand("/continue", "Ask the model to continue an interrupted response", handleContinueCommand)
+	registry.RegisterCommand("/rollback", "Remove the last n exchanges from the conversation (usage: /rollback [n])", handleRollbackCommand)
+	registry.RegisterCommand("/checkpoint", "Set a save point for the conversation and the files the agent changes", handleCheckpointCommand)
+	registry.RegisterCommand("/restore", "Roll the conversation and the files back to the last /checkpoint", handleRestoreCommand)
+	registry.RegisterCommand("/diffstat", "Show the files changed by the last turn", handleDiffstatCommand)
+	registry.RegisterCommand("/queue", "List prompts queued while streaming (usage: /queue [clear])", handleQueueCommand)
+	registry.RegisterCommand("/permissions", "Show or change tool permissions (usage: /permissions [mode ask|allow|deny] [allow|ask|deny <pattern>])", handlePermissionsCommand)
+	registry.RegisterCommand("/explain", "Ask for an overview of the repository's layout, entry points and build steps", handleExplainCommand)
+	registry.RegisterCommand("/model-compare", "Run a prompt on the current model and another one side by side (usage: /model-compare <model> [prompt])", handleModelCompareCommand)
+	registry.RegisterCommand("/last", "Reprint the last answer, or only its code blocks (usage: /last [code])", handleLastCommand)
+	registry.RegisterCommand("/whoami", "Show the provider, model and credentials in use", handleWhoamiCommand)
+	registry.RegisterCommand("/note", "Add a line to the project notes, or show them (usage: /note [text])", handleNoteCommand)
+	registry.RegisterCommand("/summary", "Summarize the session and append it to AGENTS.md", handleSummaryCommand)
+	registry.RegisterCommand("/agents", "Analyze the codebase and regenerate AGENTS.md, showing the diff before writing (usage: /agents generate)", handleAgentsCommand)
+	registry.RegisterCommand("/reload-config", "Reload conf.toml and apply what changed", handleReloadConfigCommand)
+	registry.RegisterCommand("/profile", "List config profiles or switch to one (usage: /profile [name])", handleProfileCommand)
+	registry.RegisterCommand("/compact-tool-output", "Shorten tool outputs older than the last N prompts (usage: /compact-tool-output [n|off])", handleCompactToolOutputCommand)
+	registry.RegisterCommand("/set", "Show or change the sampling settings (usage: /set [temperature|top_p <value|default>] [stop <seq>...|default])", handleSetCommand)
+	registry.RegisterCommand("/readonly", "Withhold tools that modify files or run commands (usage: /readonly [on|off])", handleReadOnlyCommand)
+	registry.RegisterCommand("/stream", "Show responses as they stream in, or wait for each full response (usage: /stream [on|off])", handleStreamCommand)
+	registry.RegisterCommand("/compact-ui", "Switch to a dense layout without the prompt border and spacing (usage: /compact-ui [on|off])", handleCompactUICommand)
+	registry.RegisterCommand("/diff-apply", "Review each file write as a diff and apply, edit or reject it (usage: /diff-apply [on|off])", handleDiffApplyCommand)
+	registry.RegisterCommand("/verbose", "Show the stop reason, token usage and tool calls under each response (usage: /verbose [on|off])", handleVerboseCommand)
+	registry.RegisterCommand("/reasoning", "Show or hide the model's thinking (usage: /reasoning [show|hide])", handleReasoningCommand)
+	registry.RegisterCommand("/patch", "Save the uncommitted changes, new files included, as a patch file (usage: /patch [file])", handlePatchCommand)
+	registry.RegisterCommand("/errors", "Show the latest errors with their details (usage: /errors [n])", handleErrorsCommand)
+	registry.RegisterCommand("/tools", "List the tools, what they do and whether the model can call them", handleToolsCommand)
+	registry.RegisterCommand("/ignore", "Show the active ignore patterns, or which rule ignores a path (usage: /ignore list|test <path>)", handleIgnoreCommand)
+	registry.RegisterCommand("/open", "Open a file in $EDITOR, by default the one the agent last read or wrote (alt+e) (usage: /open [@file])", handleOpenCommand)
+	registry.RegisterCommand("/diff", "Show the uncommitted changes (usage: /diff [path...])", handleDiffCommand)
+	registry.RegisterCommand("/shell", "Run a shell command and show its output (usage: /shell <command>)", handleShellCommand)
+	registry.RegisterCommand("/context-cmd", "Run a shell command and add its output to the context of the next prompt (usage: /context-cmd <command>)", handleContextCmdCommand)
+	registry.RegisterCommand("/jobs", "List the processes shell commands left running in the background", handleJobsCommand)
+	registry.RegisterCommand("/kill", "Stop a background process listed by /jobs (usage: /kill <n>)", handleKillCommand)
+	registry.RegisterCommand("/dump", "Write the exact messages and tools sent to the model to a JSON file, secrets redacted (usage: /dump [file])", handleDumpCommand)
 	registry.RegisterCommand("/export", "Export conversation to file and open in $EDITOR (usage: /export [full|conversation])", handleExportCommand)
 
+	// Argument completions
+	for _, name := range []string{"/readonly", "/stream", "/compact-ui", "/diff-apply", "/verbose", "/mouse"} {
+		registry.SetCompleter(name, completeWords("on", "off"))
+	}
+	registry.SetCompleter("/reasoning", completeWords("show", "hide"))
+	registry.SetCompleter("/export", completeWords("full", "conversation"))
+	registry.SetCompleter("/sessions", completeWords("rebuild"))
+	registry.SetCompleter("/queue", completeWords("clear"))
+	registry.SetCompleter("/last", completeWords("code"))
+	registry.SetCompleter("/agents", completeWords("generate"))
+	registry.SetCompleter("/ignore", completeWords("list", "test"))
+	registry.SetCompleter("/set", completeWords("temperature", "top_p", "stop"))
+	registry.SetCompleter("/compact-tool-output", completeWords("off"))
+	registry.SetCompleter("/permissions", completePermissions)
+	registry.SetCompleter("/profile", completeProfiles)
+	registry.SetCompleter("/window", completeWindow)
+	registry.SetCompleter("/model-compare", completeModels)
+
 	return registry
 }
 
@@ -52,6 +126,62 @@ func (cr *CommandRegistry) RegisterCommand(name, description string, handler fun
 	}
 }
 
+// SetCompleter sets how a registered command's arguments are completed
+func (cr *CommandRegistry) SetCompleter(name string, complete func(*TUIModel, []string) []string) {
+	if cmd, exists := cr.Commands[name]; exists {
+		cmd.Complete = complete
+		cr.Commands[name] = cmd
+	}
+}
+
+// completeWords completes a command's only argument from a fixed list
+func completeWords(words ...string) func(*TUIModel, []string) []string {
+	return func(model *TUIModel, args []string) []string {
+		if len(args) != 1 {
+			return nil
+		}
+		return words
+	}
+}
+
+// completeProfiles completes the names of the configured profiles
+func completeProfiles(model *TUIModel, args []string) []string {
+	if len(args) != 1 || model.config == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(model.config.Profiles))
+}
+
+// completeWindow completes /window's subcommands and the files it can drop
+func completeWindow(model *TUIModel, args []string) []string {
+	switch {
+	case len(args) == 1:
+		return []string{"drop", "clear"}
+	case len(args) == 2 && args[0] == "drop" && model.session != nil:
+		return slices.Sorted(maps.Keys(model.session.GetContextFiles()))
+	}
+	return nil
+}
+
+// completePermissions completes the /permissions subcommands and the modes
+func completePermissions(model *TUIModel, args []string) []string {
+	switch {
+	case len(args) == 1:
+		return []string{"mode", "allow", "ask", "deny"}
+	case len(args) == 2 && args[0] == "mode":
+		return permissionModes
+	}
+	return nil
+}
+
+// completeModels completes the model names known without asking the provider
+func completeModels(model *TUIModel, args []string) []string {
+	if len(args) != 1 || model.config == nil {
+		return nil
+	}
+	return knownModels(model.config)
+}
+
 // GetCommand gets a command by name
 func (cr CommandRegistry) GetCommand(name string) (Command, bool) {
 	cmd, exists := cr.Commands[name]
@@ -79,17 +209,37 @@ type showContextMsg struct{ content string }
 func handleHelpCommand(model *TUIModel, args []string) tea.Cmd {
 	return func() tea.Msg {
 		leader := "/"
-		if model != nil && model.prompt.ViMode {
-			leader = ":"
+		if model != nil {
+			leader = model.commandLeader()
+			if model.prompt.ViMode {
+				leader = ":"
+			}
 		}
 		return showHelpMsg{leader: leader}
 	}
 }
 
 func handleNewSessionCommand(model *TUIModel, args []string) tea.Cmd {
-	model.saveSession()
+	var issue int
+	if len(args) > 0 && args[0] == "--issue" {
+		if len(args) < 2 {
+			model.toastManager.AddToast("Usage: /new --issue <n> [prompt]", "error", 3000)
+			return nil
+		}
+		var err error
+		if issue, err = parseIssueNumber(args[1]); err != nil {
+			model.toastManager.AddToast(err.Error(), "error", 3000)
+			return nil
+		}
+		args = args[2:]
+	}
+	prompt := strings.Join(args, " ")
+
+	// Save before clearing: a queued save holds the same *Session and would
+	// otherwise record the cleared state
+	model.saveSessionSync()
 	model.sessionActive = true
-	model.chat = NewChatComponent(model.chat.Width, model.chat.Height)
+	model.chat = model.newChat()
 
 	model.rawSessionHistory = make([]string, 0)
 
@@ -104,6 +254,17 @@ func handleNewSessionCommand(model *TUIModel, args []string) tea.Cmd {
 	if model.session != nil {
 		model.session.ClearHistory()
 	}
+
+	switch {
+	case issue > 0:
+		model.toastManager.AddToast(fmt.Sprintf("Fetching issue #%d...", issue), "info", 3000)
+		return func() tea.Msg {
+			fetched, err := fetchGitHubIssue(context.Background(), issue)
+			return issueLoadedMsg{number: issue, issue: fetched, content: formatIssue(fetched), prompt: prompt, err: err}
+		}
+	case prompt != "":
+		return func() tea.Msg { return submitPromptMsg{prompt: prompt} }
+	}
 	return nil
 }
 
@@ -120,44 +281,1184 @@ func handleContextCommand(model *TUIModel, args []string) tea.Cmd {
 			return showContextMsg{content: "No active session. Use /login to configure a provider and start chatting."}
 		}
 		info := model.session.GetContextInfo()
-		return showContextMsg{content: renderContextInfo(info)}
+		content := renderContextInfo(info)
+		if usage := model.session.ThinkingUsage(); usage.Responses > 0 {
+			content += "\n" + formatThinkingUsage(usage, model.session.thinkingWarnShare())
+		}
+		return showContextMsg{content: content}
 	}
 }
 
-func handleViCommand(model *TUIModel, args []string) tea.Cmd {
-	// Toggle vi mode
-	model.prompt.SetViMode(!model.prompt.ViMode)
+func handleThinkBudgetCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	usage, warnShare := model.session.ThinkingUsage(), model.session.thinkingWarnShare()
+	return func() tea.Msg { return showContextMsg{content: formatThinkingUsage(usage, warnShare)} }
+}
 
-	var message string
-	if model.prompt.ViMode {
-		message = "Vi mode enabled. Press 'i' to insert, 'Esc' to return to normal mode. Use : for commands."
-	} else {
-		message = "Vi mode disabled. Use / for commands."
+func handleWindowCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		return func() tea.Msg {
+			return showContextMsg{content: "No active session. Use /login to configure a provider and start chatting."}
+		}
+	}
+	if len(args) > 0 {
+		switch {
+		case args[0] == "clear" && len(args) == 1:
+			model.session.ClearContext()
+			model.toastManager.AddToast("Dropped the staged context files", "info", 3000)
+			return nil
+		case args[0] == "drop" && len(args) == 2:
+			if !model.session.RemoveContextFile(args[1]) {
+				model.toastManager.AddToast(fmt.Sprintf("%s is not in the context", args[1]), "error", 3000)
+				return nil
+			}
+			model.toastManager.AddToast(fmt.Sprintf("Dropped %s from the context", args[1]), "info", 3000)
+			return nil
+		default:
+			model.toastManager.AddToast("Usage: /window [drop <file>|clear]", "error", 3000)
+			return nil
+		}
+	}
+	session, leader := model.session, model.commandLeader()
+	return func() tea.Msg {
+		info := session.GetContextInfo()
+		return showContextMsg{content: renderContextWindow(info.Model, info.TotalTokens, session.ContextWindow(), leader)}
+	}
+}
+
+func handleImageCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		model.toastManager.AddToast("Usage: /image <path>", "error", 3000)
+		return nil
+	}
+	if model.session == nil {
+		model.toastManager.AddToast("No LLM configured. Please use /login to configure an API key.", "error", 3000)
+		return nil
+	}
+	path := strings.Join(args, " ")
+	if err := model.session.AttachImage(path); err != nil {
+		model.toastManager.AddToast(err.Error(), "error", 4000)
+		return nil
 	}
+	model.chat.AddMessage(fmt.Sprintf("Attached image: %s", path))
+	return nil
+}
 
-	model.toastManager.AddToast(message, "info", 4000)
+func handleReplayCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil || model.session.scheduler == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	if len(model.turnToolCalls) == 0 {
+		model.toastManager.AddToast("No tool calls in this turn to replay", "info", 3000)
+		return nil
+	}
+	n := 0
+	if len(args) == 1 {
+		n, _ = strconv.Atoi(args[0])
+	}
+	if n < 1 || n > len(model.turnToolCalls) {
+		model.toastManager.AddToast(fmt.Sprintf("Usage: /replay <n> with n between 1 and %d", len(model.turnToolCalls)), "error", 3000)
+		return nil
+	}
+
+	// The run reaches the chat through the scheduler notifications; the
+	// model never sees it. Calls the session refuses only show the reason.
+	call := model.turnToolCalls[n-1]
+	name := call.Tool.Name()
+	if _, ok := model.session.toolCatalog[name]; !ok {
+		model.toastManager.AddToast(fmt.Sprintf("%s is not available in this session", name), "error", 3000)
+		return nil
+	}
+	session := model.session
+	return func() tea.Msg {
+		response := session.ReplayToolCall(context.Background(), fmt.Sprintf("replay-%d", n), name, call.Input)
+		return showContextMsg{content: fmt.Sprintf("Replayed #%d %s:\n%s", n, name, truncateSnippet(response, 500))}
+	}
+}
+
+func handleRerunCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil || model.session.scheduler == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	tc, ok := model.session.LastToolCall("run_in_shell")
+	if !ok {
+		model.toastManager.AddToast("No shell command to re-run in this session", "info", 3000)
+		return nil
+	}
+	tool, ok := model.session.toolCatalog["run_in_shell"]
+	if !ok {
+		model.toastManager.AddToast("Shell commands are disabled in read-only mode", "error", 3000)
+		return nil
+	}
+
+	var input RunInShellInput
+	json.Unmarshal([]byte(tc.FunctionCall.Arguments), &input)
+	model.sessionActive = true
+	model.chat.AddMessage(fmt.Sprintf("Re-running: %s", input.Command))
+	model.session.scheduler.Schedule(tool, tc.FunctionCall.Arguments)
 	return nil
 }
 
-func handleClearHistoryCommand(model *TUIModel, args []string) tea.Cmd {
-	// Clear persistent history
-	if model.historyStore != nil {
-		if err := model.historyStore.Clear(); err != nil {
-			model.toastManager.AddToast("Failed to clear history", "error", 3000)
+func handleDiffstatCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	stats := model.session.TurnDiffstat()
+	if len(stats) == 0 {
+		model.toastManager.AddToast("The last turn changed no files", "info", 3000)
+		return nil
+	}
+	content := formatDiffstat(stats)
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+func handleModelCompareCommand(model *TUIModel, args []string) tea.Cmd {
+	usage := fmt.Sprintf("Usage: %s <model> [prompt]", withLeader("/model-compare", model.commandLeader()))
+	if len(args) == 0 {
+		model.toastManager.AddToast(usage, "error", 3000)
+		return nil
+	}
+	prompt := strings.Join(args[1:], " ")
+	if prompt == "" {
+		if len(model.promptHistory) == 0 {
+			model.toastManager.AddToast("No prompt to compare. "+usage, "error", 3000)
 			return nil
 		}
+		prompt = model.promptHistory[len(model.promptHistory)-1].Prompt
+	}
+	current := model.config.LLM.Model
+	if model.session != nil {
+		current = model.session.Model
+	}
+	if current == "" {
+		current = defaultModelFor(model.config.LLM.Provider)
 	}
 
-	// Clear in-memory history
-	model.promptHistory = make([]promptHistoryEntry, 0)
-	model.historyCursor = 0
-	model.historySaved = false
-	model.historyPendingPrompt = ""
+	cfg := *model.config
+	models := []string{current, args[0]}
+	return tea.Batch(model.startWaitingForResponse(), func() tea.Msg {
+		results := runModelCompare(context.Background(), cfg, models, prompt, getLLMClient)
+		return modelCompareMsg{prompt: prompt, results: results}
+	})
+}
 
-	model.toastManager.AddToast("Prompt history cleared", "success", 3000)
+func handleLastCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	var last string
+	for i := len(model.chat.Messages) - 1; i >= 0; i-- {
+		if answer, ok := strings.CutPrefix(model.chat.Messages[i], "Asimi:"); ok {
+			last = strings.TrimSpace(answer)
+			break
+		}
+	}
+	if last == "" {
+		model.toastManager.AddToast("No answer to show yet", "info", 3000)
+		return nil
+	}
+	if len(args) > 0 && args[0] == "code" {
+		blocks := extractCodeBlocks(last)
+		if len(blocks) == 0 {
+			model.toastManager.AddToast("The last answer has no code blocks", "info", 3000)
+			return nil
+		}
+		last = strings.Join(blocks, "\n\n")
+	}
+	model.chat.AddMessage("Asimi: " + last)
+	model.chat.ScrollToBottom()
 	return nil
 }
 
+// extractCodeBlocks returns the fenced code blocks of a markdown text,
+// fences included
+func extractCodeBlocks(text string) []string {
+	var blocks []string
+	var block []string
+	fence := ""
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			block = []string{line}
+		case fence != "" && trimmed == fence:
+			blocks = append(blocks, strings.Join(append(block, line), "\n"))
+			fence = ""
+		case fence != "":
+			block = append(block, line)
+		}
+	}
+	return blocks
+}
+
+func handleWhoamiCommand(model *TUIModel, args []string) tea.Cmd {
+	var token *TokenData
+	if method := authMethod(model.config); method == "oauth_keyring" || method == "oauth" {
+		token, _ = GetTokenFromKeyring(model.config.LLM.Provider)
+	}
+	content := formatWhoami(model.config, model.session, token, model.commandLeader(), time.Now())
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+// authMethod returns how the configured provider authenticates, falling back
+// to what the loaded credentials imply when /login didn't record it
+func authMethod(config *Config) string {
+	switch {
+	case config.LLM.AuthMethod != "":
+		return config.LLM.AuthMethod
+	case config.LLM.AuthToken != "":
+		return "oauth"
+	case config.LLM.APIKeyHelper != "":
+		return "api_key_helper"
+	case config.LLM.APIKey != "":
+		return "apikey"
+	}
+	return ""
+}
+
+// authMethodLabels describes the auth_method values /login writes
+var authMethodLabels = map[string]string{
+	"oauth_keyring":  "OAuth, token in the OS keyring",
+	"oauth_file":     "OAuth, token in the config file",
+	"apikey_keyring": "API key in the OS keyring",
+	"apikey_file":    "API key in the config file",
+	"oauth":          "OAuth token",
+	"apikey":         "API key",
+	"api_key_helper": "API key from api_key_helper",
+}
+
+// formatWhoami describes the account and connection used for requests
+func formatWhoami(config *Config, session *Session, token *TokenData, leader string, now time.Time) string {
+	provider, modelName := config.LLM.Provider, config.LLM.Model
+	if session != nil {
+		provider, modelName = session.Provider, session.Model
+	}
+	if provider == "" {
+		provider = "(none)"
+	}
+	if modelName == "" {
+		modelName = "(default)"
+	}
+
+	method := authMethod(config)
+	auth := authMethodLabels[method]
+	switch {
+	case method == "":
+		auth = "not logged in"
+	case auth == "":
+		auth = method
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Provider:  %s\n", provider)
+	fmt.Fprintf(&b, "Model:     %s\n", modelName)
+	fmt.Fprintf(&b, "Auth:      %s\n", auth)
+	if token != nil && !token.Expiry.IsZero() {
+		left := token.Expiry.Sub(now).Round(time.Minute)
+		if left > 0 {
+			fmt.Fprintf(&b, "Token:     expires in %s (%s)\n", left, token.Expiry.Local().Format("Jan 2 15:04"))
+		} else {
+			fmt.Fprintf(&b, "Token:     expired %s ago\n", -left)
+		}
+	}
+	if session != nil {
+		b.WriteString("Session:   connected")
+	} else {
+		fmt.Fprintf(&b, "Session:   not connected, use %s to log in", withLeader("/login", leader))
+	}
+	return b.String()
+}
+
+func handleQueueCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) > 0 && args[0] == "clear" {
+		model.promptQueue = nil
+		model.status.SetQueued(0)
+		model.toastManager.AddToast("Prompt queue cleared", "info", 2000)
+		return nil
+	}
+	if len(model.promptQueue) == 0 {
+		model.toastManager.AddToast("No queued prompts", "info", 2000)
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("📬 Queued prompts:\n\n")
+	for i, prompt := range model.promptQueue {
+		b.WriteString(fmt.Sprintf("%d. %s\n", i+1, prompt))
+	}
+	content := b.String()
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+// permissionModes are the accepted values for permission.default_mode
+var permissionModes = []string{"ask", "allow", "deny"}
+
+// formatPermissions renders the permission mode and lists for /permissions
+func formatPermissions(perm PermissionConfig) string {
+	mode := perm.DefaultMode
+	if mode == "" {
+		mode = "ask (default)"
+	}
+	list := func(patterns []string) string {
+		if len(patterns) == 0 {
+			return "(none)"
+		}
+		return strings.Join(patterns, ", ")
+	}
+
+	var b strings.Builder
+	b.WriteString("🔐 Permissions\n\n")
+	b.WriteString(fmt.Sprintf("Mode:  %s\n", mode))
+	b.WriteString(fmt.Sprintf("Allow: %s\n", list(perm.Allow)))
+	b.WriteString(fmt.Sprintf("Ask:   %s\n", list(perm.Ask)))
+	b.WriteString(fmt.Sprintf("Deny:  %s\n", list(perm.Deny)))
+	return b.String()
+}
+
+// addPermissionPattern adds pattern to the named list, removing it from the other two
+func addPermissionPattern(perm *PermissionConfig, listName, pattern string) {
+	without := func(patterns []string) []string {
+		var kept []string
+		for _, p := range patterns {
+			if p != pattern {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	}
+	perm.Allow, perm.Ask, perm.Deny = without(perm.Allow), without(perm.Ask), without(perm.Deny)
+	switch listName {
+	case "allow":
+		perm.Allow = append(perm.Allow, pattern)
+	case "ask":
+		perm.Ask = append(perm.Ask, pattern)
+	case "deny":
+		perm.Deny = append(perm.Deny, pattern)
+	}
+}
+
+func handlePermissionsCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	perm := &model.config.Permission
+	if len(args) == 0 {
+		content := formatPermissions(*perm)
+		return func() tea.Msg { return showContextMsg{content: content} }
+	}
+
+	usage := "Usage: /permissions [mode ask|allow|deny] [allow|ask|deny <pattern>]"
+	if len(args) != 2 {
+		model.toastManager.AddToast(usage, "error", 4000)
+		return nil
+	}
+	switch args[0] {
+	case "mode":
+		if !slices.Contains(permissionModes, args[1]) {
+			model.toastManager.AddToast(usage, "error", 4000)
+			return nil
+		}
+		perm.DefaultMode = args[1]
+	case "allow", "ask", "deny":
+		addPermissionPattern(perm, args[0], args[1])
+	default:
+		model.toastManager.AddToast(usage, "error", 4000)
+		return nil
+	}
+
+	if err := SavePermissions(*perm); err != nil {
+		model.toastManager.AddToast(fmt.Sprintf("Failed to save permissions: %v", err), "error", 4000)
+		return nil
+	}
+	content := formatPermissions(*perm)
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+// summaryReadyMsg carries the session summary produced for /summary
+type summaryReadyMsg struct {
+	note string
+	err  error
+}
+
+func handleSummaryCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session to summarize", "error", 3000)
+		return nil
+	}
+	session := model.session
+	return tea.Batch(model.startWaitingForResponse(), func() tea.Msg {
+		note, err := session.Summarize(context.Background())
+		return summaryReadyMsg{note: note, err: err}
+	})
+}
+
+func handleAgentsCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) != 1 || args[0] != "generate" {
+		model.toastManager.AddToast(fmt.Sprintf("Usage: %s generate", withLeader("/agents", model.commandLeader())), "error", 3000)
+		return nil
+	}
+	if model.session == nil {
+		model.toastManager.AddToast("No LLM configured. Please use /login to configure an API key.", "error", 3000)
+		return nil
+	}
+	cfg := *model.config
+	cfg.LLM.Model = model.session.Model
+	return tea.Batch(model.startWaitingForResponse(), func() tea.Msg {
+		content, err := generateAgentsFile(context.Background(), cfg, getLLMClient)
+		return agentsGeneratedMsg{content: content, err: err}
+	})
+}
+
+// submitPromptMsg sends a prompt as if the user typed it
+type submitPromptMsg struct{ prompt string }
+
+func handleExplainCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No LLM configured. Please use /login to configure an API key.", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	for path, content := range gatherRepoOverview(".", explainContextLimit) {
+		model.session.AttachContext(path, content)
+	}
+	return func() tea.Msg { return submitPromptMsg{prompt: explainPrompt} }
+}
+
+func handleContinueCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	if !model.session.CanContinue() {
+		model.toastManager.AddToast("No interrupted response to continue", "info", 3000)
+		return nil
+	}
+	return func() tea.Msg { return submitPromptMsg{prompt: continuePrompt} }
+}
+
+func handleRollbackCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			model.toastManager.AddToast("Usage: /rollback [n]", "error", 3000)
+			return nil
+		}
+	}
+	// Each prompt sent in this session recorded where the session and the
+	// chat stood before it; loaded history entries have no snapshots
+	var turns []promptHistoryEntry
+	for _, entry := range model.promptHistory {
+		if entry.SessionSnapshot > 0 {
+			turns = append(turns, entry)
+		}
+	}
+	if len(turns) == 0 {
+		model.toastManager.AddToast("Nothing to roll back", "info", 3000)
+		return nil
+	}
+	if n > len(turns) {
+		n = len(turns)
+	}
+	snapshot := turns[len(turns)-n].SessionSnapshot
+	chatSnapshot := turns[len(turns)-n].ChatSnapshot
+	var removed []string
+	for _, entry := range turns[len(turns)-n:] {
+		removed = append(removed, truncateSnippet(strings.TrimSpace(entry.Prompt), 60))
+	}
+
+	model.session.RollbackTo(snapshot)
+	model.chat.TruncateTo(chatSnapshot)
+	model.toolCallMessageIndex = make(map[string]int)
+	// Prompts of the removed turns can no longer be returned to
+	model.promptHistory = slices.DeleteFunc(model.promptHistory, func(entry promptHistoryEntry) bool {
+		return entry.SessionSnapshot >= snapshot
+	})
+	model.historyCursor = len(model.promptHistory)
+	model.historySaved = false
+
+	summary := fmt.Sprintf("Rolled back %d exchange(s):\n- %s", n, strings.Join(removed, "\n- "))
+	return func() tea.Msg { return showContextMsg{content: summary} }
+}
+
+// viewClearedMarker is left in the chat by /clear-view
+const viewClearedMarker = "— view cleared —"
+
+func handleClearViewCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	model.chat.ClearView(viewClearedMarker)
+	model.toolCallMessageIndex = make(map[string]int)
+	// Chat positions from before the clear are gone; going back to one of
+	// them keeps the marker
+	for i := range model.promptHistory {
+		model.promptHistory[i].ChatSnapshot = min(model.promptHistory[i].ChatSnapshot, 1)
+	}
+	model.historyPresentChatSnapshot = min(model.historyPresentChatSnapshot, 1)
+	if model.session != nil {
+		if cp := model.session.Checkpoint(); cp != nil {
+			cp.Chat = min(cp.Chat, 1)
+		}
+	}
+	model.sessionActive = true
+	return nil
+}
+
+func handleCheckpointCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	model.session.SetCheckpoint(len(model.chat.Messages))
+	return func() tea.Msg {
+		return showContextMsg{content: "Checkpoint set. /restore rolls the conversation and the files the agent changes back to here. Changes made by shell commands aren't tracked."}
+	}
+}
+
+func handleRestoreCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if model.streamingActive || model.streamingCancel != nil {
+		model.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return nil
+	}
+	cp := model.session.Checkpoint()
+	if cp == nil {
+		model.toastManager.AddToast("No checkpoint set, use /checkpoint first", "info", 3000)
+		return nil
+	}
+	restored, err := model.session.RestoreCheckpoint()
+	model.chat.TruncateTo(cp.Chat)
+	model.toolCallMessageIndex = make(map[string]int)
+	model.promptHistory = slices.DeleteFunc(model.promptHistory, func(entry promptHistoryEntry) bool {
+		return entry.SessionSnapshot >= cp.Messages
+	})
+	model.historyCursor = len(model.promptHistory)
+	model.historySaved = false
+	if err != nil {
+		return func() tea.Msg { return errMsg{err: err} }
+	}
+
+	summary := fmt.Sprintf("Restored the checkpoint from %s", cp.Created.Format("15:04:05"))
+	if len(restored) > 0 {
+		summary += ":\n- " + strings.Join(restored, "\n- ")
+	}
+	return func() tea.Msg { return showContextMsg{content: summary} }
+}
+
+func handleJobsCommand(model *TUIModel, args []string) tea.Cmd {
+	content := formatShellJobs(runningShellJobs())
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+func handleKillCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) != 1 {
+		model.toastManager.AddToast("Usage: /kill <n>", "error", 3000)
+		return nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		model.toastManager.AddToast("Usage: /kill <n>", "error", 3000)
+		return nil
+	}
+	job, err := killShellJob(n)
+	if err != nil {
+		model.toastManager.AddToast(err.Error(), "error", 3000)
+		return nil
+	}
+	model.toastManager.AddToast(fmt.Sprintf("Stopped %s", truncateSnippet(job.Command, 40)), "success", 3000)
+	return nil
+}
+
+func handlePatchCommand(model *TUIModel, args []string) tea.Cmd {
+	if !isGitRepository() {
+		model.toastManager.AddToast("Not in a git repository", "error", 3000)
+		return nil
+	}
+	var sessionID string
+	if model.session != nil {
+		sessionID = model.session.ID
+	}
+	path := defaultPatchName(getCurrentGitBranch(), sessionID)
+	if len(args) > 0 {
+		path = args[0]
+	}
+	return func() tea.Msg {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return errMsg{err}
+		}
+		files, err := writeGitPatch(context.Background(), cwd, path)
+		if err != nil {
+			return errMsg{fmt.Errorf("failed to export patch: %w", err)}
+		}
+		abs, _ := filepath.Abs(path)
+		return showContextMsg{content: fmt.Sprintf("Wrote %d changed file(s) to %s\nApply it elsewhere with: git apply %s", files, abs, abs)}
+	}
+}
+
+func handleDumpCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	var path string
+	if len(args) > 0 {
+		path = args[0]
+	}
+	session := model.session
+	return func() tea.Msg {
+		written, err := dumpRequest(session, path)
+		if err != nil {
+			return errMsg{err}
+		}
+		abs, _ := filepath.Abs(written)
+		return showContextMsg{content: fmt.Sprintf("Wrote the messages and tools sent to the model to %s", abs)}
+	}
+}
+
+func handleNoteCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		notes, err := readNotes()
+		if err != nil {
+			model.toastManager.AddToast(fmt.Sprintf("Failed to read notes: %v", err), "error", 3000)
+			return nil
+		}
+		if notes == "" {
+			notes = fmt.Sprintf("No notes yet. Add one with %s <text>", withLeader("/note", model.commandLeader()))
+		}
+		return func() tea.Msg { return showContextMsg{content: notes} }
+	}
+	if err := appendNote("- " + strings.Join(args, " ")); err != nil {
+		model.toastManager.AddToast(fmt.Sprintf("Failed to save note: %v", err), "error", 3000)
+		return nil
+	}
+	model.toastManager.AddToast(fmt.Sprintf("Noted in %s", notesPath), "success", 3000)
+	return nil
+}
+
+func handleProfileCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	if len(args) == 0 {
+		if len(model.config.Profiles) == 0 {
+			return func() tea.Msg {
+				return showContextMsg{content: "No profiles configured. Add [profiles.<name>] sections to conf.toml."}
+			}
+		}
+		names := slices.Sorted(maps.Keys(model.config.Profiles))
+		var b strings.Builder
+		b.WriteString("Profiles:\n")
+		for _, name := range names {
+			marker := " "
+			if name == model.config.Profile {
+				marker = "*"
+			}
+			fmt.Fprintf(&b, "%s %s\n", marker, name)
+		}
+		content := b.String()
+		return func() tea.Msg { return showContextMsg{content: content} }
+	}
+
+	name := args[0]
+	if _, ok := model.config.Profiles[name]; !ok {
+		model.toastManager.AddToast(fmt.Sprintf("Unknown profile: %s", name), "error", 3000)
+		return nil
+	}
+	previous := activeProfile
+	activeProfile = name
+	config, err := LoadConfig()
+	if err != nil {
+		activeProfile = previous
+		model.toastManager.AddToast(fmt.Sprintf("Failed to load profile %s: %v", name, err), "error", 4000)
+		return nil
+	}
+	config.LLM.ReadOnly = config.LLM.ReadOnly || model.config.LLM.ReadOnly
+
+	old := *model.config
+	*model.config = *config
+	if err := model.reinitializeSession(); err != nil {
+		activeProfile = previous
+		*model.config = old
+		model.toastManager.AddToast(fmt.Sprintf("Failed to switch to profile %s: %v", name, err), "error", 4000)
+		return nil
+	}
+	model.toastManager.AddToast(fmt.Sprintf("Switched to profile %s (%s)", name, shortenProviderModel(config.LLM.Provider, config.LLM.Model)), "success", 3000)
+	return nil
+}
+
+func handleReloadConfigCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		model.toastManager.AddToast(fmt.Sprintf("Failed to reload config: %v", err), "error", 4000)
+		return nil
+	}
+	// The screen mode is fixed at startup
+	config.UI.Plain = model.config.UI.Plain
+	// Read-only mode belongs to the running session, set by --read-only or /readonly
+	config.LLM.ReadOnly = model.config.LLM.ReadOnly
+
+	changed := configChanges(model.config, config)
+	if len(changed) == 0 {
+		model.toastManager.AddToast("Config reloaded, nothing changed", "info", 3000)
+		return nil
+	}
+
+	old := *model.config
+	*model.config = *config
+	if slices.ContainsFunc(changed, func(key string) bool { return llmClientKeys[key] }) {
+		previous := model.session
+		if err := model.reinitializeSession(); err != nil {
+			*model.config = old
+			model.toastManager.AddToast(fmt.Sprintf("Failed to apply config: %v", err), "error", 4000)
+			return nil
+		}
+		// Carry the conversation over to the new client
+		if previous != nil {
+			model.session.RestoreFrom(previous)
+		}
+		model.status.SetProvider(config.LLM.Provider, config.LLM.Model, true)
+	}
+	model.applyConfig()
+
+	model.toastManager.AddToast(fmt.Sprintf("Config reloaded: %s", strings.Join(changed, ", ")), "success", 4000)
+	return nil
+}
+
+func handleCompactToolOutputCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	if len(args) == 0 {
+		keep := model.session.CompactToolOutput()
+		if keep <= 0 {
+			return func() tea.Msg { return showContextMsg{content: "Tool outputs are kept in full"} }
+		}
+		return func() tea.Msg {
+			return showContextMsg{content: fmt.Sprintf("Tool outputs older than the last %d prompts are shortened", keep)}
+		}
+	}
+
+	keep, err := strconv.Atoi(args[0])
+	if args[0] == "off" {
+		keep, err = 0, nil
+	}
+	if err != nil || keep < 0 {
+		model.toastManager.AddToast("Usage: /compact-tool-output [n|off]", "error", 3000)
+		return nil
+	}
+	model.session.SetCompactToolOutput(keep)
+	if keep == 0 {
+		model.toastManager.AddToast("Tool outputs are kept in full", "info", 2000)
+	} else {
+		model.toastManager.AddToast(fmt.Sprintf("Shortening tool outputs older than the last %d prompts", keep), "info", 3000)
+	}
+	return nil
+}
+
+func handleReadOnlyCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	on := !model.session.IsReadOnly()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			model.toastManager.AddToast("Usage: /readonly [on|off]", "error", 3000)
+			return nil
+		}
+	}
+	model.session.SetReadOnly(on)
+	if model.config != nil {
+		model.config.LLM.ReadOnly = on
+	}
+	if on {
+		model.toastManager.AddToast("Read-only mode on: writes and shell commands are disabled", "info", 3000)
+	} else {
+		model.toastManager.AddToast("Read-only mode off", "info", 2000)
+	}
+	return nil
+}
+
+func handleIgnoreCommand(model *TUIModel, args []string) tea.Cmd {
+	usage := fmt.Sprintf("Usage: %s list|test <path>", withLeader("/ignore", model.commandLeader()))
+	if len(args) == 0 || args[0] != "list" && args[0] != "test" || args[0] == "test" && len(args) < 2 {
+		model.toastManager.AddToast(usage, "error", 3000)
+		return nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return func() tea.Msg { return errMsg{err} }
+	}
+	root := findProjectRoot(wd)
+	rules := projectIgnoreRules(root)
+	if args[0] == "list" {
+		return func() tea.Msg { return showContextMsg{content: formatIgnoreRules(rules)} }
+	}
+
+	path := resolveFileRef(strings.TrimPrefix(strings.Join(args[1:], " "), "@"))
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		model.toastManager.AddToast(fmt.Sprintf("%s is outside the project", path), "error", 3000)
+		return nil
+	}
+	info, err := os.Stat(path)
+	isDir := err == nil && info.IsDir()
+	return func() tea.Msg { return showContextMsg{content: explainIgnore(rules, filepath.ToSlash(rel), isDir)} }
+}
+
+func handleErrorsCommand(model *TUIModel, args []string) tea.Cmd {
+	n := defaultErrorsShown
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+			model.toastManager.AddToast(fmt.Sprintf("Usage: %s [n]", withLeader("/errors", model.commandLeader())), "error", 3000)
+			return nil
+		}
+	}
+	content := formatErrors(model.errorLog.Recent(n))
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+func handleToolsCommand(model *TUIModel, args []string) tea.Cmd {
+	var content string
+	switch {
+	case model.session != nil:
+		content = formatToolList(model.session.IsReadOnly(), model.session.toolOverrides)
+	case model.config != nil:
+		content = formatToolList(model.config.LLM.ReadOnly, model.config.Tools)
+	default:
+		content = formatToolList(false, nil)
+	}
+	return func() tea.Msg { return showContextMsg{content: content} }
+}
+
+func handleOpenCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		return model.openLastFile()
+	}
+	path := strings.TrimPrefix(strings.Join(args, " "), "@")
+	if info, err := os.Stat(resolveFileRef(path)); err != nil || info.IsDir() {
+		model.toastManager.AddToast(fmt.Sprintf("No such file: %s", path), "error", 3000)
+		return nil
+	}
+	return model.openFileInEditor(path)
+}
+
+func handleSetCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	cfg := &model.config.LLM
+	if len(args) == 0 {
+		return func() tea.Msg { return showContextMsg{content: "Sampling settings:\n" + formatSampling(cfg)} }
+	}
+	usage := fmt.Sprintf("Usage: %s temperature|top_p <value|default>, or %[1]s stop <seq>...|default", withLeader("/set", model.commandLeader()))
+	if len(args) < 2 {
+		model.toastManager.AddToast(usage, "error", 3000)
+		return nil
+	}
+	provider := cfg.Provider
+	if model.session != nil {
+		provider = model.session.Provider
+	}
+
+	name, value := args[0], args[1]
+	switch name {
+	case "temperature", "top_p":
+		var setting *float64
+		if value != "default" {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil || !isFinite(v) {
+				model.toastManager.AddToast(fmt.Sprintf("Invalid %s: %s", name, value), "error", 3000)
+				return nil
+			}
+			if name == "temperature" {
+				v = clampTemperature(provider, v)
+			} else {
+				v = clampTopP(v)
+			}
+			setting = &v
+		}
+		if name == "temperature" {
+			cfg.Temperature = setting
+		} else {
+			cfg.TopP = setting
+		}
+	case "stop":
+		cfg.Stop = nil
+		if !(len(args) == 2 && value == "default") {
+			for _, arg := range args[1:] {
+				cfg.Stop = append(cfg.Stop, parseStopSequence(arg))
+			}
+		}
+	default:
+		model.toastManager.AddToast(usage, "error", 3000)
+		return nil
+	}
+	return func() tea.Msg { return showContextMsg{content: "Sampling settings:\n" + formatSampling(cfg)} }
+}
+
+func handleDiffApplyCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	on := !model.config.LLM.ReviewWrites
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			model.toastManager.AddToast("Usage: /diff-apply [on|off]", "error", 3000)
+			return nil
+		}
+	}
+	model.config.LLM.ReviewWrites = on
+	if on {
+		model.toastManager.AddToast("Write review on: each file write waits for (y)es, (e)dit or (n)o", "info", 3000)
+	} else {
+		model.toastManager.AddToast("Write review off", "info", 2000)
+	}
+	return nil
+}
+
+func handleStreamCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config == nil {
+		model.toastManager.AddToast("No configuration loaded", "error", 3000)
+		return nil
+	}
+	on := !model.config.LLM.UseStreaming()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			model.toastManager.AddToast("Usage: /stream [on|off]", "error", 3000)
+			return nil
+		}
+	}
+	model.config.LLM.Streaming = &on
+	if on {
+		model.toastManager.AddToast("Streaming on", "info", 2000)
+	} else {
+		model.toastManager.AddToast("Streaming off: each response shows when it is complete", "info", 3000)
+	}
+	return nil
+}
+
+func handleCompactUICommand(model *TUIModel, args []string) tea.Cmd {
+	if model.chat.Plain {
+		model.toastManager.AddToast("Plain mode has no layout to compact", "info", 3000)
+		return nil
+	}
+	on := !model.chat.Compact
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			model.toastManager.AddToast("Usage: /compact-ui [on|off]", "error", 3000)
+			return nil
+		}
+	}
+	if model.config != nil {
+		model.config.UI.Compact = on
+	}
+	model.setCompact(on)
+	if on {
+		model.toastManager.AddToast("Compact layout on", "info", 2000)
+	} else {
+		model.toastManager.AddToast("Compact layout off", "info", 2000)
+	}
+	return nil
+}
+
+func handleVerboseCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	on := !model.session.ShowsResponseDetails()
+	if len(args) > 0 {
+		switch args[0] {
+		case "on":
+			on = true
+		case "off":
+			on = false
+		default:
+			model.toastManager.AddToast("Usage: /verbose [on|off]", "error", 3000)
+			return nil
+		}
+	}
+	model.session.SetResponseDetails(on)
+	if on {
+		model.toastManager.AddToast("Response details on", "info", 2000)
+	} else {
+		model.toastManager.AddToast("Response details off", "info", 2000)
+	}
+	return nil
+}
+
+func handleReasoningCommand(model *TUIModel, args []string) tea.Cmd {
+	hide := !model.chat.HideReasoning
+	if len(args) > 0 {
+		switch args[0] {
+		case "show":
+			hide = false
+		case "hide":
+			hide = true
+		default:
+			model.toastManager.AddToast("Usage: /reasoning [show|hide]", "error", 3000)
+			return nil
+		}
+	}
+	model.chat.HideReasoning = hide
+	model.chat.UpdateContent()
+	if hide {
+		model.toastManager.AddToast("Reasoning hidden", "info", 2000)
+	} else {
+		model.toastManager.AddToast("Reasoning shown", "info", 2000)
+	}
+	return nil
+}
+
+func handleMouseCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.chat.Plain {
+		model.toastManager.AddToast("Plain mode leaves the mouse to the terminal", "info", 3000)
+		return nil
+	}
+	on := !model.mouse
+	switch {
+	case len(args) == 1 && args[0] == "on":
+		on = true
+	case len(args) == 1 && args[0] == "off":
+		on = false
+	case len(args) > 0:
+		model.toastManager.AddToast(fmt.Sprintf("Usage: %s [on|off]", withLeader("/mouse", model.commandLeader())), "error", 3000)
+		return nil
+	}
+	model.mouse = on
+	if !on {
+		model.toastManager.AddToast("Mouse released: select text with the terminal, scroll with the keyboard", "info", 4000)
+		return tea.DisableMouse
+	}
+	model.toastManager.AddToast("Mouse captured for scrolling and clicks", "info", 3000)
+	return tea.EnableMouseCellMotion
+}
+
+func handleViCommand(model *TUIModel, args []string) tea.Cmd {
+	// Toggle vi mode
+	model.prompt.SetViMode(!model.prompt.ViMode)
+
+	var message string
+	if model.prompt.ViMode {
+		message = "Vi mode enabled. Press 'i' to insert, 'Esc' to return to normal mode. Use : for commands."
+	} else {
+		message = "Vi mode disabled. Use / for commands."
+	}
+
+	model.toastManager.AddToast(message, "info", 4000)
+	return nil
+}
+
+func handleClearHistoryCommand(model *TUIModel, args []string) tea.Cmd {
+	// Clear persistent history
+	if model.historyStore != nil {
+		if err := model.historyStore.Clear(); err != nil {
+			model.toastManager.AddToast("Failed to clear history", "error", 3000)
+			return nil
+		}
+	}
+
+	// Clear in-memory history
+	model.promptHistory = make([]promptHistoryEntry, 0)
+	model.historyCursor = 0
+	model.historySaved = false
+	model.historyPendingPrompt = ""
+
+	model.toastManager.AddToast("Prompt history cleared", "success", 3000)
+	return nil
+}
+
+func handleSessionsCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		return handleResumeCommand(model, args)
+	}
+	if args[0] != "rebuild" {
+		model.toastManager.AddToast("Usage: /sessions [rebuild]", "error", 3000)
+		return nil
+	}
+	store := model.sessionStore
+	if store == nil {
+		model.toastManager.AddToast("Session persistence is disabled", "error", 3000)
+		return nil
+	}
+	return func() tea.Msg {
+		store.Flush()
+		count, err := store.RebuildIndex()
+		if err != nil {
+			return showContextMsg{content: fmt.Sprintf("Failed to rebuild the session index: %v", err)}
+		}
+		return showContextMsg{content: fmt.Sprintf("Rebuilt the session index with %d sessions", count)}
+	}
+}
+
 func handleResumeCommand(model *TUIModel, args []string) tea.Cmd {
 	return func() tea.Msg {
 		config, err := LoadConfig()
@@ -183,7 +1484,7 @@ func handleResumeCommand(model *TUIModel, args []string) tea.Cmd {
 			listLimit = config.Session.ListLimit
 		}
 
-		store, err := NewSessionStore(maxSessions, maxAgeDays)
+		store, err := NewSessionStore(maxSessions, maxAgeDays, config.Session.StorageDir)
 		if err != nil {
 			return sessionResumeErrorMsg{err: err}
 		}
@@ -1,6 +1,18 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/tmc/langchaingo/llms"
+)
 
 func TestCommandRegistryOrder(t *testing.T) {
 	registry := NewCommandRegistry()
@@ -52,3 +64,417 @@ func TestHandleHelpCommandLeader(t *testing.T) {
 		}
 	})
 }
+
+func TestHandlePermissionsCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	model := &TUIModel{config: &Config{}, toastManager: NewToastManager()}
+
+	if cmd := handlePermissionsCommand(model, []string{"mode", "deny"}); cmd == nil {
+		t.Fatalf("expected mode change to show permissions")
+	}
+	handlePermissionsCommand(model, []string{"deny", "run_in_shell:git*"})
+	handlePermissionsCommand(model, []string{"allow", "run_in_shell:git*"})
+	handlePermissionsCommand(model, []string{"mode", "sometimes"})
+
+	perm := model.config.Permission
+	if perm.DefaultMode != "deny" {
+		t.Fatalf("expected mode deny, got %q", perm.DefaultMode)
+	}
+	if len(perm.Allow) != 1 || len(perm.Deny) != 0 {
+		t.Fatalf("expected pattern to move from deny to allow, got allow=%v deny=%v", perm.Allow, perm.Deny)
+	}
+
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+	if loaded.Permission.DefaultMode != "deny" || len(loaded.Permission.Allow) != 1 || loaded.Permission.Allow[0] != "run_in_shell:git*" {
+		t.Fatalf("expected permissions persisted to .asimi/conf.toml, got %+v", loaded.Permission)
+	}
+
+	msg := handlePermissionsCommand(model, nil)()
+	if content := msg.(showContextMsg).content; !strings.Contains(content, "Allow: run_in_shell:git*") {
+		t.Fatalf("unexpected permissions summary: %q", content)
+	}
+}
+
+func TestNewSessionCommandSavesOutgoingSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("failed to create session store: %v", err)
+	}
+	defer store.Close()
+
+	model, _ := newTestModel(t)
+	model.config.Session = SessionConfig{Enabled: true, AutoSave: true}
+	model.sessionStore = store
+	model.session.AddContextFile("notes.md", "remember this")
+	model.session.prepareUserMessage("first conversation")
+	model.saveSession() // queued, as after a normal turn
+
+	handleNewSessionCommand(model, nil)
+	if model.session.ID != "" || model.session.HasContextFiles() {
+		t.Fatalf("expected a fresh session, got id %q", model.session.ID)
+	}
+	for _, msg := range model.session.messages {
+		if msg.Role == llms.ChatMessageTypeHuman {
+			t.Fatalf("expected no user messages in the new session")
+		}
+	}
+
+	store.Flush()
+	sessions, err := store.ListSessions(10)
+	if err != nil {
+		t.Fatalf("failed to list sessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected the old session to be saved once, got %d", len(sessions))
+	}
+	old, err := store.LoadSession(sessions[0].ID)
+	if err != nil {
+		t.Fatalf("failed to load old session: %v", err)
+	}
+	var prompt string
+	for _, msg := range old.Messages {
+		if msg.Role == llms.ChatMessageTypeHuman {
+			prompt = msg.Parts[0].(llms.TextContent).Text
+		}
+	}
+	if !strings.Contains(prompt, "first conversation") || !strings.Contains(prompt, "remember this") {
+		t.Fatalf("expected old session to keep its prompt and context, got %q", prompt)
+	}
+}
+
+func TestNoteCommand(t *testing.T) {
+	t.Chdir(t.TempDir())
+	model, _ := newTestModel(t)
+
+	handleNoteCommand(model, []string{"check", "the", "retry", "logic"})
+	notes, err := readNotes()
+	if err != nil {
+		t.Fatalf("failed to read notes: %v", err)
+	}
+	if notes != "- check the retry logic\n" {
+		t.Fatalf("unexpected notes %q", notes)
+	}
+
+	msg := handleNoteCommand(model, nil)()
+	if shown, ok := msg.(showContextMsg); !ok || shown.content != notes {
+		t.Fatalf("expected /note to show the notes, got %#v", msg)
+	}
+}
+
+func TestReloadConfigCommand(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	writeConfig := func(content string) {
+		if err := os.MkdirAll(".asimi", 0o755); err != nil {
+			t.Fatalf("failed to create .asimi: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(".asimi", "conf.toml"), []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+	writeConfig("[ui]\nplaceholder = \"Ask me\"\n")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig failed: %v", err)
+	}
+
+	model, _ := newTestModel(t)
+	*model.config = *config
+	model.applyConfig()
+	if model.prompt.TextArea.Placeholder != "Ask me" {
+		t.Fatalf("expected placeholder from config, got %q", model.prompt.TextArea.Placeholder)
+	}
+	session := model.session
+
+	writeConfig("[ui]\nplaceholder = \"What next?\"\n\n[llm]\nshow_timestamps = true\n")
+	handleReloadConfigCommand(model, nil)
+
+	if model.prompt.TextArea.Placeholder != "What next?" || !model.chat.ShowTimestamps {
+		t.Fatalf("expected reloaded settings to apply, got placeholder %q timestamps %v", model.prompt.TextArea.Placeholder, model.chat.ShowTimestamps)
+	}
+	if model.session != session {
+		t.Fatalf("expected the session to be kept when LLM settings did not change")
+	}
+	if got := configChanges(config, model.config); strings.Join(got, ",") != "llm.show_timestamps,ui.placeholder" {
+		t.Fatalf("unexpected changes %v", got)
+	}
+
+	// Reloading keeps read-only mode as /readonly left it
+	handleReadOnlyCommand(model, []string{"on"})
+	writeConfig("[ui]\nplaceholder = \"Again?\"\n")
+	handleReloadConfigCommand(model, nil)
+	if !model.session.IsReadOnly() || !model.config.LLM.ReadOnly {
+		t.Fatalf("expected read-only mode to survive a reload")
+	}
+}
+
+func TestFormatWhoami(t *testing.T) {
+	now := time.Date(2025, 1, 2, 10, 0, 0, 0, time.UTC)
+	config := &Config{LLM: LLMConfig{Provider: "anthropic", Model: "claude-sonnet-4", AuthMethod: "oauth_keyring"}}
+	token := &TokenData{Expiry: now.Add(2*time.Hour + 30*time.Minute)}
+
+	out := formatWhoami(config, nil, token, "/", now)
+	for _, want := range []string{
+		"Provider:  anthropic",
+		"Model:     claude-sonnet-4",
+		"Auth:      OAuth, token in the OS keyring",
+		"Token:     expires in 2h30m0s",
+		"Session:   not connected, use /login to log in",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected %q in:\n%s", want, out)
+		}
+	}
+
+	token.Expiry = now.Add(-10 * time.Minute)
+	if out := formatWhoami(config, nil, token, "/", now); !strings.Contains(out, "Token:     expired 10m0s ago") {
+		t.Fatalf("expected an expired token, got:\n%s", out)
+	}
+
+	// Without a recorded method the loaded credentials tell how requests authenticate
+	config = &Config{LLM: LLMConfig{Provider: "openai", APIKey: "sk-test"}}
+	sess := &Session{Provider: "openai", Model: "gpt-4o"}
+	out = formatWhoami(config, sess, nil, "/", now)
+	if !strings.Contains(out, "Auth:      API key\n") || !strings.Contains(out, "Model:     gpt-4o") || !strings.Contains(out, "Session:   connected") {
+		t.Fatalf("unexpected whoami output:\n%s", out)
+	}
+	if strings.Contains(out, "Token:") {
+		t.Fatalf("expected no token line without OAuth, got:\n%s", out)
+	}
+}
+
+func TestLastCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.chat.AddMessage("You: how do I print?")
+	answer := "Use fmt:\n\n```go\nfmt.Println(\"hi\")\n```\n\nor the shell:\n\n```\necho hi\n```"
+	model.chat.AddMessage("Asimi: " + answer)
+	model.chat.AddMessage("Tool output")
+
+	handleLastCommand(model, nil)
+	if got := model.chat.Messages[len(model.chat.Messages)-1]; got != "Asimi: "+answer {
+		t.Fatalf("expected the last answer to be reprinted, got %q", got)
+	}
+	if !model.chat.Viewport.AtBottom() {
+		t.Fatalf("expected the chat to scroll to the reprinted answer")
+	}
+
+	handleLastCommand(model, []string{"code"})
+	want := "Asimi: ```go\nfmt.Println(\"hi\")\n```\n\n```\necho hi\n```"
+	if got := model.chat.Messages[len(model.chat.Messages)-1]; got != want {
+		t.Fatalf("expected only the code blocks, got %q", got)
+	}
+}
+
+func TestRollbackCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	sess := model.session
+	for _, prompt := range []string{"first", "second", "third"} {
+		model.promptHistory = append(model.promptHistory, promptHistoryEntry{Prompt: prompt, SessionSnapshot: sess.GetMessageSnapshot(), ChatSnapshot: len(model.chat.Messages)})
+		model.chat.AddMessage("You: " + prompt)
+		sess.prepareUserMessage(prompt)
+		sess.messages = append(sess.messages,
+			llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{ID: "1", FunctionCall: &llms.FunctionCall{Name: "read_file"}}}},
+			llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: "1", Content: "data"}}},
+			llms.MessageContent{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart("Images returned by read_file:")}},
+			llms.TextParts(llms.ChatMessageTypeAI, "answer to "+prompt))
+		model.chat.AddMessage("Asimi: answer to " + prompt)
+	}
+	afterFirst := model.promptHistory[1].SessionSnapshot
+
+	cmd := handleRollbackCommand(model, []string{"2"})
+	if cmd == nil {
+		t.Fatalf("expected a summary of the removed exchanges")
+	}
+	msg, ok := cmd().(showContextMsg)
+	if !ok || msg.content != "Rolled back 2 exchange(s):\n- second\n- third" {
+		t.Fatalf("unexpected summary %#v", msg)
+	}
+	if got := sess.GetMessageSnapshot(); got != afterFirst {
+		t.Fatalf("expected the session cut back to %d messages, got %d", afterFirst, got)
+	}
+	if len(model.chat.Messages) != 3 || model.chat.Messages[2] != "Asimi: answer to first" {
+		t.Fatalf("expected only the first exchange in the chat, got %q", model.chat.Messages)
+	}
+	if len(model.promptHistory) != 1 || model.historyCursor != 1 {
+		t.Fatalf("expected the rolled back prompts dropped from history, got %v", model.promptHistory)
+	}
+
+	// Asking for more than there is removes everything
+	handleRollbackCommand(model, []string{"5"})
+	if sess.GetMessageSnapshot() != 1 || len(model.chat.Messages) != 1 {
+		t.Fatalf("expected an empty conversation, got %d chat messages", len(model.chat.Messages))
+	}
+
+	// Turns of a resumed session can be rolled back too, by the prompts the
+	// user typed rather than the nudges and context the session added
+	sess.prepareUserMessage("before resume")
+	model.promptHistory = append(model.promptHistory, promptHistoryEntry{Prompt: "before resume", SessionSnapshot: 1})
+	saved := &Session{
+		Messages: []llms.MessageContent{
+			llms.TextParts(llms.ChatMessageTypeSystem, "system"),
+			llms.TextParts(llms.ChatMessageTypeHuman, "--- Context ---\nold question"),
+			llms.TextParts(llms.ChatMessageTypeAI, "old answer"),
+			llms.TextParts(llms.ChatMessageTypeHuman, finishNudge),
+			llms.TextParts(llms.ChatMessageTypeAI, "done"),
+		},
+		Prompts: []sessionPrompt{{Index: 1, Text: "old question"}},
+	}
+	updated, _ := model.Update(sessionSelectedMsg{session: saved})
+	resumed := updated.(TUIModel)
+	if len(resumed.promptHistory) != 2 || resumed.promptHistory[0].SessionSnapshot != 0 {
+		t.Fatalf("expected the earlier prompt kept without its snapshot, got %v", resumed.promptHistory)
+	}
+	msg, ok = handleRollbackCommand(&resumed, []string{"5"})().(showContextMsg)
+	if !ok || msg.content != "Rolled back 1 exchange(s):\n- old question" || resumed.session.GetMessageSnapshot() != 1 {
+		t.Fatalf("expected the resumed exchange rolled back, got %#v", msg)
+	}
+	if len(resumed.session.Prompts) != 0 {
+		t.Fatalf("expected the rolled back prompt dropped from the session, got %v", resumed.session.Prompts)
+	}
+}
+
+func TestErrorsCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	msg := handleErrorsCommand(model, nil)().(showContextMsg)
+	if msg.content != "No errors in this session" {
+		t.Fatalf("expected no errors, got %q", msg.content)
+	}
+
+	updated, _ := model.Update(streamErrorMsg{err: errors.New("429 Too Many Requests")})
+	model2 := updated.(TUIModel)
+	model = &model2
+	msg = handleErrorsCommand(model, nil)().(showContextMsg)
+	if !strings.Contains(msg.content, "llm: The provider is rate limiting requests. Wait a moment and try again.\n    429 Too Many Requests") {
+		t.Fatalf("expected the stream error with its raw message, got %q", msg.content)
+	}
+
+	// The log keeps the latest errors once full
+	for i := range maxErrorLog + 5 {
+		model.errorLog.Add("tool run_in_shell", fmt.Sprintf("failure %d", i), "")
+	}
+	recent := model.errorLog.Recent(3)
+	if len(recent) != 3 || recent[0].Message != "failure 52" || recent[2].Message != "failure 54" {
+		t.Fatalf("expected the last 3 failures oldest first, got %+v", recent)
+	}
+	if all := model.errorLog.Recent(100); len(all) != maxErrorLog || all[0].Message != "failure 5" {
+		t.Fatalf("expected %d errors from failure 5, got %d", maxErrorLog, len(all))
+	}
+	msg = handleErrorsCommand(model, []string{"2"})().(showContextMsg)
+	if !strings.HasPrefix(msg.content, "⚠️ Last 2 errors") || !strings.Contains(msg.content, "tool run_in_shell: failure 54") {
+		t.Fatalf("expected the last 2 errors, got %q", msg.content)
+	}
+	if cmd := handleErrorsCommand(model, []string{"zero"}); cmd != nil {
+		t.Fatalf("expected a bad count to be refused")
+	}
+}
+
+func TestMouseCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	if !model.mouse {
+		t.Fatalf("expected the mouse captured by default")
+	}
+	if cmd := handleMouseCommand(model, nil); cmd == nil || cmd() != tea.DisableMouse() || model.mouse {
+		t.Fatalf("expected /mouse to release the mouse")
+	}
+	if cmd := handleMouseCommand(model, []string{"on"}); cmd == nil || cmd() != tea.EnableMouseCellMotion() || !model.mouse {
+		t.Fatalf("expected /mouse on to capture the mouse")
+	}
+	if cmd := handleMouseCommand(model, []string{"sideways"}); cmd != nil || !model.mouse {
+		t.Fatalf("expected a bad argument to leave the mouse alone")
+	}
+
+	model.config.UI.Mouse = boolPtr(false)
+	model = NewTUIModel(model.config)
+	if model.mouse {
+		t.Fatalf("expected ui.mouse = false to start with the mouse released")
+	}
+}
+
+func TestClearViewCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	sess := model.session
+	model.promptHistory = append(model.promptHistory, promptHistoryEntry{Prompt: "first", SessionSnapshot: sess.GetMessageSnapshot(), ChatSnapshot: len(model.chat.Messages)})
+	model.chat.AddMessage("You: first")
+	sess.prepareUserMessage("first")
+	model.chat.AddMessage("read_file(main.go)")
+	model.chat.SetToolResult(len(model.chat.Messages)-1, "package main")
+	model.toolCallMessageIndex["call-1"] = len(model.chat.Messages) - 1
+	model.chat.AddMessage("Asimi: done")
+	messages := sess.GetMessageSnapshot()
+
+	handleClearViewCommand(model, nil)
+	if len(model.chat.Messages) != 1 || model.chat.Messages[0] != viewClearedMarker {
+		t.Fatalf("expected only the marker in the chat, got %q", model.chat.Messages)
+	}
+	if len(model.toolCallMessageIndex) != 0 || len(model.chat.toolResults) != 0 {
+		t.Fatalf("expected the tool call display state cleared")
+	}
+	if got := sess.GetMessageSnapshot(); got != messages {
+		t.Fatalf("expected the conversation untouched with %d messages, got %d", messages, got)
+	}
+	if model.promptHistory[0].ChatSnapshot > 1 {
+		t.Fatalf("expected history to point at the cleared view, got %d", model.promptHistory[0].ChatSnapshot)
+	}
+}
+
+func TestNewSessionCommandSeeds(t *testing.T) {
+	model, _ := newTestModel(t)
+
+	msg := handleNewSessionCommand(model, []string{"fix", "the", "build"})()
+	if submit, ok := msg.(submitPromptMsg); !ok || submit.prompt != "fix the build" {
+		t.Fatalf("expected the seed prompt to be submitted, got %#v", msg)
+	}
+
+	if cmd := handleNewSessionCommand(model, []string{"--issue", "abc"}); cmd != nil {
+		t.Fatalf("expected a bad issue number to be refused")
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	msg = handleNewSessionCommand(model, []string{"--issue", "#7", "fix", "it"})()
+	loaded, ok := msg.(issueLoadedMsg)
+	if !ok || loaded.number != 7 || loaded.prompt != "fix it" || loaded.err != errGhMissing {
+		t.Fatalf("expected gh to be reported missing, got %#v", msg)
+	}
+
+	var issue githubIssue
+	issue.Number, issue.Title, issue.Body, issue.URL = 7, "Crash on start", "It crashes.", "https://github.com/o/r/issues/7"
+	updated, _ := model.handleCustomMessages(issueLoadedMsg{number: 7, issue: issue, content: formatIssue(issue)})
+	content := updated.(TUIModel).session.ContextFiles[issueContextPath(7)]
+	if !strings.Contains(content, "# #7 Crash on start") || !strings.Contains(content, "It crashes.") {
+		t.Fatalf("expected the issue in the context, got %q", content)
+	}
+}
+
+func TestNewSessionDropsCheckpoint(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("a.txt", []byte("before"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	model, _ := newTestModel(t)
+	model.session.SetCheckpoint(len(model.chat.Messages))
+	model.session.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "1",
+		FunctionCall: &llms.FunctionCall{Name: "write_file", Arguments: `{"path": "a.txt", "content": "after"}`},
+	}})
+
+	handleNewSessionCommand(model, nil)
+	if cmd := handleRestoreCommand(model, nil); cmd != nil {
+		t.Fatalf("expected no checkpoint to restore in the new session")
+	}
+	if data, _ := os.ReadFile("a.txt"); string(data) != "after" {
+		t.Fatalf("expected the file left alone, got %q", data)
+	}
+
+	// Resuming another session drops it too
+	model.session.SetCheckpoint(len(model.chat.Messages))
+	model.session.RestoreFrom(&Session{Messages: []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeSystem, "system")}})
+	if model.session.Checkpoint() != nil {
+		t.Fatalf("expected the checkpoint dropped on resume")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/tmc/langchaingo/llms"
+)
+
+// compareResult is one model's answer to a /model-compare prompt
+type compareResult struct {
+	Model    string
+	Response string
+	Elapsed  time.Duration
+	Tokens   int
+	Err      error
+}
+
+// modelCompareMsg carries the answers of all compared models
+type modelCompareMsg struct {
+	prompt  string
+	results []compareResult
+}
+
+// runModelCompare sends prompt to each model concurrently, every one in a
+// fresh read-only session so the runs can't step on each other's edits.
+// newClient builds the LLM client for a config naming the model.
+func runModelCompare(ctx context.Context, cfg Config, models []string, prompt string, newClient func(*Config) (llms.Model, error)) []compareResult {
+	results := make([]compareResult, len(models))
+	var wg sync.WaitGroup
+	for i, name := range models {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			modelCfg := cfg
+			modelCfg.LLM.Model = name
+			modelCfg.LLM.ReadOnly = true
+			results[i] = compareModel(ctx, &modelCfg, prompt, newClient)
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// compareModel runs a single /model-compare prompt and times it
+func compareModel(ctx context.Context, cfg *Config, prompt string, newClient func(*Config) (llms.Model, error)) compareResult {
+	result := compareResult{Model: cfg.LLM.Model}
+	llm, err := newClient(cfg)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	sess, err := NewSession(llm, cfg, func(any) {})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	start := time.Now()
+	result.Response, result.Err = sess.Ask(ctx, prompt)
+	result.Elapsed = time.Since(start)
+	result.Tokens = sess.countTokens(result.Response)
+	return result
+}
+
+// formatModelCompare lays the answers out in columns that fit width, or one
+// after the other in plain mode or when the columns would be too narrow
+func formatModelCompare(prompt string, results []compareResult, width int, plain bool) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Model comparison (read-only sessions): %s\n\n", truncateSnippet(prompt, 60))
+
+	const gap = 3
+	columnWidth := 0
+	if len(results) > 0 {
+		columnWidth = (width - gap*(len(results)-1)) / len(results)
+	}
+	if plain || columnWidth < 30 {
+		for i, r := range results {
+			if i > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(compareHeader(r) + "\n" + compareBody(r))
+		}
+		return b.String()
+	}
+
+	column := lipgloss.NewStyle().Width(columnWidth)
+	header := column.Bold(true)
+	columns := make([]string, 0, 2*len(results)-1)
+	for i, r := range results {
+		if i > 0 {
+			columns = append(columns, strings.Repeat(" ", gap))
+		}
+		columns = append(columns, lipgloss.JoinVertical(lipgloss.Left,
+			header.Render(compareHeader(r)),
+			column.Render(compareBody(r))))
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, columns...))
+	return b.String()
+}
+
+// compareHeader names the model with its timing and token count
+func compareHeader(r compareResult) string {
+	if r.Err != nil {
+		return r.Model
+	}
+	return fmt.Sprintf("%s (%s, ~%d tokens)", r.Model, r.Elapsed.Round(100*time.Millisecond), r.Tokens)
+}
+
+// compareBody is the model's answer, or why there is none
+func compareBody(r compareResult) string {
+	if r.Err != nil {
+		return fmt.Sprintf("Error: %v", r.Err)
+	}
+	return strings.TrimSpace(r.Response)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/fake"
+)
+
+func TestRunModelCompare(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := Config{LLM: LLMConfig{Provider: "fake", Model: "model-a"}}
+	var mu sync.Mutex
+	var readOnly []bool
+	newClient := func(c *Config) (llms.Model, error) {
+		mu.Lock()
+		readOnly = append(readOnly, c.LLM.ReadOnly)
+		mu.Unlock()
+		if c.LLM.Model == "missing" {
+			return nil, errors.New("unknown model")
+		}
+		return fake.NewFakeLLM([]string{"answer from " + c.LLM.Model}), nil
+	}
+
+	results := runModelCompare(context.Background(), cfg, []string{"model-a", "model-b"}, "what is 2+2?", newClient)
+	require.Len(t, results, 2)
+	assert.Equal(t, "model-a", results[0].Model)
+	assert.Equal(t, "answer from model-a", results[0].Response)
+	assert.Equal(t, "answer from model-b", results[1].Response)
+	assert.Positive(t, results[1].Tokens)
+	assert.Equal(t, []bool{true, true}, readOnly)
+	assert.Equal(t, "model-a", cfg.LLM.Model, "the caller's config is left alone")
+
+	out := formatModelCompare("what is 2+2?", results, 100, false)
+	assert.Contains(t, out, "Model comparison (read-only sessions): what is 2+2?")
+	for _, line := range strings.Split(out, "\n") {
+		assert.LessOrEqual(t, lipgloss.Width(line), 100)
+	}
+	// Side by side, both answers share a line
+	assert.Regexp(t, `model-a \(.*tokens\)\s+model-b \(`, out)
+
+	results = runModelCompare(context.Background(), cfg, []string{"model-a", "missing"}, "hi", newClient)
+	out = formatModelCompare("hi", results, 100, true)
+	assert.Contains(t, out, "answer from model-a")
+	assert.Contains(t, out, "missing\nError: unknown model")
+}
@@ -1,11 +1,26 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"log/slog"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/charmbracelet/lipgloss"
 )
 
+// Size of the file preview shown beside @ completions
+const (
+	completionPreviewLines = 15
+	completionPreviewWidth = 60
+)
+
+// completionDoubleClick is the longest gap between two clicks on the same
+// item that still counts as a double-click
+const completionDoubleClick = 400 * time.Millisecond
+
 // CompletionDialog represents the autocompletion pop-up
 type CompletionDialog struct {
 	Options           []string
@@ -19,6 +34,10 @@ type CompletionDialog struct {
 	Style             lipgloss.Style
 	SelectedItemStyle lipgloss.Style
 	ScrollMargin      int
+	Preview           string // Shown beside the options when set
+	PreviewStyle      lipgloss.Style
+	lastClick         time.Time // When an item was last clicked, to detect double-clicks
+	lastClickIndex    int
 }
 
 // NewCompletionDialog creates a new completion dialog
@@ -39,6 +58,10 @@ func NewCompletionDialog() CompletionDialog {
 			Background(lipgloss.Color("62")).
 			Foreground(lipgloss.Color("230")),
 		ScrollMargin: 4,
+		PreviewStyle: lipgloss.NewStyle().
+			Border(lipgloss.RoundedBorder()).
+			BorderForeground(lipgloss.Color("240")).
+			Foreground(lipgloss.Color("250")),
 	}
 }
 
@@ -52,6 +75,7 @@ func (c *CompletionDialog) SetOptions(options []string) {
 		c.Selected = 0
 	}
 	c.Offset = 0
+	c.Preview = ""
 }
 
 // Show makes the dialog visible
@@ -124,6 +148,15 @@ func (c CompletionDialog) View() string {
 		return ""
 	}
 
+	options := c.optionsView()
+	if c.Preview == "" {
+		return options
+	}
+	return lipgloss.JoinHorizontal(lipgloss.Bottom, options, c.PreviewStyle.Render(c.Preview))
+}
+
+// optionsView renders the bordered list of visible options
+func (c CompletionDialog) optionsView() string {
 	effectiveHeight := c.getEffectiveHeight()
 	start := c.Offset
 	end := c.Offset + effectiveHeight
@@ -151,3 +184,96 @@ func (c CompletionDialog) View() string {
 	content := lipgloss.JoinVertical(lipgloss.Left, lines...)
 	return c.Style.Render(content)
 }
+
+// ItemAt returns the index of the option rendered at x, y relative to the
+// top left corner of the dialog, or -1 when there is none
+func (c CompletionDialog) ItemAt(x, y int) int {
+	if !c.Visible || len(c.Options) == 0 {
+		return -1
+	}
+	options := c.optionsView()
+	// The options box is aligned to the bottom of a taller preview
+	top := lipgloss.Height(c.View()) - lipgloss.Height(options)
+	row := y - top - c.Style.GetBorderTopSize() - c.Style.GetPaddingTop()
+	if x < 0 || x >= lipgloss.Width(options) || row < 0 || row >= c.getEffectiveHeight() {
+		return -1
+	}
+	if index := c.Offset + row; index < len(c.Options) {
+		return index
+	}
+	return -1
+}
+
+// Click selects the option at index and reports whether the click completed
+// a double-click on it
+func (c *CompletionDialog) Click(index int, now time.Time) bool {
+	if index < 0 || index >= len(c.Options) {
+		return false
+	}
+	double := index == c.lastClickIndex && !c.lastClick.IsZero() && now.Sub(c.lastClick) <= completionDoubleClick
+	c.Selected = index
+	if double {
+		c.lastClick = time.Time{}
+	} else {
+		c.lastClick, c.lastClickIndex = now, index
+	}
+	return double
+}
+
+// filePreview returns the first lines of a file or the first entries of a
+// directory, reading no more than it shows
+func filePreview(path string) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+
+	var lines []string
+	if info.IsDir() {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return ""
+		}
+		for i, entry := range entries {
+			if i == completionPreviewLines {
+				lines = append(lines, fmt.Sprintf("… %d more", len(entries)-i))
+				break
+			}
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			lines = append(lines, name)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "(empty directory)")
+		}
+	} else {
+		if isImageFile(path) {
+			return "(image)"
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return ""
+		}
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for len(lines) < completionPreviewLines && scanner.Scan() {
+			line := scanner.Text()
+			if strings.ContainsRune(line, 0) {
+				return "(binary file)"
+			}
+			lines = append(lines, strings.ReplaceAll(line, "\t", "    "))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "(empty file)")
+		}
+	}
+
+	for i, line := range lines {
+		if runes := []rune(line); len(runes) > completionPreviewWidth {
+			lines[i] = string(runes[:completionPreviewWidth-1]) + "…"
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -5,8 +5,11 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	koanftoml "github.com/knadh/koanf/parsers/toml/v2"
 	koanfenv "github.com/knadh/koanf/providers/env/v2"
@@ -24,17 +27,27 @@ type oauthProviderConfig struct {
 
 // Config represents the application configuration structure
 type Config struct {
-	Server     ServerConfig     `koanf:"server"`
-	Database   DatabaseConfig   `koanf:"database"`
-	Logging    LoggingConfig    `koanf:"logging"`
-	LLM        LLMConfig        `koanf:"llm"`
-	History    HistoryConfig    `koanf:"history"`
-	Permission PermissionConfig `koanf:"permission"`
-	Hooks      HooksConfig      `koanf:"hooks"`
-	StatusLine StatusLineConfig `koanf:"statusline"`
-	Session    SessionConfig    `koanf:"session"`
+	Server     ServerConfig          `koanf:"server"`
+	Database   DatabaseConfig        `koanf:"database"`
+	Logging    LoggingConfig         `koanf:"logging"`
+	LLM        LLMConfig             `koanf:"llm"`
+	History    HistoryConfig         `koanf:"history"`
+	Permission PermissionConfig      `koanf:"permission"`
+	Hooks      HooksConfig           `koanf:"hooks"`
+	StatusLine StatusLineConfig      `koanf:"statusline"`
+	Session    SessionConfig         `koanf:"session"`
+	UI         UIConfig              `koanf:"ui"`
+	Tools      map[string]ToolConfig `koanf:"tools"` // Per-tool overrides, keyed by tool name
+
+	// Profile is the active entry of Profiles, whose keys override [llm]
+	Profile  string                    `koanf:"profile"`
+	Profiles map[string]map[string]any `koanf:"profiles"`
 }
 
+// activeProfile is the profile selected with --profile or /profile. When
+// empty, LoadConfig uses the top-level profile key, if any.
+var activeProfile string
+
 // ServerConfig holds server configuration
 type ServerConfig struct {
 	Host string `koanf:"host"`
@@ -82,12 +95,14 @@ type LLMConfig struct {
 	AnthropicCustomHeaders        string            `koanf:"anthropic_custom_headers"`
 	AnthropicSmallFastModel       string            `koanf:"anthropic_small_fast_model"`
 	AnthropicSmallFastModelRegion string            `koanf:"anthropic_small_fast_model_aws_region"`
+	AnthropicClaudeCodePreamble   *bool             `koanf:"anthropic_claude_code_preamble"` // Start the anthropic system prompt with the Claude Code preamble (default true)
 	AwsBearerTokenBedrock         string            `koanf:"aws_bearer_token_bedrock"`
 	BashDefaultTimeoutMs          int               `koanf:"bash_default_timeout_ms"`
 	BashMaxTimeoutMs              int               `koanf:"bash_max_timeout_ms"`
 	BashMaxOutputLength           int               `koanf:"bash_max_output_length"`
 	BashMaintainProjectWorkingDir bool              `koanf:"bash_maintain_project_working_dir"`
 	PodmanAllowHostFallback       bool              `koanf:"sheel_command_fallback_to_host"`
+	KillShellJobsOnExit           bool              `koanf:"kill_shell_jobs_on_exit"` // Stop the processes shell commands left running (/jobs) when asimi exits
 	ApiKeyHelperTtlMs             int               `koanf:"api_key_helper_ttl_ms"`
 	SkipAutoInstall               bool              `koanf:"skip_auto_install"`
 	MaxOutputTokens               int               `koanf:"max_output_tokens"`
@@ -106,11 +121,36 @@ type LLMConfig struct {
 	HttpProxy                     string            `koanf:"http_proxy"`
 	HttpsProxy                    string            `koanf:"https_proxy"`
 	MaxThinkingTokens             int               `koanf:"max_thinking_tokens"`
+	ThinkingWarnShare             int               `koanf:"thinking_warn_share"` // Warn when thinking takes more than this percent of a response (default 70, -1 disables)
 	McpTimeout                    int               `koanf:"mcp_timeout"`
 	McpToolTimeout                int               `koanf:"mcp_tool_timeout"`
 	MaxMcpOutputTokens            int               `koanf:"max_mcp_output_tokens"`
 	UseBuiltinRipgrep             bool              `koanf:"use_builtin_ripgrep"`
-	MaxTurns                      int               `koanf:"max_turns"`
+	Temperature                   *float64          `koanf:"temperature"`               // Sampling temperature, clamped to 0-1 for anthropic and 0-2 for the others (unset uses the provider's default)
+	TopP                          *float64          `koanf:"top_p"`                     // Nucleus sampling cutoff, 0-1 (unset uses the provider's default)
+	Stop                          []string          `koanf:"stop"`                      // Sequences that end the response when the model writes them
+	MaxTurns                      int               `koanf:"max_turns"`                 // Model calls a prompt may take before asking to continue (default 25)
+	InterruptToolKey              string            `koanf:"interrupt_tool_key"`        // Key that interrupts only the running tool (default ctrl+g)
+	SnippetLeader                 string            `koanf:"snippet_leader"`            // Prefix that marks a snippet key in the prompt (default ;)
+	ReActFallback                 bool              `koanf:"react_fallback"`            // Run "Action:"/"Action Input:" text as a tool call when the model answers without native tool calls (for local models)
+	ReadOnly                      bool              `koanf:"read_only"`                 // Withhold tools that modify files or run commands
+	ShowTimestamps                bool              `koanf:"show_timestamps"`           // Show the time above each chat message
+	ToolGlyphs                    string            `koanf:"tool_glyphs"`               // Tool status indicators: "unicode" (default), "ascii" or "emoji"
+	ToolColors                    map[string]string `koanf:"tool_colors"`               // Color per tool status: scheduled, executing, success, error
+	NonStreamingNotice            int               `koanf:"non_streaming_notice"`      // Seconds without output before noting the model doesn't stream (default 10, -1 disables)
+	CompactToolOutput             int               `koanf:"compact_tool_output"`       // Keep tool outputs of the last N prompts in full, shorten older ones (0 keeps all)
+	ContextFormat                 string            `koanf:"context_format"`            // How context files are wrapped: "fenced" (default) or "markers"
+	ContextPromptFirst            bool              `koanf:"context_prompt_first"`      // Put the prompt before the context files instead of after them
+	RequestTimeoutMs              int               `koanf:"request_timeout_ms"`        // Abort an LLM request not finished after this many ms (default 600000, -1 disables)
+	NotesInContext                bool              `koanf:"notes_in_context"`          // Send the project notes (.asimi/notes.md) with every prompt
+	GitContext                    bool              `koanf:"git_context"`               // Tell the model the git branch, whether the tree is dirty and the recent commits in the system prompt
+	ToolOutputLimit               int               `koanf:"tool_output_limit"`         // Larger shell and read_many_files results are saved to .asimi/tool-output and sent cut (default 32768 bytes, -1 disables)
+	RefreshContextOnResume        bool              `koanf:"refresh_context_on_resume"` // Re-read the session's context files from disk when resuming it
+	ReviewWrites                  bool              `koanf:"review_writes"`             // Show each write_file diff and wait for the user to apply, edit or reject it
+	Streaming                     *bool             `koanf:"streaming"`                 // Show responses as they stream in (default true); off waits for each full response
+	WarnExternalEdits             bool              `koanf:"warn_external_edits"`       // Ask before writing a file changed on disk since the agent last read it
+	PromptCaching                 bool              `koanf:"prompt_caching"`            // Mark the system prompt, context files and history as cacheable (anthropic only)
+	AuthMethod                    string            `koanf:"auth_method"`               // Where /login stored the credentials: oauth_keyring, oauth_file, apikey_keyring or apikey_file
 	// OAuth tokens (optional) when authenticating via OAuth2
 	AuthToken    string `koanf:"auth_token"`
 	RefreshToken string `koanf:"refresh_token"`
@@ -118,12 +158,13 @@ type LLMConfig struct {
 
 // HistoryConfig holds persistent session history configuration
 type HistoryConfig struct {
-	Enabled      bool `koanf:"enabled"`
-	MaxSessions  int  `koanf:"max_sessions"`
-	MaxAgeDays   int  `koanf:"max_age_days"`
-	ListLimit    int  `koanf:"list_limit"`
-	AutoSave     bool `koanf:"auto_save"`
-	SaveInterval int  `koanf:"save_interval"`
+	Enabled      bool   `koanf:"enabled"`
+	MaxSessions  int    `koanf:"max_sessions"`
+	MaxAgeDays   int    `koanf:"max_age_days"`
+	ListLimit    int    `koanf:"list_limit"`
+	AutoSave     bool   `koanf:"auto_save"`
+	SaveInterval int    `koanf:"save_interval"`
+	StorageDir   string `koanf:"storage_dir"` // Directory for history.json, e.g. .asimi under the project root (default ~/.local/share/asimi/repo/<project>)
 }
 
 // defaultConfig returns the configuration populated with sensible defaults.
@@ -162,14 +203,129 @@ type StatusLineConfig struct {
 	Template string `koanf:"template"`
 }
 
+// ToolConfig overrides how a tool is offered to the model
+type ToolConfig struct {
+	Enabled     *bool  `koanf:"enabled"`     // Set to false to withhold the tool (default true)
+	Description string `koanf:"description"` // Replaces the description sent to the model
+}
+
+// IsEnabled returns true unless the tool was disabled in the config
+func (t ToolConfig) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
 // SessionConfig holds session persistence configuration
 type SessionConfig struct {
-	Enabled      bool `koanf:"enabled"`
-	MaxSessions  int  `koanf:"max_sessions"`
-	MaxAgeDays   int  `koanf:"max_age_days"`
-	ListLimit    int  `koanf:"list_limit"`
-	AutoSave     bool `koanf:"auto_save"`
-	SaveInterval int  `koanf:"save_interval"`
+	Enabled      bool   `koanf:"enabled"`
+	MaxSessions  int    `koanf:"max_sessions"`
+	MaxAgeDays   int    `koanf:"max_age_days"`
+	ListLimit    int    `koanf:"list_limit"`
+	AutoSave     bool   `koanf:"auto_save"`
+	SaveInterval int    `koanf:"save_interval"`
+	StorageDir   string `koanf:"storage_dir"` // Directory for the session files, e.g. .asimi/sessions; an absolute one gets a directory per project
+}
+
+// UIConfig holds interface configuration
+type UIConfig struct {
+	CommandLeader string `koanf:"command_leader"` // Character that starts a command (default /)
+	Plain         bool   `koanf:"plain"`          // No alt screen, mouse, color or unicode decoration; print a linear transcript
+	Submit        string `koanf:"submit"`         // Key that sends the prompt: enter (default), alt+enter or ctrl+enter; enter then inserts a newline
+	Placeholder   string `koanf:"placeholder"`    // Text shown in the empty prompt
+	Diffstat      *bool  `koanf:"diffstat"`       // Summarize the files a turn changed after its response (default true)
+	ScrollLock    *bool  `koanf:"scroll_lock"`    // Stop following new output while scrolled up, showing a hint to jump back (default true)
+	MinWidth      int    `koanf:"min_width"`      // Narrowest terminal the layout is drawn in (default 40)
+	MinHeight     int    `koanf:"min_height"`     // Shortest terminal the layout is drawn in (default 10)
+	Compact       bool   `koanf:"compact"`        // Dense layout: no prompt border, a shorter status bar and no spacing between turns
+	Mouse         *bool  `koanf:"mouse"`          // Capture the mouse for scrolling and clicks; off leaves selection to the terminal (default true)
+}
+
+// submitKeys maps the ui.submit setting to the key bubbletea reports for it.
+// Terminals that tell ctrl+enter apart from enter send it as a line feed.
+var submitKeys = map[string]string{
+	"enter":      "enter",
+	"alt+enter":  "alt+enter",
+	"ctrl+enter": "ctrl+j",
+}
+
+// validCommandLeader reports whether leader is a single non-alphanumeric character
+func validCommandLeader(leader string) bool {
+	runes := []rune(leader)
+	if len(runes) != 1 {
+		return false
+	}
+	r := runes[0]
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r)
+}
+
+// activeConfigPaths returns the config files LoadConfig reads that exist, in load order
+func activeConfigPaths() []string {
+	var candidates []string
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, filepath.Join(homeDir, ".config", "asimi", "conf.toml"))
+	}
+	if cwd, err := os.Getwd(); err == nil {
+		candidates = append(candidates, filepath.Join(cwd, ".asimi", "conf.toml"))
+	}
+
+	var paths []string
+	for _, path := range candidates {
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// LoadSnippets reads ~/.config/asimi/snippets.toml, mapping short keys to their expansions
+func LoadSnippets() map[string]string {
+	snippets := make(map[string]string)
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return snippets
+	}
+	path := filepath.Join(homeDir, ".config", "asimi", "snippets.toml")
+	if _, err := os.Stat(path); err != nil {
+		return snippets
+	}
+
+	k := koanf.New("\x00") // snippet keys are flat, keep dots as part of the key
+	if err := k.Load(file.Provider(path), koanftoml.Parser()); err != nil {
+		log.Printf("Failed to load snippets from %s: %v", path, err)
+		return snippets
+	}
+	for key, value := range k.All() {
+		if expansion, ok := value.(string); ok {
+			snippets[key] = expansion
+		}
+	}
+	return snippets
+}
+
+// expandSnippets replaces every whitespace-delimited leader+key word in text with its expansion
+func expandSnippets(text, leader string, snippets map[string]string) string {
+	if leader == "" || len(snippets) == 0 || !strings.Contains(text, leader) {
+		return text
+	}
+
+	var b strings.Builder
+	writeWord := func(word string) {
+		if expansion, ok := snippets[strings.TrimPrefix(word, leader)]; ok && strings.HasPrefix(word, leader) {
+			b.WriteString(expansion)
+		} else {
+			b.WriteString(word)
+		}
+	}
+	start := 0
+	for i, r := range text {
+		if !unicode.IsSpace(r) {
+			continue
+		}
+		writeWord(text[start:i])
+		b.WriteRune(r)
+		start = i + utf8.RuneLen(r)
+	}
+	writeWord(text[start:])
+	return b.String()
 }
 
 // LoadConfig loads configuration from multiple sources
@@ -196,6 +352,25 @@ func LoadConfig() (*Config, error) {
 		log.Printf("Unable to stat project config at %s: %v", projectConfigPath, err)
 	}
 
+	// Merge the selected profile over the base [llm] settings, before the
+	// environment so ASIMI_LLM_* variables still win over the profile
+	profile := activeProfile
+	if profile == "" {
+		profile = os.Getenv("ASIMI_PROFILE")
+	}
+	if profile == "" {
+		profile = k.String("profile")
+	}
+	if profile != "" {
+		if !k.Exists("profiles." + profile) {
+			log.Printf("Unknown profile %q, using the base [llm] settings", profile)
+			profile = ""
+		} else if err := k.MergeAt(k.Cut("profiles."+profile), "llm"); err != nil {
+			log.Printf("Failed to apply profile %q: %v", profile, err)
+			profile = ""
+		}
+	}
+
 	// 3. Load environment variables
 	// Environment variables with prefix "ASIMI_" will override config values
 	// e.g., ASIMI_SERVER_PORT=8080 will override the server port
@@ -210,6 +385,10 @@ func LoadConfig() (*Config, error) {
 	}), nil); err != nil {
 		log.Printf("Failed to load environment variables: %v", err)
 	}
+	// Record the profile that was applied, after ASIMI_PROFILE was loaded
+	if err := k.Set("profile", profile); err != nil {
+		log.Printf("Failed to set profile: %v", err)
+	}
 
 	// Special handling for API keys from standard environment variables
 	// Check for OPENAI_API_KEY if using OpenAI
@@ -242,6 +421,16 @@ func LoadConfig() (*Config, error) {
 		config.Session.Enabled = true // Default to enabled
 	}
 
+	if config.UI.CommandLeader != "" && !validCommandLeader(config.UI.CommandLeader) {
+		log.Printf("Ignoring ui.command_leader %q: must be a single non-alphanumeric character", config.UI.CommandLeader)
+		config.UI.CommandLeader = ""
+	}
+
+	if _, ok := submitKeys[config.UI.Submit]; config.UI.Submit != "" && !ok {
+		log.Printf("Ignoring ui.submit %q: must be enter, alt+enter or ctrl+enter", config.UI.Submit)
+		config.UI.Submit = ""
+	}
+
 	return &config, nil
 }
 
@@ -280,6 +469,45 @@ func SaveConfig(config *Config) error {
 	return nil
 }
 
+// SavePermissions writes the permission mode and allow/ask/deny lists to .asimi/conf.toml
+func SavePermissions(perm PermissionConfig) error {
+	projectConfigPath := filepath.Join(".asimi", "conf.toml")
+
+	if err := os.MkdirAll(".asimi", 0o755); err != nil {
+		return fmt.Errorf("failed to create .asimi directory: %w", err)
+	}
+
+	k := koanf.New(".")
+	if _, err := os.Stat(projectConfigPath); err == nil {
+		if err := k.Load(file.Provider(projectConfigPath), koanftoml.Parser()); err != nil {
+			return fmt.Errorf("failed to load existing project config: %w", err)
+		}
+	}
+
+	values := map[string]any{
+		"permission.default_mode": perm.DefaultMode,
+		"permission.allow":        perm.Allow,
+		"permission.ask":          perm.Ask,
+		"permission.deny":         perm.Deny,
+	}
+	for key, value := range values {
+		if err := k.Set(key, value); err != nil {
+			return fmt.Errorf("failed to update %s in config: %w", key, err)
+		}
+	}
+
+	data, err := k.Marshal(koanftoml.Parser())
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	if err := os.WriteFile(projectConfigPath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
 // UpdateUserLLMAuth updates or creates ~/.config/asimi/conf.toml with the given LLM auth settings.
 // It saves API keys securely in the keyring and only stores provider/model in the config file.
 func UpdateUserLLMAuth(provider, apiKey, model string) error {
@@ -705,6 +933,83 @@ func (c *Config) IsViModeEnabled() bool {
 	return *c.LLM.ViMode
 }
 
+// UseClaudeCodePreamble reports whether the anthropic system prompt starts
+// with the Claude Code preamble (default: true). Claude subscription OAuth
+// tokens may be refused without it.
+func (c *LLMConfig) UseClaudeCodePreamble() bool {
+	if c.AnthropicClaudeCodePreamble == nil {
+		return true
+	}
+	return *c.AnthropicClaudeCodePreamble
+}
+
+// UseStreaming reports whether responses are streamed in as they are
+// generated (default: true)
+func (c *LLMConfig) UseStreaming() bool {
+	if c.Streaming == nil {
+		return true
+	}
+	return *c.Streaming
+}
+
+// llmClientKeys are the [llm] settings the LLM client is built from
+var llmClientKeys = map[string]bool{
+	"llm.provider":       true,
+	"llm.model":          true,
+	"llm.api_key":        true,
+	"llm.base_url":       true,
+	"llm.api_key_helper": true,
+	"llm.auth_token":     true,
+	"llm.refresh_token":  true,
+}
+
+// configChanges lists the keys, as written in conf.toml, whose values differ
+// between old and updated
+func configChanges(old, updated *Config) []string {
+	var changed []string
+	oldValue, newValue := reflect.ValueOf(*old), reflect.ValueOf(*updated)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		key := field.Tag.Get("koanf")
+		if field.Type.Kind() != reflect.Struct {
+			if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+				changed = append(changed, key)
+			}
+			continue
+		}
+		for j := 0; j < field.Type.NumField(); j++ {
+			if !reflect.DeepEqual(oldValue.Field(i).Field(j).Interface(), newValue.Field(i).Field(j).Interface()) {
+				changed = append(changed, key+"."+field.Type.Field(j).Tag.Get("koanf"))
+			}
+		}
+	}
+	return changed
+}
+
+// IsDiffstatEnabled returns true if a diffstat should follow turns that changed files (default: true)
+func (c *Config) IsDiffstatEnabled() bool {
+	if c.UI.Diffstat == nil {
+		return true
+	}
+	return *c.UI.Diffstat
+}
+
+// IsScrollLockEnabled returns true if the chat should stay put while the user is scrolled up (default: true)
+func (c *Config) IsScrollLockEnabled() bool {
+	if c.UI.ScrollLock == nil {
+		return true
+	}
+	return *c.UI.ScrollLock
+}
+
+// IsMouseEnabled returns true if the TUI should capture the mouse (default: true)
+func (c *Config) IsMouseEnabled() bool {
+	if c.UI.Mouse == nil {
+		return true
+	}
+	return *c.UI.Mouse
+}
+
 // boolPtr returns a pointer to the provided bool value.
 // It keeps tests and runtime code concise when configuring optional flags.
 func boolPtr(v bool) *bool {
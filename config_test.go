@@ -456,3 +456,80 @@ func TestUpdateUserLLMAuthIntegration(t *testing.T) {
 		assert.NoError(t, err, "Config file should be created")
 	})
 }
+
+func TestSnippets(t *testing.T) {
+	tempHome := t.TempDir()
+	t.Setenv("HOME", tempHome)
+	configDir := filepath.Join(tempHome, ".config", "asimi")
+	require.NoError(t, os.MkdirAll(configDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "snippets.toml"),
+		[]byte("testfix = \"Please add tests and run them.\"\nlgtm = \"Looks good, commit it.\"\n"), 0o644))
+
+	snippets := LoadSnippets()
+	require.Equal(t, "Please add tests and run them.", snippets["testfix"])
+
+	assert.Equal(t, "Fix the parser. Please add tests and run them.",
+		expandSnippets("Fix the parser. ;testfix", ";", snippets))
+	assert.Equal(t, "Looks good, commit it.\n;unknown a;lgtm",
+		expandSnippets(";lgtm\n;unknown a;lgtm", ";", snippets))
+	assert.Equal(t, "no snippets here", expandSnippets("no snippets here", ";", snippets))
+	// The second byte of "à" is not a space
+	assert.Equal(t, "voilà;lgtm", expandSnippets("voilà;lgtm", ";", snippets))
+}
+
+func TestLoadConfigProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	originalDir, err := os.Getwd()
+	require.NoError(t, err)
+	defer os.Chdir(originalDir)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { activeProfile = "" }()
+
+	require.NoError(t, os.MkdirAll(".asimi", 0755))
+	configContent := `profile = "fast"
+
+[llm]
+provider = "anthropic"
+model = "claude-opus"
+max_turns = 50
+
+[profiles.fast]
+model = "claude-haiku"
+
+[profiles.local]
+provider = "ollama"
+model = "qwen"
+`
+	require.NoError(t, os.WriteFile(".asimi/conf.toml", []byte(configContent), 0644))
+
+	config, err := LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "fast", config.Profile)
+	assert.Equal(t, "claude-haiku", config.LLM.Model)
+	assert.Equal(t, "anthropic", config.LLM.Provider)
+	assert.Equal(t, 50, config.LLM.MaxTurns)
+	assert.Len(t, config.Profiles, 2)
+
+	activeProfile = "local"
+	config, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "local", config.Profile)
+	assert.Equal(t, "ollama", config.LLM.Provider)
+	assert.Equal(t, "qwen", config.LLM.Model)
+
+	activeProfile = "missing"
+	config, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Empty(t, config.Profile)
+	assert.Equal(t, "claude-opus", config.LLM.Model)
+
+	// Environment variables override the profile, and can pick it
+	activeProfile = ""
+	t.Setenv("ASIMI_PROFILE", "local")
+	t.Setenv("ASIMI_LLM_MODEL", "from-env")
+	config, err = LoadConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "local", config.Profile)
+	assert.Equal(t, "ollama", config.LLM.Provider)
+	assert.Equal(t, "from-env", config.LLM.Model)
+}
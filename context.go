@@ -7,7 +7,10 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"math"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/tmc/langchaingo/llms"
@@ -130,6 +133,7 @@ func (s *Session) getModelContextSize() int {
 // CountSystemPromptTokens counts tokens in the system prompt.
 // This includes the base system prompt template (AGENTS.md is now in Memory files).
 func (s *Session) CountSystemPromptTokens() int {
+	defer s.rlockMessages()()
 	if len(s.Messages) == 0 {
 		return 0
 	}
@@ -165,12 +169,8 @@ func (s *Session) CountSystemToolsTokens() int {
 // CountMemoryFilesTokens counts tokens in context files.
 // This includes AGENTS.md and any files dynamically added via AddContextFile().
 func (s *Session) CountMemoryFilesTokens() int {
-	if len(s.ContextFiles) == 0 {
-		return 0
-	}
-
 	totalTokens := 0
-	for path, content := range s.ContextFiles {
+	for path, content := range s.GetContextFiles() {
 		totalTokens += s.countTokens(path)
 		totalTokens += s.countTokens(content)
 		totalTokens += memoryFileOverheadTokens
@@ -181,30 +181,121 @@ func (s *Session) CountMemoryFilesTokens() int {
 
 // CountMessagesTokens counts tokens in conversation history (excluding the system message).
 func (s *Session) CountMessagesTokens() int {
-	if len(s.Messages) <= 1 {
-		return 0
-	}
+	history := s.countHistoryTokens()
+	return history.Text + history.ToolCalls + history.ToolResults
+}
 
-	totalTokens := 0
+// historyTokens splits the conversation history's tokens by kind
+type historyTokens struct {
+	Text        int // Prompts and answers
+	ToolCalls   int
+	ToolResults int
+}
+
+// countHistoryTokens counts the conversation history's tokens by kind,
+// excluding the system message
+func (s *Session) countHistoryTokens() historyTokens {
+	defer s.rlockMessages()()
+	var tokens historyTokens
 	for i := 1; i < len(s.Messages); i++ {
-		msg := s.Messages[i]
-		for _, part := range msg.Parts {
+		for _, part := range s.Messages[i].Parts {
 			switch p := part.(type) {
 			case llms.TextContent:
-				totalTokens += s.countTokens(p.Text)
+				tokens.Text += s.countTokens(p.Text)
 			case llms.ToolCall:
 				if p.FunctionCall != nil {
-					totalTokens += s.countTokens(p.FunctionCall.Name)
-					totalTokens += s.countTokens(p.FunctionCall.Arguments)
+					tokens.ToolCalls += s.countTokens(p.FunctionCall.Name)
+					tokens.ToolCalls += s.countTokens(p.FunctionCall.Arguments)
 				}
 			case llms.ToolCallResponse:
-				totalTokens += s.countTokens(p.Name)
-				totalTokens += s.countTokens(p.Content)
+				tokens.ToolResults += s.countTokens(p.Name)
+				tokens.ToolResults += s.countTokens(p.Content)
 			}
 		}
 	}
+	return tokens
+}
 
-	return totalTokens
+// windowEntry is one row of the /window breakdown
+type windowEntry struct {
+	Label  string
+	Tokens int
+}
+
+// ContextWindow breaks the context down finer than GetContextInfo: each
+// context file and each kind of history gets its own row
+func (s *Session) ContextWindow() []windowEntry {
+	entries := []windowEntry{
+		{"System prompt", s.CountSystemPromptTokens()},
+		{"System tools", s.CountSystemToolsTokens()},
+	}
+
+	files := s.GetContextFiles()
+	paths := slices.Collect(maps.Keys(files))
+	sort.Slice(paths, func(i, j int) bool {
+		// AGENTS.md first, then the notes, then the staged files
+		rank := func(path string) int {
+			switch path {
+			case "AGENTS.md":
+				return 0
+			case notesPath:
+				return 1
+			}
+			return 2
+		}
+		if rank(paths[i]) != rank(paths[j]) {
+			return rank(paths[i]) < rank(paths[j])
+		}
+		return paths[i] < paths[j]
+	})
+	for _, path := range paths {
+		label := "File " + path
+		switch path {
+		case "AGENTS.md":
+			label = "AGENTS.md"
+		case notesPath:
+			label = "Project notes"
+		}
+		tokens := s.countTokens(path) + s.countTokens(files[path]) + memoryFileOverheadTokens
+		entries = append(entries, windowEntry{label, tokens})
+	}
+
+	history := s.countHistoryTokens()
+	return append(entries,
+		windowEntry{"Prompts and answers", history.Text},
+		windowEntry{"Tool calls", history.ToolCalls},
+		windowEntry{"Tool results", history.ToolResults},
+	)
+}
+
+// renderContextWindow draws a bar per entry of the /window breakdown, with
+// the commands that free each kind of space
+func renderContextWindow(model string, total int, entries []windowEntry, leader string) string {
+	used := 0
+	for _, e := range entries {
+		used += e.Tokens
+	}
+	if total <= 0 {
+		total = max(used, 1)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  ⎿  Context window · %s · %s/%s tokens (%.1f%%)\n",
+		model, formatTokenCount(used), formatTokenCount(total), percentage(used, total))
+	for _, e := range entries {
+		b.WriteString(formatContextLine(e.Label, e.Tokens, total, percentage(e.Tokens, total)))
+	}
+	free := max(total-used, 0)
+	fmt.Fprintf(&b, "     %s   %s Free: %s tokens (%.1f%%)\n",
+		renderCategoryBar(free, total), contextFreeSymbol, formatTokenCount(free), percentage(free, total))
+
+	b.WriteString("\n  To free space:\n")
+	fmt.Fprintf(&b, "     %s <file> drops a staged file, %s drops them all (AGENTS.md stays)\n",
+		withLeader("/window drop", leader), withLeader("/window clear", leader))
+	fmt.Fprintf(&b, "     %s <n> shortens tool results older than the last n prompts\n", withLeader("/compact-tool-output", leader))
+	fmt.Fprintf(&b, "     %s [n] removes the last exchanges, %s starts over\n",
+		withLeader("/rollback", leader), withLeader("/new", leader))
+	return b.String()
 }
 
 // countTokens provides token counting with langchaingo for OpenAI models,
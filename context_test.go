@@ -212,3 +212,50 @@ func TestHandleContextCommand(t *testing.T) {
 		}
 	})
 }
+
+func TestHandleWindowCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.session.ContextFiles = map[string]string{
+		"AGENTS.md": "be brief",
+		"main.go":   "package main",
+	}
+	model.session.Messages = append(model.session.Messages,
+		llms.MessageContent{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextPart("read it")}},
+		llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{
+			ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`},
+		}}},
+		llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+			ToolCallID: "1", Name: "read_file", Content: "package main",
+		}}},
+	)
+
+	history := model.session.countHistoryTokens()
+	if history.Text == 0 || history.ToolCalls == 0 || history.ToolResults == 0 {
+		t.Fatalf("expected tokens of every kind, got %+v", history)
+	}
+	if total := history.Text + history.ToolCalls + history.ToolResults; total != model.session.CountMessagesTokens() {
+		t.Fatalf("expected the breakdown to add up to %d, got %d", model.session.CountMessagesTokens(), total)
+	}
+
+	msg := handleWindowCommand(model, nil)()
+	contextMsg, ok := msg.(showContextMsg)
+	if !ok {
+		t.Fatalf("expected showContextMsg got %T", msg)
+	}
+	for _, want := range []string{"AGENTS.md", "File main.go", "Tool results", "Free", "/window drop"} {
+		if !strings.Contains(contextMsg.content, want) {
+			t.Fatalf("expected %q in output, got %s", want, contextMsg.content)
+		}
+	}
+	if strings.Index(contextMsg.content, "AGENTS.md") > strings.Index(contextMsg.content, "File main.go") {
+		t.Fatalf("expected AGENTS.md before staged files, got %s", contextMsg.content)
+	}
+
+	handleWindowCommand(model, []string{"drop", "main.go"})
+	if _, ok := model.session.ContextFiles["main.go"]; ok {
+		t.Fatal("expected main.go to be dropped")
+	}
+	if _, ok := model.session.ContextFiles["AGENTS.md"]; !ok {
+		t.Fatal("expected AGENTS.md to stay")
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// fileDiffstat counts the lines a turn added to and removed from a file
+type fileDiffstat struct {
+	Path    string
+	Added   int
+	Removed int
+}
+
+// recordTurnFiles remembers the content of the files a mutating tool call is
+// about to change, the first time each is touched in the turn and since the
+// checkpoint
+func (s *Session) recordTurnFiles(name, argsJSON string) {
+	paths := mutatedPaths(name, argsJSON)
+	if s.turnFiles == nil {
+		s.turnFiles = make(map[string]*string)
+	}
+	recordFileContents(s.turnFiles, paths)
+	if s.checkpoint != nil {
+		recordFileContents(s.checkpoint.Files, paths)
+		recordFileModes(s.checkpoint.Modes, paths)
+	}
+}
+
+// mutatedPaths returns the files a mutating tool call is about to change
+func mutatedPaths(name, argsJSON string) []string {
+	var paths []string
+	switch name {
+	case "apply_patch":
+		var params ApplyPatchInput
+		if err := json.Unmarshal([]byte(argsJSON), &params); err != nil {
+			return nil
+		}
+		files, err := parsePatch(params.Patch)
+		if err != nil {
+			return nil
+		}
+		for _, fp := range files {
+			paths = append(paths, fp.path)
+			if fp.moveTo != "" {
+				paths = append(paths, fp.moveTo)
+			}
+		}
+	case "project_replace":
+		var params ProjectReplaceInput
+		if err := json.Unmarshal([]byte(argsJSON), &params); err != nil || params.DryRun {
+			return nil
+		}
+		results, err := projectReplace(params)
+		if err != nil {
+			return nil
+		}
+		for _, r := range results {
+			paths = append(paths, r.Path)
+		}
+	default:
+		if path := toolPathArg(name, argsJSON); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// recordFileContents stores the current content of each path not yet in
+// files, nil for files that don't exist
+func recordFileContents(files map[string]*string, paths []string) {
+	for _, path := range paths {
+		path = projectRelPath(resolveFileRef(path))
+		if _, seen := files[path]; seen {
+			continue
+		}
+		if data, err := os.ReadFile(resolveFileRef(path)); err == nil {
+			content := string(data)
+			files[path] = &content
+		} else {
+			files[path] = nil
+		}
+	}
+}
+
+// TurnDiffstat compares the files changed in the last turn with their
+// content before it, skipping files that ended up unchanged
+func (s *Session) TurnDiffstat() []fileDiffstat {
+	var stats []fileDiffstat
+	for path, before := range s.turnFiles {
+		var old, current string
+		if before != nil {
+			old = *before
+		}
+		data, err := os.ReadFile(resolveFileRef(path))
+		if err == nil {
+			current = string(data)
+		} else if before == nil {
+			continue
+		}
+		if old == current {
+			continue
+		}
+		added, removed := countLineChanges(old, current)
+		stats = append(stats, fileDiffstat{Path: path, Added: added, Removed: removed})
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Path < stats[j].Path })
+	return stats
+}
+
+// countLineChanges returns the number of lines added and removed going from
+// old to current
+func countLineChanges(old, current string) (added, removed int) {
+	dmp := diffmatchpatch.New()
+	dmp.DiffTimeout = 2 * time.Second
+	a, b, lines := dmp.DiffLinesToRunes(old, current)
+	for _, d := range dmp.DiffCharsToLines(dmp.DiffMainRunes(a, b, false), lines) {
+		n := strings.Count(d.Text, "\n")
+		if !strings.HasSuffix(d.Text, "\n") {
+			n++
+		}
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			added += n
+		case diffmatchpatch.DiffDelete:
+			removed += n
+		}
+	}
+	return added, removed
+}
+
+// formatDiffstat renders a compact summary of changed files
+func formatDiffstat(stats []fileDiffstat) string {
+	width := 0
+	totalAdded, totalRemoved := 0, 0
+	for _, st := range stats {
+		width = max(width, len(st.Path))
+		totalAdded += st.Added
+		totalRemoved += st.Removed
+	}
+	noun := "files"
+	if len(stats) == 1 {
+		noun = "file"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Changed %d %s (+%d -%d)", len(stats), noun, totalAdded, totalRemoved)
+	for _, st := range stats {
+		fmt.Fprintf(&b, "\n  %-*s  +%d -%d", width, st.Path, st.Added, st.Removed)
+	}
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// maxErrorLog is how many errors /errors can show, older ones are overwritten
+	maxErrorLog = 50
+	// defaultErrorsShown is how many errors /errors shows without an argument
+	defaultErrorsShown = 10
+)
+
+// errorEntry is an error recorded for /errors
+type errorEntry struct {
+	Time    time.Time
+	Source  string // What failed, like "llm" or "tool run_in_shell"
+	Message string
+	Detail  string // The raw error or the input that caused it, empty when Message says it all
+}
+
+// errorLog is a ring buffer of the latest errors
+type errorLog struct {
+	entries []errorEntry
+	next    int // Slot the next error goes in
+	count   int
+}
+
+// Add records an error, overwriting the oldest once the log is full
+func (l *errorLog) Add(source, message, detail string) {
+	if l.entries == nil {
+		l.entries = make([]errorEntry, maxErrorLog)
+	}
+	l.entries[l.next] = errorEntry{Time: time.Now(), Source: source, Message: message, Detail: detail}
+	l.next = (l.next + 1) % maxErrorLog
+	l.count = min(l.count+1, maxErrorLog)
+}
+
+// Recent returns the last n errors, oldest first
+func (l *errorLog) Recent(n int) []errorEntry {
+	n = min(n, l.count)
+	recent := make([]errorEntry, 0, n)
+	for i := n; i > 0; i-- {
+		recent = append(recent, l.entries[(l.next-i+maxErrorLog)%maxErrorLog])
+	}
+	return recent
+}
+
+// formatErrors lists errors for /errors, the newest last like the chat
+func formatErrors(entries []errorEntry) string {
+	if len(entries) == 0 {
+		return "No errors in this session"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "⚠️ Last %d errors, newest last\n", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "\n[%s] %s: %s", entry.Time.Format("15:04:05"), entry.Source, entry.Message)
+		if entry.Detail != "" && entry.Detail != entry.Message {
+			for _, line := range strings.Split(truncateSnippet(entry.Detail, 500), "\n") {
+				b.WriteString("\n    " + line)
+			}
+		}
+	}
+	return b.String()
+}
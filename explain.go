@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// explainPrompt is sent by /explain along with the gathered repository overview
+const explainPrompt = "Explain this repository. Using the file tree and key files provided as context, " +
+	"give a structured overview: what the project does, how it is laid out, its entry points, " +
+	"and how to build, run and test it. Keep it concise and use markdown headings."
+
+// explainContextLimit caps the bytes of context /explain gathers
+const explainContextLimit = 64 * 1024
+
+// explainTreeKey is the context entry holding the file listing
+const explainTreeKey = "file tree"
+
+// explainKeyFiles are the files most likely to describe a project, in
+// the order they are added to the overview
+var explainKeyFiles = []string{
+	"README.md",
+	"README",
+	"go.mod",
+	"package.json",
+	"Cargo.toml",
+	"pyproject.toml",
+	"Justfile",
+	"Makefile",
+}
+
+// gatherRepoOverview collects the file tree of root, minus ignored files,
+// and the contents of its key files. The total size is capped at limit:
+// key files are added first, and the tree is cut short when it does not fit.
+func gatherRepoOverview(root string, limit int) map[string]string {
+	overview := make(map[string]string)
+	remaining := limit
+
+	for _, name := range explainKeyFiles {
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		// Leave room for at least part of the tree
+		if len(data) > remaining/2 {
+			data = append(data[:remaining/2:remaining/2], []byte("\n... (truncated)\n")...)
+		}
+		overview[name] = string(data)
+		remaining -= len(data)
+	}
+
+	files, err := getFileTree(root)
+	if err != nil {
+		return overview
+	}
+	ignored := projectIgnoreMatcher(root)
+
+	var tree strings.Builder
+	truncated := false
+	for _, file := range files {
+		if ignored(file) {
+			continue
+		}
+		if tree.Len()+len(file)+1 > remaining {
+			truncated = true
+			break
+		}
+		tree.WriteString(file)
+		tree.WriteString("\n")
+	}
+	if truncated {
+		tree.WriteString("... (more files not listed)\n")
+	}
+	if tree.Len() > 0 {
+		overview[explainTreeKey] = tree.String()
+	}
+	return overview
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGatherRepoOverview(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write("README.md", "# Demo\n")
+	write("go.mod", "module demo\n")
+	write(".gitignore", "build/\n*.log\n")
+	write("main.go", "package main\n")
+	write("cmd/tool/main.go", "package main\n")
+	write("build/out.bin", "binary")
+	write("debug.log", "noise")
+
+	overview := gatherRepoOverview(root, explainContextLimit)
+	assert.Equal(t, "# Demo\n", overview["README.md"])
+	assert.Equal(t, "module demo\n", overview["go.mod"])
+	assert.NotContains(t, overview, "Justfile")
+
+	tree := overview[explainTreeKey]
+	assert.Contains(t, tree, "main.go\n")
+	assert.Contains(t, tree, "cmd/tool/main.go\n")
+	assert.NotContains(t, tree, "build/out.bin")
+	assert.NotContains(t, tree, "debug.log")
+	assert.NotContains(t, tree, "more files not listed")
+
+	// A small cap truncates the key files and the tree
+	write("README.md", strings.Repeat("x", 200))
+	overview = gatherRepoOverview(root, 100)
+	assert.True(t, strings.HasSuffix(overview["README.md"], "... (truncated)\n"))
+	total := 0
+	for _, content := range overview {
+		total += len(content)
+	}
+	assert.LessOrEqual(t, total, 200)
+}
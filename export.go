@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -50,11 +52,53 @@ func exportSession(session *Session, exportType ExportType) (string, error) {
 	return filepath, nil
 }
 
+// requestDump is the payload of the LLM request as /dump writes it
+type requestDump struct {
+	Provider string                `json:"provider"`
+	Model    string                `json:"model"`
+	Tools    []llms.Tool           `json:"tools"`
+	Messages []llms.MessageContent `json:"messages"`
+}
+
+// dumpRequest writes the messages and tool definitions sent to the LLM as
+// JSON, with secrets redacted, and returns the file's path. An empty path
+// writes to the temp directory.
+func dumpRequest(session *Session, path string) (string, error) {
+	if session == nil {
+		return "", fmt.Errorf("no session to dump")
+	}
+	dump := requestDump{Tools: session.toolDefs}
+	if session.config != nil {
+		dump.Provider, dump.Model = session.config.Provider, session.config.Model
+	}
+	unlock := session.rlockMessages()
+	dump.Messages = session.messages
+	if session.promptCaching() {
+		dump.Messages = withCacheBreakpoint(dump.Messages)
+	}
+	data, err := json.MarshalIndent(dump, "", "  ")
+	unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the request: %w", err)
+	}
+
+	if path == "" {
+		timestamp := time.Now().Format("20060102-150405")
+		path = filepath.Join(os.TempDir(), fmt.Sprintf("asimi-dump-%s-%s.json", session.ID, timestamp))
+	}
+	if err := os.WriteFile(path, []byte(redactSecrets(string(data))), 0o600); err != nil {
+		return "", fmt.Errorf("failed to write dump file: %w", err)
+	}
+	return path, nil
+}
+
 // generateFullExportContent generates the full markdown content for the export
 // including system prompt, context files, and conversation
 func generateFullExportContent(session *Session) string {
 	var b strings.Builder
 
+	defer session.rlockMessages()()
+
 	// Header with full metadata in 4 lines
 	b.WriteString("# Asimi Conversation Export\n\n")
 	b.WriteString(session.formatMetadata(ExportTypeFull, time.Now()))
@@ -106,6 +150,8 @@ func generateFullExportContent(session *Session) string {
 func generateConversationExportContent(session *Session) string {
 	var b strings.Builder
 
+	defer session.rlockMessages()()
+
 	// Minimal header
 	b.WriteString("# Asimi Conversation\n\n")
 	b.WriteString(session.formatMetadata(ExportTypeConversation, time.Now()))
@@ -231,3 +277,80 @@ func openInEditor(filepath string) *exec.Cmd {
 func generateExportContent(session *Session) string {
 	return generateFullExportContent(session)
 }
+
+// gitOutput runs git in dir and returns its standard output
+func gitOutput(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitCommandEnv()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w (%s)", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// defaultPatchName names a patch file after the branch, or the session when
+// there's no branch
+func defaultPatchName(branch, sessionID string) string {
+	name := branch
+	if name == "" || name == "HEAD" {
+		name = sessionID
+	}
+	if name == "" {
+		name = "asimi"
+	}
+	return unsafeFileChars.ReplaceAllString(name, "-") + ".patch"
+}
+
+// writeGitPatch writes the changes in the working tree of the repository at
+// dir, staged, unstaged and untracked, to path as a git patch. It returns
+// the number of files in the patch.
+func writeGitPatch(ctx context.Context, dir, path string) (int, error) {
+	// ls-files paths are relative to where it runs and only cover that
+	// directory, so everything runs from the top of the repository
+	top, err := gitOutput(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return 0, err
+	}
+	dir = strings.TrimSpace(top)
+
+	// Untracked files only show in the diff once git knows about them. Add
+	// them as intent-to-add for the diff and forget them again after.
+	untracked, err := gitOutput(ctx, dir, "ls-files", "--others", "--exclude-standard", "-z")
+	if err != nil {
+		return 0, err
+	}
+	// Leave out an earlier patch written to the same file
+	target, _ := filepath.Abs(path)
+	var newFiles []string
+	for _, file := range strings.Split(strings.TrimRight(untracked, "\x00"), "\x00") {
+		if abs, _ := filepath.Abs(filepath.Join(dir, file)); file != "" && abs != target {
+			newFiles = append(newFiles, file)
+		}
+	}
+	if len(newFiles) > 0 {
+		if _, err := gitOutput(ctx, dir, append([]string{"add", "-N", "--"}, newFiles...)...); err != nil {
+			return 0, err
+		}
+		defer gitOutput(context.Background(), dir, append([]string{"reset", "-q", "--"}, newFiles...)...)
+	}
+
+	args := []string{"diff", "--binary"}
+	if _, err := gitOutput(ctx, dir, "rev-parse", "--verify", "-q", "HEAD"); err == nil {
+		args = append(args, "HEAD")
+	}
+	diff, err := gitOutput(ctx, dir, args...)
+	if err != nil {
+		return 0, err
+	}
+	if diff == "" {
+		return 0, fmt.Errorf("no changes to export")
+	}
+	if err := os.WriteFile(path, []byte(diff), 0o644); err != nil {
+		return 0, fmt.Errorf("failed to write patch: %w", err)
+	}
+	return strings.Count(diff, "\ndiff --git ") + 1, nil
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -547,3 +550,103 @@ func TestGenerateExportContent(t *testing.T) {
 		t.Error("Deprecated generateExportContent should still work")
 	}
 }
+
+func TestWriteGitPatch(t *testing.T) {
+	repo := t.TempDir()
+	runGit(t, repo, "init", "-b", "main")
+	runGit(t, repo, "config", "user.name", "Tester")
+	runGit(t, repo, "config", "user.email", "tester@example.com")
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("one\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, repo, "add", "a.txt")
+	runGit(t, repo, "commit", "-m", "initial commit")
+
+	patch := filepath.Join(repo, "main.patch")
+	if _, err := writeGitPatch(context.Background(), repo, patch); err == nil {
+		t.Fatalf("expected an error for a clean tree")
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "a.txt"), []byte("two\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "new.txt"), []byte("new\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := writeGitPatch(context.Background(), repo, patch)
+	if err != nil {
+		t.Fatalf("writeGitPatch failed: %v", err)
+	}
+	if files != 2 {
+		t.Fatalf("expected 2 files in the patch, got %d", files)
+	}
+	data, err := os.ReadFile(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "+two") || !strings.Contains(string(data), "+++ b/new.txt") {
+		t.Fatalf("patch misses a change:\n%s", data)
+	}
+	// New files go back to untracked, and a second export leaves out the first patch
+	if status := runGitOutput(t, repo, "status", "--porcelain"); !strings.Contains(status, "?? new.txt") {
+		t.Fatalf("expected new.txt untracked again, got %q", status)
+	}
+	if files, err = writeGitPatch(context.Background(), repo, patch); err != nil || files != 2 {
+		t.Fatalf("expected the same 2 files on a second export, got %d (%v)", files, err)
+	}
+
+	// Exporting from a subdirectory still covers the whole repository
+	sub := filepath.Join(repo, "sub")
+	if err := os.MkdirAll(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(sub, "inner.txt"), []byte("inner\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if files, err = writeGitPatch(context.Background(), sub, patch); err != nil || files != 3 {
+		t.Fatalf("expected 3 files exporting from a subdirectory, got %d (%v)", files, err)
+	}
+	if data, _ := os.ReadFile(patch); !strings.Contains(string(data), "+++ b/new.txt") || !strings.Contains(string(data), "+++ b/sub/inner.txt") {
+		t.Fatalf("patch from a subdirectory misses a file:\n%s", data)
+	}
+
+	if got := defaultPatchName("feature/login", "abc"); got != "feature-login.patch" {
+		t.Fatalf("unexpected patch name %q", got)
+	}
+	if got := defaultPatchName("", "abc"); got != "abc.patch" {
+		t.Fatalf("unexpected patch name %q", got)
+	}
+}
+
+func TestDumpRequest(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{Provider: "openai", Model: "gpt-4o"}}, func(any) {})
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	sess.prepareUserMessage("my key is sk-abcdefghijklmnop, use it")
+
+	path, err := dumpRequest(sess, filepath.Join(t.TempDir(), "dump.json"))
+	if err != nil {
+		t.Fatalf("dumpRequest failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read dump: %v", err)
+	}
+	var dump requestDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("dump is not valid JSON: %v\n%s", err, data)
+	}
+	if dump.Provider != "openai" || dump.Model != "gpt-4o" {
+		t.Fatalf("unexpected provider/model %s/%s", dump.Provider, dump.Model)
+	}
+	if len(dump.Tools) == 0 || len(dump.Tools) != len(sess.toolDefs) {
+		t.Fatalf("expected %d tools, got %d", len(sess.toolDefs), len(dump.Tools))
+	}
+	if len(dump.Messages) != 2 || dump.Messages[0].Role != llms.ChatMessageTypeSystem {
+		t.Fatalf("expected the system prompt and the prompt, got %d messages", len(dump.Messages))
+	}
+	if strings.Contains(string(data), "sk-abcdefghijklmnop") || !strings.Contains(string(data), "[REDACTED]") {
+		t.Fatalf("expected the key to be redacted:\n%s", data)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// watchedTools are the tools that read or write whole files, whose
+// modification times are tracked
+var watchedTools = map[string]bool{
+	"read_file":       true,
+	"write_file":      true,
+	"replace_text":    true,
+	"apply_patch":     true,
+	"project_replace": true,
+}
+
+// watchedPaths returns the project relative paths of the files a watched
+// tool call reads or writes
+func watchedPaths(name, argsJSON string) []string {
+	switch name {
+	case "apply_patch", "project_replace":
+		paths := mutatedPaths(name, argsJSON)
+		for i, path := range paths {
+			paths[i] = projectRelPath(resolveFileRef(path))
+		}
+		return paths
+	}
+	if path := toolPathArg(name, argsJSON); path != "" {
+		return []string{path}
+	}
+	return nil
+}
+
+// externalEditConfirmer asks the user whether to write over a file changed
+// on disk since the agent last saw it
+type externalEditConfirmer func(ctx context.Context, path string) (bool, error)
+
+// externalEditMsg asks the TUI whether to write over an externally changed
+// file. The answer goes back on reply.
+type externalEditMsg struct {
+	path  string
+	reply chan bool
+}
+
+// sendExternalEditConfirm asks the TUI about an externally changed file and
+// waits for the answer. Without a TUI nobody can approve, so the write is
+// refused.
+func sendExternalEditConfirm(ctx context.Context, path string) (bool, error) {
+	if program == nil {
+		return false, nil
+	}
+	reply := make(chan bool, 1)
+	program.Send(externalEditMsg{path: path, reply: reply})
+	select {
+	case yes := <-reply:
+		return yes, nil
+	case <-ctx.Done():
+		return false, ctx.Err()
+	}
+}
+
+// SetExternalEditConfirmer sets who approves writes to externally changed
+// files when warn_external_edits is on
+func (s *Session) SetExternalEditConfirmer(confirmer externalEditConfirmer) {
+	s.externalEditConfirmer = confirmer
+}
+
+// watchesExternalEdits reports whether file modification times are tracked
+func (s *Session) watchesExternalEdits() bool {
+	return s.config != nil && s.config.WarnExternalEdits
+}
+
+// noteFileTime remembers when the file was modified as the agent saw it
+func (s *Session) noteFileTime(path string) {
+	path = resolveFileRef(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if s.fileTimes == nil {
+		s.fileTimes = make(map[string]time.Time)
+	}
+	s.fileTimes[projectRelPath(path)] = info.ModTime()
+}
+
+// changedExternally reports whether the file was modified since the agent
+// last read or wrote it. Files the agent hasn't seen don't count.
+func (s *Session) changedExternally(path string) bool {
+	path = resolveFileRef(path)
+	seen, ok := s.fileTimes[projectRelPath(path)]
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.ModTime().Equal(seen)
+}
+
+// confirmExternalEdit asks before a tool writes over a file changed since
+// the agent last saw it. When the write is refused, ok is false and note is
+// the tool response.
+func (s *Session) confirmExternalEdit(ctx context.Context, path string) (note string, ok bool) {
+	if !s.changedExternally(path) {
+		return "", true
+	}
+	var yes bool
+	var err error
+	if s.externalEditConfirmer != nil {
+		yes, err = s.externalEditConfirmer(ctx, path)
+	}
+	if err != nil {
+		return fmt.Sprintf("%s was not changed: %v", path, err), false
+	}
+	if !yes {
+		return fmt.Sprintf("%s was changed outside the session since you last read it, and the user kept their version. "+
+			"Read the file again before editing it.", path), false
+	}
+	return "", true
+}
+
+// showExternalEdit warns that a write would clobber changes made outside
+// the session and waits for the user to allow or refuse it
+func (m *TUIModel) showExternalEdit(msg externalEditMsg) {
+	m.externalEdit = &msg
+	m.chat.AddMessage(fmt.Sprintf("⚠️  %s was changed outside the session since the agent last read it", msg.path))
+	m.toastManager.AddToast(fmt.Sprintf("Overwrite the changes to %s? (y/n)", msg.path), "error", 10*time.Minute)
+}
+
+// answerExternalEdit handles a key press while a write to an externally
+// changed file waits for approval. It returns false for keys that don't
+// answer it.
+func (m *TUIModel) answerExternalEdit(key string) (tea.Cmd, bool) {
+	switch key {
+	case "y", "Y":
+		m.externalEdit.reply <- true
+	case "n", "N", "esc":
+		m.externalEdit.reply <- false
+		m.toastManager.AddToast(fmt.Sprintf("Kept your changes to %s", m.externalEdit.path), "info", 3000)
+	default:
+		return nil, false
+	}
+	m.externalEdit = nil
+	m.toastManager.Clear()
+	return nil, true
+}
@@ -22,8 +22,9 @@ type HistoryStore struct {
 	maxSize  int // Maximum number of entries to keep
 }
 
-// NewHistoryStore creates a new history store
-func NewHistoryStore() (*HistoryStore, error) {
+// NewHistoryStore creates a new history store. storageDir is
+// history.storage_dir, empty for the default location.
+func NewHistoryStore(storageDir string) (*HistoryStore, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user home directory: %w", err)
@@ -39,9 +40,8 @@ func NewHistoryStore() (*HistoryStore, error) {
 		slug = defaultProjectSlug
 	}
 
-	repoBase := filepath.Join(homeDir, ".local", "share", "asimi", "repo")
-	projectDir := filepath.Join(repoBase, filepath.FromSlash(slug))
-	if err := os.MkdirAll(projectDir, 0o755); err != nil {
+	projectDir, err := projectDataDir(storageDir, homeDir, projectRoot, slug, "")
+	if err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
@@ -49,7 +49,9 @@ func NewHistoryStore() (*HistoryStore, error) {
 		filePath: filepath.Join(projectDir, "history.json"),
 		maxSize:  1000, // Keep last 1000 prompts
 	}
-	store.migrateLegacyHistory(filepath.Join(homeDir, ".local", "share", "asimi", "history.json"))
+	if storageDir == "" {
+		store.migrateLegacyHistory(filepath.Join(homeDir, ".local", "share", "asimi", "history.json"))
+	}
 	return store, nil
 }
 
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// historySearch is a reverse incremental search through the prompt history,
+// started with ctrl+r like in the shell
+type historySearch struct {
+	query    string
+	match    int             // Index in promptHistory of the shown match, -1 for none
+	failing  bool            // Nothing matches the query; the last match stays shown
+	shown    map[string]bool // Prompts already shown by ctrl+r for this query
+	original string          // Prompt to restore when the search is cancelled
+}
+
+// findHistoryMatch returns the index of the newest prompt at or before from
+// that contains query, ignoring case, or -1. Prompts in skip are passed over
+// so cycling doesn't stop on repeats of earlier matches.
+func findHistoryMatch(history []promptHistoryEntry, query string, from int, skip map[string]bool) int {
+	query = strings.ToLower(query)
+	for i := min(from, len(history)-1); i >= 0; i-- {
+		prompt := history[i].Prompt
+		if skip[prompt] {
+			continue
+		}
+		if strings.Contains(strings.ToLower(prompt), query) {
+			return i
+		}
+	}
+	return -1
+}
+
+// startHistorySearch enters reverse search mode
+func (m *TUIModel) startHistorySearch() {
+	m.historySearch = &historySearch{match: -1, original: m.prompt.Value()}
+	m.showHistorySearch()
+}
+
+// handleHistorySearchKey handles a key press during a history search. It
+// returns false when the key ends the search and should be handled as usual.
+func (m *TUIModel) handleHistorySearchKey(msg tea.KeyMsg) bool {
+	search := m.historySearch
+	switch msg.String() {
+	case "ctrl+r":
+		// Cycle to the next older match
+		if search.match >= 0 {
+			if search.shown == nil {
+				search.shown = make(map[string]bool)
+			}
+			search.shown[m.promptHistory[search.match].Prompt] = true
+			if older := findHistoryMatch(m.promptHistory, search.query, search.match-1, search.shown); older >= 0 {
+				search.match = older
+			}
+		} else {
+			search.match = findHistoryMatch(m.promptHistory, search.query, len(m.promptHistory)-1, nil)
+			search.failing = search.match < 0 && search.query != ""
+		}
+	case "backspace":
+		if search.query != "" {
+			runes := []rune(search.query)
+			search.query = string(runes[:len(runes)-1])
+			search.shown = nil
+			search.match = findHistoryMatch(m.promptHistory, search.query, len(m.promptHistory)-1, nil)
+			search.failing = search.match < 0 && search.query != ""
+		}
+	case "esc", "ctrl+g", "ctrl+c":
+		m.historySearch = nil
+		m.toastManager.Clear()
+		m.prompt.SetValue(search.original)
+		m.prompt.TextArea.CursorEnd()
+		return true
+	case "enter":
+		m.acceptHistorySearch()
+		return true
+	default:
+		if msg.Type != tea.KeyRunes && msg.Type != tea.KeySpace {
+			// Like the shell, other keys take the match and then act on it
+			m.acceptHistorySearch()
+			return false
+		}
+		search.query += string(msg.Runes)
+		search.shown = nil
+		// Keep the shown match while it still matches
+		from := len(m.promptHistory) - 1
+		if search.match >= 0 {
+			from = search.match
+		}
+		if found := findHistoryMatch(m.promptHistory, search.query, from, nil); found >= 0 {
+			search.match = found
+		} else {
+			search.failing = true
+		}
+	}
+	m.showHistorySearch()
+	return true
+}
+
+// acceptHistorySearch loads the match into the prompt for editing
+func (m *TUIModel) acceptHistorySearch() {
+	search := m.historySearch
+	m.historySearch = nil
+	m.toastManager.Clear()
+	if search.match < 0 {
+		m.prompt.SetValue(search.original)
+	} else {
+		m.prompt.SetValue(m.promptHistory[search.match].Prompt)
+	}
+	m.prompt.TextArea.CursorEnd()
+	// The loaded prompt is new input, not a step back in history to roll back to
+	m.historyCursor = len(m.promptHistory)
+	m.historySaved = false
+}
+
+// showHistorySearch shows the match in the prompt and the query in a toast
+func (m *TUIModel) showHistorySearch() {
+	search := m.historySearch
+	label := "reverse-i-search"
+	if search.failing {
+		label = "failing reverse-i-search"
+	}
+	if search.match >= 0 {
+		m.prompt.SetValue(m.promptHistory[search.match].Prompt)
+	} else {
+		m.prompt.SetValue(search.original)
+	}
+	m.prompt.TextArea.CursorEnd()
+	m.toastManager.Clear()
+	m.toastManager.AddToast(fmt.Sprintf("(%s)`%s': ctrl+r older, enter accept, esc cancel", label, search.query), "info", time.Minute)
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	tea "github.com/charmbracelet/bubbletea"
 	"github.com/stretchr/testify/require"
 )
 
@@ -15,7 +16,7 @@ func TestHistoryStore_NewHistoryStore(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewHistoryStore()
+	store, err := NewHistoryStore("")
 	require.NoError(t, err)
 	require.NotNil(t, store)
 	require.NotEmpty(t, store.filePath)
@@ -30,6 +31,28 @@ func TestHistoryStore_NewHistoryStore(t *testing.T) {
 	require.Equal(t, expectedPath, store.filePath)
 }
 
+func TestProjectDataDir(t *testing.T) {
+	home, root := t.TempDir(), t.TempDir()
+	t.Setenv("ASIMI_TEST_DATA", filepath.Join(home, "data"))
+
+	dir, err := projectDataDir("", home, root, "github.com/o/r", "sessions")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, ".local", "share", "asimi", "repo", "github.com", "o", "r", "sessions"), dir)
+
+	dir, err = projectDataDir(".asimi/sessions", home, root, "github.com/o/r", "sessions")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(root, ".asimi", "sessions"), dir)
+
+	dir, err = projectDataDir("~/asimi", home, root, "github.com/o/r", "sessions")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "asimi", "github.com", "o", "r"), dir)
+
+	dir, err = projectDataDir("$ASIMI_TEST_DATA", home, root, "github.com/o/r", "")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(home, "data", "github.com", "o", "r"), dir)
+	require.DirExists(t, dir)
+}
+
 func TestHistoryStore_LoadEmpty(t *testing.T) {
 	// Create a temporary directory for testing
 	tmpDir := t.TempDir()
@@ -291,3 +314,60 @@ func TestClearHistoryCommand(t *testing.T) {
 	require.NoError(t, err)
 	require.Empty(t, entries)
 }
+
+func TestTUIModel_HistorySearch(t *testing.T) {
+	model, _ := newTestModel(t)
+	for _, p := range []string{"fix the build", "add tests", "fix the docs", "fix the build"} {
+		model.promptHistory = append(model.promptHistory, promptHistoryEntry{Prompt: p})
+	}
+	model.historyCursor = len(model.promptHistory)
+	model.prompt.SetValue("draft")
+
+	press := func(key tea.KeyMsg) {
+		updated, _ := model.handleKeyMsg(key)
+		*model = updated.(TUIModel)
+	}
+	typeText := func(s string) {
+		for _, r := range s {
+			press(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{r}})
+		}
+	}
+
+	press(tea.KeyMsg{Type: tea.KeyCtrlR})
+	require.NotNil(t, model.historySearch)
+	typeText("FIX")
+	require.Equal(t, "fix the build", model.prompt.Value())
+
+	// Repeated ctrl+r skips the duplicate and goes to older matches
+	press(tea.KeyMsg{Type: tea.KeyCtrlR})
+	require.Equal(t, "fix the docs", model.prompt.Value())
+	press(tea.KeyMsg{Type: tea.KeyCtrlR})
+	require.Equal(t, "fix the docs", model.prompt.Value(), "stays on the oldest match")
+
+	// A query with no match keeps showing the last one
+	typeText("zzz")
+	require.True(t, model.historySearch.failing)
+	require.Equal(t, "fix the docs", model.prompt.Value())
+
+	// Esc restores the prompt typed before searching
+	press(tea.KeyMsg{Type: tea.KeyEsc})
+	require.Nil(t, model.historySearch)
+	require.Equal(t, "draft", model.prompt.Value())
+
+	// Enter loads the match without submitting it
+	press(tea.KeyMsg{Type: tea.KeyCtrlR})
+	typeText("tests")
+	press(tea.KeyMsg{Type: tea.KeyEnter})
+	require.Nil(t, model.historySearch)
+	require.Equal(t, "add tests", model.prompt.Value())
+	require.Equal(t, len(model.promptHistory), model.historyCursor)
+
+	// Ctrl+C cancels the search instead of quitting
+	press(tea.KeyMsg{Type: tea.KeyCtrlR})
+	typeText("docs")
+	updated, cmd := model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlC})
+	*model = updated.(TUIModel)
+	require.Nil(t, cmd)
+	require.Nil(t, model.historySearch)
+	require.Equal(t, "add tests", model.prompt.Value())
+}
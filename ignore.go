@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// ignoredDirs are directories left out of the file tree at any level
+var ignoredDirs = []string{".git", "vendor", ".asimi", "archive"}
+
+// asimiIgnoreFile lists, in .gitignore syntax, project files the agent should leave alone
+const asimiIgnoreFile = ".asimiignore"
+
+// projectIgnoreMatcher returns a func reporting whether a file path,
+// relative to root, is excluded by the project's .gitignore files or its
+// .asimiignore
+func projectIgnoreMatcher(root string) func(relPath string) bool {
+	rules := projectIgnoreRules(root)
+	return func(relPath string) bool {
+		_, ignored := matchIgnoreRules(rules, relPath, false)
+		return ignored
+	}
+}
+
+// ignoreRule is one ignore pattern and where it comes from
+type ignoreRule struct {
+	Source  string // File holding the pattern, relative to the project root
+	Line    int
+	Text    string
+	pattern gitignore.Pattern
+}
+
+// String names the pattern and its source, like "*.log (.gitignore:3)"
+func (r ignoreRule) String() string {
+	return fmt.Sprintf("%s (%s:%d)", r.Text, r.Source, r.Line)
+}
+
+// readIgnoreRules reads the patterns in file, which applies to the files
+// under dir. Both are relative to root.
+func readIgnoreRules(root, dir, file string) []ignoreRule {
+	source := filepath.ToSlash(filepath.Join(dir, file))
+	data, err := os.ReadFile(filepath.Join(root, source))
+	if err != nil {
+		return nil
+	}
+	var domain []string
+	if dir != "" {
+		domain = strings.Split(filepath.ToSlash(dir), "/")
+	}
+	var rules []ignoreRule
+	for i, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(line)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rules = append(rules, ignoreRule{Source: source, Line: i + 1, Text: text, pattern: gitignore.ParsePattern(text, domain)})
+	}
+	return rules
+}
+
+// projectIgnoreRules reads the ignore patterns of the project at root in
+// ascending priority: .git/info/exclude, the .gitignore files from the root
+// down, skipping directories already ignored, and .asimiignore last
+func projectIgnoreRules(root string) []ignoreRule {
+	rules := readIgnoreRules(root, "", filepath.Join(".git", "info", "exclude"))
+	var walk func(dir string)
+	walk = func(dir string) {
+		rules = append(rules, readIgnoreRules(root, dir, ".gitignore")...)
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() || entry.Name() == ".git" {
+				continue
+			}
+			sub := filepath.Join(dir, entry.Name())
+			if _, ignored := matchIgnoreRules(rules, sub, true); ignored || slices.Contains(ignoredDirs, entry.Name()) {
+				continue
+			}
+			walk(sub)
+		}
+	}
+	walk("")
+	return append(rules, readIgnoreRules(root, "", asimiIgnoreFile)...)
+}
+
+// matchIgnoreRules returns the rule deciding whether relPath is ignored, the
+// last one matching it, and whether it ignores or re-includes the path.
+// The rule is nil when none matches.
+func matchIgnoreRules(rules []ignoreRule, relPath string, isDir bool) (*ignoreRule, bool) {
+	path := strings.Split(filepath.ToSlash(relPath), "/")
+	for i := len(rules) - 1; i >= 0; i-- {
+		switch rules[i].pattern.Match(path, isDir) {
+		case gitignore.Exclude:
+			return &rules[i], true
+		case gitignore.Include:
+			return &rules[i], false
+		}
+	}
+	return nil, false
+}
+
+// ignoredDirIn returns the first directory of relPath that the file tree
+// always leaves out, empty when there is none
+func ignoredDirIn(relPath string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	for _, part := range parts[:len(parts)-1] {
+		if slices.Contains(ignoredDirs, part) {
+			return part
+		}
+	}
+	return ""
+}
+
+// explainIgnore reports whether relPath is ignored and by which rule
+func explainIgnore(rules []ignoreRule, relPath string, isDir bool) string {
+	if dir := ignoredDirIn(relPath); dir != "" {
+		return fmt.Sprintf("%s is ignored: %s/ is a built-in ignored directory", relPath, dir)
+	}
+	rule, ignored := matchIgnoreRules(rules, relPath, isDir)
+	switch {
+	case rule == nil:
+		return fmt.Sprintf("%s is not ignored", relPath)
+	case ignored:
+		return fmt.Sprintf("%s is ignored by %s", relPath, rule)
+	default:
+		return fmt.Sprintf("%s is not ignored: %s re-includes it", relPath, rule)
+	}
+}
+
+// formatIgnoreRules lists the built-in ignored directories and the active
+// patterns grouped by the file they come from
+func formatIgnoreRules(rules []ignoreRule) string {
+	dirs := slices.Clone(ignoredDirs)
+	sort.Strings(dirs)
+	var b strings.Builder
+	fmt.Fprintf(&b, "Built-in ignored directories: %s/", strings.Join(dirs, "/, "))
+	source := ""
+	for _, rule := range rules {
+		if rule.Source != source {
+			source = rule.Source
+			fmt.Fprintf(&b, "\n\n%s:", source)
+		}
+		fmt.Fprintf(&b, "\n  %d: %s", rule.Line, rule.Text)
+	}
+	if len(rules) == 0 {
+		b.WriteString("\n\nNo ignore patterns (.gitignore, .git/info/exclude, " + asimiIgnoreFile + ")")
+	}
+	return b.String()
+}
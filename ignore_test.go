@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		".gitignore":        "# build output\n*.log\n!keep.log\n",
+		"sub/.gitignore":    "tmp/\n",
+		".asimiignore":      "generated/\n",
+		".git/info/exclude": "secret.txt\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	rules := projectIgnoreRules(root)
+	cases := map[string]string{
+		"main.go":           "main.go is not ignored",
+		"debug.log":         "debug.log is ignored by *.log (.gitignore:2)",
+		"keep.log":          "keep.log is not ignored: !keep.log (.gitignore:3) re-includes it",
+		"sub/tmp/x.go":      "sub/tmp/x.go is ignored by tmp/ (sub/.gitignore:1)",
+		"tmp/x.go":          "tmp/x.go is not ignored",
+		"generated/a.go":    "generated/a.go is ignored by generated/ (.asimiignore:1)",
+		"secret.txt":        "secret.txt is ignored by secret.txt (.git/info/exclude:1)",
+		"vendor/lib/lib.go": "vendor/lib/lib.go is ignored: vendor/ is a built-in ignored directory",
+	}
+	for path, want := range cases {
+		assert.Equal(t, want, explainIgnore(rules, path, false))
+	}
+
+	// The matcher used by the tools agrees with what /ignore reports
+	ignored := projectIgnoreMatcher(root)
+	assert.True(t, ignored("debug.log"))
+	assert.False(t, ignored("keep.log"))
+	assert.True(t, ignored("generated/a.go"))
+
+	list := formatIgnoreRules(rules)
+	assert.Contains(t, list, "Built-in ignored directories: .asimi/, .git/, archive/, vendor/")
+	assert.Contains(t, list, ".gitignore:\n  2: *.log\n  3: !keep.log")
+	assert.Contains(t, list, "sub/.gitignore:\n  1: tmp/")
+	assert.NotContains(t, list, "# build output")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubIssue is the part of `gh issue view --json` loaded as context
+type githubIssue struct {
+	Number   int    `json:"number"`
+	Title    string `json:"title"`
+	Body     string `json:"body"`
+	URL      string `json:"url"`
+	Comments []struct {
+		Author struct {
+			Login string `json:"login"`
+		} `json:"author"`
+		Body string `json:"body"`
+	} `json:"comments"`
+}
+
+// issueLoadedMsg carries an issue fetched for /new --issue and the prompt
+// to submit with it
+type issueLoadedMsg struct {
+	number  int
+	issue   githubIssue
+	content string
+	prompt  string
+	err     error
+}
+
+// errGhMissing is returned when the GitHub CLI isn't installed
+var errGhMissing = errors.New("the GitHub CLI (gh) is not installed; get it from https://cli.github.com and run `gh auth login`")
+
+// parseIssueNumber accepts an issue number with or without a leading #
+func parseIssueNumber(arg string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(arg, "#"))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("%q is not an issue number", arg)
+	}
+	return n, nil
+}
+
+// fetchGitHubIssue reads an issue of the current repository with gh
+func fetchGitHubIssue(ctx context.Context, number int) (githubIssue, error) {
+	var issue githubIssue
+	if _, err := exec.LookPath("gh"); err != nil {
+		return issue, errGhMissing
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gh", "issue", "view", strconv.Itoa(number), "--json", "number,title,body,url,comments")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return issue, fmt.Errorf("gh issue view %d failed: %w (%s)", number, err, strings.TrimSpace(stderr.String()))
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &issue); err != nil {
+		return issue, fmt.Errorf("failed to parse gh output: %w", err)
+	}
+	return issue, nil
+}
+
+// formatIssue renders an issue and its comments as a context file
+func formatIssue(issue githubIssue) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# #%d %s\n%s\n\n%s\n", issue.Number, issue.Title, issue.URL, strings.TrimSpace(issue.Body))
+	for _, c := range issue.Comments {
+		fmt.Fprintf(&b, "\n## Comment by %s\n%s\n", c.Author.Login, strings.TrimSpace(c.Body))
+	}
+	return b.String()
+}
+
+// issueContextPath names the context file an issue is loaded as
+func issueContextPath(number int) string {
+	return fmt.Sprintf("github-issue-%d.md", number)
+}
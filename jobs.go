@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// shellJobWaitDelay is how long a host shell command's output is read after
+// the command exits, before giving up on processes it left in the background
+const shellJobWaitDelay = time.Second
+
+// shellJob is a process group a host run_in_shell command left running,
+// like a dev server started with "&"
+type shellJob struct {
+	PID     int // Process group ID
+	Command string
+	Started time.Time
+}
+
+var (
+	shellJobsMu sync.Mutex
+	shellJobs   []shellJob
+)
+
+// trackShellJob remembers the process group of a command that left
+// processes running after it exited
+func trackShellJob(pid int, command string) {
+	shellJobsMu.Lock()
+	defer shellJobsMu.Unlock()
+	shellJobs = append(shellJobs, shellJob{PID: pid, Command: command, Started: time.Now()})
+}
+
+// runningShellJobs returns the tracked jobs that are still running, oldest
+// first, and forgets the ones that ended
+func runningShellJobs() []shellJob {
+	shellJobsMu.Lock()
+	defer shellJobsMu.Unlock()
+	running := shellJobs[:0]
+	for _, job := range shellJobs {
+		if processGroupAlive(job.PID) {
+			running = append(running, job)
+		}
+	}
+	shellJobs = running
+	return append([]shellJob(nil), running...)
+}
+
+// killShellJob terminates the nth running job, counting from 1 as /jobs
+// lists them
+func killShellJob(n int) (shellJob, error) {
+	jobs := runningShellJobs()
+	if n < 1 || n > len(jobs) {
+		return shellJob{}, fmt.Errorf("no job %d, /jobs lists %d", n, len(jobs))
+	}
+	job := jobs[n-1]
+	if err := killProcessGroup(job.PID); err != nil {
+		return job, fmt.Errorf("failed to kill job %d: %w", n, err)
+	}
+	forgetShellJob(job.PID)
+	return job, nil
+}
+
+// killShellJobs terminates all running jobs
+func killShellJobs() {
+	for _, job := range runningShellJobs() {
+		_ = killProcessGroup(job.PID)
+		forgetShellJob(job.PID)
+	}
+}
+
+// forgetShellJob stops tracking the job with the given process group
+func forgetShellJob(pid int) {
+	shellJobsMu.Lock()
+	defer shellJobsMu.Unlock()
+	for i, job := range shellJobs {
+		if job.PID == pid {
+			shellJobs = append(shellJobs[:i], shellJobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// formatShellJobs lists the running jobs for /jobs
+func formatShellJobs(jobs []shellJob) string {
+	if len(jobs) == 0 {
+		return "No background shell processes"
+	}
+	var b strings.Builder
+	b.WriteString("Background shell processes (/kill <n> to stop one):")
+	for i, job := range jobs {
+		fmt.Fprintf(&b, "\n  %d. pid %d, started %s: %s", i+1, job.PID, job.Started.Format("15:04:05"), truncateSnippet(job.Command, 60))
+	}
+	return b.String()
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts cmd in its own process group, so processes it
+// leaves in the background can be found and killed together
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processGroupAlive reports whether any process in the group is running
+func processGroupAlive(pgid int) bool {
+	return syscall.Kill(-pgid, 0) == nil
+}
+
+// killProcessGroup terminates every process in the group
+func killProcessGroup(pgid int) error {
+	return syscall.Kill(-pgid, syscall.SIGTERM)
+}
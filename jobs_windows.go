@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on Windows, where background jobs aren't tracked
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// processGroupAlive reports false, as no jobs are tracked on Windows
+func processGroupAlive(pgid int) bool {
+	return false
+}
+
+// killProcessGroup is not supported on Windows
+func killProcessGroup(pgid int) error {
+	return errors.New("killing background jobs is not supported on Windows")
+}
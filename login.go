@@ -525,20 +525,9 @@ func handleLoginCommand(model *TUIModel, args []string) tea.Cmd {
 // performOAuthLogin performs OAuth login for non-Anthropic providers
 func (m *TUIModel) performOAuthLogin(provider string) tea.Cmd {
 	return func() tea.Msg {
-		// Set default model based on provider
-		var selModel string
-		switch provider {
-		case "openai":
-			selModel = "gpt-4o-mini"
-		case "googleai":
-			selModel = "gemini-2.5-flash"
-		default:
-			selModel = "gpt-4o-mini"
-		}
-
 		// Update in-memory config
 		m.config.LLM.Provider = provider
-		m.config.LLM.Model = selModel
+		m.config.LLM.Model = defaultModelFor(provider)
 
 		// Run generic OAuth2 loopback flow for other providers
 		token, refresh, expiry, err := runOAuthLoopback(provider)
@@ -598,8 +587,8 @@ func (m *TUIModel) completeAnthropicOAuth(authCode, verifier string) tea.Cmd {
 		m.config.LLM.Provider = "anthropic"
 		m.config.LLM.AuthToken = tokens.AccessToken
 		m.config.LLM.RefreshToken = tokens.RefreshToken
-		if m.config.LLM.Model == "" {
-			m.config.LLM.Model = "claude-3-5-sonnet-20241022"
+		if m.config.LLM.Model == "" || !isValidModelFor("anthropic", m.config.LLM.Model, m.config.LLM.BaseURL) {
+			m.config.LLM.Model = defaultModelFor("anthropic")
 		}
 
 		// Reinitialize LLM and session with new credentials
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
@@ -19,7 +21,9 @@ import (
 	"github.com/alecthomas/kong"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
+	"github.com/charmbracelet/lipgloss"
 	isatty "github.com/mattn/go-isatty"
+	"github.com/muesli/termenv"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/anthropic"
 	"github.com/tmc/langchaingo/llms/fake"
@@ -37,7 +41,12 @@ var program *tea.Program
 
 var cli struct {
 	Version       versionCmd `cmd:"version" help:"Print version information"`
+	ShowVersion   bool       `name:"version" help:"Print version information and quit"`
 	Prompt        string     `short:"p" help:"Prompt to send to the agent"`
+	Cwd           string     `name:"cwd" aliases:"project" type:"path" help:"Run against the project in this directory instead of the current one"`
+	ReadOnly      bool       `name:"read-only" help:"Only give the agent tools that read; no writes or shell commands"`
+	ConfigProfile string     `name:"profile" help:"Use the [profiles.<name>] settings from conf.toml over [llm]"`
+	Plain         bool       `help:"Plain accessible output: no alt screen, mouse, color or unicode decoration"`
 	Debug         bool       `help:"Enable debug logging"`
 	CPUProfile    string     `help:"Write CPU profile to file"`
 	MemProfile    string     `help:"Write memory profile to file"`
@@ -46,6 +55,9 @@ var cli struct {
 	Run           runCmd     `cmd:"" default:"1" help:"Run the interactive application"`
 }
 
+// logLevel is the active log level. Verbose mode raises it to debug after the config loads.
+var logLevel = new(slog.LevelVar)
+
 // version holds the application version. Overwrite via -ldflags "-X main.version=x.y.z".
 var version = "dev"
 
@@ -70,9 +82,8 @@ func initLogger() {
 	}
 
 	// Set log level based on debug flag, default to INFO
-	logLevel := slog.LevelInfo
 	if cli.Debug {
-		logLevel = slog.LevelDebug
+		logLevel.Set(slog.LevelDebug)
 	}
 
 	opts := &slog.HandlerOptions{
@@ -82,10 +93,20 @@ func initLogger() {
 }
 
 func (v versionCmd) Run() error {
-	fmt.Printf("Asimi CLI v%s\n", asimiVersion())
+	fmt.Println(versionInfo())
 	return nil
 }
 
+// versionInfo describes the running build for bug reports
+func versionInfo() string {
+	configPaths := "none (using defaults)"
+	if paths := activeConfigPaths(); len(paths) > 0 {
+		configPaths = strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("Asimi CLI v%s\nGo: %s\nOS/Arch: %s/%s\nConfig: %s",
+		asimiVersion(), runtime.Version(), runtime.GOOS, runtime.GOARCH, configPaths)
+}
+
 func (r *runCmd) Run() error {
 	startTime := time.Now()
 
@@ -126,7 +147,7 @@ func (r *runCmd) Run() error {
 			},
 			LLM: LLMConfig{
 				Provider: "openai",
-				Model:    "gpt-3.5-turbo",
+				Model:    defaultModelFor("openai"),
 				APIKey:   "",
 				BaseURL:  "",
 			},
@@ -139,6 +160,24 @@ func (r *runCmd) Run() error {
 
 	// Initialize shell runner with config
 	initShellRunner(config)
+	setAdditionalWriteDirs(config.Permission.AdditionalDirectories)
+	if config.LLM.Verbose {
+		logLevel.Set(slog.LevelDebug)
+	}
+	if cli.ReadOnly {
+		config.LLM.ReadOnly = true
+	}
+	if cli.Plain {
+		config.UI.Plain = true
+	}
+	programOptions := []tea.ProgramOption{tea.WithAltScreen()}
+	if config.IsMouseEnabled() {
+		programOptions = append(programOptions, tea.WithMouseCellMotion())
+	}
+	if config.UI.Plain {
+		lipgloss.SetColorProfile(termenv.Ascii)
+		programOptions = nil
+	}
 
 	// Create the TUI model
 	tuiStart := time.Now()
@@ -150,7 +189,7 @@ func (r *runCmd) Run() error {
 
 	// Create the program but don't start it yet
 	programStart := time.Now()
-	program = tea.NewProgram(tuiModel, tea.WithAltScreen(), tea.WithMouseCellMotion())
+	program = tea.NewProgram(tuiModel, programOptions...)
 
 	if cli.Debug {
 		fmt.Fprintf(os.Stderr, "[TIMING] tea.NewProgram() completed in %v\n", time.Since(programStart))
@@ -244,7 +283,11 @@ func (r *runCmd) Run() error {
 	}
 
 	runStart := time.Now()
-	if _, err := program.Run(); err != nil {
+	_, err = program.Run()
+	if config.LLM.KillShellJobsOnExit {
+		killShellJobs()
+	}
+	if err != nil {
 		return fmt.Errorf("alas, there's been an error: %w", err)
 	}
 
@@ -278,6 +321,20 @@ func main() {
 	startTime := time.Now()
 	ctx := kong.Parse(&cli)
 
+	// Everything below resolves the project from the working directory
+	if cli.Cwd != "" {
+		if err := os.Chdir(cli.Cwd); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: cannot use --cwd %s: %v\n", cli.Cwd, err)
+			os.Exit(1)
+		}
+	}
+	activeProfile = cli.ConfigProfile
+	// Printed after --cwd so the config paths are the project's
+	if cli.ShowVersion {
+		fmt.Println(versionInfo())
+		return
+	}
+
 	// Start profiling if requested
 	if cli.CPUProfile != "" {
 		f, err := os.Create(cli.CPUProfile)
@@ -330,6 +387,13 @@ func main() {
 
 		// Initialize shell runner with config
 		initShellRunner(config)
+		setAdditionalWriteDirs(config.Permission.AdditionalDirectories)
+		if config.LLM.Verbose {
+			logLevel.Set(slog.LevelDebug)
+		}
+		if cli.ReadOnly {
+			config.LLM.ReadOnly = true
+		}
 
 		llm, err := getLLMClient(config)
 		if err != nil {
@@ -342,18 +406,28 @@ func main() {
 		var finalResponse strings.Builder
 		var mu sync.Mutex
 
-		sess, err := NewSession(llm, config, consoleStreamingNotify(done, &finalResponse, &mu))
+		theme := NewTheme()
+		theme.ApplyConfig(config)
+		sess, err := NewSession(llm, config, consoleStreamingNotify(done, &finalResponse, &mu, theme))
 		if err != nil {
 			fmt.Printf("Error creating session: %v\n", err)
 			os.Exit(1)
 		}
 
+		// Piped input, as in `git diff | asimi -p "review this"`, becomes context
+		if piped := readPipedStdin(os.Stdin); piped != "" {
+			sess.AddContextFile("stdin", piped)
+		}
+
 		// Start streaming
 		sess.AskStream(context.Background(), cli.Prompt)
 
 		// Wait for streaming to complete
 		<-done
 
+		if config.LLM.KillShellJobsOnExit {
+			killShellJobs()
+		}
 		os.Exit(0)
 	}
 
@@ -385,6 +459,21 @@ func main() {
 	}
 }
 
+// readPipedStdin returns what was piped or redirected into f, or "" when f is a
+// terminal. It doesn't read from character devices that may never reach EOF.
+func readPipedStdin(f *os.File) string {
+	info, err := f.Stat()
+	if err != nil || !(info.Mode()&os.ModeNamedPipe != 0 || info.Mode().IsRegular()) {
+		return ""
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		slog.Warn("failed to read stdin", "error", err)
+		return ""
+	}
+	return string(data)
+}
+
 // formatToolCall formats a tool call according to the spec: two lines with ⏺ and ⎿ symbols
 func formatToolCall(toolName, icon string, input, result string, err error) string {
 	// Parse input JSON to extract key parameters for the first line
@@ -405,15 +494,16 @@ func formatToolCall(toolName, icon string, input, result string, err error) stri
 }
 
 // consoleStreamingNotify handles streaming and tool messages for non-interactive mode
-func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder, mu *sync.Mutex) func(any) {
+func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder, mu *sync.Mutex, theme *Theme) func(any) {
 	// Track active tool calls to update their status
 	activeToolCalls := make(map[string]*toolCallDisplay)
 
 	return func(m any) {
 		switch v := m.(type) {
 		case ToolCallScheduledMsg:
-			// Create initial display with hollow circle
+			// Create initial display with the scheduled indicator
 			display := &toolCallDisplay{
+				theme:    theme,
 				toolName: v.Call.Tool.Name(),
 				input:    v.Call.Input,
 				status:   "scheduled",
@@ -422,14 +512,14 @@ func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder,
 			display.show()
 			slog.Info("tool.scheduled", "tool", v.Call.Tool.Name(), "input", v.Call.Input)
 		case ToolCallExecutingMsg:
-			// Update to half-filled circle
+			// Update to the executing indicator
 			if display, exists := activeToolCalls[v.Call.ID]; exists {
 				display.status = "executing"
 				display.update()
 			}
 			slog.Info("tool.executing", "tool", v.Call.Tool.Name(), "input", v.Call.Input)
 		case ToolCallSuccessMsg:
-			// Update to full circle and show result
+			// Update to the success indicator and show result
 			if display, exists := activeToolCalls[v.Call.ID]; exists {
 				display.status = "success"
 				display.result = v.Call.Result
@@ -438,7 +528,7 @@ func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder,
 			}
 			slog.Info("tool.success", "tool", v.Call.Tool.Name(), "input", v.Call.Input, "output", v.Call.Result)
 		case ToolCallErrorMsg:
-			// Update to X and show error
+			// Update to the error indicator and show error
 			if display, exists := activeToolCalls[v.Call.ID]; exists {
 				display.status = "error"
 				display.err = v.Call.Error
@@ -468,7 +558,7 @@ func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder,
 			close(done)
 		case streamErrorMsg:
 			slog.Debug("console streaming error", "error", v.err)
-			fmt.Printf("\nError: %v\n", v.err)
+			fmt.Printf("\nError: %v\n", classifyLLMError(v.err))
 			close(done)
 		case streamMaxTokensReachedMsg:
 			slog.Debug("console streaming max tokens reached", "content", v.content)
@@ -480,6 +570,7 @@ func consoleStreamingNotify(done chan struct{}, finalResponse *strings.Builder,
 
 // toolCallDisplay manages the display of a tool call with dynamic status updates
 type toolCallDisplay struct {
+	theme    *Theme
 	toolName string
 	input    string
 	result   string
@@ -488,7 +579,7 @@ type toolCallDisplay struct {
 	linePos  int    // Track cursor position for updates
 }
 
-// show displays the initial tool call with hollow circle
+// show displays the initial tool call with the scheduled indicator
 func (d *toolCallDisplay) show() {
 	formatted := d.formatWithStatus()
 	lines := strings.Split(formatted, "\n")
@@ -555,23 +646,7 @@ func (d *toolCallDisplay) formatWithStatus() string {
 		baseFormat = fmt.Sprintf("⏺ Unknown tool: %s\n  ⎿  Error: tool not found", d.toolName)
 	}
 
-	// Replace the circle based on status
-	var statusCircle string
-	switch d.status {
-	case "scheduled":
-		statusCircle = "○" // Hollow circle
-	case "executing":
-		statusCircle = "◐" // Half-filled circle
-	case "success":
-		statusCircle = "●" // Full circle
-	case "error":
-		statusCircle = "✗" // X mark
-	default:
-		statusCircle = "○"
-	}
-
-	// Replace the first ○ with the status circle
-	return strings.Replace(baseFormat, "○", statusCircle, 1)
+	return fmt.Sprintf("%s %s", d.theme.ToolStatus(d.status), baseFormat)
 }
 
 // getLLMClient creates and returns an LLM client based on the configuration
@@ -662,6 +737,10 @@ func getLLMClient(config *Config) (llms.Model, error) {
 			opts = append(opts, openai.WithBaseURL(config.LLM.BaseURL))
 		}
 
+		if config.LLM.Verbose {
+			opts = append(opts, openai.WithHTTPClient(&http.Client{Transport: llmTransport(config)}))
+		}
+
 		return openai.New(opts...)
 	case "anthropic":
 		// For Anthropic, we can use either OAuth tokens or API key
@@ -683,12 +762,15 @@ func getLLMClient(config *Config) (llms.Model, error) {
 			httpClient := &http.Client{
 				Transport: &anthropicOAuthTransport{
 					token: accessToken,
-					base:  http.DefaultTransport,
+					base:  llmTransport(config),
 				},
 			}
 			opts = append(opts, anthropic.WithHTTPClient(httpClient))
 		} else if config.LLM.APIKey != "" {
 			opts = append(opts, anthropic.WithToken(config.LLM.APIKey))
+			if config.LLM.Verbose {
+				opts = append(opts, anthropic.WithHTTPClient(&http.Client{Transport: llmTransport(config)}))
+			}
 		}
 
 		if config.LLM.BaseURL != "" {
@@ -717,6 +799,14 @@ func getLLMClient(config *Config) (llms.Model, error) {
 	}
 }
 
+// llmTransport returns the base HTTP transport for provider clients, logging traffic in verbose mode
+func llmTransport(config *Config) http.RoundTripper {
+	if config.LLM.Verbose {
+		return &verboseTransport{base: http.DefaultTransport}
+	}
+	return http.DefaultTransport
+}
+
 // anthropicOAuthTransport adds OAuth headers for Anthropic API
 type anthropicOAuthTransport struct {
 	token string
@@ -771,3 +861,63 @@ func (t *anthropicAPIKeyTransport) RoundTrip(req *http.Request) (*http.Response,
 	}
 	return t.base.RoundTrip(r)
 }
+
+// verboseTransport logs provider HTTP requests and responses with credentials redacted
+type verboseTransport struct {
+	base http.RoundTripper
+}
+
+func (t *verboseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.base == nil {
+		t.base = http.DefaultTransport
+	}
+	slog.Debug("llm.http.request", "method", req.Method, "url", redactSecrets(req.URL.String()), "headers", redactHeaders(req.Header))
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		slog.Debug("llm.http.error", "url", redactSecrets(req.URL.String()), "error", redactSecrets(err.Error()))
+		return nil, err
+	}
+	slog.Debug("llm.http.response", "status", resp.StatusCode, "headers", redactHeaders(resp.Header))
+	return resp, nil
+}
+
+// sensitiveHeaders are never written to the log
+var sensitiveHeaders = map[string]bool{
+	"authorization":  true,
+	"x-api-key":      true,
+	"api-key":        true,
+	"x-goog-api-key": true,
+	"cookie":         true,
+	"set-cookie":     true,
+}
+
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for name, values := range h {
+		if sensitiveHeaders[strings.ToLower(name)] {
+			out[name] = "[REDACTED]"
+			continue
+		}
+		out[name] = strings.Join(values, ",")
+	}
+	return out
+}
+
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{8,}`),
+	regexp.MustCompile(`AIza[0-9A-Za-z_\-]{20,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._\-]+`),
+	regexp.MustCompile(`(?i)("?(?:api_?key|auth_token|refresh_token|access_token|key)"?\s*[:=]\s*"?)[^"&\s,}]+`),
+}
+
+// redactSecrets masks API keys and tokens in text destined for the log
+func redactSecrets(text string) string {
+	for _, re := range secretPatterns {
+		if re.NumSubexp() > 0 {
+			text = re.ReplaceAllString(text, "${1}[REDACTED]")
+		} else {
+			text = re.ReplaceAllString(text, "[REDACTED]")
+		}
+	}
+	return text
+}
@@ -5,7 +5,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -89,6 +94,223 @@ func fetchAnthropicModels(config *Config) ([]AnthropicModel, error) {
 	return modelsResponse.Data, nil
 }
 
+// modelCacheTTL is how long fetched model lists are reused before asking the API again
+const modelCacheTTL = 10 * time.Minute
+
+var anthropicModelCache struct {
+	sync.Mutex
+	models  []AnthropicModel
+	baseURL string
+	fetched time.Time
+}
+
+// cachedAnthropicModels returns the model list from the cache, fetching it when stale
+func cachedAnthropicModels(config *Config) ([]AnthropicModel, error) {
+	anthropicModelCache.Lock()
+	defer anthropicModelCache.Unlock()
+
+	if anthropicModelCache.models != nil &&
+		anthropicModelCache.baseURL == config.LLM.BaseURL &&
+		time.Since(anthropicModelCache.fetched) < modelCacheTTL {
+		return anthropicModelCache.models, nil
+	}
+
+	models, err := fetchAnthropicModels(config)
+	if err != nil {
+		return nil, err
+	}
+	anthropicModelCache.models = models
+	anthropicModelCache.baseURL = config.LLM.BaseURL
+	anthropicModelCache.fetched = time.Now()
+	return models, nil
+}
+
+// knownModels lists the models of the configured provider that are known
+// without a request: the current and default models, and the anthropic
+// model list when it was already fetched
+func knownModels(config *Config) []string {
+	names := []string{config.LLM.Model, defaultModelFor(config.LLM.Provider)}
+	if config.LLM.Provider == "anthropic" {
+		anthropicModelCache.Lock()
+		for _, m := range anthropicModelCache.models {
+			names = append(names, m.ID)
+		}
+		anthropicModelCache.Unlock()
+	}
+	slices.Sort(names)
+	return slices.DeleteFunc(slices.Compact(names), func(name string) bool { return name == "" })
+}
+
+// modelCapabilities describes what a model supports and roughly what it costs
+type modelCapabilities struct {
+	Family        string
+	ContextWindow int
+	Tools         bool
+	Vision        bool
+	Thinking      bool
+	InputPrice    float64 // USD per million input tokens
+	OutputPrice   float64 // USD per million output tokens
+}
+
+// anthropicModelCapabilities derives capabilities from a Claude model ID.
+// The models API only returns IDs and names, so this is based on published model specs.
+func anthropicModelCapabilities(id string) modelCapabilities {
+	id = strings.ToLower(id)
+	caps := modelCapabilities{
+		Family:        "Other",
+		ContextWindow: 200_000,
+		Tools:         !strings.HasPrefix(id, "claude-2") && !strings.HasPrefix(id, "claude-instant"),
+		Vision:        !strings.HasPrefix(id, "claude-2") && !strings.HasPrefix(id, "claude-instant"),
+		Thinking:      containsAny(id, "claude-3-7", "sonnet-4", "opus-4", "haiku-4"),
+	}
+	if size, ok := extendedModelContextSizes[id]; ok {
+		caps.ContextWindow = size
+	}
+
+	switch {
+	case strings.Contains(id, "opus"):
+		caps.Family = "Opus"
+		caps.InputPrice, caps.OutputPrice = 15, 75
+		if strings.Contains(id, "opus-4-5") {
+			caps.InputPrice, caps.OutputPrice = 5, 25
+		}
+	case strings.Contains(id, "sonnet"):
+		caps.Family = "Sonnet"
+		caps.InputPrice, caps.OutputPrice = 3, 15
+	case strings.Contains(id, "haiku"):
+		caps.Family = "Haiku"
+		switch {
+		case strings.Contains(id, "haiku-4"):
+			caps.InputPrice, caps.OutputPrice = 1, 5
+		case strings.Contains(id, "3-5-haiku"):
+			caps.InputPrice, caps.OutputPrice = 0.8, 4
+		default:
+			caps.InputPrice, caps.OutputPrice = 0.25, 1.25
+		}
+	}
+	return caps
+}
+
+// renderModelList renders the models grouped by family with their capabilities
+func renderModelList(models []AnthropicModel, currentModel string) string {
+	if len(models) == 0 {
+		return "No models available"
+	}
+
+	familyOrder := []string{"Opus", "Sonnet", "Haiku", "Other"}
+	groups := make(map[string][]AnthropicModel)
+	for _, model := range models {
+		family := anthropicModelCapabilities(model.ID).Family
+		groups[family] = append(groups[family], model)
+	}
+
+	var b strings.Builder
+	b.WriteString("Available models (price per 1M tokens, input/output):\n")
+	for _, family := range familyOrder {
+		group := groups[family]
+		if len(group) == 0 {
+			continue
+		}
+		sort.SliceStable(group, func(i, j int) bool { return group[i].ID > group[j].ID })
+		fmt.Fprintf(&b, "\n%s\n", family)
+		for _, model := range group {
+			caps := anthropicModelCapabilities(model.ID)
+			var features []string
+			if caps.Tools {
+				features = append(features, "tools")
+			}
+			if caps.Vision {
+				features = append(features, "vision")
+			}
+			if caps.Thinking {
+				features = append(features, "thinking")
+			}
+			marker := "  "
+			if model.ID == currentModel {
+				marker = "▶ "
+			}
+			price := "n/a"
+			if caps.InputPrice > 0 {
+				price = fmt.Sprintf("$%g/$%g", caps.InputPrice, caps.OutputPrice)
+			}
+			fmt.Fprintf(&b, "%s%s  %s ctx  %s  %s\n", marker, model.ID,
+				formatTokenCount(caps.ContextWindow), strings.Join(features, ","), price)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// modelSupportsVision reports whether the model accepts image input
+func modelSupportsVision(provider, model string) bool {
+	lower := strings.ToLower(model)
+	switch provider {
+	case "anthropic":
+		return anthropicModelCapabilities(model).Vision
+	case "openai":
+		return containsAny(lower, "gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-5", "vision", "o1", "o3", "o4")
+	case "googleai":
+		return strings.HasPrefix(lower, "gemini-")
+	case "ollama":
+		return containsAny(lower, "llava", "vision", "gemma3", "-vl", "vl:")
+	default:
+		return false
+	}
+}
+
+// isImageFile reports whether path has a common image extension
+func isImageFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+// defaultModelFor returns the model used when a provider is selected without one
+func defaultModelFor(provider string) string {
+	switch provider {
+	case "anthropic":
+		return "claude-sonnet-4-5-20250929"
+	case "googleai":
+		return "gemini-2.5-flash"
+	case "ollama":
+		return "llama3.1"
+	default:
+		return "gpt-4o-mini"
+	}
+}
+
+// validModels returns the model name prefixes a provider is known to accept.
+// A nil result means the provider accepts arbitrary model names.
+func validModels(provider string) []string {
+	switch provider {
+	case "anthropic":
+		return []string{"claude-"}
+	case "openai":
+		return []string{"gpt-", "o1", "o3", "o4", "chatgpt-"}
+	case "googleai":
+		return []string{"gemini-"}
+	default:
+		return nil
+	}
+}
+
+// isValidModelFor reports whether model looks like a model served by provider.
+// Any model is valid behind a custom base_url, which may serve other models.
+func isValidModelFor(provider, model, baseURL string) bool {
+	prefixes := validModels(provider)
+	if prefixes == nil || baseURL != "" {
+		return true
+	}
+	model = strings.ToLower(model)
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
 // ModelSelectionModal represents a modal for selecting AI models
 type ModelSelectionModal struct {
 	*BaseModal
@@ -231,13 +453,16 @@ type modelSelectedMsg struct {
 	model *AnthropicModel
 }
 
-// Message types for model loading
+// Message types for model loading. toChat is set when the list was requested
+// by /models and should be rendered to the chat instead of the selection modal.
 type modelsLoadedMsg struct {
 	models []AnthropicModel
+	toChat bool
 }
 
 type modelsLoadErrorMsg struct {
-	error string
+	error  string
+	toChat bool
 }
 
 type showModelSelectionMsg struct{}
@@ -255,13 +480,22 @@ func handleModelsCommand(model *TUIModel, args []string) tea.Cmd {
 	}
 }
 
+// handleListModelsCommand lists the available models with their capabilities in the chat
+func handleListModelsCommand(model *TUIModel, args []string) tea.Cmd {
+	if model.config.LLM.Provider != "anthropic" {
+		model.toastManager.AddToast("Model listing is only available for Anthropic provider", "error", 3000)
+		return nil
+	}
+	return model.fetchModelsCommand(true)
+}
+
 // TUI command to fetch models
-func (m *TUIModel) fetchModelsCommand() tea.Cmd {
+func (m *TUIModel) fetchModelsCommand(toChat bool) tea.Cmd {
 	return func() tea.Msg {
-		models, err := fetchAnthropicModels(m.config)
+		models, err := cachedAnthropicModels(m.config)
 		if err != nil {
-			return modelsLoadErrorMsg{error: err.Error()}
+			return modelsLoadErrorMsg{error: err.Error(), toChat: toChat}
 		}
-		return modelsLoadedMsg{models: models}
+		return modelsLoadedMsg{models: models, toChat: toChat}
 	}
 }
@@ -5,6 +5,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -337,3 +338,71 @@ func TestMessageTypes(t *testing.T) {
 	showMsg := showModelSelectionMsg{}
 	_ = showMsg // Just test that it compiles
 }
+
+func TestDefaultModelForMatchesProvider(t *testing.T) {
+	for _, provider := range []string{"anthropic", "openai", "googleai", "ollama"} {
+		model := defaultModelFor(provider)
+		if model == "" {
+			t.Errorf("Expected a default model for %s", provider)
+		}
+		if !isValidModelFor(provider, model, "") {
+			t.Errorf("Default model %s is not valid for %s", model, provider)
+		}
+	}
+}
+
+func TestIsValidModelFor(t *testing.T) {
+	tests := []struct {
+		provider string
+		model    string
+		baseURL  string
+		want     bool
+	}{
+		{"anthropic", "claude-3-5-sonnet-latest", "", true},
+		{"anthropic", "gpt-4o-mini", "", false},
+		{"openai", "gpt-4o", "", true},
+		{"openai", "o3-mini", "", true},
+		{"openai", "claude-3-haiku-20240307", "", false},
+		{"googleai", "gemini-2.5-flash", "", true},
+		{"googleai", "gpt-4o", "", false},
+		{"ollama", "anything-goes", "", true},
+		{"openai", "llama-3.1-70b", "https://api.groq.com/openai/v1", true},
+	}
+	for _, tt := range tests {
+		if got := isValidModelFor(tt.provider, tt.model, tt.baseURL); got != tt.want {
+			t.Errorf("isValidModelFor(%q, %q, %q) = %v, want %v", tt.provider, tt.model, tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestRenderModelListGroupsByFamily(t *testing.T) {
+	models := []AnthropicModel{
+		{ID: "claude-3-haiku-20240307"},
+		{ID: "claude-sonnet-4-5-20250929"},
+		{ID: "claude-opus-4-1-20250805"},
+	}
+	out := renderModelList(models, "claude-sonnet-4-5-20250929")
+
+	opus := strings.Index(out, "Opus")
+	sonnet := strings.Index(out, "Sonnet")
+	haiku := strings.Index(out, "Haiku")
+	if opus < 0 || sonnet < opus || haiku < sonnet {
+		t.Fatalf("Expected Opus, Sonnet, Haiku groups in order, got:\n%s", out)
+	}
+	if !strings.Contains(out, "▶ claude-sonnet-4-5-20250929  200.0k ctx  tools,vision,thinking  $3/$15") {
+		t.Errorf("Expected current sonnet model with capabilities, got:\n%s", out)
+	}
+	if !strings.Contains(out, "claude-3-haiku-20240307  200.0k ctx  tools,vision  $0.25/$1.25") {
+		t.Errorf("Expected haiku model without thinking, got:\n%s", out)
+	}
+}
+
+func TestHandleListModelsCommandRequiresAnthropic(t *testing.T) {
+	model := &TUIModel{
+		config:       &Config{LLM: LLMConfig{Provider: "openai"}},
+		toastManager: NewToastManager(),
+	}
+	if cmd := handleListModelsCommand(model, nil); cmd != nil {
+		t.Error("Expected no command for non-Anthropic provider")
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// notesPath is the project scratchpad shared by the user and the agent,
+// relative to the project root
+var notesPath = filepath.Join(".asimi", "notes.md")
+
+// notesFile returns where the notes are, at the project root even when
+// asimi runs in a subdirectory
+func notesFile() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return notesPath
+	}
+	return filepath.Join(findProjectRoot(wd), notesPath)
+}
+
+// readNotes returns the project notes, empty when there are none yet
+func readNotes() (string, error) {
+	data, err := os.ReadFile(notesFile())
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// writeNotes replaces the project notes
+func writeNotes(content string) error {
+	path := notesFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return os.WriteFile(path, []byte(content), 0o644)
+}
+
+// appendNote adds text to the end of the project notes
+func appendNote(text string) error {
+	existing, err := readNotes()
+	if err != nil {
+		return err
+	}
+	if existing != "" && !strings.HasSuffix(existing, "\n") {
+		existing += "\n"
+	}
+	return writeNotes(existing + strings.TrimRight(text, "\n"))
+}
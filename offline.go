@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// loginKey opens /login while no LLM is configured
+const loginKey = "ctrl+l"
+
+// shellCommandTimeout bounds a command run with /shell
+const shellCommandTimeout = 2 * time.Minute
+
+// showLoginMsg opens the provider selection of /login
+type showLoginMsg struct{}
+
+// offerLogin asks to set up a provider when a prompt needs the AI
+func (m *TUIModel) offerLogin() {
+	question := "AI is disabled. Log in to a provider now?"
+	if m.llmInitErr != nil {
+		question = fmt.Sprintf("AI is disabled (%v). Log in to a provider now?", m.llmInitErr)
+	}
+	m.askConfirm(question, func(yes bool) tea.Cmd {
+		if !yes {
+			return nil
+		}
+		return func() tea.Msg { return showLoginMsg{} }
+	})
+}
+
+// showFile prints a file picked with @ in the chat, for browsing the
+// project while there's no session to add it to
+func (m *TUIModel) showFile(path string, content []byte) {
+	m.chat.AddMessage(fmt.Sprintf("📄 %s\n```%s\n%s\n```", path, fenceLanguage(path), strings.TrimRight(string(content), "\n")))
+	m.sessionActive = true
+}
+
+func handleDiffCommand(model *TUIModel, args []string) tea.Cmd {
+	if !isGitRepository() {
+		model.toastManager.AddToast("Not in a git repository", "error", 3000)
+		return nil
+	}
+	return func() tea.Msg {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return errMsg{err}
+		}
+		diff, err := gitOutput(context.Background(), cwd, append([]string{"diff", "HEAD", "--"}, args...)...)
+		if err != nil {
+			// No commits yet
+			if diff, err = gitOutput(context.Background(), cwd, append([]string{"diff", "--"}, args...)...); err != nil {
+				return errMsg{err}
+			}
+		}
+		if strings.TrimSpace(diff) == "" {
+			return showContextMsg{content: "No uncommitted changes"}
+		}
+		return showContextMsg{content: fmt.Sprintf("```diff\n%s\n```", strings.TrimRight(diff, "\n"))}
+	}
+}
+
+func handleShellCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		model.toastManager.AddToast(fmt.Sprintf("Usage: %s <command>", withLeader("/shell", model.commandLeader())), "error", 3000)
+		return nil
+	}
+	command := strings.Join(args, " ")
+	return func() tea.Msg {
+		out, status, err := runShellCommand(command, true)
+		if err != nil {
+			return errMsg{err}
+		}
+		return showContextMsg{content: fmt.Sprintf("$ %s\n```\n%s\n```\n%s", command, strings.TrimRight(out, "\n"), status)}
+	}
+}
+
+// runShellCommand runs command with sh for /shell and /context-cmd and
+// returns its output, with stderr when combined is set, and how it ended
+func runShellCommand(command string, combined bool) (out, status string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	var data []byte
+	if combined {
+		data, err = cmd.CombinedOutput()
+	} else {
+		data, err = cmd.Output()
+	}
+	status = "exit 0"
+	var exitErr *exec.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		status = fmt.Sprintf("timed out after %s", shellCommandTimeout)
+	case errors.As(err, &exitErr):
+		status = fmt.Sprintf("exit %d", exitErr.ExitCode())
+	case err != nil:
+		return "", "", fmt.Errorf("failed to run %q: %w", command, err)
+	}
+	return string(data), status, nil
+}
+
+// contextCommandMsg carries the output of a /context-cmd command
+type contextCommandMsg struct {
+	command string
+	output  string
+	status  string
+	err     error
+}
+
+// commandContextPath names the context file holding a command's output,
+// like cmd-go-build.txt, without spaces so /window drop can take it
+func commandContextPath(command string) string {
+	words := strings.FieldsFunc(strings.ToLower(command), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	slug := strings.Join(words, "-")
+	if runes := []rune(slug); len(runes) > 40 {
+		slug = strings.TrimRight(string(runes[:40]), "-")
+	}
+	if slug == "" {
+		slug = "output"
+	}
+	return "cmd-" + slug + ".txt"
+}
+
+func handleContextCmdCommand(model *TUIModel, args []string) tea.Cmd {
+	if len(args) == 0 {
+		model.toastManager.AddToast(fmt.Sprintf("Usage: %s <command>", withLeader("/context-cmd", model.commandLeader())), "error", 3000)
+		return nil
+	}
+	if model.session == nil {
+		model.toastManager.AddToast("No active session", "error", 3000)
+		return nil
+	}
+	command := strings.Join(args, " ")
+	// Allow the whole command in quotes, as in /context-cmd "go vet ./..."
+	if unquoted, err := strconv.Unquote(command); err == nil && strings.HasPrefix(command, `"`) {
+		command = unquoted
+	} else if len(command) > 1 && strings.HasPrefix(command, "'") && strings.HasSuffix(command, "'") {
+		command = command[1 : len(command)-1]
+	}
+	return func() tea.Msg {
+		out, status, err := runShellCommand(command, false)
+		return contextCommandMsg{command: command, output: out, status: status, err: err}
+	}
+}
@@ -0,0 +1,472 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// patchOp is what a file patch does to its target
+type patchOp int
+
+const (
+	patchUpdate patchOp = iota
+	patchAdd
+	patchDelete
+)
+
+// patchHunk is one change within a file. Lines keep their ' ', '-' or '+'
+// prefix. start is the 1-based line the hunk expects to begin at, or 0 when
+// the patch gives no line numbers. anchor is the line from a "@@ <line>"
+// header that the hunk comes after.
+type patchHunk struct {
+	start  int
+	anchor string
+	lines  []string
+}
+
+// filePatch holds the changes a patch makes to a single file
+type filePatch struct {
+	path   string
+	moveTo string // New path of an updated file, from "*** Move to:"
+	op     patchOp
+	hunks  []patchHunk
+}
+
+// parsePatch reads a unified diff or a "*** Begin Patch" block into per-file
+// changes
+func parsePatch(patch string) ([]filePatch, error) {
+	patch = strings.ReplaceAll(patch, "\r\n", "\n")
+	lines := strings.Split(strings.TrimRight(patch, "\n"), "\n")
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "*** Begin Patch" {
+			return parseBeginPatch(lines)
+		}
+	}
+	return parseUnifiedDiff(lines)
+}
+
+// parseUnifiedDiff parses the output of diff -u or git diff
+func parseUnifiedDiff(lines []string) ([]filePatch, error) {
+	var files []filePatch
+	var current *filePatch
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case isFileHeader(lines, i):
+			oldPath := diffPath(line[4:])
+			newPath := diffPath(lines[i+1][4:])
+			i++
+			fp := filePatch{path: newPath, op: patchUpdate}
+			switch {
+			case oldPath == "/dev/null":
+				fp.op = patchAdd
+			case newPath == "/dev/null":
+				fp.path, fp.op = oldPath, patchDelete
+			}
+			files = append(files, fp)
+			current = &files[len(files)-1]
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, fmt.Errorf("hunk header before any file header: %q", line)
+			}
+			start, oldCount, newCount, err := hunkHeader(line)
+			if err != nil {
+				return nil, err
+			}
+			// The counts say where the hunk ends: its lines may themselves
+			// start with "--- " or "+++ "
+			hunk := patchHunk{start: start}
+			for oldCount > 0 || newCount > 0 {
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("hunk %q ends early: %d old and %d new lines missing", line, oldCount, newCount)
+				}
+				if strings.HasPrefix(lines[i], `\`) {
+					continue
+				}
+				hl := hunkLine(lines[i])
+				switch hl[0] {
+				case ' ':
+					oldCount--
+					newCount--
+				case '-':
+					oldCount--
+				case '+':
+					newCount--
+				}
+				if oldCount < 0 || newCount < 0 {
+					return nil, fmt.Errorf("hunk %q has more lines than its header counts", line)
+				}
+				hunk.lines = append(hunk.lines, hl)
+			}
+			// "\ No newline at end of file" may follow the last line
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], `\`) {
+				i++
+			}
+			if i+1 < len(lines) && isHunkLine(lines[i+1]) && !isFileHeader(lines, i+1) {
+				return nil, fmt.Errorf("hunk %q has more lines than its header counts", line)
+			}
+			current.hunks = append(current.hunks, hunk)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file headers (--- / +++) found in patch")
+	}
+	return files, nil
+}
+
+// parseBeginPatch parses the "*** Begin Patch" / "*** End Patch" format
+func parseBeginPatch(lines []string) ([]filePatch, error) {
+	var files []filePatch
+	var current *filePatch
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "*** Begin Patch"), strings.HasPrefix(line, "*** End Patch"):
+			continue
+		case strings.HasPrefix(line, "*** Update File: "):
+			files = append(files, filePatch{path: strings.TrimSpace(line[len("*** Update File: "):]), op: patchUpdate})
+			current = &files[len(files)-1]
+		case strings.HasPrefix(line, "*** Add File: "):
+			files = append(files, filePatch{path: strings.TrimSpace(line[len("*** Add File: "):]), op: patchAdd})
+			current = &files[len(files)-1]
+		case strings.HasPrefix(line, "*** Delete File: "):
+			files = append(files, filePatch{path: strings.TrimSpace(line[len("*** Delete File: "):]), op: patchDelete})
+			current = &files[len(files)-1]
+		case current == nil:
+			continue
+		case strings.HasPrefix(line, "*** Move to: "):
+			current.moveTo = strings.TrimSpace(line[len("*** Move to: "):])
+		case strings.HasPrefix(line, "@@"):
+			current.hunks = append(current.hunks, patchHunk{anchor: strings.TrimSpace(strings.TrimPrefix(line, "@@"))})
+		case strings.HasPrefix(line, `\`), strings.HasPrefix(line, "*** End of File"):
+			continue
+		default:
+			if len(current.hunks) == 0 {
+				current.hunks = append(current.hunks, patchHunk{})
+			}
+			hunk := &current.hunks[len(current.hunks)-1]
+			hunk.lines = append(hunk.lines, hunkLine(line))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *** Update/Add/Delete File sections found in patch")
+	}
+	return files, nil
+}
+
+// diffPath strips the timestamp and a/ b/ prefixes from a diff file header
+func diffPath(header string) string {
+	path := strings.TrimSpace(strings.SplitN(header, "\t", 2)[0])
+	if path == "/dev/null" {
+		return path
+	}
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		path = path[2:]
+	}
+	return path
+}
+
+// hunkHeader returns the old-file start line and the old and new line
+// counts from a "@@ -l,c +l,c @@" header. An omitted count is 1.
+func hunkHeader(header string) (start, oldCount, newCount int, err error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	rangeOf := func(field string) (int, int, error) {
+		from, count, found := strings.Cut(field[1:], ",")
+		line, err := strconv.Atoi(from)
+		if err != nil || !found {
+			return line, 1, err
+		}
+		n, err := strconv.Atoi(count)
+		return line, n, err
+	}
+	start, oldCount, err = rangeOf(fields[1])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	_, newCount, err = rangeOf(fields[2])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("malformed hunk header: %q", header)
+	}
+	return start, oldCount, newCount, nil
+}
+
+// isHunkLine reports whether line looks like a unified diff hunk line
+func isHunkLine(line string) bool {
+	return line != "" && strings.ContainsRune(" -+", rune(line[0]))
+}
+
+// isFileHeader reports whether lines[i] starts a "--- " / "+++ " file header
+func isFileHeader(lines []string, i int) bool {
+	return strings.HasPrefix(lines[i], "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ ")
+}
+
+// hunkLine normalizes a hunk line, treating a bare empty line as empty context
+func hunkLine(line string) string {
+	if line == "" {
+		return " "
+	}
+	switch line[0] {
+	case ' ', '-', '+':
+		return line
+	}
+	return " " + line
+}
+
+// split returns the lines the hunk expects to find and the lines that replace them
+func (h patchHunk) split() (before, after []string) {
+	for _, line := range h.lines {
+		switch line[0] {
+		case ' ':
+			before = append(before, line[1:])
+			after = append(after, line[1:])
+		case '-':
+			before = append(before, line[1:])
+		case '+':
+			after = append(after, line[1:])
+		}
+	}
+	return before, after
+}
+
+// patchMatchers compare file lines with hunk lines, from strict to loose
+var patchMatchers = []func(a, b string) bool{
+	func(a, b string) bool { return a == b },
+	func(a, b string) bool { return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t") },
+	func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+}
+
+// findHunk locates before in lines at or after from, preferring the exact
+// match closest to hint and falling back to whitespace-insensitive matches.
+// It returns -1 when the hunk's context is not found.
+func findHunk(lines, before []string, from, hint int) int {
+	if len(before) == 0 {
+		return max(from, min(hint, len(lines)))
+	}
+	for _, equal := range patchMatchers {
+		best := -1
+		for pos := from; pos+len(before) <= len(lines); pos++ {
+			matched := true
+			for j, want := range before {
+				if !equal(lines[pos+j], want) {
+					matched = false
+					break
+				}
+			}
+			if matched && (best < 0 || abs(pos-hint) < abs(best-hint)) {
+				best = pos
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+	}
+	return -1
+}
+
+// findAnchor returns the first line at or after from that matches anchor,
+// or -1 when there is none
+func findAnchor(lines []string, anchor string, from int) int {
+	for _, equal := range patchMatchers {
+		for pos := from; pos < len(lines); pos++ {
+			if equal(lines[pos], anchor) {
+				return pos
+			}
+		}
+	}
+	return -1
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// applyHunks applies the hunks to content, skipping the ones whose context
+// can't be found. It returns the new content and the 1-based numbers of the
+// hunks that failed.
+func applyHunks(content string, hunks []patchHunk) (string, []int) {
+	trailingNewline := content == "" || strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var failed []int
+	from, delta := 0, 0
+	for i, hunk := range hunks {
+		before, after := hunk.split()
+		hint := from
+		if hunk.start > 0 {
+			hint = hunk.start - 1 + delta
+			if len(before) == 0 {
+				// A pure insertion's start is the line it goes after
+				hint++
+			}
+		}
+		start := from
+		if hunk.anchor != "" {
+			// The hunk goes after the anchor line, wherever that is
+			anchor := findAnchor(lines, hunk.anchor, from)
+			if anchor < 0 {
+				failed = append(failed, i+1)
+				continue
+			}
+			start, hint = anchor+1, anchor+1
+		}
+		pos := findHunk(lines, before, start, hint)
+		if pos < 0 {
+			failed = append(failed, i+1)
+			continue
+		}
+		updated := append(append(append([]string{}, lines[:pos]...), after...), lines[pos+len(before):]...)
+		lines = updated
+		from = pos + len(after)
+		delta += len(after) - len(before)
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		result += "\n"
+	}
+	return result, failed
+}
+
+// resolvePatchPath makes path absolute and checks it stays inside root or
+// the additional write directories
+func resolvePatchPath(root, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("patch has a file section without a path")
+	}
+	abspath := path
+	if !filepath.IsAbs(abspath) {
+		abspath = filepath.Join(root, path)
+	}
+	abspath = filepath.Clean(abspath)
+	if !isWritable(root, abspath) {
+		return "", fmt.Errorf("refusing to patch %s: outside the project root %s", path, root)
+	}
+	return abspath, nil
+}
+
+// applyPatch applies a parsed patch to files under root and returns a
+// per-file report of the hunks that applied and failed. Files are only
+// written when at least one of their hunks applied.
+func applyPatch(root string, files []filePatch) (string, error) {
+	// Check every path before touching anything
+	targets := make([]string, len(files))
+	moves := make([]string, len(files))
+	for i, fp := range files {
+		target, err := resolvePatchPath(root, fp.path)
+		if err != nil {
+			return "", err
+		}
+		targets[i] = target
+		if fp.moveTo != "" {
+			if moves[i], err = resolvePatchPath(root, fp.moveTo); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	var report strings.Builder
+	applied := 0
+	for i, fp := range files {
+		target := targets[i]
+		switch fp.op {
+		case patchDelete:
+			if err := os.Remove(target); err != nil {
+				fmt.Fprintf(&report, "%s: delete failed: %v\n", fp.path, err)
+				continue
+			}
+			applied++
+			fmt.Fprintf(&report, "%s: deleted\n", fp.path)
+		case patchAdd:
+			if _, err := os.Stat(target); err == nil {
+				fmt.Fprintf(&report, "%s: add failed: file already exists\n", fp.path)
+				continue
+			}
+			content, _ := applyHunks("", fp.hunks)
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				fmt.Fprintf(&report, "%s: add failed: %v\n", fp.path, err)
+				continue
+			}
+			if err := os.WriteFile(target, []byte(content), 0o644); err != nil {
+				fmt.Fprintf(&report, "%s: add failed: %v\n", fp.path, err)
+				continue
+			}
+			applied++
+			fmt.Fprintf(&report, "%s: created\n", fp.path)
+		default:
+			if moves[i] != "" && moves[i] != target {
+				if _, err := os.Stat(moves[i]); err == nil {
+					fmt.Fprintf(&report, "%s: move to %s failed: file already exists\n", fp.path, fp.moveTo)
+					continue
+				}
+			}
+			data, err := os.ReadFile(target)
+			if err != nil {
+				fmt.Fprintf(&report, "%s: all %d hunks failed: %v\n", fp.path, len(fp.hunks), err)
+				continue
+			}
+			content, failed := applyHunks(string(data), fp.hunks)
+			ok := len(fp.hunks) - len(failed)
+			if ok > 0 {
+				info, _ := os.Stat(target)
+				mode := os.FileMode(0o644)
+				if info != nil {
+					mode = info.Mode().Perm()
+				}
+				if err := os.WriteFile(target, []byte(content), mode); err != nil {
+					fmt.Fprintf(&report, "%s: write failed: %v\n", fp.path, err)
+					continue
+				}
+				applied++
+			}
+			fmt.Fprintf(&report, "%s: %d of %d hunks applied", fp.path, ok, len(fp.hunks))
+			if moves[i] != "" && (ok > 0 || len(fp.hunks) == 0) {
+				if err := os.MkdirAll(filepath.Dir(moves[i]), 0o755); err == nil {
+					err = os.Rename(target, moves[i])
+				}
+				if err != nil {
+					fmt.Fprintf(&report, "; move to %s failed: %v", fp.moveTo, err)
+				} else {
+					if ok == 0 {
+						applied++
+					}
+					fmt.Fprintf(&report, "; moved to %s", fp.moveTo)
+				}
+			}
+			if len(failed) > 0 {
+				noun := "hunks"
+				if len(failed) == 1 {
+					noun = "hunk"
+				}
+				fmt.Fprintf(&report, "; %s %s failed (context not found)", noun, joinInts(failed))
+			}
+			report.WriteString("\n")
+		}
+	}
+
+	if applied == 0 {
+		return "", fmt.Errorf("patch did not apply:\n%s", strings.TrimRight(report.String(), "\n"))
+	}
+	return strings.TrimRight(report.String(), "\n"), nil
+}
+
+// joinInts formats numbers as a comma separated list
+func joinInts(nums []int) string {
+	parts := make([]string, len(nums))
+	for i, n := range nums {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/charmbracelet/bubbles/key"
 	"github.com/charmbracelet/bubbles/textarea"
@@ -18,6 +20,9 @@ const (
 	ViModeCommandLine = "command"
 )
 
+// defaultPlaceholder is shown in an empty prompt unless ui.placeholder is set
+const defaultPlaceholder = "Type your message here..."
+
 // PromptComponent represents the user input text area
 type PromptComponent struct {
 	TextArea       textarea.Model
@@ -36,7 +41,7 @@ type PromptComponent struct {
 // NewPromptComponent creates a new prompt component
 func NewPromptComponent(width, height int) PromptComponent {
 	ta := textarea.New()
-	ta.Placeholder = "Type your message here..."
+	ta.Placeholder = defaultPlaceholder
 	ta.ShowLineNumbers = false
 	ta.Focus()
 
@@ -101,6 +106,7 @@ func NewPromptComponent(width, height int) PromptComponent {
 
 	return PromptComponent{
 		TextArea:       ta,
+		Placeholder:    defaultPlaceholder,
 		Height:         height,
 		Width:          width,
 		ViMode:         false,        // Default to normal mode
@@ -117,6 +123,23 @@ func NewPromptComponent(width, height int) PromptComponent {
 	}
 }
 
+// SetCompact drops the prompt border in the compact layout, or brings it back
+func (p *PromptComponent) SetCompact(compact bool) {
+	if compact {
+		p.Style = p.Style.UnsetBorderStyle()
+	} else {
+		p.Style = p.Style.Border(lipgloss.RoundedBorder())
+	}
+}
+
+// SetPlaceholder changes the text shown in an empty prompt
+func (p *PromptComponent) SetPlaceholder(placeholder string) {
+	p.Placeholder = placeholder
+	if !p.ViMode || p.ViCurrentMode == ViModeInsert {
+		p.TextArea.Placeholder = placeholder
+	}
+}
+
 // SetWidth updates the width of the prompt component
 func (p *PromptComponent) SetWidth(width int) {
 	p.Width = width
@@ -160,14 +183,14 @@ func (p *PromptComponent) SetViMode(enabled bool) {
 		p.ViCurrentMode = ViModeInsert
 		p.TextArea.KeyMap = p.viInsertKeyMap
 		p.viPendingOp = ""
-		p.TextArea.Placeholder = "Type your message here..."
+		p.TextArea.Placeholder = p.Placeholder
 		p.updateViModeStyle()
 	} else {
 		// Return to normal keymap
 		p.ViCurrentMode = ""
 		p.TextArea.KeyMap = p.normalKeyMap
 		p.viPendingOp = ""
-		p.TextArea.Placeholder = "Type your message here..."
+		p.TextArea.Placeholder = p.Placeholder
 		p.Style = p.Style.BorderForeground(lipgloss.Color("#F952F9")) // Terminal7 prompt border (magenta)
 	}
 }
@@ -204,7 +227,7 @@ func (p *PromptComponent) EnterViInsertMode() {
 	p.ViCurrentMode = ViModeInsert
 	p.viPendingOp = ""
 	p.TextArea.KeyMap = p.viInsertKeyMap
-	p.TextArea.Placeholder = "Type your message here..."
+	p.TextArea.Placeholder = p.Placeholder
 	p.updateViModeStyle()
 }
 
@@ -481,6 +504,48 @@ func (p *PromptComponent) deleteWordForward() (bool, tea.Cmd) {
 	return true, nil
 }
 
+// expandSnippetBeforeCursor replaces the leader+key word that ends at the
+// cursor with its expansion, leaving the cursor right after the expansion
+func (p *PromptComponent) expandSnippetBeforeCursor(leader string, snippets map[string]string) {
+	if leader == "" || len(snippets) == 0 {
+		return
+	}
+	lines := strings.Split(p.TextArea.Value(), "\n")
+	row := p.TextArea.Line()
+	if row >= len(lines) {
+		return
+	}
+	line := []rune(lines[row])
+	lineInfo := p.TextArea.LineInfo()
+	col := min(lineInfo.StartColumn+lineInfo.ColumnOffset, len(line))
+	before, after := string(line[:col]), string(line[col:])
+
+	start := len(before)
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(before[:start])
+		if unicode.IsSpace(r) {
+			break
+		}
+		start -= size
+	}
+	word := before[start:]
+	expansion, ok := snippets[strings.TrimPrefix(word, leader)]
+	if !ok || !strings.HasPrefix(word, leader) {
+		return
+	}
+	expanded := before[:start] + expansion
+	lines[row] = expanded + after
+	p.TextArea.SetValue(strings.Join(lines, "\n"))
+
+	// SetValue leaves the cursor at the end of the text
+	expandedLines := strings.Split(expanded, "\n")
+	targetRow := row + len(expandedLines) - 1
+	for p.TextArea.Line() > targetRow {
+		p.TextArea.CursorUp()
+	}
+	p.TextArea.SetCursor(utf8.RuneCountInString(expandedLines[len(expandedLines)-1]))
+}
+
 // Update handles messages for the prompt component
 func (p PromptComponent) Update(msg interface{}) (PromptComponent, tea.Cmd) {
 	var cmd tea.Cmd
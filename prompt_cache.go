@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+)
+
+// promptCaching reports whether requests mark a cache breakpoint for the
+// provider. Only anthropic takes cache markers; OpenAI caches long prompts
+// on its own.
+func (s *Session) promptCaching() bool {
+	return s.config != nil && s.config.PromptCaching && s.config.Provider == "anthropic"
+}
+
+// withCacheBreakpoint returns messages with the newest prompt marked as a
+// cache breakpoint. Anthropic caches everything before the marker - the
+// tools, the system prompt and the history up to and including the context
+// files sent with the prompt - so the following requests of the turn, and
+// the next turn, read that prefix from the cache. messages is not modified.
+func withCacheBreakpoint(messages []llms.MessageContent) []llms.MessageContent {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role != llms.ChatMessageTypeHuman {
+			continue
+		}
+		parts := messages[i].Parts
+		if len(parts) == 0 {
+			return messages
+		}
+		last := parts[len(parts)-1]
+		switch last.(type) {
+		case llms.TextContent, llms.BinaryContent:
+		default:
+			return messages
+		}
+		parts = slices.Clone(parts)
+		parts[len(parts)-1] = llms.WithCacheControl(last, anthropic.EphemeralCache())
+		messages = slices.Clone(messages)
+		messages[i].Parts = parts
+		return messages
+	}
+	return messages
+}
@@ -171,3 +171,29 @@ func TestArrowKeysInInsertMode(t *testing.T) {
 		t.Error("Should still be in insert mode after left arrow")
 	}
 }
+
+// TestExpandSnippetBeforeCursor tests that only the word before the cursor
+// expands and the cursor stays right after the expansion
+func TestExpandSnippetBeforeCursor(t *testing.T) {
+	snippets := map[string]string{"lgtm": "Looks good,\ncommit it."}
+	prompt := NewPromptComponent(80, 5)
+	prompt.SetValue(";lgtm ;lgtm\nthe end")
+	prompt.TextArea.CursorUp()
+	prompt.TextArea.SetCursor(len(";lgtm"))
+
+	prompt.expandSnippetBeforeCursor(";", snippets)
+	if got := prompt.Value(); got != "Looks good,\ncommit it. ;lgtm\nthe end" {
+		t.Fatalf("Unexpected expansion %q", got)
+	}
+	prompt.TextArea.InsertString("!")
+	if got := prompt.Value(); got != "Looks good,\ncommit it.! ;lgtm\nthe end" {
+		t.Fatalf("Expected the cursor after the expansion, got %q", got)
+	}
+
+	// A word ending in a multi-byte rune is not cut at one of its bytes
+	prompt.SetValue("à;lgtm")
+	prompt.expandSnippetBeforeCursor(";", snippets)
+	if got := prompt.Value(); got != "à;lgtm" {
+		t.Fatalf("Expected no expansion inside a word, got %q", got)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// maxRawHistory is the most raw history entries saved with a session,
+	// the oldest are dropped first
+	maxRawHistory = 1000
+	// maxRawEntryLen is the most bytes of a raw history entry saved
+	maxRawEntryLen = 4000
+)
+
+// unsavedRawPrefixes are raw history entries not saved with the session:
+// the chunks add up to the response, which is saved whole
+var unsavedRawPrefixes = []string{"STREAM_CHUNK"}
+
+// AddRawHistory records an entry of the raw history (Ctrl+O) so that it is
+// saved with the session and shown again on resume
+func (s *Session) AddRawHistory(prefix, entry string) {
+	if slices.Contains(unsavedRawPrefixes, prefix) {
+		return
+	}
+	if len(entry) > maxRawEntryLen {
+		cut := maxRawEntryLen
+		for cut > 0 && !utf8.RuneStart(entry[cut]) {
+			cut--
+		}
+		entry = entry[:cut] + fmt.Sprintf("... [%d bytes truncated]", len(entry)-cut)
+	}
+	defer s.lockMessages()()
+	s.RawHistory = append(s.RawHistory, entry)
+	if over := len(s.RawHistory) - maxRawHistory; over > 0 {
+		s.RawHistory = slices.Delete(s.RawHistory, 0, over)
+	}
+}
+
+// resumedRawHistory returns the raw history of a saved session. Sessions
+// saved before the raw history was kept get one rebuilt from their
+// messages, without timestamps.
+func resumedRawHistory(saved *Session) []string {
+	if len(saved.RawHistory) > 0 {
+		return slices.Clone(saved.RawHistory)
+	}
+	var entries []string
+	add := func(prefix, content string) {
+		entries = append(entries, fmt.Sprintf("[--:--:--] %s: %s", prefix, content))
+	}
+	for _, msg := range saved.Messages {
+		for _, part := range msg.Parts {
+			switch part := part.(type) {
+			case llms.TextContent:
+				switch msg.Role {
+				case llms.ChatMessageTypeHuman:
+					add("USER", part.Text)
+				case llms.ChatMessageTypeAI:
+					add("AI_RESPONSE", part.Text)
+				}
+			case llms.ToolCall:
+				if part.FunctionCall != nil {
+					add("TOOL_SCHEDULED", fmt.Sprintf("%s with input: %s", part.FunctionCall.Name, part.FunctionCall.Arguments))
+				}
+			case llms.ToolCallResponse:
+				add("TOOL_SUCCESS", fmt.Sprintf("%s\nOutput: %s", part.Name, part.Content))
+			}
+		}
+	}
+	return entries
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
@@ -22,6 +23,42 @@ type sessionResumeErrorMsg struct {
 	err error
 }
 
+// recentSessionMsg offers to resume a session updated shortly before startup
+type recentSessionMsg struct {
+	session Session
+}
+
+// recentSessionWindow is how recently a session must have been updated to be offered on startup
+const recentSessionWindow = time.Hour
+
+// checkRecentSession looks for a session of the current project updated within recentSessionWindow
+func checkRecentSession(store *SessionStore) tea.Cmd {
+	if store == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		sessions, err := store.ListSessions(1)
+		if err != nil || len(sessions) == 0 {
+			return nil
+		}
+		if time.Since(sessions[0].LastUpdated) > recentSessionWindow {
+			return nil
+		}
+		return recentSessionMsg{session: sessions[0]}
+	}
+}
+
+// resumeSession loads a stored session by ID
+func resumeSession(store *SessionStore, id string) tea.Cmd {
+	return func() tea.Msg {
+		session, err := store.LoadSession(id)
+		if err != nil {
+			return sessionResumeErrorMsg{err: fmt.Errorf("failed to load session: %w", err)}
+		}
+		return sessionSelectedMsg{session: session}
+	}
+}
+
 type SessionSelectionModal struct {
 	*BaseModal
 	sessions     []Session
@@ -58,7 +95,10 @@ func (m *SessionSelectionModal) SetError(err error) {
 }
 
 func sessionTitlePreview(session Session) string {
-	snippet := lastHumanMessage(session.Messages)
+	snippet := session.LastPrompt
+	if snippet == "" {
+		snippet = lastHumanMessage(session.Messages)
+	}
 	if snippet == "" {
 		snippet = session.FirstPrompt
 	}
@@ -127,14 +167,28 @@ func truncateSnippet(text string, limit int) string {
 	return string(runes[:limit-3]) + "..."
 }
 
-func formatMessageCount(messages []llms.MessageContent) string {
+// countChatMessages counts the prompts and answers, leaving out system and
+// tool messages
+func countChatMessages(messages []llms.MessageContent) int {
 	count := 0
 	for _, msg := range messages {
 		if msg.Role == llms.ChatMessageTypeHuman || msg.Role == llms.ChatMessageTypeAI {
 			count++
 		}
 	}
+	return count
+}
+
+// sessionMessageCount returns the prompts and answers of a listed session,
+// counted from its messages for index entries written before they were left out
+func sessionMessageCount(session Session) int {
+	if session.MessageCount > 0 || session.Messages == nil {
+		return session.MessageCount
+	}
+	return countChatMessages(session.Messages)
+}
 
+func formatMessageCount(count int) string {
 	if count == 0 {
 		return ""
 	}
@@ -243,7 +297,7 @@ func (m *SessionSelectionModal) Render() string {
 		timeStr := formatRelativeTime(session.LastUpdated)
 
 		title := sessionTitlePreview(session)
-		messageCount := formatMessageCount(session.Messages)
+		messageCount := formatMessageCount(sessionMessageCount(session))
 		modelName := shortenModelName(session.Model)
 
 		var detailParts []string
@@ -368,7 +422,7 @@ func (m *SessionSelectionModal) loadSelectedSession() tea.Cmd {
 			maxAgeDays = config.Session.MaxAgeDays
 		}
 
-		store, err := NewSessionStore(maxSessions, maxAgeDays)
+		store, err := NewSessionStore(maxSessions, maxAgeDays, config.Session.StorageDir)
 		if err != nil {
 			return sessionResumeErrorMsg{err: fmt.Errorf("failed to create session store: %w", err)}
 		}
@@ -540,3 +540,40 @@ func TestSessionSelectionModalLifecycle(t *testing.T) {
 		assert.Contains(t, output, "Test prompt")
 	})
 }
+
+func TestCheckRecentSession(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	store, err := NewSessionStore(50, 30, "")
+	require.NoError(t, err)
+	require.Nil(t, checkRecentSession(nil))
+	require.Nil(t, checkRecentSession(store)())
+
+	store.SaveSession(&Session{
+		Messages: []llms.MessageContent{
+			{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{llms.TextContent{Text: "Hello"}}},
+		},
+	})
+	store.Flush()
+
+	msg, ok := checkRecentSession(store)().(recentSessionMsg)
+	require.True(t, ok)
+
+	loaded, ok := resumeSession(store, msg.session.ID)().(sessionSelectedMsg)
+	require.True(t, ok)
+	require.Len(t, loaded.session.Messages, 1)
+
+	// Typing instead of answering cancels the offer and says so
+	model, _ := newTestModel(t)
+	model.prompt.SetViMode(false)
+	updated, _ := model.Update(msg)
+	m := updated.(TUIModel)
+	require.NotNil(t, m.confirm)
+	updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'h'}})
+	m = updated.(TUIModel)
+	require.Nil(t, m.confirm)
+	require.Nil(t, cmd)
+	require.Len(t, m.toastManager.Toasts, 1)
+	require.Contains(t, m.toastManager.Toasts[0].Message, "Cancelled: Resume last session")
+	require.Equal(t, "h", m.prompt.Value())
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// writeReview is a write_file call waiting for the user's decision
+type writeReview struct {
+	Path     string
+	Original string // Current content, empty for a new file
+	Proposed string
+}
+
+// writeReviewReply is the user's decision on a proposed write
+type writeReviewReply struct {
+	Apply   bool
+	Content string // What to write: the proposed content unless the user edited it
+}
+
+// writeReviewer asks the user about a proposed write and waits for the answer
+type writeReviewer func(ctx context.Context, review writeReview) (writeReviewReply, error)
+
+// writeReviewMsg asks the TUI to review a proposed write. The answer goes
+// back on reply.
+type writeReviewMsg struct {
+	review writeReview
+	reply  chan writeReviewReply
+}
+
+// sendWriteReview hands a proposed write to the TUI and waits for the
+// user's answer. Without a TUI the write is applied as proposed.
+func sendWriteReview(ctx context.Context, review writeReview) (writeReviewReply, error) {
+	if program == nil {
+		return writeReviewReply{Apply: true, Content: review.Proposed}, nil
+	}
+	reply := make(chan writeReviewReply, 1)
+	program.Send(writeReviewMsg{review: review, reply: reply})
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-ctx.Done():
+		return writeReviewReply{}, ctx.Err()
+	}
+}
+
+// SetWriteReviewer sets who reviews file writes when review_writes is on
+func (s *Session) SetWriteReviewer(reviewer writeReviewer) {
+	s.writeReviewer = reviewer
+}
+
+// reviewsWrites reports whether write_file calls wait for the user's review
+func (s *Session) reviewsWrites() bool {
+	return s.writeReviewer != nil && s.config != nil && s.config.ReviewWrites
+}
+
+// reviewWriteCall lets the user apply, edit or reject a write_file call. It
+// returns the arguments to run the call with and a note telling the model
+// what was written when the user changed it. When the write is rejected,
+// ok is false and the note is the tool response.
+func (s *Session) reviewWriteCall(ctx context.Context, argsJSON string) (args, note string, ok bool) {
+	var params WriteFileInput
+	if err := json.Unmarshal([]byte(argsJSON), &params); err != nil || params.Path == "" {
+		// Let the tool report the bad arguments
+		return argsJSON, "", true
+	}
+	review := writeReview{Path: params.Path, Proposed: params.Content}
+	if data, err := os.ReadFile(resolveFileRef(params.Path)); err == nil {
+		review.Original = string(data)
+	}
+
+	reply, err := s.writeReviewer(ctx, review)
+	if err != nil {
+		return "", fmt.Sprintf("The write to %s was not applied: %v", params.Path, err), false
+	}
+	if !reply.Apply {
+		return "", fmt.Sprintf("The user rejected the write to %s. The file was not changed.", params.Path), false
+	}
+	if reply.Content == params.Content {
+		return argsJSON, "", true
+	}
+
+	params.Content = reply.Content
+	edited, err := json.Marshal(params)
+	if err != nil {
+		return "", fmt.Sprintf("The write to %s was not applied: %v", params.Path, err), false
+	}
+	note = fmt.Sprintf("The user edited the content before it was written. %s now contains:\n```\n%s\n```",
+		params.Path, strings.TrimRight(reply.Content, "\n"))
+	return string(edited), note, true
+}
+
+// diffContextLines is how many unchanged lines renderLineDiff keeps around
+// each change
+const diffContextLines = 3
+
+// renderLineDiff shows the lines removed (-) and added (+) going from old to
+// current, with a few unchanged lines around each change
+func renderLineDiff(old, current string) string {
+	dmp := diffmatchpatch.New()
+	a, b, lines := dmp.DiffLinesToRunes(old, current)
+	diffs := dmp.DiffCharsToLines(dmp.DiffMainRunes(a, b, false), lines)
+
+	var out []string
+	for i, d := range diffs {
+		text := strings.Split(strings.TrimSuffix(d.Text, "\n"), "\n")
+		switch d.Type {
+		case diffmatchpatch.DiffInsert:
+			for _, line := range text {
+				out = append(out, "+ "+line)
+			}
+		case diffmatchpatch.DiffDelete:
+			for _, line := range text {
+				out = append(out, "- "+line)
+			}
+		default:
+			// Keep context after the previous change and before the next one
+			var head, tail []string
+			if i > 0 {
+				head = text[:min(diffContextLines, len(text))]
+			}
+			if i < len(diffs)-1 {
+				tail = text[max(len(text)-diffContextLines, 0):]
+			}
+			if len(head)+len(tail) >= len(text) {
+				head, tail = text, nil
+			} else {
+				head = append(head, "…")
+			}
+			for _, line := range append(head, tail...) {
+				if line == "…" {
+					out = append(out, "  …")
+				} else {
+					out = append(out, "  "+line)
+				}
+			}
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// showWriteReview adds the diff of a proposed write to the chat and waits
+// for the user to apply, edit or reject it
+func (m *TUIModel) showWriteReview(msg writeReviewMsg) {
+	m.writeReview = &msg
+	diff := renderLineDiff(msg.review.Original, msg.review.Proposed)
+	if diff == "" {
+		diff = "(no changes)"
+	}
+	m.chat.AddMessage(fmt.Sprintf("📝 Proposed write to %s:\n```diff\n%s\n```", msg.review.Path, diff))
+	m.toastManager.AddToast(fmt.Sprintf("Apply write to %s? (y)es, (e)dit in $EDITOR, (n)o", msg.review.Path), "info", 10*time.Minute)
+}
+
+// answerWriteReview handles a key press while a write waits for review.
+// It returns false for keys that don't answer it.
+func (m *TUIModel) answerWriteReview(key string) (tea.Cmd, bool) {
+	review := m.writeReview
+	switch key {
+	case "y", "Y":
+		review.reply <- writeReviewReply{Apply: true, Content: review.review.Proposed}
+	case "n", "N", "esc":
+		review.reply <- writeReviewReply{}
+		m.toastManager.AddToast(fmt.Sprintf("Write to %s rejected", review.review.Path), "info", 3000)
+	case "e", "E":
+		m.writeReview = nil
+		m.toastManager.Clear()
+		return m.editWriteReview(*review), true
+	default:
+		return nil, false
+	}
+	m.writeReview = nil
+	m.toastManager.Clear()
+	return nil, true
+}
+
+// editWriteReview opens the proposed content in $EDITOR and applies what
+// the user saves. If the editor fails the review is asked again.
+func (m *TUIModel) editWriteReview(review writeReviewMsg) tea.Cmd {
+	tmp, err := os.CreateTemp("", "asimi-review-*"+filepath.Ext(review.review.Path))
+	if err == nil {
+		_, err = tmp.WriteString(review.review.Proposed)
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return func() tea.Msg { return writeReviewRetryMsg{review: review, err: err} }
+	}
+
+	return tea.ExecProcess(openInEditor(tmp.Name()), func(err error) tea.Msg {
+		defer os.Remove(tmp.Name())
+		if err != nil {
+			return writeReviewRetryMsg{review: review, err: fmt.Errorf("editor exited with error: %w", err)}
+		}
+		data, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return writeReviewRetryMsg{review: review, err: err}
+		}
+		review.reply <- writeReviewReply{Apply: true, Content: string(data)}
+		if string(data) != review.review.Proposed {
+			return showContextMsg{content: fmt.Sprintf("Wrote your edited version of %s", review.review.Path)}
+		}
+		return nil
+	})
+}
+
+// writeReviewRetryMsg asks about a write again after editing it failed
+type writeReviewRetryMsg struct {
+	review writeReviewMsg
+	err    error
+}
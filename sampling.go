@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// maxStopSequences is the most stop sequences openai accepts in a request
+const maxStopSequences = 4
+
+// maxTemperature returns the highest temperature the provider accepts
+func maxTemperature(provider string) float64 {
+	if provider == "anthropic" {
+		return 1
+	}
+	return 2
+}
+
+// clampTemperature keeps a temperature within the provider's range
+func clampTemperature(provider string, t float64) float64 {
+	return min(max(t, 0), maxTemperature(provider))
+}
+
+// clampTopP keeps top_p within 0-1
+func clampTopP(p float64) float64 {
+	return min(max(p, 0), 1)
+}
+
+// isFinite reports whether a sampling setting is a usable number, neither NaN nor infinite
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// samplingOptions returns the temperature, top_p and stop sequence options
+// set in the config, clamped to what the provider accepts. Settings left
+// unset or not finite use the provider's defaults.
+func (s *Session) samplingOptions() []llms.CallOption {
+	if s.config == nil {
+		return nil
+	}
+	var opts []llms.CallOption
+	if s.config.Temperature != nil && isFinite(*s.config.Temperature) {
+		opts = append(opts, llms.WithTemperature(clampTemperature(s.Provider, *s.config.Temperature)))
+	}
+	if s.config.TopP != nil && isFinite(*s.config.TopP) {
+		opts = append(opts, llms.WithTopP(clampTopP(*s.config.TopP)))
+	}
+	if stop := s.config.Stop; len(stop) > 0 {
+		if s.Provider == "openai" && len(stop) > maxStopSequences {
+			stop = stop[:maxStopSequences]
+		}
+		opts = append(opts, llms.WithStopWords(stop))
+	}
+	return opts
+}
+
+// formatSampling describes the sampling settings for /set
+func formatSampling(cfg *LLMConfig) string {
+	value := func(v *float64) string {
+		if v == nil {
+			return "provider default"
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	stop := "none"
+	if len(cfg.Stop) > 0 {
+		quoted := make([]string, len(cfg.Stop))
+		for i, seq := range cfg.Stop {
+			quoted[i] = strconv.Quote(seq)
+		}
+		stop = strings.Join(quoted, " ")
+	}
+	return fmt.Sprintf("temperature: %s\ntop_p: %s\nstop: %s", value(cfg.Temperature), value(cfg.TopP), stop)
+}
+
+// parseStopSequence reads a stop sequence typed in /set, where escapes
+// like \n stand for the characters they name
+func parseStopSequence(arg string) string {
+	if unquoted, err := strconv.Unquote(`"` + arg + `"`); err == nil {
+		return unquoted
+	}
+	return arg
+}
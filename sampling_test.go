@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplingOptions(t *testing.T) {
+	float := func(v float64) *float64 { return &v }
+	options := func(cfg LLMConfig) *capturingLLM {
+		llm := &capturingLLM{}
+		sess, err := NewSession(llm, &Config{LLM: cfg}, func(any) {})
+		require.NoError(t, err)
+		sess.Provider = cfg.Provider
+		_, err = sess.Ask(context.Background(), "hi")
+		require.NoError(t, err)
+		return llm
+	}
+
+	// Unset settings leave the provider's defaults alone
+	llm := options(LLMConfig{Provider: "openai"})
+	assert.Zero(t, llm.options.Temperature)
+	assert.Empty(t, llm.options.StopWords)
+
+	llm = options(LLMConfig{Provider: "openai", Temperature: float(0.7), TopP: float(0.9), Stop: []string{"END"}})
+	assert.Equal(t, 0.7, llm.options.Temperature)
+	assert.Equal(t, 0.9, llm.options.TopP)
+	assert.Equal(t, []string{"END"}, llm.options.StopWords)
+
+	// Out of range values are clamped to what the provider accepts
+	llm = options(LLMConfig{Provider: "anthropic", Temperature: float(1.5), TopP: float(3)})
+	assert.Equal(t, 1.0, llm.options.Temperature)
+	assert.Equal(t, 1.0, llm.options.TopP)
+	llm = options(LLMConfig{Provider: "openai", Temperature: float(5), Stop: []string{"a", "b", "c", "d", "e"}})
+	assert.Equal(t, 2.0, llm.options.Temperature)
+	assert.Len(t, llm.options.StopWords, maxStopSequences)
+
+	// NaN and infinite values from the config are ignored
+	llm = options(LLMConfig{Provider: "openai", Temperature: float(math.NaN()), TopP: float(math.Inf(1))})
+	assert.Zero(t, llm.options.Temperature)
+	assert.Zero(t, llm.options.TopP)
+}
+
+func TestSetCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	cfg := &model.config.LLM
+
+	handleSetCommand(model, []string{"temperature", "0"})
+	require.NotNil(t, cfg.Temperature)
+	assert.Zero(t, *cfg.Temperature)
+
+	cmd := handleSetCommand(model, []string{"stop", `\n\nUser:`, "END"})
+	assert.Equal(t, []string{"\n\nUser:", "END"}, cfg.Stop)
+	msg, ok := cmd().(showContextMsg)
+	require.True(t, ok)
+	assert.Contains(t, msg.content, "temperature: 0\n")
+	assert.Contains(t, msg.content, `stop: "\n\nUser:" "END"`)
+
+	handleSetCommand(model, []string{"temperature", "default"})
+	handleSetCommand(model, []string{"stop", "default"})
+	assert.Nil(t, cfg.Temperature)
+	assert.Nil(t, cfg.Stop)
+
+	assert.Nil(t, handleSetCommand(model, []string{"temperature", "hot"}))
+	assert.Nil(t, cfg.Temperature)
+	assert.Nil(t, handleSetCommand(model, []string{"temperature", "NaN"}))
+	assert.Nil(t, handleSetCommand(model, []string{"top_p", "-Inf"}))
+	assert.Nil(t, cfg.Temperature)
+	assert.Nil(t, cfg.TopP)
+}
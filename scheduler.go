@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"sync"
 
@@ -22,6 +23,9 @@ const (
 	StatusCancelled          ToolCallStatus = "cancelled"
 )
 
+// errToolInterrupted is reported to the model when the user interrupts a running tool
+var errToolInterrupted = errors.New("tool execution interrupted by user")
+
 // ToolCall represents a single tool call task
 type ToolCall struct {
 	ID     string
@@ -30,6 +34,8 @@ type ToolCall struct {
 	Status ToolCallStatus
 	Result string
 	Error  error
+
+	cancel context.CancelFunc // Cancels the tool's context while it is executing
 }
 
 // ToolCallResult is used to send the result of a tool call back to the caller
@@ -95,7 +101,9 @@ func (s *CoreToolScheduler) processQueue() {
 	call := s.queue[0]
 	s.queue = s.queue[1:]
 
+	ctx, cancel := context.WithCancel(context.Background())
 	call.Status = StatusExecuting
+	call.cancel = cancel
 	if s.notify != nil {
 		s.notify(ToolCallExecutingMsg{Call: call})
 	}
@@ -105,14 +113,43 @@ func (s *CoreToolScheduler) processQueue() {
 		// The toolWrapper's Call method is what schedules the tool.
 		// This means the tool passed to Schedule should be the unwrapped tool.
 		slog.Info("scheduler.exec", "tool", call.Tool.Name())
-		output, err := call.Tool.Call(context.Background(), call.Input)
+		type outcome struct {
+			output string
+			err    error
+		}
+		done := make(chan outcome, 1)
+		go func() {
+			output, err := call.Tool.Call(ctx, call.Input)
+			done <- outcome{output, err}
+		}()
+
+		// Don't wait for tools that ignore their context once interrupted
+		var output string
+		var err error
+		select {
+		case res := <-done:
+			output, err = res.output, res.err
+		case <-ctx.Done():
+		}
+		interrupted := ctx.Err() != nil
+		cancel()
 
 		s.mu.Lock()
 		defer s.mu.Unlock()
 
+		call.cancel = nil
 		resultChan := s.resultChans[call.ID]
 
-		if err != nil {
+		if interrupted {
+			call.Status = StatusCancelled
+			call.Error = errToolInterrupted
+			if s.notify != nil {
+				s.notify(ToolCallErrorMsg{Call: call})
+			}
+			if resultChan != nil {
+				resultChan <- ToolCallResult{Error: errToolInterrupted}
+			}
+		} else if err != nil {
 			call.Status = StatusError
 			call.Error = err
 			if s.notify != nil {
@@ -141,6 +178,24 @@ func (s *CoreToolScheduler) processQueue() {
 	}()
 }
 
+// CancelRunning interrupts the tool calls that are currently executing, leaving
+// queued calls and the surrounding stream untouched. It reports whether any
+// tool was interrupted.
+func (s *CoreToolScheduler) CancelRunning() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cancelled := false
+	for _, call := range s.toolCalls {
+		if call.Status == StatusExecuting && call.cancel != nil {
+			slog.Info("scheduler.interrupt", "tool", call.Tool.Name())
+			call.cancel()
+			cancelled = true
+		}
+	}
+	return cancelled
+}
+
 // Messages for bubbletea
 type ToolCallScheduledMsg struct{ Call *ToolCall }
 type ToolCallExecutingMsg struct{ Call *ToolCall }
@@ -96,3 +96,40 @@ func TestCoreToolScheduler(t *testing.T) {
 	_, ok = model.messages[2].(ToolCallSuccessMsg)
 	assert.True(t, ok)
 }
+
+func TestCoreToolSchedulerCancelRunning(t *testing.T) {
+	scheduler := NewCoreToolScheduler(nil)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	tool := &mockTool{
+		name: "hung-tool",
+		callFunc: func(ctx context.Context, input string) (string, error) {
+			close(started)
+			// Ignore ctx on purpose: the scheduler must not wait for us
+			<-release
+			return "too late", nil
+		},
+	}
+
+	resultChan := scheduler.Schedule(tool, "{}")
+	<-started
+	assert.True(t, scheduler.CancelRunning())
+
+	select {
+	case result := <-resultChan:
+		assert.ErrorIs(t, result.Error, errToolInterrupted)
+	case <-time.After(time.Second):
+		t.Fatal("interrupted tool call did not return")
+	}
+
+	// The next call runs normally after an interruption
+	next := &mockTool{name: "next", callFunc: func(ctx context.Context, input string) (string, error) {
+		return "ok", nil
+	}}
+	result := <-scheduler.Schedule(next, "{}")
+	assert.NoError(t, result.Error)
+	assert.Equal(t, "ok", result.Output)
+	assert.False(t, scheduler.CancelRunning())
+}
@@ -7,20 +7,30 @@ import (
 	_ "embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
+	"maps"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	debug "runtime/debug"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
 	"github.com/tmc/langchaingo/prompts"
 	lctools "github.com/tmc/langchaingo/tools"
 )
@@ -40,9 +50,14 @@ type Session struct {
 	Model       string    `json:"model"`
 	WorkingDir  string    `json:"working_dir"`
 	ProjectSlug string    `json:"project_slug,omitempty"`
+	// Set only in index.json entries, which leave out the messages
+	LastPrompt   string `json:"last_prompt,omitempty"`
+	MessageCount int    `json:"message_count,omitempty"`
 
 	Messages     []llms.MessageContent `json:"messages"`
 	ContextFiles map[string]string     `json:"context_files"`
+	RawHistory   []string              `json:"raw_history,omitempty"` // Entries of the raw view (Ctrl+O), without streaming chunks
+	Prompts      []sessionPrompt       `json:"prompts,omitempty"`     // The prompts as the user typed them, before context was added
 	messages     []llms.MessageContent `json:"-"`
 
 	llm                     llms.Model              `json:"-"`
@@ -55,6 +70,36 @@ type Session struct {
 	accumulatedContent      strings.Builder         `json:"-"`
 	config                  *LLMConfig              `json:"-"`
 	startTime               time.Time               `json:"-"`
+	pendingImages           []llms.ContentPart      `json:"-"` // Images attached to the next prompt
+	pendingContext          map[string]string       `json:"-"` // Files sent with the next prompt only
+	readOnly                bool                    `json:"-"` // Mutating tools are withheld from the model
+	compactToolOutput       int                     `json:"-"` // Prompts whose tool outputs are kept in full, 0 keeps all
+	toolOverrides           map[string]ToolConfig   `json:"-"` // Per-tool settings from the [tools] config
+	writeReviewer           writeReviewer           `json:"-"` // Asks the user about write_file calls when review_writes is on
+	externalEditConfirmer   externalEditConfirmer   `json:"-"` // Asks the user before writing over files changed outside the session
+	responseDetails         bool                    `json:"-"` // Report each response's stop reason, usage and tool calls (/verbose)
+	messagesMu              *sync.RWMutex           `json:"-"` // Guards messages, Messages, RawHistory and Prompts, written by the streaming goroutine while the TUI reads them
+	readCache               map[string]cachedRead   `json:"-"` // Read tool results for the current turn, by tool call key
+	turnFiles               map[string]*string      `json:"-"` // Content before the current turn of the files it changed, nil for new files
+	fileTimes               map[string]time.Time    `json:"-"` // Modification time of each file when the agent last read or wrote it
+	lastFile                string                  `json:"-"` // File the agent last read or wrote whole, opened by alt+e
+	checkpoint              *sessionCheckpoint      `json:"-"` // Save point set with /checkpoint
+	thinking                thinkingUsage           `json:"-"` // Tokens spent thinking and answering, for /think-budget
+	toolFallback            int                     `json:"-"` // Tool options the provider rejected: 1 without tool_choice, 2 without tools
+}
+
+// cachedRead is a read tool result kept for the rest of the turn. path is the
+// file or directory it covers, empty when it can't be pinned to one path.
+type cachedRead struct {
+	path   string
+	output string
+}
+
+// cacheableTools are read tools whose results can be reused within a turn
+var cacheableTools = map[string]bool{
+	"read_file":       true,
+	"list_files":      true,
+	"read_many_files": true,
 }
 
 // formatMetadata returns the metadata header used by export helpers.
@@ -89,6 +134,38 @@ func (s *Session) syncMessages() {
 	s.Messages = s.messages
 }
 
+// lockMessages locks the message history for changes and returns the unlock
+func (s *Session) lockMessages() func() {
+	if s.messagesMu == nil {
+		return func() {}
+	}
+	s.messagesMu.Lock()
+	return s.messagesMu.Unlock
+}
+
+// rlockMessages locks the message history for reading and returns the unlock
+func (s *Session) rlockMessages() func() {
+	if s.messagesMu == nil {
+		return func() {}
+	}
+	s.messagesMu.RLock()
+	return s.messagesMu.RUnlock
+}
+
+// addMessages adds messages to the history
+func (s *Session) addMessages(msgs ...llms.MessageContent) {
+	defer s.lockMessages()()
+	s.messages = append(s.messages, msgs...)
+	s.syncMessages()
+}
+
+// MessagesSnapshot returns a copy of the message history that stays valid
+// while a response streams
+func (s *Session) MessagesSnapshot() []llms.MessageContent {
+	defer s.rlockMessages()()
+	return slices.Clone(s.Messages)
+}
+
 // resetStreamBuffer safely resets the accumulated content buffer
 func (s *Session) resetStreamBuffer() {
 	s.accumulatedContent.Reset()
@@ -111,22 +188,246 @@ type streamInterruptedMsg struct{ partialContent string }
 type streamErrorMsg struct{ err error }
 type streamMaxTurnsExceededMsg struct{ maxTurns int }
 type streamMaxTokensReachedMsg struct{ content string }
+type llmTraceMsg string        // Compact per-request trace shown in raw mode when verbose
+type responseDetailsMsg string // Stop reason, usage and tool calls of a response, shown under it by /verbose
+
+// Phase messages mark what a streamed turn is doing, so the TUI can tell the
+// model's responses apart from the tool calls between them
+type thinkingPhaseStartMsg struct{}        // Waiting for the model's next response
+type assistantTextStartMsg struct{}        // The model started writing text in this response
+type toolPhaseStartMsg struct{ count int } // The response asked for tools, which run next
+
+// ToolCallArgsChunkMsg reports a tool call whose arguments are still streaming in
+type ToolCallArgsChunkMsg struct {
+	Name    string
+	ArgsLen int // Bytes of arguments received so far
+}
+
+// parseToolCallChunk recognizes the tool call deltas OpenAI-compatible
+// providers pass to the streaming func, returning the tool name (empty on
+// argument-only deltas) and the argument fragment.
+func parseToolCallChunk(chunk []byte) (name, args string, ok bool) {
+	if len(chunk) < 2 || chunk[0] != '[' || chunk[1] != '{' {
+		return "", "", false
+	}
+	var deltas []struct {
+		Function struct {
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(chunk, &deltas); err != nil || len(deltas) == 0 {
+		return "", "", false
+	}
+	for _, d := range deltas {
+		if d.Function.Name != "" {
+			name = d.Function.Name
+		}
+		args += d.Function.Arguments
+	}
+	if name == "" && args == "" {
+		return "", "", false
+	}
+	return name, args, true
+}
+
+// LLMErrorKind classifies failures returned by LLM providers
+type LLMErrorKind string
+
+const (
+	LLMErrorAuth          LLMErrorKind = "auth"
+	LLMErrorRateLimit     LLMErrorKind = "rate_limit"
+	LLMErrorContextLength LLMErrorKind = "context_length"
+	LLMErrorNetwork       LLMErrorKind = "network"
+	LLMErrorInvalidModel  LLMErrorKind = "invalid_model"
+	LLMErrorTimeout       LLMErrorKind = "timeout"
+	LLMErrorUnknown       LLMErrorKind = "unknown"
+)
+
+// LLMError wraps a provider error with a user-friendly message and a suggested action
+type LLMError struct {
+	Kind    LLMErrorKind
+	Message string
+	Action  string
+	Err     error
+}
+
+func (e *LLMError) Error() string {
+	if e.Action == "" {
+		return e.Message
+	}
+	return e.Message + " " + e.Action
+}
+
+func (e *LLMError) Unwrap() error {
+	return e.Err
+}
+
+// classifyLLMError turns a raw provider error into an LLMError. Errors already
+// classified are returned as is.
+func classifyLLMError(err error) *LLMError {
+	if err == nil {
+		return nil
+	}
+	var llmErr *LLMError
+	if errors.As(err, &llmErr) {
+		return llmErr
+	}
+
+	kind := llmErrorKind(err)
+	switch kind {
+	case LLMErrorAuth:
+		return &LLMError{Kind: kind, Err: err, Message: "Authentication with the provider failed.", Action: "Run /login to sign in again."}
+	case LLMErrorRateLimit:
+		return &LLMError{Kind: kind, Err: err, Message: "The provider is rate limiting requests.", Action: "Wait a moment and try again."}
+	case LLMErrorContextLength:
+		return &LLMError{Kind: kind, Err: err, Message: "The conversation no longer fits in the model's context window.", Action: "Start a fresh conversation with /new or check /context."}
+	case LLMErrorInvalidModel:
+		return &LLMError{Kind: kind, Err: err, Message: "The configured model is not available from the provider.", Action: "Switch model with /model."}
+	case LLMErrorNetwork:
+		return &LLMError{Kind: kind, Err: err, Message: "Could not reach the provider.", Action: "Check your network connection and try again."}
+	default:
+		return &LLMError{Kind: kind, Err: err, Message: err.Error()}
+	}
+}
+
+// llmErrorKind classifies err by the provider's typed error, then by the
+// HTTP status in it, and only then by a few unambiguous provider phrases
+func llmErrorKind(err error) LLMErrorKind {
+	var provErr *llms.Error
+	if errors.As(err, &provErr) {
+		switch provErr.Code {
+		case llms.ErrCodeAuthentication:
+			return LLMErrorAuth
+		case llms.ErrCodeRateLimit, llms.ErrCodeQuotaExceeded:
+			return LLMErrorRateLimit
+		case llms.ErrCodeTokenLimit:
+			return LLMErrorContextLength
+		case llms.ErrCodeResourceNotFound:
+			return LLMErrorInvalidModel
+		}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return LLMErrorNetwork
+	}
+
+	lower := strings.ToLower(err.Error())
+	switch status := httpStatus(err.Error()); {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return LLMErrorAuth
+	case status == http.StatusTooManyRequests:
+		return LLMErrorRateLimit
+	case status == http.StatusRequestEntityTooLarge:
+		return LLMErrorContextLength
+	case status == http.StatusNotFound && strings.Contains(lower, "model"):
+		return LLMErrorInvalidModel
+	}
+
+	switch {
+	case containsAny(lower, "authentication_error", "invalid x-api-key", "invalid api key"):
+		return LLMErrorAuth
+	case containsAny(lower, "rate_limit_error", "too many requests", "overloaded_error"):
+		return LLMErrorRateLimit
+	case containsAny(lower, "context_length_exceeded", "prompt is too long", "maximum context length"):
+		return LLMErrorContextLength
+	case containsAny(lower, "model_not_found") || strings.Contains(lower, "not_found_error: model"):
+		return LLMErrorInvalidModel
+	case containsAny(lower, "connection refused", "no such host", "connection reset", "network is unreachable", "tls handshake"):
+		return LLMErrorNetwork
+	}
+	return LLMErrorUnknown
+}
+
+var (
+	// statusCodePattern finds "status code: 401" as provider clients report it
+	statusCodePattern = regexp.MustCompile(`(?i)\bstatus(?: code)?:?\s*(\d{3})\b`)
+	// statusLinePattern finds an HTTP status line such as "429 Too Many Requests"
+	statusLinePattern = regexp.MustCompile(`\b([45]\d\d) ([A-Za-z][A-Za-z -]*)`)
+)
+
+// httpStatus returns the HTTP status code an error message reports, or 0
+func httpStatus(msg string) int {
+	if m := statusCodePattern.FindStringSubmatch(msg); m != nil {
+		code, _ := strconv.Atoi(m[1])
+		return code
+	}
+	for _, m := range statusLinePattern.FindAllStringSubmatch(msg, -1) {
+		code, _ := strconv.Atoi(m[1])
+		if text := http.StatusText(code); text != "" && strings.HasPrefix(m[2], text) {
+			return code
+		}
+	}
+	return 0
+}
+
+// toolFallbackMsg tells the user the model is called without tools after
+// its provider rejected them
+type toolFallbackMsg string
+
+// isToolSchemaError reports whether a provider refused a request for its
+// tool_choice or tool definitions, which a request with fewer tool options
+// may get past
+func isToolSchemaError(err error) bool {
+	lower := strings.ToLower(err.Error())
+	return containsAny(lower, "tool_choice", "tool choice", "does not support tools", "tools are not supported",
+		"tool use is not supported", "function calling", "functions are not supported", "input_schema", "invalid schema")
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, sub := range substrs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
 
 // Local copies of prompt partials and template used by the session, to decouple from agent.go.
 var sessPromptPartials = map[string]any{
 	"SandboxStatus": "none",
 	"UserMemory":    "",
 	"Env":           "",
+	"history":       "",
+}
+
+// sessToolPartials maps the logical tool names used by the system prompt
+// template to the tool that fills that role. Roles with no tool stay empty.
+var sessToolPartials = map[string]string{
 	"ReadFile":      "read_file",
 	"WriteFile":     "write_file",
-	"Grep":          "grep",
-	"Glob":          "glob",
+	"Grep":          "",
+	"Glob":          "",
 	"Edit":          "replace_text",
 	"Shell":         "run_in_shell",
 	"ReadManyFiles": "read_many_files",
 	"Memory":        "",
 	"LS":            "list_files",
-	"history":       "",
+}
+
+// buildToolPartials returns the template partials naming the tools in defs,
+// leaving roles empty when their tool is unavailable, plus a Tools list.
+func buildToolPartials(defs []llms.Tool) map[string]any {
+	available := make(map[string]bool, len(defs))
+	var list strings.Builder
+	for _, def := range defs {
+		if def.Function == nil {
+			continue
+		}
+		available[def.Function.Name] = true
+		fmt.Fprintf(&list, "- %s: %s\n", def.Function.Name, def.Function.Description)
+	}
+
+	partials := make(map[string]any, len(sessToolPartials)+1)
+	for role, name := range sessToolPartials {
+		if available[name] {
+			partials[role] = name
+		} else {
+			partials[role] = ""
+		}
+	}
+	partials["Tools"] = strings.TrimSuffix(list.String(), "\n")
+	return partials
 }
 
 //go:embed prompts/system_prompt.tmpl
@@ -145,26 +446,74 @@ func NewSession(llm llms.Model, cfg *Config, toolNotify NotifyFunc) (*Session, e
 		llm:         llm,
 		toolCatalog: map[string]lctools.Tool{},
 		notify:      toolNotify,
+		messagesMu:  &sync.RWMutex{},
 	}
 	if cfg != nil {
 		s.config = &cfg.LLM
+		s.toolOverrides = cfg.Tools
 		s.Provider = cfg.LLM.Provider
 		s.Model = cfg.LLM.Model
-		// Set default maxTurns if not configured
+		if s.Model != "" && !isValidModelFor(s.Provider, s.Model, cfg.LLM.BaseURL) {
+			slog.Warn("model does not look like it belongs to provider",
+				"provider", s.Provider, "model", s.Model, "default", defaultModelFor(s.Provider))
+		}
 	} else {
 		// Create default config if none provided
 		s.config = &LLMConfig{}
 	}
+	// Set default maxTurns if not configured
 	if s.config.MaxTurns <= 0 {
-		s.config.MaxTurns = 999
+		s.config.MaxTurns = defaultMaxTurns
+	}
+
+	// Build tool schema for the model and execution catalog for the scheduler.
+	// The system prompt names these tools, so they come first.
+	s.readOnly = s.config.ReadOnly
+	s.compactToolOutput = s.config.CompactToolOutput
+	s.toolDefs, s.toolCatalog = buildLLMTools(s.readOnly, s.toolOverrides)
+
+	parts, err := s.buildSystemParts()
+	if err != nil {
+		return nil, err
+	}
+	s.addMessages(llms.MessageContent{
+		Role:  llms.ChatMessageTypeSystem,
+		Parts: parts,
+	})
+
+	s.scheduler = NewCoreToolScheduler(s.notify)
+	s.ContextFiles = make(map[string]string)
+	s.startTime = time.Now()
+
+	// Add AGENTS.md as a persistent context file if it exists
+	projectContext := readProjectContext()
+	if projectContext != "" {
+		s.ContextFiles["AGENTS.md"] = projectContext
 	}
+	return s, nil
+}
+
+// readOnlyNotice is appended to the system prompt while the session is read-only
+const readOnlyNotice = "You are in read-only mode. Tools that modify files or run shell commands are unavailable. " +
+	"Answer questions and review code using the read tools only, and describe any changes instead of making them."
 
+// buildSystemParts renders the system prompt template for the current tool set
+func (s *Session) buildSystemParts() ([]llms.ContentPart, error) {
 	// Build system prompt from the existing template and partials, same as the agent.
-	partials := make(map[string]any, len(sessPromptPartials))
+	partials := make(map[string]any, len(sessPromptPartials)+len(sessToolPartials)+1)
 	for k, v := range sessPromptPartials {
 		partials[k] = v
 	}
-	partials["Env"] = sessBuildEnvBlock()
+	for k, v := range buildToolPartials(s.toolDefs) {
+		partials[k] = v
+	}
+	env := sessBuildEnvBlock()
+	if s.config != nil && s.config.GitContext {
+		if git := sessBuildGitBlock(); git != "" {
+			env += "\n" + git
+		}
+	}
+	partials["Env"] = env
 
 	pt := prompts.PromptTemplate{
 		Template:         sessSystemPromptTemplate,
@@ -179,38 +528,127 @@ func NewSession(llm llms.Model, cfg *Config, toolNotify NotifyFunc) (*Session, e
 		return nil, fmt.Errorf("formatting system prompt: %w", err)
 	}
 	var parts []llms.ContentPart
-	if s.config != nil && s.config.Provider == "anthropic" {
+	if s.config != nil && s.config.Provider == "anthropic" && s.config.UseClaudeCodePreamble() {
 		parts = append(parts, llms.TextPart("You are Claude Code, Anthropic's official CLI for Claude."))
 	}
 	parts = append(parts, llms.TextPart(sys))
+	if s.readOnly {
+		parts = append(parts, llms.TextPart(readOnlyNotice))
+	}
+	return parts, nil
+}
 
-	s.messages = append(s.messages, llms.MessageContent{
-		Role:  llms.ChatMessageTypeSystem,
-		Parts: parts,
-	})
-	s.syncMessages()
+// SetReadOnly switches the session in or out of read-only mode, rebuilding the
+// tool set and the system prompt that names it.
+func (s *Session) SetReadOnly(on bool) {
+	s.readOnly = on
+	s.rebuildTools()
+}
 
-	// Build tool schema for the model and execution catalog for the scheduler.
-	s.toolDefs, s.toolCatalog = buildLLMTools()
-	s.scheduler = NewCoreToolScheduler(s.notify)
-	s.ContextFiles = make(map[string]string)
-	s.startTime = time.Now()
+// SetToolOverrides applies new [tools] settings, rebuilding the tool set and
+// the system prompt that names it.
+func (s *Session) SetToolOverrides(overrides map[string]ToolConfig) {
+	s.toolOverrides = overrides
+	s.rebuildTools()
+}
 
-	// Add AGENTS.md as a persistent context file if it exists
-	projectContext := readProjectContext()
-	if projectContext != "" {
-		s.ContextFiles["AGENTS.md"] = projectContext
+// rebuildTools refreshes the tool set and the system prompt after the
+// settings that shape it changed
+func (s *Session) rebuildTools() {
+	s.toolDefs, s.toolCatalog = buildLLMTools(s.readOnly, s.toolOverrides)
+
+	parts, err := s.buildSystemParts()
+	if err != nil {
+		slog.Error("failed to rebuild system prompt", "error", err)
+		return
 	}
-	return s, nil
+	defer s.lockMessages()()
+	if len(s.messages) == 0 || s.messages[0].Role != llms.ChatMessageTypeSystem {
+		return
+	}
+	s.messages[0].Parts = parts
+	s.syncMessages()
+}
+
+// IsReadOnly reports whether mutating tools are withheld from the model
+func (s *Session) IsReadOnly() bool {
+	return s.readOnly
+}
+
+// LastFile returns the file the agent last read or wrote, empty when none
+func (s *Session) LastFile() string {
+	defer s.rlockMessages()()
+	return s.lastFile
 }
 
 // AddContextFile adds file content to the context for the next prompt
 func (s *Session) AddContextFile(path, content string) {
+	defer s.lockMessages()()
 	s.ContextFiles[path] = content
 }
 
+// RemoveContextFile drops a file from the context, reporting whether it was there
+func (s *Session) RemoveContextFile(path string) bool {
+	defer s.lockMessages()()
+	if _, ok := s.ContextFiles[path]; !ok {
+		return false
+	}
+	delete(s.ContextFiles, path)
+	return true
+}
+
+// RefreshContextFiles re-reads the context files from disk, returning a note
+// for each file that changed or was deleted since it was added. Deleted
+// files keep their saved content.
+func (s *Session) RefreshContextFiles() []string {
+	files := s.GetContextFiles()
+	paths := slices.Sorted(maps.Keys(files))
+	var notes []string
+	for _, path := range paths {
+		data, err := os.ReadFile(resolveFileRef(path))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			notes = append(notes, fmt.Sprintf("%s was deleted since the session was saved, keeping the saved copy", path))
+		case err != nil:
+			notes = append(notes, fmt.Sprintf("%s could not be re-read, keeping the saved copy: %v", path, err))
+		case string(data) != files[path]:
+			s.AddContextFile(path, string(data))
+			notes = append(notes, fmt.Sprintf("%s changed since the session was saved, using the current content", path))
+		}
+	}
+	return notes
+}
+
+// AttachContext sends a file's content with the next prompt only, without
+// keeping it in the context of later prompts
+func (s *Session) AttachContext(path, content string) {
+	if s.pendingContext == nil {
+		s.pendingContext = make(map[string]string)
+	}
+	s.pendingContext[path] = content
+}
+
+// AttachImage attaches an image file to the next prompt. It fails when the
+// active model cannot accept images.
+func (s *Session) AttachImage(path string) error {
+	if !modelSupportsVision(s.Provider, s.Model) {
+		return fmt.Errorf("model %s does not support images", s.Model)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read image: %w", err)
+	}
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return fmt.Errorf("%s is not an image (%s)", path, mimeType)
+	}
+	s.pendingImages = append(s.pendingImages, llms.BinaryPart(mimeType, data))
+	return nil
+}
+
 // ClearContext removes all file content from the context except AGENTS.md
 func (s *Session) ClearContext() {
+	defer s.lockMessages()()
 	// Preserve AGENTS.md if it exists
 	agentsContent, hasAgents := s.ContextFiles["AGENTS.md"]
 	s.ContextFiles = make(map[string]string)
@@ -221,6 +659,11 @@ func (s *Session) ClearContext() {
 
 // ClearHistory clears the conversation history but keeps the system message and AGENTS.md
 func (s *Session) ClearHistory() {
+	unlock := s.lockMessages()
+	// Start a new saved session rather than overwriting this one
+	s.ID = ""
+	s.FirstPrompt = ""
+
 	// Keep only the system message (first message)
 	if len(s.messages) > 0 && s.messages[0].Role == llms.ChatMessageTypeSystem {
 		s.messages = s.messages[:1]
@@ -228,6 +671,11 @@ func (s *Session) ClearHistory() {
 		s.messages = []llms.MessageContent{}
 	}
 	s.syncMessages()
+	s.RawHistory = nil
+	s.Prompts = nil
+	unlock()
+	// The checkpoint's indices and files belong to the old conversation
+	s.checkpoint = nil
 
 	// Reset tool call tracking
 	s.lastToolCallKey = ""
@@ -239,32 +687,88 @@ func (s *Session) ClearHistory() {
 	s.ClearContext()
 }
 
+// RestoreFrom replaces the conversation with a saved session's, so that
+// later saves update that session instead of this one
+func (s *Session) RestoreFrom(saved *Session) {
+	unlock := s.lockMessages()
+	s.ID = saved.ID
+	s.CreatedAt = saved.CreatedAt
+	s.LastUpdated = saved.LastUpdated
+	s.FirstPrompt = saved.FirstPrompt
+	s.messages = append([]llms.MessageContent(nil), saved.Messages...)
+	s.syncMessages()
+	s.RawHistory = resumedRawHistory(saved)
+	s.Prompts = slices.Clone(saved.Prompts)
+	s.ContextFiles = make(map[string]string, len(saved.ContextFiles))
+	maps.Copy(s.ContextFiles, saved.ContextFiles)
+	unlock()
+	s.checkpoint = nil
+	s.lastToolCallKey = ""
+	s.toolCallRepetitionCount = 0
+}
+
 // HasContextFiles returns true if there are files in the context
 func (s *Session) HasContextFiles() bool {
+	defer s.rlockMessages()()
 	return len(s.ContextFiles) > 0
 }
 
 // GetContextFiles returns a copy of the context files map
 func (s *Session) GetContextFiles() map[string]string {
-	result := make(map[string]string)
-	for k, v := range s.ContextFiles {
-		result[k] = v
-	}
-	return result
+	defer s.rlockMessages()()
+	return maps.Clone(s.ContextFiles)
 }
 
 // buildPromptWithContext builds a prompt that includes all file content
 func (s *Session) buildPromptWithContext(userPrompt string) string {
-	if len(s.ContextFiles) == 0 {
+	files := s.GetContextFiles()
+	if len(s.pendingContext) > 0 {
+		files = maps.Clone(s.pendingContext)
+		maps.Copy(files, s.GetContextFiles())
+	}
+	if len(files) == 0 {
 		return userPrompt
 	}
 
 	var fileContents []string
-	for path, content := range s.ContextFiles {
-		fileContents = append(fileContents, fmt.Sprintf("--- Context from: %s ---\n%s\n--- End of Context from: %s ---", path, content, path))
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		content := files[path]
+		if s.config.ContextFormat == "markers" {
+			fileContents = append(fileContents, fmt.Sprintf("--- Context from: %s ---\n%s\n--- End of Context from: %s ---", path, content, path))
+			continue
+		}
+		fence := "```"
+		for strings.Contains(content, fence) {
+			fence += "`"
+		}
+		fileContents = append(fileContents, fmt.Sprintf("%s:\n%s%s\n%s\n%s", path, fence, fenceLanguage(path), strings.TrimSuffix(content, "\n"), fence))
 	}
 
-	return strings.Join(fileContents, "\n\n") + "\n" + userPrompt
+	ctxText := strings.Join(fileContents, "\n\n")
+	if s.config.ContextPromptFirst {
+		return userPrompt + "\n\n" + ctxText
+	}
+	return ctxText + "\n" + userPrompt
+}
+
+// fenceLanguages maps file extensions to markdown code fence languages
+var fenceLanguages = map[string]string{
+	".go": "go", ".py": "python", ".js": "javascript", ".ts": "typescript", ".tsx": "tsx", ".jsx": "jsx",
+	".rs": "rust", ".rb": "ruby", ".java": "java", ".kt": "kotlin", ".c": "c", ".h": "c", ".cpp": "cpp",
+	".cc": "cpp", ".cs": "csharp", ".swift": "swift", ".php": "php", ".sh": "bash", ".bash": "bash",
+	".zsh": "zsh", ".sql": "sql", ".html": "html", ".css": "css", ".json": "json", ".yaml": "yaml",
+	".yml": "yaml", ".toml": "toml", ".xml": "xml", ".md": "markdown", ".lua": "lua", ".tmpl": "gotemplate",
+}
+
+// fenceLanguage returns the code fence language for a file, "" when unknown
+func fenceLanguage(path string) string {
+	if filepath.Base(path) == "Makefile" || filepath.Base(path) == "Justfile" {
+		return "make"
+	}
+	if filepath.Base(path) == "Dockerfile" {
+		return "dockerfile"
+	}
+	return fenceLanguages[strings.ToLower(filepath.Ext(path))]
 }
 
 // getToolCallKey generates a unique key for a tool call based on name and arguments
@@ -294,14 +798,124 @@ func (s *Session) checkToolCallLoop(name, argsJSON string) bool {
 	return false
 }
 
+// Tool results shorter than this are left alone by compactToolOutputs
+const compactToolOutputMin = 200
+
+// compactToolOutputs replaces tool results older than the configured number of
+// prompts with a short placeholder, keeping recent outputs in full. The
+// caller holds the message lock.
+func (s *Session) compactToolOutputs() {
+	keep := s.compactToolOutput
+	if keep <= 0 {
+		return
+	}
+
+	// Find where the last keep prompts start
+	cutoff, prompts := 0, 0
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		if s.messages[i].Role == llms.ChatMessageTypeHuman {
+			prompts++
+			if prompts == keep {
+				cutoff = i
+				break
+			}
+		}
+	}
+
+	calls := make(map[string]llms.ToolCall)
+	compacted := make(map[int]bool)
+	for i := 0; i < cutoff; i++ {
+		for j, part := range s.messages[i].Parts {
+			switch p := part.(type) {
+			case llms.ToolCall:
+				calls[p.ID] = p
+			case llms.ToolCallResponse:
+				if len(p.Content) < compactToolOutputMin {
+					continue
+				}
+				p.Content = compactedToolOutput(calls[p.ToolCallID], p)
+				// Snapshots may share the parts, so change a copy
+				if !compacted[i] {
+					s.messages[i].Parts = slices.Clone(s.messages[i].Parts)
+					compacted[i] = true
+				}
+				s.messages[i].Parts[j] = p
+			}
+		}
+	}
+}
+
+// compactedToolOutput describes a tool result that was dropped from history
+func compactedToolOutput(call llms.ToolCall, resp llms.ToolCallResponse) string {
+	var args string
+	if call.FunctionCall != nil {
+		args = call.FunctionCall.Arguments
+	}
+	if resp.Name == "run_in_shell" {
+		var in RunInShellInput
+		var out RunInShellOutput
+		json.Unmarshal([]byte(args), &in)
+		if json.Unmarshal([]byte(resp.Content), &out) == nil && in.Command != "" {
+			return fmt.Sprintf("[output from `%s` truncated, exit %s]", in.Command, out.ExitCode)
+		}
+	}
+	if path := toolPathArg(resp.Name, args); path != "" {
+		return fmt.Sprintf("[output from %s(%s) truncated]", resp.Name, path)
+	}
+	return fmt.Sprintf("[output from %s truncated]", resp.Name)
+}
+
+// SetCompactToolOutput sets how many recent prompts of this session keep
+// their tool outputs in full, leaving the config alone
+func (s *Session) SetCompactToolOutput(keep int) {
+	defer s.lockMessages()()
+	s.compactToolOutput = keep
+}
+
+// CompactToolOutput returns how many recent prompts keep their tool outputs in full
+func (s *Session) CompactToolOutput() int {
+	defer s.rlockMessages()()
+	return s.compactToolOutput
+}
+
 // prepareUserMessage builds the prompt with context and adds it to the message history
 func (s *Session) prepareUserMessage(prompt string) {
+	if notes, err := readNotes(); err == nil && notes != "" && s.config != nil && s.config.NotesInContext {
+		s.AddContextFile(notesPath, notes)
+	} else {
+		// The notes were turned off or emptied since they were last sent
+		s.RemoveContextFile(notesPath)
+	}
 	fullPrompt := s.buildPromptWithContext(prompt)
+	parts := append(s.pendingImages, llms.TextPart(fullPrompt))
+	s.pendingImages = nil
+	s.pendingContext = nil
+	s.readCache = nil
+	s.turnFiles = nil
+	unlock := s.lockMessages()
+	s.thinking.warned = false
+	s.Prompts = append(s.Prompts, sessionPrompt{Index: len(s.messages), Text: prompt})
 	s.messages = append(s.messages, llms.MessageContent{
 		Role:  llms.ChatMessageTypeHuman,
-		Parts: []llms.ContentPart{llms.TextPart(fullPrompt)},
+		Parts: parts,
 	})
+	s.compactToolOutputs()
 	s.syncMessages()
+	unlock()
+}
+
+// defaultRequestTimeout bounds a single LLM request when request_timeout_ms is unset
+const defaultRequestTimeout = 10 * time.Minute
+
+// requestTimeout returns how long a single LLM request may take, 0 for no limit
+func (s *Session) requestTimeout() time.Duration {
+	if s.config == nil || s.config.RequestTimeoutMs == 0 {
+		return defaultRequestTimeout
+	}
+	if s.config.RequestTimeoutMs < 0 {
+		return 0
+	}
+	return time.Duration(s.config.RequestTimeoutMs) * time.Millisecond
 }
 
 func (s *Session) generateLLMResponse(ctx context.Context, streamingFunc func(ctx context.Context, chunk []byte) error) (*llms.ContentChoice, error) {
@@ -314,22 +928,130 @@ func (s *Session) generateLLMResponse(ctx context.Context, streamingFunc func(ct
 		callOptsWithChoice = append(callOptsWithChoice, llms.WithToolChoice("auto"))
 	}
 
+	common := s.samplingOptions()
+
 	// Add streaming option if requested
 	if streamingFunc != nil {
-		callOptsWithChoice = append(callOptsWithChoice, llms.WithStreamingFunc(streamingFunc))
+		common = append(common, llms.WithStreamingFunc(streamingFunc))
+	}
+	verbose := s.config != nil && s.config.Verbose
+	if verbose {
+		slog.Debug("llm.request", "provider", s.Provider, "model", s.Model, "messages", describeMessages(s.messages))
+	}
+	// Bound the whole request; cancelling ctx (ESC) still ends it early
+	callCtx := ctx
+	timeout := s.requestTimeout()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	messages := s.messages
+	if s.promptCaching() {
+		messages = withCacheBreakpoint(messages)
+		common = append(common, anthropic.WithPromptCaching())
+	}
+	attempts := [][]llms.CallOption{callOptsWithChoice, callOptsNoChoice, nil}
+	if len(s.toolDefs) == 0 {
+		attempts = attempts[2:]
+	} else {
+		// Skip what the provider already rejected in this session
+		attempts = attempts[s.toolFallback:]
+	}
+	var resp *llms.ContentResponse
+	var err error
+	for i, opts := range attempts {
+		resp, err = s.llm.GenerateContent(callCtx, messages, append(slices.Clone(opts), common...)...)
+		if err == nil || i == len(attempts)-1 || ctx.Err() != nil || !isToolSchemaError(err) {
+			break
+		}
+		s.toolFallback++
+		slog.Warn("provider rejected the tool options, retrying with fewer", "provider", s.Provider, "model", s.Model, "error", err)
+		if attempts[i+1] == nil && s.notify != nil {
+			s.notify(toolFallbackMsg(fmt.Sprintf("%s rejected the tool definitions, continuing without tools", s.Model)))
+		}
 	}
-	// Attempt with explicit tool choice first.
-	resp, err := s.llm.GenerateContent(ctx, s.messages, callOptsWithChoice...)
 	if err != nil {
+		if ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+			return nil, &LLMError{
+				Kind:    LLMErrorTimeout,
+				Err:     err,
+				Message: fmt.Sprintf("The provider did not finish responding within %s.", timeout),
+				Action:  "Try again, or raise request_timeout_ms.",
+			}
+		}
 		return nil, err
 	}
+	if verbose {
+		slog.Debug("llm.response", "choices", describeChoices(resp.Choices))
+		if s.notify != nil && len(resp.Choices) > 0 {
+			choice := resp.Choices[0]
+			s.notify(llmTraceMsg(fmt.Sprintf("%d messages sent, stop=%s, %d chars, %d tool calls",
+				len(s.messages), choice.StopReason, len(choice.Content), len(choice.ToolCalls))))
+		}
+	}
 
 	if len(resp.Choices) == 0 {
 		return nil, fmt.Errorf("empty response choices")
 	}
+	s.recordThinking(resp.Choices[0])
+	if s.ShowsResponseDetails() && s.notify != nil {
+		s.notify(responseDetailsMsg(formatResponseDetails(resp.Choices[0])))
+	}
 	return resp.Choices[0], nil
 }
 
+// SetResponseDetails turns the per-response details shown by /verbose on or off
+func (s *Session) SetResponseDetails(on bool) {
+	defer s.lockMessages()()
+	s.responseDetails = on
+}
+
+// ShowsResponseDetails reports whether /verbose is on for this session
+func (s *Session) ShowsResponseDetails() bool {
+	defer s.rlockMessages()()
+	return s.responseDetails
+}
+
+// formatResponseDetails summarizes what the provider returned besides the
+// text: why it stopped, the tokens it reported and the tools it called
+func formatResponseDetails(choice *llms.ContentChoice) string {
+	stop := choice.StopReason
+	if stop == "" {
+		stop = "(none)"
+	}
+	details := []string{"stop=" + stop}
+	in, hasIn := usageTokens(choice.GenerationInfo, "InputTokens", "PromptTokens")
+	out, hasOut := usageTokens(choice.GenerationInfo, "OutputTokens", "CompletionTokens")
+	if hasIn || hasOut {
+		details = append(details, fmt.Sprintf("tokens in=%d out=%d", in, out))
+	}
+	for _, tc := range choice.ToolCalls {
+		if tc.FunctionCall == nil {
+			continue
+		}
+		details = append(details, fmt.Sprintf("tool %s %s (id %s)", tc.FunctionCall.Name, truncateSnippet(tc.FunctionCall.Arguments, 80), tc.ID))
+	}
+	return strings.Join(details, " · ")
+}
+
+// usageTokens returns the first of keys found in a provider's generation info
+func usageTokens(info map[string]any, keys ...string) (int, bool) {
+	for _, key := range keys {
+		switch v := info[key].(type) {
+		case int:
+			return v, true
+		case int32:
+			return int(v), true
+		case int64:
+			return int(v), true
+		case float64:
+			return int(v), true
+		}
+	}
+	return 0, false
+}
+
 // appendMessages adds LLM response content and tool calls to the message history
 func (s *Session) appendMessages(content string, toolCalls []llms.ToolCall) {
 	// Build the assistant message parts
@@ -342,28 +1064,44 @@ func (s *Session) appendMessages(content string, toolCalls []llms.ToolCall) {
 
 	// Add tool calls if present
 	for _, toolCall := range toolCalls {
+		call := toolCall.FunctionCall
+		// Providers that parse the arguments of past calls would fail every
+		// later request on broken ones. The tool response tells the model
+		// what was wrong with them.
+		if call != nil && strings.TrimSpace(call.Arguments) != "" && !json.Valid([]byte(call.Arguments)) {
+			call = &llms.FunctionCall{Name: call.Name, Arguments: "{}"}
+		}
 		parts = append(parts, llms.ToolCall{
 			ID:           toolCall.ID,
 			Type:         toolCall.Type,
-			FunctionCall: toolCall.FunctionCall,
+			FunctionCall: call,
 		})
 	}
 
 	// Only add the assistant message if we have content or tool calls
 	if len(parts) > 0 {
-		s.messages = append(s.messages, llms.MessageContent{
+		s.addMessages(llms.MessageContent{
 			Role:  llms.ChatMessageTypeAI,
 			Parts: parts,
 		})
-		s.syncMessages()
 	}
 }
 
-// executeToolCall executes a single tool call and returns the response content
-func (s *Session) executeToolCall(ctx context.Context, tool lctools.Tool, tc llms.ToolCall, argsJSON string) llms.ToolCallResponse {
+// executeToolCall runs a tool and returns its response along with the
+// images of a structured result, to send after the response
+func (s *Session) executeToolCall(ctx context.Context, tool lctools.Tool, tc llms.ToolCall, argsJSON string) (llms.ToolCallResponse, []llms.ContentPart, error) {
 	var out string
 	var callErr error
 
+	// Some tools take malformed JSON as a raw path, so catch it before running them
+	if strings.TrimSpace(argsJSON) != "" && !json.Valid([]byte(argsJSON)) {
+		callErr = fmt.Errorf("invalid arguments for %s: not valid JSON", tc.FunctionCall.Name)
+		if truncatedJSON(argsJSON) {
+			callErr = fmt.Errorf("invalid arguments for %s: not valid JSON, they were cut off after %d bytes so the call was not run", tc.FunctionCall.Name, len(argsJSON))
+		}
+		return s.invalidArgsResponse(tc, callErr), nil, callErr
+	}
+
 	if s.scheduler != nil {
 		ch := s.scheduler.Schedule(tool, argsJSON)
 		res := <-ch
@@ -372,28 +1110,171 @@ func (s *Session) executeToolCall(ctx context.Context, tool lctools.Tool, tc llm
 		out, callErr = tool.Call(ctx, argsJSON)
 	}
 
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(callErr, &syntaxErr) || errors.As(callErr, &typeErr) {
+		return s.invalidArgsResponse(tc, callErr), nil, callErr
+	}
+
 	if callErr != nil {
 		return llms.ToolCallResponse{
 			ToolCallID: tc.ID,
 			Name:       tc.FunctionCall.Name,
 			Content:    fmt.Sprintf("Error: %v", callErr),
-		}
+		}, nil, callErr
+	}
+
+	// Decoded before spilling, which would cut the JSON
+	var images []llms.ContentPart
+	if returner, ok := tool.(ToolResultReturner); ok && returner.ReturnsToolResult() {
+		out, images = s.splitToolResult(tc.FunctionCall.Name, out)
+	}
+	if spillTools[tc.FunctionCall.Name] {
+		out = spillToolOutput(tc.ID, tc.FunctionCall.Name, out, s.toolOutputLimit())
 	}
 
 	return llms.ToolCallResponse{
 		ToolCallID: tc.ID,
 		Name:       tc.FunctionCall.Name,
 		Content:    out,
+	}, images, nil
+}
+
+// truncatedJSON reports whether data is valid JSON cut off before its end,
+// like tool call arguments from a stream that broke mid-call
+func truncatedJSON(data string) bool {
+	var v any
+	return errors.Is(json.NewDecoder(strings.NewReader(data)).Decode(&v), io.ErrUnexpectedEOF)
+}
+
+// invalidArgsResponse answers a tool call whose arguments couldn't be parsed
+// with the tool's parameter schema, so the model can correct the call
+// instead of repeating it.
+func (s *Session) invalidArgsResponse(tc llms.ToolCall, callErr error) llms.ToolCallResponse {
+	name := tc.FunctionCall.Name
+	content := fmt.Sprintf("Error: %v", callErr)
+	for _, def := range s.toolDefs {
+		if def.Function == nil || def.Function.Name != name {
+			continue
+		}
+		if schema, err := json.MarshalIndent(def.Function.Parameters, "", "  "); err == nil {
+			content += fmt.Sprintf("\nThe arguments must be a JSON object matching this schema:\n%s\nFix the arguments and call %s again.", schema, name)
+		}
+		break
+	}
+	return llms.ToolCallResponse{
+		ToolCallID: tc.ID,
+		Name:       name,
+		Content:    content,
+	}
+}
+
+// toolPathArg returns the single path a file tool call targets, relative to
+// the project root when inside it, or "" for tools that work on globs or
+// arbitrary commands.
+func toolPathArg(name, argsJSON string) string {
+	if name == "read_many_files" || name == "run_in_shell" || name == "merge" {
+		return ""
+	}
+	var args struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+		return ""
+	}
+	if args.Path == "" {
+		if name == "list_files" {
+			return "."
+		}
+		return ""
 	}
+	return projectRelPath(resolveFileRef(args.Path))
+}
+
+// invalidateReadCache drops cached reads that a change to path may have made
+// stale. An empty path drops the whole cache.
+func (s *Session) invalidateReadCache(path string) {
+	for key, entry := range s.readCache {
+		if path == "" || entry.path == "" || entry.path == path || entry.path == filepath.Dir(path) {
+			delete(s.readCache, key)
+		}
+	}
+}
+
+// ReplayToolCall runs a tool call again through the same checks as the
+// model's calls: read-only mode, [tools], write review, external edits and
+// checkpoints. It returns the tool response, which is not added to the
+// conversation.
+func (s *Session) ReplayToolCall(ctx context.Context, id, name, argsJSON string) string {
+	// A replay runs the tool again instead of returning the cached read
+	delete(s.readCache, s.getToolCallKey(name, argsJSON))
+	msgs, _ := s.processToolCalls(ctx, []llms.ToolCall{{
+		ID:           id,
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: name, Arguments: argsJSON},
+	}})
+	for _, msg := range msgs {
+		for _, part := range msg.Parts {
+			if resp, ok := part.(llms.ToolCallResponse); ok {
+				return resp.Content
+			}
+		}
+	}
+	return ""
+}
+
+// LastToolCall returns the most recent call the model made to the named tool
+func (s *Session) LastToolCall(name string) (llms.ToolCall, bool) {
+	defer s.rlockMessages()()
+	for i := len(s.messages) - 1; i >= 0; i-- {
+		parts := s.messages[i].Parts
+		for j := len(parts) - 1; j >= 0; j-- {
+			if tc, ok := parts[j].(llms.ToolCall); ok && tc.FunctionCall != nil && tc.FunctionCall.Name == name {
+				return tc, true
+			}
+		}
+	}
+	return llms.ToolCall{}, false
+}
+
+// defaultMaxTurns caps the model calls a prompt may take when max_turns is unset
+const defaultMaxTurns = 25
+
+// continueTaskPrompt resumes a task stopped by the max turns limit
+const continueTaskPrompt = "You reached the turn limit before finishing. Continue the task from where you stopped."
+
+// continuePrompt asks the model to pick up a response that was cut off
+const continuePrompt = "Continue your previous response from exactly where it stopped, without repeating what you already wrote."
+
+// CanContinue reports whether the conversation ends with an assistant
+// message without tool calls, which the model can be asked to carry on.
+// That includes complete answers: the history doesn't mark cut off ones.
+func (s *Session) CanContinue() bool {
+	defer s.rlockMessages()()
+	if len(s.messages) == 0 {
+		return false
+	}
+	last := s.messages[len(s.messages)-1]
+	if last.Role != llms.ChatMessageTypeAI {
+		return false
+	}
+	for _, part := range last.Parts {
+		if _, ok := part.(llms.ToolCall); ok {
+			return false
+		}
+	}
+	return true
 }
 
 // GetMessageSnapshot returns the current size of the message history for rollback purposes
 func (s *Session) GetMessageSnapshot() int {
+	defer s.rlockMessages()()
 	return len(s.messages)
 }
 
 // RollbackTo truncates the message history back to the provided snapshot index
 func (s *Session) RollbackTo(snapshot int) {
+	unlock := s.lockMessages()
 	if snapshot < 1 {
 		snapshot = 1 // always preserve the system prompt
 	}
@@ -404,6 +1285,10 @@ func (s *Session) RollbackTo(snapshot int) {
 		s.messages = s.messages[:snapshot]
 		s.syncMessages()
 	}
+	s.Prompts = slices.DeleteFunc(s.Prompts, func(p sessionPrompt) bool {
+		return p.Index >= snapshot
+	})
+	unlock()
 
 	// Reset tool loop detection state when rolling back
 	s.lastToolCallKey = ""
@@ -413,6 +1298,7 @@ func (s *Session) RollbackTo(snapshot int) {
 // processToolCalls handles executing tool calls and building response messages
 func (s *Session) processToolCalls(ctx context.Context, toolCalls []llms.ToolCall) ([]llms.MessageContent, bool) {
 	toolMessages := make([]llms.MessageContent, 0, len(toolCalls))
+	var images []llms.ContentPart
 
 	for _, tc := range toolCalls {
 		if tc.FunctionCall == nil {
@@ -448,14 +1334,112 @@ func (s *Session) processToolCalls(ctx context.Context, toolCalls []llms.ToolCal
 			continue
 		}
 
+		key := s.getToolCallKey(name, argsJSON)
+		if cached, ok := s.readCache[key]; ok {
+			slog.Debug("reusing cached read", "tool", name, "args", argsJSON)
+			toolMessages = append(toolMessages, llms.MessageContent{
+				Role: llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{
+					ToolCallID: tc.ID,
+					Name:       name,
+					Content:    cached.output,
+				}},
+			})
+			continue
+		}
+
+		// Computed before the call, as a project_replace finds no files to change after it
+		var watched []string
+		if watchedTools[name] {
+			watched = watchedPaths(name, argsJSON)
+		}
+		if s.watchesExternalEdits() && name != "read_file" {
+			refused := ""
+			for _, path := range watched {
+				if note, ok := s.confirmExternalEdit(ctx, path); !ok {
+					refused = note
+					break
+				}
+			}
+			if refused != "" {
+				toolMessages = append(toolMessages, llms.MessageContent{
+					Role: llms.ChatMessageTypeTool,
+					Parts: []llms.ContentPart{llms.ToolCallResponse{
+						ToolCallID: tc.ID,
+						Name:       name,
+						Content:    refused,
+					}},
+				})
+				continue
+			}
+		}
+
+		var reviewNote string
+		if name == "write_file" && s.reviewsWrites() {
+			var applied bool
+			if argsJSON, reviewNote, applied = s.reviewWriteCall(ctx, argsJSON); !applied {
+				toolMessages = append(toolMessages, llms.MessageContent{
+					Role: llms.ChatMessageTypeTool,
+					Parts: []llms.ContentPart{llms.ToolCallResponse{
+						ToolCallID: tc.ID,
+						Name:       name,
+						Content:    reviewNote,
+					}},
+				})
+				continue
+			}
+		}
+
+		if mutatingTools[name] {
+			s.recordTurnFiles(name, argsJSON)
+		}
+
 		// Execute tool and add response
-		response := s.executeToolCall(ctx, tool, tc, argsJSON)
+		response, toolImages, callErr := s.executeToolCall(ctx, tool, tc, argsJSON)
+		if reviewNote != "" && callErr == nil {
+			response.Content += "\n\n" + reviewNote
+		}
+		if len(watched) > 0 && callErr == nil {
+			unlock := s.lockMessages()
+			s.lastFile = watched[len(watched)-1]
+			unlock()
+			if s.watchesExternalEdits() {
+				for _, path := range watched {
+					s.noteFileTime(path)
+				}
+			}
+		}
+		images = append(images, toolImages...)
+		switch {
+		case cacheableTools[name] && callErr == nil:
+			if s.readCache == nil {
+				s.readCache = make(map[string]cachedRead)
+			}
+			s.readCache[key] = cachedRead{path: toolPathArg(name, argsJSON), output: response.Content}
+		case mutatingTools[name]:
+			// Tools without file paths, like run_in_shell, may have changed anything
+			paths := watched
+			if len(paths) == 0 {
+				paths = []string{toolPathArg(name, argsJSON)}
+			}
+			for _, path := range paths {
+				s.invalidateReadCache(path)
+			}
+		}
 		toolMessages = append(toolMessages, llms.MessageContent{
 			Role:  llms.ChatMessageTypeTool,
 			Parts: []llms.ContentPart{response},
 		})
 	}
 
+	// Tool responses are text only, so images follow them in a message of their own
+	if len(images) > 0 {
+		toolMessages = append(toolMessages, llms.MessageContent{
+			Role:  llms.ChatMessageTypeHuman,
+			Parts: images,
+		})
+	}
+
 	return toolMessages, false // shouldReturn = false
 }
 
@@ -471,12 +1455,13 @@ func (s *Session) Ask(ctx context.Context, prompt string) (string, error) {
 	var finalText string
 	var lastAssistant string
 	var hadAnyToolCall bool
+	var toolOnlyTurns int
 	var i int
 	maxTurns := s.config.MaxTurns
 	for i = 0; i < maxTurns; i++ {
 		choice, err := s.generateLLMResponse(ctx, nil)
 		if err != nil {
-			return "", err
+			return "", classifyLLMError(err)
 		}
 
 		// Check if response was truncated due to max tokens
@@ -498,6 +1483,15 @@ func (s *Session) Ask(ctx context.Context, prompt string) (string, error) {
 
 		// Handle tool calls, if any.
 		if len(choice.ToolCalls) == 0 {
+			if call, ok := s.reactAction(choice); ok {
+				hadAnyToolCall = true
+				observation, shouldReturn := s.runReActAction(ctx, call)
+				s.addMessages(observation)
+				if shouldReturn {
+					return finalText, nil
+				}
+				continue
+			}
 			// Give the model another turn to issue tool calls if it only planned.
 			// Stop if it repeats the same assistant content.
 			if hadAnyToolCall || strings.TrimSpace(choice.Content) == strings.TrimSpace(lastAssistant) {
@@ -511,13 +1505,13 @@ func (s *Session) Ask(ctx context.Context, prompt string) (string, error) {
 		// Process tool calls and add responses
 		toolMessages, shouldReturn := s.processToolCalls(ctx, choice.ToolCalls)
 		if len(toolMessages) > 0 {
-			s.messages = append(s.messages, toolMessages...)
-			s.syncMessages()
+			s.addMessages(toolMessages...)
 		}
 
 		if shouldReturn {
 			return finalText, nil
 		}
+		toolOnlyTurns = s.trackToolOnlyTurn(choice, toolOnlyTurns)
 
 		// Continue to next iteration to let the model incorporate tool results.
 		if len(toolMessages) > 0 {
@@ -530,7 +1524,33 @@ func (s *Session) Ask(ctx context.Context, prompt string) (string, error) {
 	if i < maxTurns {
 		return finalText, nil
 	}
-	return fmt.Sprintf("%s\n\nEnded after %d interation", finalText, maxTurns), nil
+	return fmt.Sprintf("%s\n\nEnded after %d iterations", finalText, maxTurns), nil
+}
+
+const (
+	// toolOnlyTurnLimit is how many consecutive turns of tool calls without any
+	// text pass before the model is asked to wrap up
+	toolOnlyTurnLimit = 10
+	finishNudge       = "You have made many tool calls in a row without reporting back. " +
+		"Stop calling tools unless essential, summarize what you found and did, and finish your answer."
+)
+
+// trackToolOnlyTurn counts consecutive tool-only turns and, every
+// toolOnlyTurnLimit of them, asks the model to summarize and finish.
+// It returns the updated count.
+func (s *Session) trackToolOnlyTurn(choice *llms.ContentChoice, count int) int {
+	if strings.TrimSpace(choice.Content) != "" {
+		return 0
+	}
+	count++
+	if count%toolOnlyTurnLimit == 0 {
+		slog.Info("nudging model to finish after tool-only turns", "turns", count)
+		s.addMessages(llms.MessageContent{
+			Role:  llms.ChatMessageTypeHuman,
+			Parts: []llms.ContentPart{llms.TextPart(finishNudge)},
+		})
+	}
+	return count
 }
 
 // AskStream sends a user prompt through the native loop with streaming support.
@@ -556,6 +1576,7 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 		// A simple loop: generate -> maybe tool calls -> tool responses -> generate.
 		// Cap at a few iterations to avoid infinite loops.
 		var i int
+		var toolOnlyTurns int
 		maxTurns := s.config.MaxTurns
 		for i = 0; i < maxTurns; i++ {
 			s.resetStreamBuffer()
@@ -576,7 +1597,14 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 				// Continue with streaming
 			}
 
+			if s.notify != nil {
+				s.notify(thinkingPhaseStartMsg{})
+			}
+
 			// Create streaming function that accumulates content and notifies UI
+			var preparingTool string
+			var preparingArgs int
+			var textStarted bool
 			streamingFunc := func(ctx context.Context, chunk []byte) error {
 				// Check for cancellation in streaming callback
 				select {
@@ -585,14 +1613,33 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 				default:
 				}
 
+				// Tool call arguments are not content; report progress instead
+				if name, args, ok := parseToolCallChunk(chunk); ok {
+					if name != "" {
+						preparingTool, preparingArgs = name, 0
+					}
+					preparingArgs += len(args)
+					if s.notify != nil {
+						s.notify(ToolCallArgsChunkMsg{Name: preparingTool, ArgsLen: preparingArgs})
+					}
+					return nil
+				}
+
 				chunkStr := string(chunk)
 				s.accumulatedContent.WriteString(chunkStr)
 				if s.notify != nil {
+					if !textStarted {
+						textStarted = true
+						s.notify(assistantTextStartMsg{})
+					}
 					s.notify(streamChunkMsg(chunkStr))
 				}
 				return nil
 			}
 
+			if !s.config.UseStreaming() {
+				streamingFunc = nil
+			}
 			choice, err := s.generateLLMResponse(ctx, streamingFunc)
 			if err != nil {
 				// Check if this was a cancellation
@@ -607,13 +1654,26 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 					return
 				}
 
-				// Regular error
+				// Regular error - keep the partial response so /continue has context
+				slog.Error("llm request failed", "error", err)
+				if accumulatedText := s.getStreamBuffer(false); strings.TrimSpace(accumulatedText) != "" {
+					s.appendMessages(accumulatedText, nil)
+				}
 				if s.notify != nil {
-					s.notify(streamErrorMsg{err: err})
+					s.notify(streamErrorMsg{err: classifyLLMError(err)})
 				}
 				return
 			}
 
+			if streamingFunc == nil && choice.Content != "" {
+				// Show the full response at once
+				s.accumulatedContent.WriteString(choice.Content)
+				if s.notify != nil {
+					s.notify(assistantTextStartMsg{})
+					s.notify(streamChunkMsg(choice.Content))
+				}
+			}
+
 			// Use accumulated content as the response
 			responseContent := s.getStreamBuffer(false)
 
@@ -636,20 +1696,35 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 
 			// Handle tool calls, if any.
 			if len(choice.ToolCalls) == 0 {
-				// No tool calls - streaming is complete
-				break
+				call, ok := s.reactAction(choice)
+				if !ok {
+					// No tool calls - streaming is complete
+					break
+				}
+				if s.notify != nil {
+					s.notify(toolPhaseStartMsg{count: 1})
+				}
+				observation, shouldReturn := s.runReActAction(ctx, call)
+				s.addMessages(observation)
+				if shouldReturn {
+					break
+				}
+				continue
 			}
 
 			// Process tool calls and add responses
+			if s.notify != nil {
+				s.notify(toolPhaseStartMsg{count: len(choice.ToolCalls)})
+			}
 			toolMessages, shouldReturn := s.processToolCalls(ctx, choice.ToolCalls)
 			if len(toolMessages) > 0 {
-				s.messages = append(s.messages, toolMessages...)
-				s.syncMessages()
+				s.addMessages(toolMessages...)
 			}
 
 			if shouldReturn {
 				break
 			}
+			toolOnlyTurns = s.trackToolOnlyTurn(choice, toolOnlyTurns)
 
 			// Continue to next iteration to let the model incorporate tool results.
 			if len(toolMessages) > 0 {
@@ -672,7 +1747,7 @@ func (s *Session) AskStream(ctx context.Context, prompt string) {
 }
 
 // parseReActAction extracts a tool name and JSON arguments from text containing lines like:
-// "Action: tool_name" and "Action Input: { ... }".
+// "Action: tool_name" and "Action Input: { ... }". The input may span lines.
 func parseReActAction(text string) (name string, argsJSON string, ok bool) {
 	if text == "" {
 		return "", "", false
@@ -680,12 +1755,21 @@ func parseReActAction(text string) (name string, argsJSON string, ok bool) {
 	var tool string
 	var args string
 	lines := strings.Split(text, "\n")
-	for _, ln := range lines {
+	for i, ln := range lines {
 		l := strings.TrimSpace(ln)
 		if strings.HasPrefix(strings.ToLower(l), "action:") {
-			tool = strings.TrimSpace(l[len("Action:"):])
+			tool = strings.Trim(strings.TrimSpace(l[len("Action:"):]), "`")
 		} else if strings.HasPrefix(strings.ToLower(l), "action input:") {
 			args = strings.TrimSpace(l[len("Action Input:"):])
+			// Take the whole JSON object when it continues on the next lines
+			rest := args + "\n" + strings.Join(lines[i+1:], "\n")
+			if start := strings.Index(rest, "{"); start >= 0 {
+				var raw json.RawMessage
+				if err := json.NewDecoder(strings.NewReader(rest[start:])).Decode(&raw); err == nil {
+					args = string(raw)
+				}
+			}
+			break
 		}
 	}
 	if tool == "" || args == "" {
@@ -694,6 +1778,47 @@ func parseReActAction(text string) (name string, argsJSON string, ok bool) {
 	return tool, args, true
 }
 
+// reactObservationPrefix starts the message that feeds a ReAct action's
+// result back to the model
+const reactObservationPrefix = "Observation: "
+
+// reactAction returns the ReAct action in a response without native tool
+// calls as a tool call, when react_fallback is on
+func (s *Session) reactAction(choice *llms.ContentChoice) (llms.ToolCall, bool) {
+	if s.config == nil || !s.config.ReActFallback || len(choice.ToolCalls) > 0 {
+		return llms.ToolCall{}, false
+	}
+	name, args, ok := parseReActAction(choice.Content)
+	if !ok {
+		return llms.ToolCall{}, false
+	}
+	return llms.ToolCall{
+		ID:           fmt.Sprintf("react-%d", s.GetMessageSnapshot()),
+		Type:         "function",
+		FunctionCall: &llms.FunctionCall{Name: name, Arguments: args},
+	}, true
+}
+
+// runReActAction runs a ReAct action through the scheduler like a native
+// tool call and returns its result as an observation from the user. Models
+// that answer in ReAct text often run on providers that reject tool
+// messages, so the exchange stays plain text.
+func (s *Session) runReActAction(ctx context.Context, call llms.ToolCall) (llms.MessageContent, bool) {
+	toolMessages, shouldReturn := s.processToolCalls(ctx, []llms.ToolCall{call})
+	var observation strings.Builder
+	for _, msg := range toolMessages {
+		for _, part := range msg.Parts {
+			if response, ok := part.(llms.ToolCallResponse); ok {
+				observation.WriteString(response.Content)
+			}
+		}
+	}
+	return llms.MessageContent{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.TextPart(reactObservationPrefix + observation.String())},
+	}, shouldReturn
+}
+
 // sessBuildEnvBlock constructs a markdown summary of the OS, shell, and key paths.
 func sessBuildEnvBlock() string {
 	cwd, _ := os.Getwd()
@@ -729,9 +1854,58 @@ func sessBuildEnvBlock() string {
 		home)
 }
 
+// gitContextTimeout bounds the git calls made for the system prompt
+const gitContextTimeout = 2 * time.Second
+
+// gitContextCommits is how many recent commit subjects the system prompt lists
+const gitContextCommits = 5
+
+// sessBuildGitBlock summarizes the git branch, the working tree state and the
+// recent commits for the env block. It is empty outside a git repository or
+// when git doesn't answer in time.
+func sessBuildGitBlock() string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), gitContextTimeout)
+	defer cancel()
+
+	branch, err := gitOutput(ctx, cwd, "branch", "--show-current")
+	if err != nil {
+		return ""
+	}
+	branch = strings.TrimSpace(branch)
+	if branch == "" {
+		branch = "(detached HEAD)"
+	}
+	tree := "(unknown)"
+	if status, err := gitOutput(ctx, cwd, "status", "--porcelain"); err == nil {
+		if changed := strings.Count(status, "\n"); changed == 1 {
+			tree = "dirty, 1 changed file"
+		} else if changed > 1 {
+			tree = fmt.Sprintf("dirty, %d changed files", changed)
+		} else {
+			tree = "clean"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "- **Git:**\n  - **branch:** %s\n  - **working tree:** %s", branch, tree)
+	// A new repository has no commits to list
+	if log, err := gitOutput(ctx, cwd, "log", "-n", strconv.Itoa(gitContextCommits), "--format=%s"); err == nil && strings.TrimSpace(log) != "" {
+		b.WriteString("\n  - **recent commits:**")
+		for _, subject := range strings.Split(strings.TrimSpace(log), "\n") {
+			b.WriteString("\n    - " + subject)
+		}
+	}
+	return b.String()
+}
+
 func asimiVersion() string {
-	if strings.TrimSpace(version) != "" {
-		return strings.TrimSpace(version)
+	// "dev" is the unset default, so fall through to build info for the revision
+	if v := strings.TrimSpace(version); v != "" && v != "dev" {
+		return v
 	}
 
 	if v := os.Getenv("ASIMI_VERSION"); v != "" {
@@ -776,6 +1950,65 @@ func normalizeBuildVersion(v string) string {
 	return strings.TrimPrefix(v, "v")
 }
 
+// summaryPrompt asks the model for a handoff note covering the session so far
+const summaryPrompt = "Write a concise handoff note for the next developer or agent working on this project. " +
+	"Cover what changed in this session and why, decisions made, and anything left unfinished. " +
+	"Use a short markdown bullet list, no headings, and do not call any tools."
+
+// Summarize asks the model for a "what changed and why" note about the
+// session. The exchange is not added to the message history.
+func (s *Session) Summarize(ctx context.Context) (string, error) {
+	if s.llm == nil {
+		return "", fmt.Errorf("no LLM configured")
+	}
+	messages := append(s.MessagesSnapshot(), llms.MessageContent{
+		Role:  llms.ChatMessageTypeHuman,
+		Parts: []llms.ContentPart{llms.TextPart(summaryPrompt)},
+	})
+	var opts []llms.CallOption
+	if len(s.toolDefs) > 0 {
+		// Providers reject histories with tool calls when no tools are declared
+		opts = append(opts, llms.WithTools(s.toolDefs))
+	}
+	resp, err := s.llm.GenerateContent(ctx, messages, opts...)
+	if err != nil {
+		return "", classifyLLMError(err)
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Content) == "" {
+		return "", fmt.Errorf("model returned an empty summary")
+	}
+	return strings.TrimSpace(resp.Choices[0].Content), nil
+}
+
+// sessionNotesHeading is the AGENTS.md section that collects session summaries
+const sessionNotesHeading = "## Session Notes"
+
+// appendSessionNote appends a timestamped note to the Session Notes section
+// at the end of AGENTS.md, creating the file or the section if needed.
+func appendSessionNote(note string, at time.Time) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(wd, "AGENTS.md")
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var b strings.Builder
+	content := strings.TrimRight(string(existing), "\n")
+	if content != "" {
+		b.WriteString("\n\n")
+	}
+	if !strings.Contains(content, sessionNotesHeading) {
+		b.WriteString(sessionNotesHeading + "\n\n")
+	}
+	b.WriteString(fmt.Sprintf("### %s\n\n%s\n", at.Format("2006-01-02 15:04"), note))
+
+	return os.WriteFile(path, []byte(content+b.String()), 0o644)
+}
+
 // readProjectContext reads the contents of AGENTS.md from the current working directory.
 func readProjectContext() string {
 	wd, err := os.Getwd()
@@ -790,8 +2023,20 @@ func readProjectContext() string {
 	return string(b)
 }
 
+// mutatingTools lists the tools withheld in read-only mode
+var mutatingTools = map[string]bool{
+	"write_file":      true,
+	"replace_text":    true,
+	"apply_patch":     true,
+	"project_replace": true,
+	"run_in_shell":    true,
+	"merge":           true,
+	"notes":           true,
+}
+
 // buildLLMTools returns the LLM tool/function definitions and a catalog by name for execution.
-func buildLLMTools() ([]llms.Tool, map[string]lctools.Tool) {
+// In read-only mode the mutating tools are left out of both.
+func buildLLMTools(readOnly bool, overrides map[string]ToolConfig) ([]llms.Tool, map[string]lctools.Tool) {
 	// Map our concrete tools by name for execution.
 	execCatalog := map[string]lctools.Tool{}
 	for i := range availableTools {
@@ -859,6 +2104,30 @@ func buildLLMTools() ([]llms.Tool, map[string]lctools.Tool) {
 				}, []string{"path", "old_text", "new_text"}),
 			},
 		},
+		{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        "apply_patch",
+				Description: "Applies a multi-hunk patch to files in the project, matching hunks by context. Prefer it over replace_text for large edits.",
+				Parameters: obj(map[string]any{
+					"patch": str("A unified diff (--- a/path, +++ b/path, @@ hunks) or a '*** Begin Patch' block with *** Update File/Add File/Delete File sections"),
+				}, []string{"patch"}),
+			},
+		},
+		{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        "project_replace",
+				Description: "Replaces text across all project files matching a glob, skipping ignored files. Use it for renames instead of many replace_text calls.",
+				Parameters: obj(map[string]any{
+					"pattern":     str("Text to find, or a Go regular expression when regex is true"),
+					"replacement": str("Replacement text; with regex it may reference groups as $1"),
+					"glob":        str("Files to search, e.g. **/*.go or *.md (defaults to all files)"),
+					"regex":       boolean("Treat pattern as a regular expression"),
+					"dry_run":     boolean("Report the replacements per file without writing"),
+				}, []string{"pattern", "replacement"}),
+			},
+		},
 		{
 			Type: "function",
 			Function: &llms.FunctionDefinition{
@@ -887,6 +2156,21 @@ func buildLLMTools() ([]llms.Tool, map[string]lctools.Tool) {
 				}, []string{"paths"}),
 			},
 		},
+		{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        "notes",
+				Description: "Reads or updates the project notes (.asimi/notes.md), a scratchpad that persists across turns and sessions. Use it to record TODOs and findings while working through a larger task.",
+				Parameters: obj(map[string]any{
+					"action": map[string]any{
+						"type":        "string",
+						"description": "read, append or write",
+						"enum":        []string{"read", "append", "write"},
+					},
+					"content": str("Text to append, or the full notes to write"),
+				}, []string{"action"}),
+			},
+		},
 		{
 			Type: "function",
 			Function: &llms.FunctionDefinition{
@@ -905,15 +2189,153 @@ func buildLLMTools() ([]llms.Tool, map[string]lctools.Tool) {
 		},
 	}
 
+	if readOnly {
+		var readDefs []llms.Tool
+		for _, def := range defs {
+			if !mutatingTools[def.Function.Name] {
+				readDefs = append(readDefs, def)
+			}
+		}
+		for name := range mutatingTools {
+			delete(execCatalog, name)
+		}
+		defs = readDefs
+	}
+
+	// Apply the [tools] config: drop disabled tools and reword descriptions
+	if len(overrides) > 0 {
+		var kept []llms.Tool
+		for _, def := range defs {
+			override := overrides[def.Function.Name]
+			if !override.IsEnabled() {
+				delete(execCatalog, def.Function.Name)
+				continue
+			}
+			if override.Description != "" {
+				fn := *def.Function
+				fn.Description = override.Description
+				def.Function = &fn
+			}
+			kept = append(kept, def)
+		}
+		defs = kept
+	}
+
 	return defs, execCatalog
 }
 
+// formatToolList lists every tool for /tools: its description, whether it
+// changes files, and whether the model can call it under readOnly and the
+// [tools] overrides. Tools defined for the model without an implementation,
+// or implemented but never offered, are flagged.
+func formatToolList(readOnly bool, overrides map[string]ToolConfig) string {
+	allDefs, implemented := buildLLMTools(false, nil)
+	offeredDefs, _ := buildLLMTools(readOnly, overrides)
+	offered := map[string]bool{}
+	for _, def := range offeredDefs {
+		offered[def.Function.Name] = true
+	}
+
+	var b strings.Builder
+	b.WriteString("🔧 Tools\n")
+	line := func(name, description, status string) {
+		kind := "read-only"
+		if mutatingTools[name] {
+			kind = "mutating"
+		}
+		fmt.Fprintf(&b, "\n%-16s %-9s  %s\n    %s\n", name, kind, status, description)
+	}
+	defined := map[string]bool{}
+	for _, def := range allDefs {
+		name := def.Function.Name
+		defined[name] = true
+		description := def.Function.Description
+		if override := overrides[name]; override.Description != "" {
+			description = override.Description
+		}
+		switch {
+		case implemented[name] == nil:
+			line(name, description, "⚠ defined for the model but not implemented")
+		case offered[name]:
+			line(name, description, "enabled")
+		case !overrides[name].IsEnabled():
+			line(name, description, "off (disabled in [tools])")
+		default:
+			line(name, description, "off (read-only mode)")
+		}
+	}
+	names := make([]string, 0, len(implemented))
+	for name := range implemented {
+		if !defined[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		line(name, implemented[name].Description(), "⚠ implemented but not offered to the model")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
 // Utility to pretty-print any struct for debug (unused but handy during dev).
 func toJSON(v any) string {
 	b, _ := json.MarshalIndent(v, "", "  ")
 	return string(b)
 }
 
+// verboseLogLimit is how much of each text the verbose log keeps
+const verboseLogLimit = 200
+
+// logSnippet masks secrets in text and shortens it for the verbose log.
+// Masking goes first so a cut can't leave part of a key unmatched.
+func logSnippet(text string) string {
+	return truncateSnippet(redactSecrets(text), verboseLogLimit)
+}
+
+// describeMessages summarizes messages for the verbose log: their roles,
+// the size of each part and the start of its text. Images and tool output
+// are left out, they can be huge and hold anything.
+func describeMessages(messages []llms.MessageContent) []string {
+	out := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		parts := make([]string, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				parts = append(parts, fmt.Sprintf("text %d bytes %q", len(p.Text), logSnippet(p.Text)))
+			case llms.ImageURLContent:
+				parts = append(parts, fmt.Sprintf("image %d bytes", len(p.URL)))
+			case llms.BinaryContent:
+				parts = append(parts, fmt.Sprintf("%s %d bytes", p.MIMEType, len(p.Data)))
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					parts = append(parts, fmt.Sprintf("tool call %s %q", p.FunctionCall.Name, logSnippet(p.FunctionCall.Arguments)))
+				}
+			case llms.ToolCallResponse:
+				parts = append(parts, fmt.Sprintf("tool result %s %d bytes", p.Name, len(p.Content)))
+			}
+		}
+		out = append(out, fmt.Sprintf("%s: %s", msg.Role, strings.Join(parts, ", ")))
+	}
+	return out
+}
+
+// describeChoices summarizes a response for the verbose log like
+// describeMessages does a request
+func describeChoices(choices []*llms.ContentChoice) []string {
+	out := make([]string, 0, len(choices))
+	for _, choice := range choices {
+		desc := fmt.Sprintf("stop=%s text %d bytes %q", choice.StopReason, len(choice.Content), logSnippet(choice.Content))
+		for _, tc := range choice.ToolCalls {
+			if tc.FunctionCall != nil {
+				desc += fmt.Sprintf(", tool call %s %q", tc.FunctionCall.Name, logSnippet(tc.FunctionCall.Arguments))
+			}
+		}
+		out = append(out, desc)
+	}
+	return out
+}
+
 // GetSessionDuration returns the duration since the session started
 func (s *Session) GetSessionDuration() time.Duration {
 	return time.Since(s.startTime)
@@ -943,6 +2365,7 @@ type SessionStore struct {
 	saveChan           chan *Session
 	stopChan           chan struct{}
 	closeOnce          sync.Once
+	saveMu             sync.Mutex // Serializes the worker's saves with SaveSessionSync
 }
 
 func generateSessionID() string {
@@ -955,7 +2378,9 @@ func generateSessionID() string {
 	return fmt.Sprintf("%s-%s", timestamp, suffix)
 }
 
-func NewSessionStore(maxSessions, maxAgeDays int) (*SessionStore, error) {
+// NewSessionStore creates the session store of the current project.
+// storageDir is session.storage_dir, empty for the default location.
+func NewSessionStore(maxSessions, maxAgeDays int, storageDir string) (*SessionStore, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get home directory: %w", err)
@@ -971,23 +2396,24 @@ func NewSessionStore(maxSessions, maxAgeDays int) (*SessionStore, error) {
 		slug = defaultProjectSlug
 	}
 
-	repoBase := filepath.Join(homeDir, ".local", "share", "asimi", "repo")
-	projectDir := filepath.Join(repoBase, filepath.FromSlash(slug))
-	storageDir := filepath.Join(projectDir, "sessions")
-	if err := os.MkdirAll(storageDir, 0755); err != nil {
+	dir, err := projectDataDir(storageDir, homeDir, projectRoot, slug, "sessions")
+	if err != nil {
 		return nil, fmt.Errorf("failed to create session storage directory: %w", err)
 	}
 
 	store := &SessionStore{
-		storageDir:         storageDir,
-		projectSlug:        slug,
-		projectRoot:        projectRoot,
-		legacySessionsRoot: filepath.Join(homeDir, ".local", "share", "asimi", "sessions"),
-		legacyIndexPath:    filepath.Join(homeDir, ".local", "share", "asimi", "sessions", "index.json"),
-		maxSessions:        maxSessions,
-		maxAgeDays:         maxAgeDays,
-		saveChan:           make(chan *Session, 100),
-		stopChan:           make(chan struct{}),
+		storageDir:  dir,
+		projectSlug: slug,
+		projectRoot: projectRoot,
+		maxSessions: maxSessions,
+		maxAgeDays:  maxAgeDays,
+		saveChan:    make(chan *Session, 100),
+		stopChan:    make(chan struct{}),
+	}
+	// Sessions saved before per-project storage move to the default location only
+	if storageDir == "" {
+		store.legacySessionsRoot = filepath.Join(homeDir, ".local", "share", "asimi", "sessions")
+		store.legacyIndexPath = filepath.Join(store.legacySessionsRoot, "index.json")
 	}
 
 	if err := store.migrateLegacySessions(); err != nil {
@@ -1049,12 +2475,18 @@ func (store *SessionStore) migrateLegacySessions() error {
 		return nil
 	}
 
-	if err := store.saveIndex(&SessionIndex{Sessions: migrated}); err != nil {
+	unlock, err := store.lockIndex()
+	if err != nil {
+		return err
+	}
+	err = store.saveIndex(&SessionIndex{Sessions: migrated})
+	unlock()
+	if err != nil {
 		return fmt.Errorf("failed to write migrated session index: %w", err)
 	}
 
 	if data, err := json.MarshalIndent(SessionIndex{Sessions: remaining}, "", "  "); err == nil {
-		_ = os.WriteFile(store.legacyIndexPath, data, 0644)
+		_ = writeFileAtomic(store.legacyIndexPath, data, 0644)
 	}
 
 	return nil
@@ -1125,8 +2557,23 @@ func (store *SessionStore) SaveSession(session *Session) {
 	}
 }
 
-// SaveSessionSync saves a session synchronously and returns any error
+// SaveSessionSync saves a session synchronously and returns any error. Saves of
+// the same session still queued are dropped since this one supersedes them.
 func (store *SessionStore) SaveSessionSync(session *Session) error {
+	var others []*Session
+	for pending := true; pending; {
+		select {
+		case queued := <-store.saveChan:
+			if queued != session {
+				others = append(others, queued)
+			}
+		default:
+			pending = false
+		}
+	}
+	for _, queued := range others {
+		store.SaveSession(queued)
+	}
 	return store.saveSessionSync(session)
 }
 
@@ -1157,7 +2604,11 @@ func (store *SessionStore) saveSessionSync(session *Session) error {
 	if session == nil {
 		return fmt.Errorf("cannot save nil session")
 	}
+	store.saveMu.Lock()
+	defer store.saveMu.Unlock()
 
+	// Hold the history still while it's read, a response may be streaming into it
+	unlock := session.lockMessages()
 	session.syncMessages()
 
 	hasUserMessage := false
@@ -1168,6 +2619,7 @@ func (store *SessionStore) saveSessionSync(session *Session) error {
 		}
 	}
 	if !hasUserMessage {
+		unlock()
 		return nil
 	}
 
@@ -1212,21 +2664,24 @@ func (store *SessionStore) saveSessionSync(session *Session) error {
 
 	session.LastUpdated = time.Now()
 
+	sessionJSON, err := json.MarshalIndent(session, "", "  ")
+	// The index gets a copy taken now, the session keeps changing as it streams
+	entry := indexEntry(*session)
+	unlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal session data: %w", err)
+	}
+
 	sessionDir := filepath.Join(store.storageDir, "session-"+session.ID)
 	if err := os.MkdirAll(sessionDir, 0755); err != nil {
 		return fmt.Errorf("failed to create session directory: %w", err)
 	}
-
 	sessionFile := filepath.Join(sessionDir, "session.json")
-	sessionJSON, err := json.MarshalIndent(session, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal session data: %w", err)
-	}
-	if err := os.WriteFile(sessionFile, sessionJSON, 0644); err != nil {
+	if err := writeFileAtomic(sessionFile, sessionJSON, 0644); err != nil {
 		return fmt.Errorf("failed to write session file: %w", err)
 	}
 
-	if err := store.updateIndex(session); err != nil {
+	if err := store.updateIndex(entry); err != nil {
 		return fmt.Errorf("failed to update index: %w", err)
 	}
 
@@ -1358,10 +2813,19 @@ type persistedSession struct {
 	ProjectSlug  string            `json:"project_slug,omitempty"`
 	Messages     []json.RawMessage `json:"messages"`
 	ContextFiles map[string]string `json:"context_files"`
+	RawHistory   []string          `json:"raw_history,omitempty"`
+	Prompts      []sessionPrompt   `json:"prompts,omitempty"`
+}
+
+// sessionPrompt is a prompt the user sent and the index of the message that
+// carries it, so a resumed session can offer its turns for rollback
+type sessionPrompt struct {
+	Index int    `json:"index"`
+	Text  string `json:"text"`
 }
 
 func (store *SessionStore) LoadSession(id string) (*Session, error) {
-	index, err := store.loadIndex()
+	index, err := store.readIndex()
 	if err != nil {
 		return nil, err
 	}
@@ -1412,12 +2876,25 @@ func (store *SessionStore) LoadSession(id string) (*Session, error) {
 		}
 	}
 
+	session, err := decodeSession(data)
+	if err != nil {
+		return nil, err
+	}
+	if session.ProjectSlug == "" {
+		session.ProjectSlug = slug
+	}
+	return session, nil
+}
+
+// decodeSession restores a session from the contents of its session.json
+func decodeSession(data []byte) (*Session, error) {
 	var persisted persistedSession
 	if err := json.Unmarshal(data, &persisted); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal session data: %w", err)
 	}
 
 	session := &Session{
+		messagesMu:   &sync.RWMutex{},
 		ID:           persisted.ID,
 		CreatedAt:    persisted.CreatedAt,
 		LastUpdated:  persisted.LastUpdated,
@@ -1427,10 +2904,8 @@ func (store *SessionStore) LoadSession(id string) (*Session, error) {
 		WorkingDir:   persisted.WorkingDir,
 		ProjectSlug:  persisted.ProjectSlug,
 		ContextFiles: persisted.ContextFiles,
-	}
-
-	if session.ProjectSlug == "" {
-		session.ProjectSlug = slug
+		RawHistory:   persisted.RawHistory,
+		Prompts:      persisted.Prompts,
 	}
 
 	if session.ContextFiles == nil {
@@ -1450,8 +2925,89 @@ func (store *SessionStore) LoadSession(id string) (*Session, error) {
 	return session, nil
 }
 
+// RebuildIndex regenerates index.json from the session directories on disk,
+// moving this project's sessions found in the legacy layout into the storage
+// directory. It returns the number of sessions indexed.
+func (store *SessionStore) RebuildIndex() (int, error) {
+	var sessions []Session
+	seen := make(map[string]bool)
+
+	files, err := filepath.Glob(filepath.Join(store.storageDir, "session-*", "session.json"))
+	if err != nil {
+		return 0, err
+	}
+	for _, file := range files {
+		session, err := readSessionFile(file)
+		if err != nil {
+			slog.Warn("skipping unreadable session", "path", file, "error", err)
+			continue
+		}
+		session.ProjectSlug = store.projectSlug
+		sessions = append(sessions, *session)
+		seen[session.ID] = true
+	}
+
+	// Legacy sessions live under sessions/ or sessions/<slug>/
+	var legacy []*Session
+	if store.legacySessionsRoot != "" {
+		cleanRoot := filepath.Clean(store.projectRoot)
+		filepath.WalkDir(store.legacySessionsRoot, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || d.Name() != "session.json" || !strings.HasPrefix(filepath.Base(filepath.Dir(path)), "session-") {
+				return nil
+			}
+			session, err := readSessionFile(path)
+			if err != nil || seen[session.ID] {
+				return nil
+			}
+			if session.ProjectSlug == store.projectSlug || filepath.Clean(session.WorkingDir) == cleanRoot {
+				legacy = append(legacy, session)
+				seen[session.ID] = true
+			}
+			return nil
+		})
+	}
+	for _, session := range legacy {
+		if err := store.migrateLegacySessionData(*session); err != nil {
+			slog.Warn("failed to migrate legacy session", "id", session.ID, "error", err)
+			continue
+		}
+		session.ProjectSlug = store.projectSlug
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastUpdated.After(sessions[j].LastUpdated)
+	})
+
+	unlock, err := store.lockIndex()
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := store.saveIndex(&SessionIndex{Sessions: sessions}); err != nil {
+		return 0, err
+	}
+	return len(sessions), nil
+}
+
+// readSessionFile loads a session.json file
+func readSessionFile(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	session, err := decodeSession(data)
+	if err != nil {
+		return nil, err
+	}
+	if session.ID == "" {
+		return nil, fmt.Errorf("session file has no id")
+	}
+	return session, nil
+}
+
 func (store *SessionStore) ListSessions(limit int) ([]Session, error) {
-	index, err := store.loadIndex()
+	index, err := store.readIndex()
 	if err != nil {
 		return nil, err
 	}
@@ -1489,7 +3045,28 @@ func (store *SessionStore) ListSessions(limit int) ([]Session, error) {
 	return filtered, nil
 }
 
+// PreviousSession loads the most recently updated session of the project
+// other than currentID
+func (store *SessionStore) PreviousSession(currentID string) (*Session, error) {
+	sessions, err := store.ListSessions(0)
+	if err != nil {
+		return nil, err
+	}
+	for _, session := range sessions {
+		if session.ID != currentID {
+			return store.LoadSession(session.ID)
+		}
+	}
+	return nil, fmt.Errorf("no other session to switch to")
+}
+
 func (store *SessionStore) CleanupOldSessions() error {
+	unlock, err := store.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	index, err := store.loadIndex()
 	if err != nil {
 		return err
@@ -1588,6 +3165,64 @@ func copyDirectory(src, dst string) error {
 	})
 }
 
+const (
+	indexLockStale   = 10 * time.Second               // Age after which a leftover lock file is considered abandoned
+	indexLockTimeout = indexLockStale + 5*time.Second // How long to wait for another instance, long enough to outlast a stale lock
+)
+
+// lockIndex serializes index access across asimi instances using a lock file
+// next to index.json. Callers must invoke the returned func to release it.
+func (store *SessionStore) lockIndex() (func(), error) {
+	lockFile := filepath.Join(store.storageDir, "index.lock")
+	deadline := time.Now().Add(indexLockTimeout)
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(lockFile) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create index lock: %w", err)
+		}
+		if info, statErr := os.Stat(lockFile); statErr == nil && time.Since(info.ModTime()) > indexLockStale {
+			store.takeOverStaleLock(lockFile)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for session index lock %s", lockFile)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// takeOverStaleLock moves an abandoned lock file aside. The rename is atomic,
+// so when several instances find the same stale lock only one removes it. If
+// another instance took the lock between the stat and the rename, its fresh
+// lock is put back.
+func (store *SessionStore) takeOverStaleLock(lockFile string) {
+	aside := fmt.Sprintf("%s.%d.stale", lockFile, os.Getpid())
+	if err := os.Rename(lockFile, aside); err != nil {
+		return
+	}
+	defer os.Remove(aside)
+	if info, err := os.Stat(aside); err == nil && time.Since(info.ModTime()) <= indexLockStale {
+		os.Link(aside, lockFile)
+		return
+	}
+	slog.Warn("removing stale session index lock", "path", lockFile)
+}
+
+// readIndex loads the index while holding the index lock
+func (store *SessionStore) readIndex() (*SessionIndex, error) {
+	unlock, err := store.lockIndex()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	return store.loadIndex()
+}
+
 func (store *SessionStore) loadIndex() (*SessionIndex, error) {
 	indexFile := filepath.Join(store.storageDir, "index.json")
 
@@ -1617,45 +3252,74 @@ func (store *SessionStore) loadIndex() (*SessionIndex, error) {
 	return &index, nil
 }
 
+// indexEntry is the session as listed in index.json: its metadata, the last
+// prompt and the message count, without the messages and context files that
+// only session.json holds, nor the raw history and prompts
+func indexEntry(session Session) Session {
+	if session.Messages != nil {
+		session.LastPrompt = lastHumanMessage(session.Messages)
+		session.MessageCount = countChatMessages(session.Messages)
+	}
+	session.Messages = nil
+	session.ContextFiles = nil
+	session.RawHistory = nil
+	session.Prompts = nil
+	return session
+}
+
+// saveIndex writes the index, replacing index.json atomically. Entries are
+// stored without their messages so the file stays small however long the
+// sessions get.
 func (store *SessionStore) saveIndex(index *SessionIndex) error {
 	indexFile := filepath.Join(store.storageDir, "index.json")
 
-	data, err := json.MarshalIndent(index, "", "  ")
+	entries := make([]Session, len(index.Sessions))
+	for i, session := range index.Sessions {
+		entries[i] = indexEntry(session)
+	}
+	data, err := json.MarshalIndent(SessionIndex{Sessions: entries}, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal index: %w", err)
 	}
 
-	if err := os.WriteFile(indexFile, data, 0644); err != nil {
+	if err := writeFileAtomic(indexFile, data, 0644); err != nil {
 		return fmt.Errorf("failed to write index file: %w", err)
 	}
 
 	return nil
 }
 
-func (store *SessionStore) updateIndex(session *Session) error {
+// updateIndex adds or replaces the session's entry in the index
+func (store *SessionStore) updateIndex(entry Session) error {
+	unlock, err := store.lockIndex()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	index, err := store.loadIndex()
 	if err != nil {
 		return err
 	}
 
-	if session.ProjectSlug == "" {
-		session.ProjectSlug = projectSlug(session.WorkingDir)
+	if entry.ProjectSlug == "" {
+		entry.ProjectSlug = projectSlug(entry.WorkingDir)
 	}
-	if session.ProjectSlug == "" {
-		session.ProjectSlug = defaultProjectSlug
+	if entry.ProjectSlug == "" {
+		entry.ProjectSlug = defaultProjectSlug
 	}
 
 	found := false
 	for i, s := range index.Sessions {
-		if s.ID == session.ID {
-			index.Sessions[i] = *session
+		if s.ID == entry.ID {
+			index.Sessions[i] = entry
 			found = true
 			break
 		}
 	}
 
 	if !found {
-		index.Sessions = append(index.Sessions, *session)
+		index.Sessions = append(index.Sessions, entry)
 	}
 
 	return store.saveIndex(index)
@@ -1689,7 +3353,7 @@ func FormatSessionList(sessions []Session) string {
 	b.WriteString("Recent Sessions:\n\n")
 
 	for i, session := range sessions {
-		messageCount := len(session.Messages)
+		messageCount := sessionMessageCount(session)
 		b.WriteString(fmt.Sprintf("%2d. [%s] %s\n", i+1, formatRelativeTime(session.LastUpdated), session.FirstPrompt))
 		b.WriteString(fmt.Sprintf("    %d messages • %s", messageCount, session.Model))
 
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -250,3 +252,59 @@ func TestSession_RollbackPreservesSystemPrompt(t *testing.T) {
 	assert.Equal(t, 1, len(sess.messages))
 	assert.Equal(t, llms.ChatMessageTypeSystem, sess.messages[0].Role)
 }
+
+// TestSession_RestoreCheckpoint tests that restoring a checkpoint rolls back
+// the messages and the files changed since, deleting new files
+func TestSession_RestoreCheckpoint(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("a.txt", []byte("before\n"), 0o644))
+	assert.NoError(t, os.WriteFile("run.sh", []byte("#!/bin/sh\n"), 0o755))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	_, err = sess.RestoreCheckpoint()
+	assert.Error(t, err, "restoring without a checkpoint should fail")
+
+	cp := sess.SetCheckpoint(3)
+	write := func(path, content string) {
+		sess.toolCallRepetitionCount = 0
+		sess.prepareUserMessage("write " + path)
+		sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           "1",
+			FunctionCall: &llms.FunctionCall{Name: "write_file", Arguments: `{"path": "` + path + `", "content": "` + content + `"}`},
+		}})
+	}
+	write("a.txt", "first")
+	write("a.txt", "second")
+	write("dir/new.txt", "new")
+	sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "2",
+		FunctionCall: &llms.FunctionCall{Name: "apply_patch", Arguments: `{"patch": "*** Begin Patch\n*** Delete File: run.sh\n*** End Patch"}`},
+	}})
+
+	restored, err := sess.RestoreCheckpoint()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.txt", "dir/new.txt", "run.sh"}, restored)
+	info, err := os.Stat("run.sh")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "restored files keep their mode")
+	data, err := os.ReadFile("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "before\n", string(data))
+	_, err = os.Stat("dir/new.txt")
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, cp.Messages, sess.GetMessageSnapshot())
+	assert.Same(t, cp, sess.Checkpoint(), "the checkpoint stays set after a restore")
+
+	// Paths outside the project are refused before anything is written
+	outside := "outside"
+	changed := "changed"
+	cp.Files["../outside.txt"] = &outside
+	cp.Files["a.txt"] = &changed
+	_, err = sess.RestoreCheckpoint()
+	assert.ErrorContains(t, err, "outside project root")
+	data, err = os.ReadFile("a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "before\n", string(data))
+	assert.NoFileExists(t, filepath.Join("..", "outside.txt"))
+}
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -15,7 +20,7 @@ func TestSessionStore_SaveAndLoad(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewSessionStore(50, 30)
+	store, err := NewSessionStore(50, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -144,7 +149,7 @@ func TestSessionStore_EmptySession(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewSessionStore(50, 30)
+	store, err := NewSessionStore(50, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -186,7 +191,7 @@ func TestSessionStore_Cleanup(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewSessionStore(2, 30)
+	store, err := NewSessionStore(2, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -234,7 +239,7 @@ func TestSessionStore_ListSessionsLimit(t *testing.T) {
 	tempDir := t.TempDir()
 	os.Setenv("HOME", tempDir)
 
-	store, err := NewSessionStore(50, 30)
+	store, err := NewSessionStore(50, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -273,6 +278,115 @@ func TestSessionStore_ListSessionsLimit(t *testing.T) {
 	}
 }
 
+func TestSessionStore_IndexLeavesOutMessages(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+
+	session := &Session{
+		Messages: []llms.MessageContent{
+			llms.TextParts(llms.ChatMessageTypeSystem, "system prompt"),
+			llms.TextParts(llms.ChatMessageTypeHuman, "first question"),
+			llms.TextParts(llms.ChatMessageTypeAI, "a long answer"),
+			llms.TextParts(llms.ChatMessageTypeHuman, "second question"),
+		},
+		ContextFiles: map[string]string{"main.go": "package main"},
+	}
+	store.SaveSession(session)
+	store.Flush()
+
+	data, err := os.ReadFile(filepath.Join(store.storageDir, "index.json"))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if strings.Contains(string(data), "a long answer") || strings.Contains(string(data), "package main") {
+		t.Fatalf("Expected the index to leave out messages and context files, got %s", data)
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(store.storageDir, "*.tmp")); len(tmp) > 0 {
+		t.Fatalf("Expected no temporary index file left behind, got %v", tmp)
+	}
+
+	sessions, err := store.ListSessions(10)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("Expected 1 listed session, got %d (%v)", len(sessions), err)
+	}
+	if got := sessionTitlePreview(sessions[0]); got != "second question" {
+		t.Fatalf("Expected the last prompt as the title, got %q", got)
+	}
+	if got := formatMessageCount(sessionMessageCount(sessions[0])); got != "3 msgs" {
+		t.Fatalf("Expected 3 msgs, got %q", got)
+	}
+
+	loaded, err := store.LoadSession(sessions[0].ID)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if len(loaded.Messages) != 4 || loaded.ContextFiles["main.go"] != "package main" {
+		t.Fatalf("Expected session.json to keep the full session, got %d messages", len(loaded.Messages))
+	}
+}
+
+func TestSessionStore_RawHistory(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+
+	session := &Session{
+		Messages: []llms.MessageContent{
+			llms.TextParts(llms.ChatMessageTypeHuman, "list files"),
+			{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{ID: "1", FunctionCall: &llms.FunctionCall{Name: "list_files", Arguments: `{"path":"."}`}}}},
+			{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: "1", Name: "list_files", Content: "main.go"}}},
+			llms.TextParts(llms.ChatMessageTypeAI, "There is main.go"),
+		},
+		Prompts: []sessionPrompt{{Index: 0, Text: "list files"}},
+	}
+
+	// Sessions saved without a raw history get one rebuilt from their messages
+	rebuilt := resumedRawHistory(session)
+	want := []string{
+		"[--:--:--] USER: list files",
+		`[--:--:--] TOOL_SCHEDULED: list_files with input: {"path":"."}`,
+		"[--:--:--] TOOL_SUCCESS: list_files\nOutput: main.go",
+		"[--:--:--] AI_RESPONSE: There is main.go",
+	}
+	if !slices.Equal(rebuilt, want) {
+		t.Fatalf("Expected the rebuilt raw history %q, got %q", want, rebuilt)
+	}
+
+	session.AddRawHistory("USER", "[10:00:00] USER: list files")
+	session.AddRawHistory("STREAM_CHUNK", "[10:00:01] STREAM_CHUNK: There")
+	session.AddRawHistory("AI_RESPONSE", "[10:00:02] AI_RESPONSE: "+strings.Repeat("x", maxRawEntryLen))
+	store.SaveSession(session)
+	store.Flush()
+
+	data, err := os.ReadFile(filepath.Join(store.storageDir, "index.json"))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+	if strings.Contains(string(data), "raw_history") || strings.Contains(string(data), "prompts") {
+		t.Fatalf("Expected the index to leave out the raw history and prompts, got %s", data)
+	}
+
+	loaded, err := store.LoadSession(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if !slices.Equal(loaded.Prompts, session.Prompts) {
+		t.Fatalf("Expected the prompts restored, got %v", loaded.Prompts)
+	}
+	raw := resumedRawHistory(loaded)
+	if len(raw) != 2 || raw[0] != "[10:00:00] USER: list files" {
+		t.Fatalf("Expected the saved raw history without stream chunks, got %q", raw)
+	}
+	if !strings.HasSuffix(raw[1], "bytes truncated]") {
+		t.Fatalf("Expected the long entry truncated, got %d bytes", len(raw[1]))
+	}
+}
+
 func TestFormatRelativeTime(t *testing.T) {
 	now := time.Now()
 
@@ -298,7 +412,7 @@ func TestSessionStore_DirectoryCreation(t *testing.T) {
 	os.Setenv("HOME", tempDir)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewSessionStore(50, 30)
+	store, err := NewSessionStore(50, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -317,3 +431,216 @@ func TestSessionStore_DirectoryCreation(t *testing.T) {
 		t.Fatalf("Expected storageDir '%s', got '%s'", expectedDir, store.storageDir)
 	}
 }
+
+func TestSessionStore_ConcurrentIndexUpdates(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	first, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	second, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+
+	const perStore = 20
+	var wg sync.WaitGroup
+	for _, store := range []*SessionStore{first, second} {
+		wg.Add(1)
+		go func(store *SessionStore) {
+			defer wg.Done()
+			for i := 0; i < perStore; i++ {
+				session := Session{ID: generateSessionID(), ProjectSlug: store.projectSlug, LastUpdated: time.Now()}
+				if err := store.updateIndex(session); err != nil {
+					t.Errorf("updateIndex failed: %v", err)
+				}
+			}
+		}(store)
+	}
+	wg.Wait()
+
+	sessions, err := first.ListSessions(0)
+	if err != nil {
+		t.Fatalf("Failed to list sessions: %v", err)
+	}
+	if len(sessions) != 2*perStore {
+		t.Fatalf("Expected %d sessions after concurrent updates, got %d", 2*perStore, len(sessions))
+	}
+	if _, err := os.Stat(filepath.Join(first.storageDir, "index.lock")); !os.IsNotExist(err) {
+		t.Fatalf("Expected index lock to be released, stat returned %v", err)
+	}
+}
+
+func TestSessionStore_StaleIndexLock(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	if indexLockTimeout <= indexLockStale {
+		t.Fatalf("Expected waiting for the lock to outlast a stale one")
+	}
+
+	// A lock left behind by an instance that died is taken over
+	lockFile := filepath.Join(store.storageDir, "index.lock")
+	if err := os.WriteFile(lockFile, []byte("1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write lock: %v", err)
+	}
+	old := time.Now().Add(-2 * indexLockStale)
+	if err := os.Chtimes(lockFile, old, old); err != nil {
+		t.Fatalf("Failed to age lock: %v", err)
+	}
+	unlock, err := store.lockIndex()
+	if err != nil {
+		t.Fatalf("Expected the stale lock taken over, got %v", err)
+	}
+	unlock()
+	leftovers, _ := filepath.Glob(filepath.Join(store.storageDir, "index.lock*"))
+	if len(leftovers) != 0 {
+		t.Fatalf("Expected no lock files left, got %v", leftovers)
+	}
+}
+
+func TestSessionStore_RebuildIndex(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	defer store.Close()
+
+	for _, prompt := range []string{"first", "second"} {
+		session := &Session{
+			Messages: []llms.MessageContent{{
+				Role:  llms.ChatMessageTypeHuman,
+				Parts: []llms.ContentPart{llms.TextContent{Text: prompt}},
+			}},
+			ContextFiles: map[string]string{},
+		}
+		if err := store.SaveSessionSync(session); err != nil {
+			t.Fatalf("Failed to save session: %v", err)
+		}
+	}
+
+	// A session left in the legacy layout for this project
+	legacyID := "2024-01-01-000000-legacy00"
+	legacyDir := filepath.Join(store.legacySessionsRoot, store.projectSlug, "session-"+legacyID)
+	if err := os.MkdirAll(legacyDir, 0755); err != nil {
+		t.Fatalf("Failed to create legacy dir: %v", err)
+	}
+	legacyJSON := `{"id":"` + legacyID + `","first_prompt":"legacy","project_slug":"` + store.projectSlug + `","messages":[]}`
+	if err := os.WriteFile(filepath.Join(legacyDir, "session.json"), []byte(legacyJSON), 0644); err != nil {
+		t.Fatalf("Failed to write legacy session: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(store.storageDir, "index.json"), []byte("{corrupt"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt index: %v", err)
+	}
+	if _, err := store.ListSessions(10); err == nil {
+		t.Fatalf("Expected a corrupt index to fail")
+	}
+
+	count, err := store.RebuildIndex()
+	if err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+	if count != 3 {
+		t.Fatalf("Expected 3 sessions, got %d", count)
+	}
+	if _, err := store.LoadSession(legacyID); err != nil {
+		t.Fatalf("Expected migrated legacy session to load: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(store.storageDir, "session-"+legacyID, "session.json")); err != nil {
+		t.Fatalf("Expected legacy session to move into the storage dir: %v", err)
+	}
+}
+
+// toolLoopLLM streams a few chunks and asks for a different tool call on each
+// of its first turns, so a streamed prompt appends many messages
+type toolLoopLLM struct {
+	turns int
+	calls int
+}
+
+func (m *toolLoopLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	callOpts := &llms.CallOptions{}
+	for _, opt := range options {
+		opt(callOpts)
+	}
+	m.calls++
+	if callOpts.StreamingFunc != nil {
+		for i := 0; i < 5; i++ {
+			if err := callOpts.StreamingFunc(ctx, []byte("chunk ")); err != nil {
+				return nil, err
+			}
+		}
+	}
+	choice := &llms.ContentChoice{Content: "chunk chunk chunk chunk chunk "}
+	if m.calls <= m.turns {
+		choice.ToolCalls = []llms.ToolCall{{
+			ID:           fmt.Sprintf("call-%d", m.calls),
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: "probe", Arguments: fmt.Sprintf(`{"n": %d}`, m.calls)},
+		}}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{choice}}, nil
+}
+
+func (m *toolLoopLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+// Run with -race: saving and reading the session while a response streams
+// into it must not race with the streaming goroutine
+func TestSessionStore_SaveWhileStreaming(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	if err != nil {
+		t.Fatalf("Failed to create session store: %v", err)
+	}
+	defer store.Close()
+
+	done := make(chan struct{})
+	session, err := NewSession(&toolLoopLLM{turns: 8}, &Config{LLM: LLMConfig{MaxTurns: 20}}, func(msg any) {
+		switch msg.(type) {
+		case streamCompleteMsg, streamErrorMsg:
+			close(done)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	session.scheduler = nil
+	session.toolCatalog["probe"] = &mockTool{name: "probe", callFunc: func(ctx context.Context, input string) (string, error) {
+		return "probed " + input, nil
+	}}
+
+	session.AskStream(context.Background(), "Hello")
+	for streaming := true; streaming; {
+		select {
+		case <-done:
+			streaming = false
+		default:
+			if err := store.SaveSessionSync(session); err != nil {
+				t.Fatalf("SaveSessionSync failed: %v", err)
+			}
+			session.GetContextUsagePercent()
+			session.GetMessageSnapshot()
+			session.CanContinue()
+			generateConversationExportContent(session)
+		}
+	}
+
+	if err := store.SaveSessionSync(session); err != nil {
+		t.Fatalf("SaveSessionSync failed: %v", err)
+	}
+	loaded, err := store.LoadSession(session.ID)
+	if err != nil {
+		t.Fatalf("Failed to load session: %v", err)
+	}
+	if len(loaded.Messages) != len(session.MessagesSnapshot()) {
+		t.Fatalf("Expected %d saved messages, got %d", len(session.MessagesSnapshot()), len(loaded.Messages))
+	}
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -37,6 +40,9 @@ func (m *MockStreamingLLM) GenerateContent(ctx context.Context, messages []llms.
 			}
 		}
 	}
+	if m.shouldFail {
+		return nil, errors.New("connection reset by peer")
+	}
 
 	return &llms.ContentResponse{
 		Choices: []*llms.ContentChoice{
@@ -103,6 +109,29 @@ func TestSession_AskStream(t *testing.T) {
 	assert.Equal(t, 1, completeCount, "Should have received exactly one complete notification")
 }
 
+func TestSession_AskStreamErrorKeepsPartialResponse(t *testing.T) {
+	mockLLM := &MockStreamingLLM{response: "Half of an answer", shouldFail: true}
+	done := make(chan struct{})
+	session, err := NewSession(mockLLM, nil, func(msg any) {
+		if _, ok := msg.(streamErrorMsg); ok {
+			close(done)
+		}
+	})
+	require.NoError(t, err)
+	assert.False(t, session.CanContinue())
+
+	session.AskStream(context.Background(), "Hello")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not fail")
+	}
+
+	require.True(t, session.CanContinue())
+	last := session.messages[len(session.messages)-1]
+	assert.Equal(t, llms.TextPart("Half of an answer"), last.Parts[0])
+}
+
 func TestChatComponent_AppendToLastMessage(t *testing.T) {
 	chat := NewChatComponent(80, 20)
 
@@ -122,3 +151,179 @@ func TestChatComponent_AppendToLastMessage(t *testing.T) {
 	assert.Equal(t, 2, len(chat.Messages))
 	assert.Equal(t, "Asimi: This is streaming", chat.Messages[1])
 }
+
+// scriptedStreamingLLM streams each choice's content and returns the choices in turn
+type scriptedStreamingLLM struct {
+	choices  []*llms.ContentChoice
+	calls    int
+	streamed int // Calls made with a streaming function
+}
+
+func (m *scriptedStreamingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	callOpts := &llms.CallOptions{}
+	for _, opt := range options {
+		opt(callOpts)
+	}
+	choice := m.choices[min(m.calls, len(m.choices)-1)]
+	m.calls++
+	if callOpts.StreamingFunc != nil {
+		m.streamed++
+	}
+	if callOpts.StreamingFunc != nil && choice.Content != "" {
+		if err := callOpts.StreamingFunc(ctx, []byte(choice.Content)); err != nil {
+			return nil, err
+		}
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{choice}}, nil
+}
+
+func (m *scriptedStreamingLLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return "", nil
+}
+
+func TestSession_AskStreamPhases(t *testing.T) {
+	llm := &scriptedStreamingLLM{choices: []*llms.ContentChoice{
+		{Content: "Let me look.", ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "probe", Arguments: `{}`}}}},
+		{Content: "Done."},
+	}}
+	var phases []string
+	done := make(chan struct{})
+	session, err := NewSession(llm, nil, func(msg any) {
+		switch m := msg.(type) {
+		case thinkingPhaseStartMsg:
+			phases = append(phases, "thinking")
+		case assistantTextStartMsg:
+			phases = append(phases, "text")
+		case toolPhaseStartMsg:
+			phases = append(phases, fmt.Sprintf("tools(%d)", m.count))
+		case streamCompleteMsg:
+			close(done)
+		}
+	})
+	require.NoError(t, err)
+	session.toolCatalog["probe"] = &mockTool{name: "probe", callFunc: func(ctx context.Context, input string) (string, error) {
+		return "ok", nil
+	}}
+
+	session.AskStream(context.Background(), "Hello")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not complete")
+	}
+	assert.Equal(t, []string{"thinking", "text", "tools(1)", "thinking", "text"}, phases)
+}
+
+func TestSession_AskStreamWithoutStreaming(t *testing.T) {
+	llm := &scriptedStreamingLLM{choices: []*llms.ContentChoice{
+		{Content: "Let me look.", ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "probe", Arguments: `{}`}}}},
+		{Content: "Done."},
+	}}
+	streaming := false
+	var chunks []string
+	done := make(chan struct{})
+	session, err := NewSession(llm, &Config{LLM: LLMConfig{Streaming: &streaming}}, func(msg any) {
+		switch m := msg.(type) {
+		case streamChunkMsg:
+			chunks = append(chunks, string(m))
+		case streamCompleteMsg:
+			close(done)
+		}
+	})
+	require.NoError(t, err)
+	probed := false
+	session.toolCatalog["probe"] = &mockTool{name: "probe", callFunc: func(ctx context.Context, input string) (string, error) {
+		probed = true
+		return "ok", nil
+	}}
+
+	session.AskStream(context.Background(), "Hello")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not complete")
+	}
+	assert.Equal(t, 0, llm.streamed)
+	assert.True(t, probed, "tool calls should still run")
+	assert.Equal(t, []string{"Let me look.", "Done."}, chunks)
+	last := session.messages[len(session.messages)-1]
+	assert.Equal(t, llms.ChatMessageTypeAI, last.Role)
+	assert.Equal(t, "Done.", last.Parts[0].(llms.TextContent).Text)
+}
+
+func TestSession_ResponseDetails(t *testing.T) {
+	llm := &scriptedStreamingLLM{choices: []*llms.ContentChoice{{
+		Content:        "Done.",
+		StopReason:     "end_turn",
+		GenerationInfo: map[string]any{"InputTokens": 120, "OutputTokens": 8},
+	}}}
+	var details []string
+	session, err := NewSession(llm, nil, func(msg any) {
+		if d, ok := msg.(responseDetailsMsg); ok {
+			details = append(details, string(d))
+		}
+	})
+	require.NoError(t, err)
+
+	_, err = session.generateLLMResponse(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Empty(t, details, "details are off by default")
+
+	session.SetResponseDetails(true)
+	_, err = session.generateLLMResponse(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stop=end_turn · tokens in=120 out=8"}, details)
+
+	got := formatResponseDetails(&llms.ContentChoice{
+		GenerationInfo: map[string]any{"PromptTokens": 5, "CompletionTokens": 2},
+		ToolCalls:      []llms.ToolCall{{ID: "c1", FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"a.go"}`}}},
+	})
+	assert.Equal(t, `stop=(none) · tokens in=5 out=2 · tool read_file {"path":"a.go"} (id c1)`, got)
+}
+
+func TestSession_TruncatedToolCallStream(t *testing.T) {
+	llm := &scriptedStreamingLLM{choices: []*llms.ContentChoice{
+		// The stream broke while the arguments were streaming
+		{ToolCalls: []llms.ToolCall{{ID: "1", Type: "function", FunctionCall: &llms.FunctionCall{Name: "probe", Arguments: `{"path": "main.go", "conte`}}}},
+		{ToolCalls: []llms.ToolCall{{ID: "2", Type: "function", FunctionCall: &llms.FunctionCall{Name: "probe", Arguments: `{"path": "main.go"}`}}}},
+		{Content: "Done."},
+	}}
+	done := make(chan struct{})
+	session, err := NewSession(llm, nil, func(msg any) {
+		if _, ok := msg.(streamCompleteMsg); ok {
+			close(done)
+		}
+	})
+	require.NoError(t, err)
+	var probed []string
+	session.toolCatalog["probe"] = &mockTool{name: "probe", callFunc: func(ctx context.Context, input string) (string, error) {
+		probed = append(probed, input)
+		return "ok", nil
+	}}
+
+	session.AskStream(context.Background(), "Hello")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not complete")
+	}
+	assert.Equal(t, []string{`{"path": "main.go"}`}, probed, "only the re-emitted call should run")
+
+	var responses []string
+	for _, msg := range session.messages {
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case llms.ToolCall:
+				assert.True(t, json.Valid([]byte(p.FunctionCall.Arguments)), "stored arguments must stay valid JSON: %s", p.FunctionCall.Arguments)
+			case llms.ToolCallResponse:
+				responses = append(responses, p.Content)
+			}
+		}
+	}
+	require.Len(t, responses, 2)
+	assert.Contains(t, responses[0], "cut off")
+	assert.Equal(t, "ok", responses[1])
+
+	assert.False(t, truncatedJSON(`{"a": 1}}`))
+	assert.True(t, truncatedJSON(`[1, 2`))
+}
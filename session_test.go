@@ -2,10 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+	"unicode/utf8"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tmc/langchaingo/llms"
@@ -80,6 +85,34 @@ func (m *mockLLMNoTools) GenerateContent(ctx context.Context, messages []llms.Me
 	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "Hello world"}}}, nil
 }
 
+// mockStalledLLM never answers, like a provider that accepts the connection and hangs
+type mockStalledLLM struct{ llms.Model }
+
+func (m *mockStalledLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestSession_RequestTimeout(t *testing.T) {
+	sess, err := NewSession(&mockStalledLLM{}, &Config{LLM: LLMConfig{RequestTimeoutMs: 20}}, func(any) {})
+	assert.NoError(t, err)
+
+	_, err = sess.Ask(context.Background(), "hello?")
+	var llmErr *LLMError
+	assert.True(t, errors.As(err, &llmErr))
+	assert.Equal(t, LLMErrorTimeout, llmErr.Kind)
+	assert.Contains(t, llmErr.Message, "20ms")
+
+	// Cancelling the request is not reported as a timeout
+	ctx, cancel := context.WithCancel(context.Background())
+	sess.config.RequestTimeoutMs = -1
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = sess.Ask(ctx, "hello again?")
+	assert.True(t, errors.As(err, &llmErr))
+	assert.NotEqual(t, LLMErrorTimeout, llmErr.Kind)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
 func TestSession_NoTools(t *testing.T) {
 	t.Parallel()
 
@@ -100,21 +133,15 @@ func (m *sessionMockLLMReAct) Call(ctx context.Context, prompt string, options .
 }
 func (m *sessionMockLLMReAct) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
 	last := messages[len(messages)-1]
-	switch last.Role {
-	case llms.ChatMessageTypeHuman:
-		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
-			Content: "Action: read_file\nAction Input: { \"path\": \"testdata/test.txt\" }",
-		}}}, nil
-	case llms.ChatMessageTypeTool:
+	if last.Role == llms.ChatMessageTypeHuman {
+		text := last.Parts[len(last.Parts)-1].(llms.TextContent).Text
 		// Return final answer echoing the tool output
-		var out string
-		for i := len(last.Parts) - 1; i >= 0; i-- {
-			if tr, ok := last.Parts[i].(llms.ToolCallResponse); ok {
-				out = tr.Content
-				break
-			}
+		if observation, ok := strings.CutPrefix(text, reactObservationPrefix); ok {
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: observation}}}, nil
 		}
-		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: out}}}, nil
+		return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+			Content: "Thought: I need the file.\nAction: read_file\nAction Input: {\n  \"path\": \"testdata/test.txt\"\n}\nObservation:",
+		}}}, nil
 	}
 	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
 }
@@ -168,10 +195,9 @@ func (m *sessionMockLLMWriteRead) GenerateContent(ctx context.Context, messages
 }
 
 func TestSession_WriteAndReadFile(t *testing.T) {
-	t.Parallel()
-
-	// Create a temp file path
+	// Create a temp file path, in the project so the write is allowed
 	tmp := t.TempDir()
+	t.Chdir(tmp)
 	path := tmp + "/wr_test.txt"
 
 	// We encode the path into the system message content via the template; to avoid
@@ -418,3 +444,985 @@ func (m *sessionMockLLMMultiTools) GenerateContent(ctx context.Context, messages
 	}
 	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
 }
+
+func TestClassifyLLMError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind LLMErrorKind
+	}{
+		{"auth status", errors.New("anthropic: API returned unexpected status code: 401"), LLMErrorAuth},
+		{"typed auth", llms.NewError(llms.ErrCodeAuthentication, "openai", "bad key"), LLMErrorAuth},
+		{"rate limit", errors.New("429 Too Many Requests"), LLMErrorRateLimit},
+		{"context length", errors.New("prompt is too long: 210000 tokens > 200000 maximum"), LLMErrorContextLength},
+		{"invalid model", errors.New("not_found_error: model: claude-nope"), LLMErrorInvalidModel},
+		{"network", errors.New("dial tcp: lookup api.anthropic.com: no such host"), LLMErrorNetwork},
+		{"typed network", &net.OpError{Op: "dial", Err: errors.New("refused")}, LLMErrorNetwork},
+		{"typed rate limit", llms.NewError(llms.ErrCodeRateLimit, "anthropic", "slow down"), LLMErrorRateLimit},
+		{"overloaded", errors.New("API returned unexpected status code: 529: overloaded_error"), LLMErrorRateLimit},
+		{"unknown", errors.New("something odd"), LLMErrorUnknown},
+		// Numbers and words in unrelated errors don't count
+		{"number in a path", errors.New("failed to read /tmp/session-4291/quota.json"), LLMErrorUnknown},
+		{"model in a tool error", errors.New("tool read_file: model.go not found"), LLMErrorUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			llmErr := classifyLLMError(tt.err)
+			assert.Equal(t, tt.kind, llmErr.Kind)
+			assert.ErrorIs(t, llmErr, tt.err)
+			if tt.kind != LLMErrorUnknown {
+				assert.NotEmpty(t, llmErr.Action)
+			}
+			// Classifying twice keeps the original classification
+			assert.Same(t, llmErr, classifyLLMError(llmErr))
+		})
+	}
+}
+
+func TestSession_AttachImage(t *testing.T) {
+	dir := t.TempDir()
+	imgPath := filepath.Join(dir, "shot.png")
+	// Minimal PNG header is enough for content sniffing
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	assert.NoError(t, os.WriteFile(imgPath, png, 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{Provider: "anthropic", Model: "claude-sonnet-4-5-20250929"}}, func(any) {})
+	assert.NoError(t, err)
+
+	assert.NoError(t, sess.AttachImage(imgPath))
+	sess.prepareUserMessage("what is in this screenshot?")
+
+	last := sess.messages[len(sess.messages)-1]
+	assert.Len(t, last.Parts, 2)
+	bin, ok := last.Parts[0].(llms.BinaryContent)
+	assert.True(t, ok)
+	assert.Equal(t, "image/png", bin.MIMEType)
+	assert.Empty(t, sess.pendingImages)
+
+	notImage := filepath.Join(dir, "notes.png")
+	assert.NoError(t, os.WriteFile(notImage, []byte("just text"), 0o644))
+	assert.Error(t, sess.AttachImage(notImage))
+
+	textOnly, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{Provider: "ollama", Model: "llama3.1"}}, func(any) {})
+	assert.NoError(t, err)
+	assert.Error(t, textOnly.AttachImage(imgPath))
+}
+
+func TestSession_ReadOnly(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{ReadOnly: true}}, func(any) {})
+	assert.NoError(t, err)
+	assert.True(t, sess.IsReadOnly())
+
+	for _, def := range sess.toolDefs {
+		assert.False(t, mutatingTools[def.Function.Name], "%s should be withheld", def.Function.Name)
+	}
+	_, ok := sess.toolCatalog["write_file"]
+	assert.False(t, ok)
+	_, ok = sess.toolCatalog["read_file"]
+	assert.True(t, ok)
+	assert.Contains(t, sess.messages[0].Parts, llms.TextPart(readOnlyNotice))
+
+	sess.SetReadOnly(false)
+	_, ok = sess.toolCatalog["write_file"]
+	assert.True(t, ok)
+	assert.NotContains(t, sess.messages[0].Parts, llms.TextPart(readOnlyNotice))
+}
+
+// unofferedTool is implemented but has no definition in buildLLMTools
+type unofferedTool struct{ ReadFileTool }
+
+func (unofferedTool) Name() string { return "unoffered" }
+
+func TestFormatToolList(t *testing.T) {
+	disabled := false
+	list := formatToolList(true, map[string]ToolConfig{"notes": {Enabled: &disabled}, "read_file": {Description: "Reads one file."}})
+	assert.Contains(t, list, "read_file        read-only  enabled\n    Reads one file.")
+	assert.Contains(t, list, "write_file       mutating   off (read-only mode)")
+	assert.Contains(t, list, "notes            mutating   off (disabled in [tools])")
+	assert.NotContains(t, list, "⚠")
+
+	saved := availableTools
+	t.Cleanup(func() { availableTools = saved })
+	availableTools = append([]Tool{unofferedTool{}}, saved[1:]...)
+	list = formatToolList(false, nil)
+	assert.Contains(t, list, "read_file        read-only  ⚠ defined for the model but not implemented")
+	assert.Contains(t, list, "unoffered        read-only  ⚠ implemented but not offered to the model")
+}
+
+func TestSession_ReadCache(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "cached.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("first"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	sess.prepareUserMessage("read it twice")
+
+	read := func(id string) string {
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           id,
+			FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"` + path + `"}`},
+		}})
+		resp := msgs[0].Parts[0].(llms.ToolCallResponse)
+		assert.Equal(t, id, resp.ToolCallID)
+		return resp.Content
+	}
+
+	assert.Contains(t, read("1"), "first")
+	assert.NoError(t, os.WriteFile(path, []byte("second"), 0o644))
+	assert.Contains(t, read("2"), "first", "duplicate read within a turn should be cached")
+
+	sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "3",
+		FunctionCall: &llms.FunctionCall{Name: "write_file", Arguments: `{"path":"` + path + `","content":"third"}`},
+	}})
+	assert.Contains(t, read("4"), "third", "writing the file should invalidate its cached read")
+
+	// Multi-file edits invalidate the reads of every file they change, and only those
+	other := filepath.Join(dir, "other.txt")
+	assert.NoError(t, os.WriteFile(other, []byte("kept"), 0o644))
+	msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "r",
+		FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"other.txt"}`},
+	}})
+	assert.Contains(t, msgs[0].Parts[0].(llms.ToolCallResponse).Content, "kept")
+	assert.NoError(t, os.WriteFile(other, []byte("changed"), 0o644))
+	sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "p",
+		FunctionCall: &llms.FunctionCall{Name: "project_replace", Arguments: `{"pattern":"third","replacement":"patched","glob":"cached.txt"}`},
+	}})
+	assert.Contains(t, read("6"), "patched")
+	msgs, _ = sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "r2",
+		FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"other.txt"}`},
+	}})
+	assert.Contains(t, msgs[0].Parts[0].(llms.ToolCallResponse).Content, "kept", "unrelated reads stay cached")
+
+	assert.NoError(t, os.WriteFile(path, []byte("fourth"), 0o644))
+	sess.prepareUserMessage("next turn")
+	assert.Contains(t, read("5"), "fourth", "a new turn should start with an empty cache")
+}
+
+func TestSession_InvalidToolArgsIncludeSchema(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	sess.prepareUserMessage("edit something")
+
+	call := func(name, args string) string {
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           "1",
+			FunctionCall: &llms.FunctionCall{Name: name, Arguments: args},
+		}})
+		return msgs[0].Parts[0].(llms.ToolCallResponse).Content
+	}
+
+	// Truncated JSON
+	content := call("read_file", `{"path": "main.go"`)
+	assert.Contains(t, content, "invalid arguments for read_file: not valid JSON")
+	assert.Contains(t, content, "matching this schema")
+	assert.Contains(t, content, `"path": {`)
+	assert.Contains(t, content, `"required": [`)
+
+	// Valid JSON with a wrong type
+	content = call("replace_text", `{"path": 5, "old_text": "a", "new_text": "b"}`)
+	assert.Contains(t, content, "cannot unmarshal number")
+	assert.Contains(t, content, `"old_text": {`)
+	assert.Contains(t, content, "call replace_text again")
+}
+
+func TestSession_TurnDiffstat(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("a.txt", []byte("one\n2\nthree\n"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	sess.prepareUserMessage("edit the files")
+
+	call := func(name, args string) {
+		sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           name,
+			FunctionCall: &llms.FunctionCall{Name: name, Arguments: args},
+		}})
+	}
+	call("replace_text", `{"path":"a.txt","old_text":"2\n","new_text":"two\ntwo and a half\n"}`)
+	call("write_file", `{"path":"new.txt","content":"fresh\n"}`)
+	call("read_file", `{"path":"a.txt"}`)
+
+	stats := sess.TurnDiffstat()
+	assert.Equal(t, []fileDiffstat{
+		{Path: "a.txt", Added: 2, Removed: 1},
+		{Path: "new.txt", Added: 1, Removed: 0},
+	}, stats)
+	assert.Equal(t, "Changed 2 files (+3 -1)\n  a.txt    +2 -1\n  new.txt  +1 -0", formatDiffstat(stats))
+
+	sess.prepareUserMessage("next turn")
+	assert.Empty(t, sess.TurnDiffstat())
+}
+
+func TestSession_Summarize(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	before := len(sess.messages)
+
+	note, err := sess.Summarize(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello world", note)
+	assert.Len(t, sess.messages, before, "summarizing must not change the history")
+}
+
+func TestAppendSessionNote(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("AGENTS.md", []byte("# Project\n\nUse go-git.\n"), 0o644))
+
+	at := time.Date(2025, 10, 1, 9, 30, 0, 0, time.UTC)
+	assert.NoError(t, appendSessionNote("- Added caching", at))
+	assert.NoError(t, appendSessionNote("- Fixed tests", at.Add(time.Hour)))
+
+	b, err := os.ReadFile("AGENTS.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "# Project\n\nUse go-git.\n\n## Session Notes\n\n### 2025-10-01 09:30\n\n- Added caching\n\n### 2025-10-01 10:30\n\n- Fixed tests\n", string(b))
+	assert.Contains(t, readProjectContext(), "- Fixed tests")
+}
+
+func TestParseToolCallChunk(t *testing.T) {
+	name, args, ok := parseToolCallChunk([]byte(`[{"id":"call_1","type":"function","function":{"name":"write_file","arguments":""}}]`))
+	assert.True(t, ok)
+	assert.Equal(t, "write_file", name)
+	assert.Empty(t, args)
+
+	name, args, ok = parseToolCallChunk([]byte(`[{"function":{"arguments":"{\"path\":"}}]`))
+	assert.True(t, ok)
+	assert.Empty(t, name)
+	assert.Equal(t, `{"path":`, args)
+
+	_, _, ok = parseToolCallChunk([]byte("[{ not json"))
+	assert.False(t, ok)
+	_, _, ok = parseToolCallChunk([]byte("Hello"))
+	assert.False(t, ok)
+}
+
+func TestSession_SystemPromptNamesAvailableTools(t *testing.T) {
+	systemText := func(sess *Session) string {
+		var b strings.Builder
+		for _, part := range sess.messages[0].Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				b.WriteString(text.Text)
+			}
+		}
+		return b.String()
+	}
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	prompt := systemText(sess)
+	for _, def := range sess.toolDefs {
+		assert.Contains(t, prompt, "- "+def.Function.Name+": ")
+	}
+	assert.Contains(t, prompt, "'run_in_shell'")
+	assert.NotContains(t, prompt, "run_shell_command")
+	assert.NotContains(t, prompt, "''")
+
+	sess.SetReadOnly(true)
+	prompt = systemText(sess)
+	assert.NotContains(t, prompt, "run_in_shell")
+	assert.NotContains(t, prompt, "write_file")
+	assert.Contains(t, prompt, "- read_file: ")
+	assert.NotContains(t, prompt, "''")
+
+	disabled := false
+	sess, err = NewSession(&mockLLMNoTools{}, &Config{Tools: map[string]ToolConfig{"run_in_shell": {Enabled: &disabled}}}, func(any) {})
+	assert.NoError(t, err)
+	prompt = systemText(sess)
+	assert.NotContains(t, prompt, "run_in_shell")
+	assert.Contains(t, prompt, "'write_file'")
+	assert.NotContains(t, prompt, "''")
+}
+
+// toolOnlyMockLLM keeps listing directories without saying anything until asked to finish
+type toolOnlyMockLLM struct {
+	llms.Model
+	calls int
+}
+
+func (m *toolOnlyMockLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == llms.ChatMessageTypeHuman {
+		if text, ok := last.Parts[0].(llms.TextContent); ok && text.Text == finishNudge {
+			return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "Summary: listed everything."}}}, nil
+		}
+	}
+	m.calls++
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		ToolCalls: []llms.ToolCall{{
+			ID:           "call-" + strings.Repeat("x", m.calls),
+			Type:         "function",
+			FunctionCall: &llms.FunctionCall{Name: "list_files", Arguments: `{"path":"` + strings.Repeat("./", m.calls) + `"}`},
+		}},
+	}}}, nil
+}
+
+func TestSession_NudgesAfterToolOnlyTurns(t *testing.T) {
+	llm := &toolOnlyMockLLM{}
+	sess, err := NewSession(llm, &Config{LLM: LLMConfig{MaxTurns: 50}}, func(any) {})
+	assert.NoError(t, err)
+
+	out, err := sess.Ask(context.Background(), "explore")
+	assert.NoError(t, err)
+	assert.Equal(t, "Summary: listed everything.", out)
+	assert.Equal(t, toolOnlyTurnLimit, llm.calls)
+}
+
+func TestSession_CompactToolOutput(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{CompactToolOutput: 1}}, func(any) {})
+	assert.NoError(t, err)
+
+	turn := func(id, command string) {
+		sess.prepareUserMessage("run " + command)
+		sess.messages = append(sess.messages,
+			llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{
+				ID:           id,
+				Type:         "function",
+				FunctionCall: &llms.FunctionCall{Name: "run_in_shell", Arguments: `{"command":"` + command + `"}`},
+			}}},
+			llms.MessageContent{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{
+				ToolCallID: id,
+				Name:       "run_in_shell",
+				Content:    `{"output":"` + strings.Repeat("ok ", 100) + `","exitCode":"0"}`,
+			}}},
+		)
+	}
+	toolOutput := func(id string) string {
+		for _, msg := range sess.messages {
+			for _, part := range msg.Parts {
+				if resp, ok := part.(llms.ToolCallResponse); ok && resp.ToolCallID == id {
+					return resp.Content
+				}
+			}
+		}
+		return ""
+	}
+
+	turn("1", "go test")
+	turn("2", "go vet")
+	assert.Equal(t, "[output from `go test` truncated, exit 0]", toolOutput("1"))
+	assert.Contains(t, toolOutput("2"), "ok ok")
+
+	sess.SetCompactToolOutput(0)
+	turn("3", "go build")
+	assert.Contains(t, toolOutput("2"), "ok ok")
+	assert.Equal(t, 1, sess.config.CompactToolOutput, "the session setting leaves the config alone")
+}
+
+func TestSession_BuildPromptWithContextFormats(t *testing.T) {
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	sess.ContextFiles = map[string]string{}
+	sess.AddContextFile("main.go", "package main\n")
+	sess.AddContextFile("README.md", "Use ```go build```")
+
+	prompt := sess.buildPromptWithContext("explain")
+	assert.Equal(t, "README.md:\n````markdown\nUse ```go build```\n````\n\nmain.go:\n```go\npackage main\n```\nexplain", prompt)
+
+	sess.config.ContextFormat = "markers"
+	sess.config.ContextPromptFirst = true
+	prompt = sess.buildPromptWithContext("explain")
+	assert.True(t, strings.HasPrefix(prompt, "explain\n\n--- Context from: README.md ---"))
+	assert.Contains(t, prompt, "--- Context from: main.go ---\npackage main\n\n--- End of Context from: main.go ---")
+
+	// Attached files ride along with the next prompt only
+	sess.AttachContext("tree.txt", "main.go\n")
+	sess.prepareUserMessage("explain")
+	assert.Contains(t, sess.messages[len(sess.messages)-1].Parts[0].(llms.TextContent).Text, "--- Context from: tree.txt ---")
+	assert.NotContains(t, sess.GetContextFiles(), "tree.txt")
+	assert.NotContains(t, sess.buildPromptWithContext("next"), "tree.txt")
+}
+
+func TestSession_SpillLargeToolOutput(t *testing.T) {
+	t.Chdir(t.TempDir())
+	big := "BEGIN\n" + strings.Repeat("line of output\n", 500) + "END\n"
+	assert.NoError(t, os.WriteFile("big.txt", []byte(big), 0o644))
+	assert.NoError(t, os.WriteFile("small.txt", []byte("tiny\n"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{ToolOutputLimit: 1000}}, func(any) {})
+	assert.NoError(t, err)
+	sess.prepareUserMessage("read the files")
+
+	call := func(id, name, args string) string {
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           id,
+			FunctionCall: &llms.FunctionCall{Name: name, Arguments: args},
+		}})
+		return msgs[0].Parts[0].(llms.ToolCallResponse).Content
+	}
+
+	content := call("call1", "read_many_files", `{"paths": ["big.txt"]}`)
+	assert.Less(t, len(content), 1300)
+	assert.Contains(t, content, "BEGIN")
+	assert.Contains(t, content, "END")
+	path := filepath.Join(".asimi", "tool-output", "read_many_files-call1.txt")
+	assert.Contains(t, content, "saved to "+path)
+	saved, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved), big)
+
+	// Small results and tools outside the spill set are sent whole
+	content = call("call2", "read_many_files", `{"paths": ["small.txt"]}`)
+	assert.NotContains(t, content, "saved to")
+	content = call("call3", "read_file", `{"path": "big.txt"}`)
+	assert.Equal(t, big, content)
+}
+
+func TestSpillToolOutput(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0o755))
+	t.Chdir(filepath.Join(root, "sub"))
+	dir := filepath.Join(root, ".asimi", "tool-output")
+
+	// Cuts fall on rune boundaries and the output is saved under the project root
+	content := spillToolOutput("call1", "run_in_shell", strings.Repeat("שלום ", 100), 101)
+	assert.True(t, utf8.ValidString(content))
+	assert.FileExists(t, filepath.Join(dir, "run_in_shell-call1.txt"))
+
+	// Only the newest results are kept
+	old := time.Now().Add(-time.Hour)
+	for i := range maxToolOutputFiles {
+		path := filepath.Join(dir, fmt.Sprintf("old-%d.txt", i))
+		assert.NoError(t, os.WriteFile(path, nil, 0o644))
+		assert.NoError(t, os.Chtimes(path, old, old))
+	}
+	spillToolOutput("call2", "run_in_shell", strings.Repeat("x", 200), 100)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, maxToolOutputFiles)
+	assert.FileExists(t, filepath.Join(dir, "run_in_shell-call1.txt"))
+	assert.FileExists(t, filepath.Join(dir, "run_in_shell-call2.txt"))
+}
+
+func TestSession_ToolOverrides(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.MkdirAll(".asimi", 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(".asimi", "conf.toml"), []byte(`[llm]
+provider = "fake"
+
+[tools.run_in_shell]
+enabled = false
+
+[tools.read_file]
+description = "Read one file."
+`), 0o644))
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+
+	sess, err := NewSession(&mockLLMNoTools{}, cfg, func(any) {})
+	assert.NoError(t, err)
+	descriptions := map[string]string{}
+	for _, def := range sess.toolDefs {
+		descriptions[def.Function.Name] = def.Function.Description
+	}
+	assert.NotContains(t, descriptions, "run_in_shell")
+	assert.NotContains(t, sess.toolCatalog, "run_in_shell")
+	assert.Equal(t, "Read one file.", descriptions["read_file"])
+	assert.Contains(t, descriptions, "write_file")
+
+	// A disabled tool the model calls anyway isn't run
+	msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "1",
+		FunctionCall: &llms.FunctionCall{Name: "run_in_shell", Arguments: `{"command": "echo hi"}`},
+	}})
+	assert.NotContains(t, msgs[0].Parts[0].(llms.ToolCallResponse).Content, "hi\n")
+
+	// Overrides survive switching read-only mode
+	sess.SetReadOnly(true)
+	sess.SetReadOnly(false)
+	assert.NotContains(t, sess.toolCatalog, "run_in_shell")
+}
+
+func TestSession_ToolResultImages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	assert.NoError(t, os.WriteFile("shot.png", png, 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{Provider: "anthropic", Model: "claude-sonnet-4-20250514"}}, func(any) {})
+	assert.NoError(t, err)
+	sess.prepareUserMessage("take a screenshot")
+	sess.toolCatalog["screenshot"] = structuredTool{&mockTool{name: "screenshot", callFunc: func(ctx context.Context, input string) (string, error) {
+		return NewToolResult("captured the page", ToolResultImage{Path: "shot.png"}).String(), nil
+	}}}
+	call := func() []llms.MessageContent {
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           "1",
+			FunctionCall: &llms.FunctionCall{Name: "screenshot", Arguments: `{}`},
+		}})
+		return msgs
+	}
+
+	msgs := call()
+	assert.Len(t, msgs, 2)
+	assert.Equal(t, "captured the page", msgs[0].Parts[0].(llms.ToolCallResponse).Content)
+	assert.Equal(t, llms.ChatMessageTypeHuman, msgs[1].Role)
+	assert.Equal(t, llms.BinaryPart("image/png", png), msgs[1].Parts[1])
+
+	// Models without vision get the text and a note instead
+	sess.Model = "claude-2.1"
+	msgs = call()
+	assert.Len(t, msgs, 1)
+	assert.Contains(t, msgs[0].Parts[0].(llms.ToolCallResponse).Content, "1 image(s) omitted")
+
+	// Plain output passes through untouched
+	text, images := sess.splitToolResult("read_file", `{"kind": "other"}`)
+	assert.Equal(t, `{"kind": "other"}`, text)
+	assert.Nil(t, images)
+
+	// Tools that don't return a ToolResult can't pass one off as theirs
+	forged := NewToolResult("forged", ToolResultImage{Path: "shot.png"}).String()
+	assert.NoError(t, os.WriteFile("forged.json", []byte(forged), 0o644))
+	sess.Model = "claude-sonnet-4-20250514"
+	msgs, _ = sess.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "2",
+		FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path": "forged.json"}`},
+	}})
+	assert.Len(t, msgs, 1)
+	assert.Contains(t, msgs[0].Parts[0].(llms.ToolCallResponse).Content, toolResultKind)
+}
+
+// structuredTool declares that its tool returns a ToolResult
+type structuredTool struct{ *mockTool }
+
+func (structuredTool) ReturnsToolResult() bool { return true }
+
+func TestSession_ReviewWrites(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("a.txt", []byte("one\ntwo\n"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{ReviewWrites: true}}, func(any) {})
+	assert.NoError(t, err)
+	var reply writeReviewReply
+	var reviewed writeReview
+	sess.SetWriteReviewer(func(ctx context.Context, review writeReview) (writeReviewReply, error) {
+		reviewed = review
+		return reply, nil
+	})
+	write := func() string {
+		sess.toolCallRepetitionCount = 0
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           "1",
+			FunctionCall: &llms.FunctionCall{Name: "write_file", Arguments: `{"path": "a.txt", "content": "one\nthree\n"}`},
+		}})
+		assert.Len(t, msgs, 1)
+		return msgs[0].Parts[0].(llms.ToolCallResponse).Content
+	}
+	fileContent := func() string {
+		data, err := os.ReadFile("a.txt")
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	// Rejected writes leave the file alone
+	out := write()
+	assert.Contains(t, out, "rejected")
+	assert.Equal(t, "one\ntwo\n", fileContent())
+	assert.Equal(t, writeReview{Path: "a.txt", Original: "one\ntwo\n", Proposed: "one\nthree\n"}, reviewed)
+
+	// Edited content is written and reported back to the model
+	reply = writeReviewReply{Apply: true, Content: "one\nfour\n"}
+	out = write()
+	assert.Equal(t, "one\nfour\n", fileContent())
+	assert.Contains(t, out, "The user edited the content")
+	assert.Contains(t, out, "one\nfour")
+
+	// Accepted writes go through as proposed
+	reply = writeReviewReply{Apply: true, Content: "one\nthree\n"}
+	out = write()
+	assert.Equal(t, "one\nthree\n", fileContent())
+	assert.NotContains(t, out, "edited")
+
+	assert.Equal(t, "  one\n- two\n+ three", renderLineDiff("one\ntwo\n", "one\nthree\n"))
+}
+
+func TestSession_WarnExternalEdits(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("a.txt", []byte("one\n"), 0o644))
+	assert.NoError(t, os.WriteFile("b.txt", []byte("one\n"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{WarnExternalEdits: true}}, func(any) {})
+	assert.NoError(t, err)
+	var asked []string
+	allow := false
+	sess.SetExternalEditConfirmer(func(ctx context.Context, path string) (bool, error) {
+		asked = append(asked, path)
+		return allow, nil
+	})
+	call := func(name, args string) string {
+		sess.toolCallRepetitionCount = 0
+		msgs, _ := sess.processToolCalls(context.Background(), []llms.ToolCall{{
+			ID:           "1",
+			FunctionCall: &llms.FunctionCall{Name: name, Arguments: args},
+		}})
+		assert.Len(t, msgs, 1)
+		return msgs[0].Parts[0].(llms.ToolCallResponse).Content
+	}
+	fileContent := func(path string) string {
+		data, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		return string(data)
+	}
+
+	call("read_file", `{"path": "a.txt"}`)
+	// The user saves the file in their editor
+	assert.NoError(t, os.WriteFile("a.txt", []byte("mine\n"), 0o644))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes("a.txt", later, later))
+
+	out := call("write_file", `{"path": "a.txt", "content": "agent\n"}`)
+	assert.Equal(t, []string{"a.txt"}, asked)
+	assert.Contains(t, out, "Read the file again")
+	assert.Equal(t, "mine\n", fileContent("a.txt"))
+
+	allow = true
+	call("write_file", `{"path": "a.txt", "content": "agent\n"}`)
+	assert.Equal(t, "agent\n", fileContent("a.txt"))
+
+	// The agent's own write is not an external change
+	call("write_file", `{"path": "a.txt", "content": "agent again\n"}`)
+	assert.Len(t, asked, 2)
+
+	// Files the agent never read are written without asking
+	call("write_file", `{"path": "b.txt", "content": "agent\n"}`)
+	assert.Len(t, asked, 2)
+	assert.Equal(t, "agent\n", fileContent("b.txt"))
+
+	// Multi-file edits check every file they change
+	assert.NoError(t, os.WriteFile("b.txt", []byte("mine agent\n"), 0o644))
+	assert.NoError(t, os.Chtimes("b.txt", later, later))
+	allow = false
+	out = call("project_replace", `{"pattern": "agent", "replacement": "bot"}`)
+	assert.Equal(t, []string{"a.txt", "a.txt", "b.txt"}, asked)
+	assert.Contains(t, out, "b.txt was changed outside the session")
+	assert.Equal(t, "agent again\n", fileContent("a.txt"))
+
+	allow = true
+	call("project_replace", `{"pattern": "agent", "replacement": "bot"}`)
+	assert.Equal(t, "bot again\n", fileContent("a.txt"))
+	assert.Equal(t, "b.txt", sess.LastFile())
+	call("apply_patch", `{"patch": "*** Begin Patch\n*** Update File: b.txt\n@@\n-mine bot\n+patched\n*** End Patch"}`)
+	assert.Equal(t, "patched\n", fileContent("b.txt"))
+	assert.Len(t, asked, 4, "the agent's own edits are not external changes")
+}
+
+func TestSession_RefreshContextFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	assert.NoError(t, os.WriteFile("same.go", []byte("same"), 0o644))
+	assert.NoError(t, os.WriteFile("changed.go", []byte("new"), 0o644))
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	sess.ContextFiles = map[string]string{
+		"same.go":    "same",
+		"changed.go": "old",
+		"gone.go":    "saved",
+	}
+
+	notes := sess.RefreshContextFiles()
+	assert.Equal(t, []string{
+		"changed.go changed since the session was saved, using the current content",
+		"gone.go was deleted since the session was saved, keeping the saved copy",
+	}, notes)
+	assert.Equal(t, map[string]string{"same.go": "same", "changed.go": "new", "gone.go": "saved"}, sess.ContextFiles)
+}
+
+func TestSession_ClaudeCodePreamble(t *testing.T) {
+	systemText := func(cfg LLMConfig) string {
+		sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: cfg}, func(any) {})
+		assert.NoError(t, err)
+		var text strings.Builder
+		for _, part := range sess.messages[0].Parts {
+			text.WriteString(part.(llms.TextContent).Text)
+		}
+		return text.String()
+	}
+
+	assert.Contains(t, systemText(LLMConfig{Provider: "anthropic"}), "You are Claude Code")
+	assert.NotContains(t, systemText(LLMConfig{Provider: "anthropic", AnthropicClaudeCodePreamble: boolPtr(false)}), "You are Claude Code")
+	assert.NotContains(t, systemText(LLMConfig{Provider: "openai"}), "You are Claude Code")
+}
+
+type capturingLLM struct {
+	llms.Model
+	messages []llms.MessageContent
+	options  llms.CallOptions
+}
+
+func (m *capturingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	m.messages = messages
+	m.options = llms.CallOptions{}
+	for _, opt := range options {
+		opt(&m.options)
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
+}
+
+// toolRejectingLLM fails requests carrying tool_choice, and also those
+// carrying tools when rejectTools is set, like providers with limited tool
+// support. err, when set, fails every request.
+type toolRejectingLLM struct {
+	llms.Model
+	rejectTools bool
+	err         error
+	calls       []llms.CallOptions
+}
+
+func (m *toolRejectingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var opts llms.CallOptions
+	for _, opt := range options {
+		opt(&opts)
+	}
+	m.calls = append(m.calls, opts)
+	switch {
+	case m.err != nil:
+		return nil, m.err
+	case opts.ToolChoice != nil:
+		return nil, errors.New(`400 Bad Request: "tool_choice" is not supported by this model`)
+	case m.rejectTools && len(opts.Tools) > 0:
+		return nil, errors.New("registry.ollama.ai/library/gemma does not support tools")
+	}
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{Content: "ok"}}}, nil
+}
+
+func TestSession_ToolFallback(t *testing.T) {
+	llm := &toolRejectingLLM{}
+	sess, err := NewSession(llm, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	out, err := sess.Ask(context.Background(), "hi")
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", out)
+	// The rejected request, its retry, then the second turn Ask gives a
+	// response without tool calls
+	assert.Len(t, llm.calls, 3)
+	assert.Equal(t, "auto", llm.calls[0].ToolChoice)
+	assert.Nil(t, llm.calls[1].ToolChoice)
+	assert.NotEmpty(t, llm.calls[1].Tools, "the retry keeps the tools")
+
+	// Later requests skip what was rejected
+	llm.calls = nil
+	_, err = sess.Ask(context.Background(), "again")
+	assert.NoError(t, err)
+	assert.Len(t, llm.calls, 2)
+	assert.Nil(t, llm.calls[0].ToolChoice)
+
+	var notices []string
+	llm = &toolRejectingLLM{rejectTools: true}
+	sess, err = NewSession(llm, &Config{}, func(msg any) {
+		if notice, ok := msg.(toolFallbackMsg); ok {
+			notices = append(notices, string(notice))
+		}
+	})
+	assert.NoError(t, err)
+	_, err = sess.Ask(context.Background(), "hi")
+	assert.NoError(t, err)
+	assert.Len(t, llm.calls, 4)
+	assert.NotEmpty(t, llm.calls[1].Tools)
+	assert.Empty(t, llm.calls[2].Tools)
+	assert.Empty(t, llm.calls[3].Tools)
+	assert.Len(t, notices, 1)
+
+	// Other errors are not retried
+	llm = &toolRejectingLLM{err: errors.New("500 internal server error")}
+	sess, err = NewSession(llm, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	_, err = sess.Ask(context.Background(), "hi")
+	assert.Error(t, err)
+	assert.Len(t, llm.calls, 1)
+}
+
+func TestSession_ReActFallback(t *testing.T) {
+	data, err := os.ReadFile("testdata/test.txt")
+	assert.NoError(t, err)
+
+	// Off by default: the ReAct text is left as it is
+	sess, err := NewSession(&sessionMockLLMReAct{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	out, err := sess.Ask(context.Background(), "what is in the test file?")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, strings.TrimSpace(string(data)))
+	assert.NotContains(t, toJSON(sess.MessagesSnapshot()), reactObservationPrefix)
+
+	sess, err = NewSession(&sessionMockLLMReAct{}, &Config{LLM: LLMConfig{ReActFallback: true}}, func(any) {})
+	assert.NoError(t, err)
+	out, err = sess.Ask(context.Background(), "what is in the test file?")
+	assert.NoError(t, err)
+	assert.Contains(t, out, strings.TrimSpace(string(data)))
+
+	// The exchange stays plain text for providers that reject tool messages
+	for _, msg := range sess.MessagesSnapshot() {
+		for _, part := range msg.Parts {
+			_, isText := part.(llms.TextContent)
+			assert.True(t, isText, "unexpected %T in %s message", part, msg.Role)
+		}
+	}
+}
+
+func TestParseReActAction(t *testing.T) {
+	name, args, ok := parseReActAction("Action: `list_files`\nAction Input: {\"path\": \".\"}")
+	assert.True(t, ok)
+	assert.Equal(t, "list_files", name)
+	assert.Equal(t, `{"path": "."}`, args)
+
+	_, args, ok = parseReActAction("Action: read_file\nAction Input:\n```json\n{\n  \"path\": \"a.go\"\n}\n```\nObservation: made up")
+	assert.True(t, ok)
+	assert.JSONEq(t, `{"path": "a.go"}`, args)
+
+	_, _, ok = parseReActAction("I would read the file next.")
+	assert.False(t, ok)
+}
+
+func TestSession_PromptCaching(t *testing.T) {
+	cached := func(cfg LLMConfig) (*Session, *capturingLLM) {
+		llm := &capturingLLM{}
+		sess, err := NewSession(llm, &Config{LLM: cfg}, func(any) {})
+		assert.NoError(t, err)
+		sess.AddContextFile("main.go", "package main")
+		sess.prepareUserMessage("explain main.go")
+		_, err = sess.generateLLMResponse(context.Background(), nil)
+		assert.NoError(t, err)
+		return sess, llm
+	}
+
+	sess, llm := cached(LLMConfig{Provider: "anthropic", PromptCaching: true})
+	last := llm.messages[len(llm.messages)-1]
+	assert.Equal(t, llms.ChatMessageTypeHuman, last.Role)
+	part, ok := last.Parts[len(last.Parts)-1].(llms.CachedContent)
+	if !assert.True(t, ok, "expected the prompt to be a cache breakpoint, got %T", last.Parts[len(last.Parts)-1]) {
+		return
+	}
+	assert.Equal(t, "ephemeral", part.CacheControl.Type)
+	assert.Contains(t, part.ContentPart.(llms.TextContent).Text, "package main")
+	assert.NotNil(t, llm.options.Metadata["anthropic:beta_headers"])
+	// The history keeps the plain prompt
+	for _, msg := range sess.messages {
+		for _, p := range msg.Parts {
+			_, isCached := p.(llms.CachedContent)
+			assert.False(t, isCached)
+		}
+	}
+
+	for _, cfg := range []LLMConfig{{Provider: "anthropic"}, {Provider: "openai", PromptCaching: true}} {
+		_, llm := cached(cfg)
+		for _, msg := range llm.messages {
+			for _, p := range msg.Parts {
+				_, isCached := p.(llms.CachedContent)
+				assert.False(t, isCached, "%s caching=%v", cfg.Provider, cfg.PromptCaching)
+			}
+		}
+	}
+}
+
+func TestSession_GitContext(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	assert.Empty(t, sessBuildGitBlock(), "no git block outside a repository")
+
+	runGit(t, dir, "init", "-b", "main")
+	runGit(t, dir, "config", "user.name", "Asimi Tester")
+	runGit(t, dir, "config", "user.email", "tester@example.com")
+	assert.Contains(t, sessBuildGitBlock(), "**branch:** main")
+	assert.NotContains(t, sessBuildGitBlock(), "recent commits", "a new repository has no commits")
+
+	assert.NoError(t, os.WriteFile("README.md", []byte("hello\n"), 0o644))
+	runGit(t, dir, "add", "README.md")
+	runGit(t, dir, "commit", "-m", "Add the readme")
+	assert.NoError(t, os.WriteFile("README.md", []byte("changed\n"), 0o644))
+
+	block := sessBuildGitBlock()
+	assert.Contains(t, block, "**working tree:** dirty, 1 changed file")
+	assert.Contains(t, block, "    - Add the readme")
+
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{}, func(any) {})
+	assert.NoError(t, err)
+	assert.NotContains(t, sess.messages[0].Parts[0].(llms.TextContent).Text, "Add the readme", "git context is off by default")
+	sess, err = NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{GitContext: true}}, func(any) {})
+	assert.NoError(t, err)
+	assert.Contains(t, sess.messages[0].Parts[0].(llms.TextContent).Text, "Add the readme")
+}
+
+// thinkingLLM answers with reasoning and reports the tokens spent on it
+type thinkingLLM struct {
+	llms.Model
+	info map[string]any
+}
+
+func (m *thinkingLLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	return &llms.ContentResponse{Choices: []*llms.ContentChoice{{
+		Content:          "42",
+		ReasoningContent: "Let me think about this at length...",
+		GenerationInfo:   m.info,
+	}}}, nil
+}
+
+func TestSession_ThinkingUsage(t *testing.T) {
+	var warnings []string
+	llm := &thinkingLLM{info: map[string]any{"OutputTokens": 3000, "ThinkingTokens": 2700}}
+	sess, err := NewSession(llm, &Config{}, func(msg any) {
+		if w, ok := msg.(thinkingWarningMsg); ok {
+			warnings = append(warnings, string(w))
+		}
+	})
+	assert.NoError(t, err)
+
+	_, err = sess.Ask(context.Background(), "what is the answer?")
+	assert.NoError(t, err)
+	usage := sess.ThinkingUsage()
+	assert.Equal(t, 2700, usage.LastThinking)
+	assert.Equal(t, 300, usage.LastAnswer, "reported output tokens include the thinking")
+	assert.False(t, usage.Estimated)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0], "90% of its response thinking")
+
+	report := formatThinkingUsage(sess.ThinkingUsage(), sess.thinkingWarnShare())
+	assert.Contains(t, report, "90% of the output")
+	assert.Contains(t, report, "Last response: 2.7k thinking, 300 answer (90%)")
+	assert.Contains(t, report, "above 70% thinking")
+
+	// Below the configured share there is no warning
+	warnings = nil
+	sess.config.ThinkingWarnShare = 95
+	_, err = sess.Ask(context.Background(), "and again?")
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	// Without usage from the provider the text is counted
+	llm.info = nil
+	before := sess.ThinkingUsage().ThinkingTokens
+	_, err = sess.Ask(context.Background(), "once more?")
+	assert.NoError(t, err)
+	assert.Greater(t, sess.ThinkingUsage().ThinkingTokens, before)
+	assert.True(t, sess.ThinkingUsage().Estimated)
+}
+
+func TestDescribeMessages(t *testing.T) {
+	image := "data:image/png;base64," + strings.Repeat("A", 5000)
+	output := strings.Repeat("line of tool output\n", 500)
+	described := strings.Join(describeMessages([]llms.MessageContent{
+		{Role: llms.ChatMessageTypeHuman, Parts: []llms.ContentPart{
+			llms.ImageURLContent{URL: image},
+			llms.TextPart("my key is sk-abcdefghijklmnop " + strings.Repeat("x", 1000)),
+		}},
+		{Role: llms.ChatMessageTypeAI, Parts: []llms.ContentPart{llms.ToolCall{ID: "1", FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`}}}},
+		{Role: llms.ChatMessageTypeTool, Parts: []llms.ContentPart{llms.ToolCallResponse{ToolCallID: "1", Name: "read_file", Content: output}}},
+	}), "\n")
+
+	assert.Contains(t, described, "human: image 5022 bytes, text 1030 bytes")
+	assert.Contains(t, described, `ai: tool call read_file "{\"path\":\"main.go\"}"`)
+	assert.Contains(t, described, fmt.Sprintf("tool: tool result read_file %d bytes", len(output)))
+	assert.NotContains(t, described, "AAAA", "images stay out of the log")
+	assert.NotContains(t, described, "line of tool output", "tool output stays out of the log")
+	assert.NotContains(t, described, "sk-abcdefghijklmnop")
+	assert.Less(t, len(described), 600)
+
+	choices := describeChoices([]*llms.ContentChoice{{StopReason: "end_turn", Content: strings.Repeat("y", 1000)}})
+	assert.Len(t, choices, 1)
+	assert.Contains(t, choices[0], "stop=end_turn text 1000 bytes")
+	assert.Less(t, len(choices[0]), 300)
+}
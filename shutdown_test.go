@@ -17,7 +17,7 @@ func TestSessionStoreCloseWithTimeout(t *testing.T) {
 	os.Setenv("HOME", tmpHome)
 	defer os.Setenv("HOME", originalHome)
 
-	store, err := NewSessionStore(10, 30)
+	store, err := NewSessionStore(10, 30, "")
 	if err != nil {
 		t.Fatalf("Failed to create session store: %v", err)
 	}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+)
+
+// defaultToolOutputLimit caps the bytes of a tool result sent to the model
+// when tool_output_limit is unset
+const defaultToolOutputLimit = 32 * 1024
+
+// toolOutputDir holds full tool results that were too large to send whole,
+// relative to the project root
+var toolOutputDir = filepath.Join(".asimi", "tool-output")
+
+// maxToolOutputFiles is how many spilled results are kept, the oldest are
+// removed first
+const maxToolOutputFiles = 100
+
+// spillTools are the tools whose results can grow without bound
+var spillTools = map[string]bool{
+	"run_in_shell":    true,
+	"read_many_files": true,
+}
+
+// unsafeFileChars matches characters not allowed in a spilled output file name
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// toolOutputLimit returns the largest tool result sent to the model whole,
+// 0 for no limit
+func (s *Session) toolOutputLimit() int {
+	if s.config == nil || s.config.ToolOutputLimit == 0 {
+		return defaultToolOutputLimit
+	}
+	if s.config.ToolOutputLimit < 0 {
+		return 0
+	}
+	return s.config.ToolOutputLimit
+}
+
+// spillToolOutput saves a result larger than limit to disk and returns its
+// head and tail with a note pointing the model at the full output. Results
+// within the limit, or that can't be saved, are returned unchanged.
+func spillToolOutput(callID, name, content string, limit int) string {
+	if limit <= 0 || len(content) <= limit {
+		return content
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return content
+	}
+	dir := filepath.Join(findProjectRoot(wd), toolOutputDir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return content
+	}
+	name = unsafeFileChars.ReplaceAllString(name+"-"+callID, "_") + ".txt"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+		return content
+	}
+	pruneToolOutput(dir)
+
+	headEnd := limit / 2
+	for headEnd > 0 && !utf8.RuneStart(content[headEnd]) {
+		headEnd--
+	}
+	tailStart := len(content) - limit/2
+	for tailStart < len(content) && !utf8.RuneStart(content[tailStart]) {
+		tailStart++
+	}
+	head, tail := content[:headEnd], content[tailStart:]
+	return fmt.Sprintf("%s\n\n[... %d bytes omitted. The full output (%d bytes) was saved to %s, use read_file with offset and limit to inspect it ...]\n\n%s",
+		head, len(content)-len(head)-len(tail), len(content), filepath.Join(toolOutputDir, name), tail)
+}
+
+// pruneToolOutput removes the oldest spilled results beyond maxToolOutputFiles
+func pruneToolOutput(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) <= maxToolOutputFiles {
+		return
+	}
+	type spilled struct {
+		path    string
+		modTime int64
+	}
+	files := make([]spilled, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			files = append(files, spilled{filepath.Join(dir, entry.Name()), info.ModTime().UnixNano()})
+		}
+	}
+	slices.SortFunc(files, func(a, b spilled) int { return cmp.Compare(a.modTime, b.modTime) })
+	for _, file := range files[:max(len(files)-maxToolOutputFiles, 0)] {
+		os.Remove(file.path)
+	}
+}
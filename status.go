@@ -13,9 +13,11 @@ type StatusComponent struct {
 	Provider  string
 	Model     string
 	Connected bool
-	Width     int
-	Style     lipgloss.Style
-	Session   *Session // Reference to session for token/time tracking
+	// No LLM could be set up; the status bar points to /login
+	AIDisabled bool
+	Width      int
+	Style      lipgloss.Style
+	Session    *Session // Reference to session for token/time tracking
 	// Vi mode status
 	ViModeEnabled bool
 	ViCurrentMode string
@@ -24,6 +26,50 @@ type StatusComponent struct {
 	// Waiting indicator
 	waitingForResponse bool
 	waitingSince       time.Time
+	nonStreaming       bool
+
+	// Tool call whose arguments are still streaming in
+	preparingTool    string
+	preparingArgsLen int
+
+	// What the current streamed turn is doing
+	phase streamPhase
+
+	// Number of prompts waiting for the current stream to finish
+	queued int
+
+	// Plain drops color and non-ASCII icons
+	Plain bool
+
+	// Compact keeps only the essentials: branch, context usage, progress and model
+	Compact bool
+}
+
+// streamPhase is the part of a streamed turn in progress
+type streamPhase int
+
+const (
+	phaseIdle streamPhase = iota
+	phaseThinking
+	phaseTools
+	phaseResponding
+)
+
+// label names the phase for the status bar
+func (p streamPhase) label(plain bool) string {
+	labels := map[streamPhase][2]string{
+		phaseThinking:   {"💭 thinking", "thinking"},
+		phaseTools:      {"🔧 using tools", "using tools"},
+		phaseResponding: {"💬 responding", "responding"},
+	}
+	l, ok := labels[p]
+	if !ok {
+		return ""
+	}
+	if plain {
+		return l[1]
+	}
+	return l[0]
 }
 
 // NewStatusComponent creates a new status component
@@ -43,6 +89,11 @@ func (s *StatusComponent) SetProvider(provider, model string, connected bool) {
 	s.Connected = connected
 }
 
+// SetAIDisabled marks that no LLM could be set up
+func (s *StatusComponent) SetAIDisabled(disabled bool) {
+	s.AIDisabled = disabled
+}
+
 // SetSession sets the session reference for tracking
 func (s *StatusComponent) SetSession(session *Session) {
 	s.Session = session
@@ -64,6 +115,29 @@ func (s *StatusComponent) StartWaiting() {
 // StopWaiting clears the waiting indicator
 func (s *StatusComponent) StopWaiting() {
 	s.waitingForResponse = false
+	s.nonStreaming = false
+	s.preparingTool = ""
+}
+
+// SetNonStreaming notes that the model returns its response all at once
+func (s *StatusComponent) SetNonStreaming(on bool) {
+	s.nonStreaming = on
+}
+
+// SetPhase shows what the current streamed turn is doing
+func (s *StatusComponent) SetPhase(phase streamPhase) {
+	s.phase = phase
+}
+
+// SetQueued sets the number of queued prompts shown in the status bar
+func (s *StatusComponent) SetQueued(n int) {
+	s.queued = n
+}
+
+// SetPreparingTool shows a tool call whose arguments are still streaming; an empty name clears it
+func (s *StatusComponent) SetPreparingTool(name string, argsLen int) {
+	s.preparingTool = name
+	s.preparingArgsLen = argsLen
 }
 
 // SetAgent sets the current agent (legacy method for compatibility)
@@ -160,6 +234,9 @@ func (s StatusComponent) View() string {
 		statusLine = leftSection + strings.Repeat(" ", spacing) + rightSection
 	}
 
+	if s.Plain {
+		return asciiOnly(statusLine)
+	}
 	return s.Style.Render(statusLine)
 }
 
@@ -180,7 +257,7 @@ func (s StatusComponent) renderLeftSection() string {
 
 	var parts []string
 	parts = append(parts, "🌴 "+bs.Render(branch))
-	if gitStatus := getGitStatus(); gitStatus != "" {
+	if gitStatus := getGitStatus(); gitStatus != "" && !s.Compact {
 		parts = append(parts, gitStatus)
 	}
 	return strings.Join(parts, " ")
@@ -213,11 +290,26 @@ func (s StatusComponent) renderMiddleSection() string {
 
 	// Format the output with icons
 	statusStr := fmt.Sprintf("🪣 %.0f%%   %s ⏱", usagePercent, durationStr)
+	if s.Compact {
+		statusStr = fmt.Sprintf("🪣 %.0f%%", usagePercent)
+	}
+	if s.queued > 0 {
+		statusStr += fmt.Sprintf("  queued (%d)", s.queued)
+	}
+	if label := s.phase.label(s.Plain); label != "" {
+		statusStr += "  " + label
+	}
+	if s.preparingTool != "" {
+		statusStr += fmt.Sprintf("  🛠 preparing %s… %dB", s.preparingTool, s.preparingArgsLen)
+	}
 	if s.waitingForResponse && !s.waitingSince.IsZero() {
 		waitSeconds := int(time.Since(s.waitingSince).Seconds())
 		if waitSeconds >= 3 {
 			statusStr += fmt.Sprintf("  ⏳ %ds", waitSeconds)
 		}
+		if s.nonStreaming {
+			statusStr += " (non-streaming model, please wait)"
+		}
 	}
 
 	// Style with Terminal7 text color
@@ -228,7 +320,14 @@ func (s StatusComponent) renderMiddleSection() string {
 // renderRightSection renders the right section with provider info
 func (s StatusComponent) renderRightSection() string {
 	icon := getProviderStatusIcon(s.Connected)
+	if s.AIDisabled {
+		warning := lipgloss.NewStyle().Foreground(lipgloss.Color("#F4DB53"))
+		return warning.Render(fmt.Sprintf("AI off · %s to log in", loginKey)) + " " + icon
+	}
 	providerModel := shortenProviderModel(s.Provider, s.Model)
+	if s.Compact {
+		providerModel = s.Model
+	}
 
 	// Style provider info
 	providerStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#01FAFA")) // Terminal7 text color
@@ -2,6 +2,21 @@ package main
 
 import "github.com/charmbracelet/lipgloss"
 
+// ToolStatusGlyphs holds the indicator shown for each tool call status
+type ToolStatusGlyphs struct {
+	Scheduled string
+	Executing string
+	Success   string
+	Error     string
+}
+
+// Glyph sets selectable with the tool_glyphs setting
+var toolGlyphSets = map[string]ToolStatusGlyphs{
+	"unicode": {Scheduled: "○", Executing: "◐", Success: "●", Error: "✗"},
+	"ascii":   {Scheduled: "[ ]", Executing: "[~]", Success: "[x]", Error: "[!]"},
+	"emoji":   {Scheduled: "📋", Executing: "⚙️", Success: "✅", Error: "⁉️"},
+}
+
 // Theme defines the colors and styles for the UI.
 type Theme struct {
 	// Terminal7 color scheme
@@ -29,6 +44,10 @@ type Theme struct {
 	// Borders and highlights
 	Border    lipgloss.Style
 	Highlight lipgloss.Style
+
+	// Tool call status indicators, keyed by status for the colors
+	ToolGlyphs ToolStatusGlyphs
+	ToolColors map[string]lipgloss.Color
 }
 
 // NewTheme creates and returns a new Theme with Terminal7 colors.
@@ -80,5 +99,50 @@ func NewTheme() *Theme {
 		Highlight: lipgloss.NewStyle().
 			Foreground(textColor).
 			Background(promptBackground),
+
+		ToolGlyphs: toolGlyphSets["unicode"],
+		ToolColors: map[string]lipgloss.Color{
+			"scheduled": promptBorder,
+			"executing": warning,
+			"success":   textColor,
+			"error":     errorColor,
+		},
+	}
+}
+
+// ApplyConfig overrides the tool status glyph set and colors from the config
+func (t *Theme) ApplyConfig(config *Config) {
+	if config == nil {
+		return
+	}
+	if glyphs, ok := toolGlyphSets[config.LLM.ToolGlyphs]; ok {
+		t.ToolGlyphs = glyphs
+	}
+	for status, color := range config.LLM.ToolColors {
+		t.ToolColors[status] = lipgloss.Color(color)
+	}
+	if config.UI.Plain {
+		t.ToolGlyphs = toolGlyphSets["ascii"]
+		t.ToolColors = map[string]lipgloss.Color{}
+	}
+}
+
+// ToolStatus returns the colored indicator for a tool call status
+func (t *Theme) ToolStatus(status string) string {
+	var glyph string
+	switch status {
+	case "executing":
+		glyph = t.ToolGlyphs.Executing
+	case "success":
+		glyph = t.ToolGlyphs.Success
+	case "error":
+		glyph = t.ToolGlyphs.Error
+	default:
+		glyph = t.ToolGlyphs.Scheduled
+	}
+	color, ok := t.ToolColors[status]
+	if !ok {
+		return glyph
 	}
+	return lipgloss.NewStyle().Foreground(color).Render(glyph)
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+const (
+	// defaultThinkingWarnShare is the share of a response's tokens, in
+	// percent, spent thinking above which the user is warned
+	defaultThinkingWarnShare = 70
+	// thinkingWarnMinTokens keeps short responses from warning, where a
+	// high share costs little
+	thinkingWarnMinTokens = 1000
+)
+
+// thinkingUsage adds up the tokens a session's responses spent thinking and
+// answering. Provider counts are used when reported, otherwise the text is
+// counted.
+type thinkingUsage struct {
+	Responses      int // Responses with any thinking
+	ThinkingTokens int
+	AnswerTokens   int
+	LastThinking   int // Thinking tokens of the last response
+	LastAnswer     int
+	Estimated      bool // Some counts came from the text rather than the provider
+	warned         bool // The current prompt already warned
+}
+
+// thinkingWarningMsg warns that a response spent most of its tokens thinking
+type thinkingWarningMsg string
+
+// thinkingShare returns the percent of tokens spent thinking
+func thinkingShare(thinking, answer int) int {
+	if thinking+answer == 0 {
+		return 0
+	}
+	return thinking * 100 / (thinking + answer)
+}
+
+// responseTokens splits a response's output tokens into thinking and
+// answer. Reported output counts include the thinking tokens.
+func (s *Session) responseTokens(choice *llms.ContentChoice) (thinking, answer int, estimated bool) {
+	thinking, ok := usageTokens(choice.GenerationInfo, "ThinkingTokens", "ReasoningTokens")
+	if !ok || thinking == 0 {
+		thinking, estimated = s.countTokens(choice.ReasoningContent), choice.ReasoningContent != ""
+	}
+	if out, ok := usageTokens(choice.GenerationInfo, "OutputTokens", "CompletionTokens"); ok && out >= thinking {
+		return thinking, out - thinking, estimated
+	}
+	return thinking, s.countTokens(choice.Content), true
+}
+
+// recordThinking adds a response to the thinking usage and warns, once per
+// prompt, when thinking took more than thinking_warn_share of it
+func (s *Session) recordThinking(choice *llms.ContentChoice) {
+	thinking, answer, estimated := s.responseTokens(choice)
+	if thinking == 0 {
+		return
+	}
+	limit := s.thinkingWarnShare()
+	share := thinkingShare(thinking, answer)
+	unlock := s.lockMessages()
+	usage := &s.thinking
+	usage.Responses++
+	usage.ThinkingTokens += thinking
+	usage.AnswerTokens += answer
+	usage.LastThinking, usage.LastAnswer = thinking, answer
+	usage.Estimated = usage.Estimated || estimated
+	warn := limit >= 0 && !usage.warned && thinking >= thinkingWarnMinTokens && share > limit
+	if warn {
+		usage.warned = true
+	}
+	unlock()
+	if warn && s.notify != nil {
+		s.notify(thinkingWarningMsg(fmt.Sprintf("The model spent %d%% of its response thinking (%s thinking tokens). See /think-budget",
+			share, formatTokenCount(thinking))))
+	}
+}
+
+// thinkingWarnShare returns the configured warning threshold in percent, -1
+// when warnings are off
+func (s *Session) thinkingWarnShare() int {
+	if s.config == nil || s.config.ThinkingWarnShare == 0 {
+		return defaultThinkingWarnShare
+	}
+	if s.config.ThinkingWarnShare < 0 {
+		return -1
+	}
+	return s.config.ThinkingWarnShare
+}
+
+// ThinkingUsage returns the thinking and answer tokens spent so far
+func (s *Session) ThinkingUsage() thinkingUsage {
+	defer s.rlockMessages()()
+	return s.thinking
+}
+
+// formatThinkingUsage reports the thinking usage for /think-budget and /context
+func formatThinkingUsage(usage thinkingUsage, warnShare int) string {
+	if usage.Responses == 0 {
+		return "No thinking tokens spent in this session"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Thinking: %s tokens, %d%% of the output of %d responses (answers: %s tokens)",
+		formatTokenCount(usage.ThinkingTokens), thinkingShare(usage.ThinkingTokens, usage.AnswerTokens),
+		usage.Responses, formatTokenCount(usage.AnswerTokens))
+	fmt.Fprintf(&b, "\nLast response: %s thinking, %s answer (%d%%)",
+		formatTokenCount(usage.LastThinking), formatTokenCount(usage.LastAnswer), thinkingShare(usage.LastThinking, usage.LastAnswer))
+	if warnShare < 0 {
+		b.WriteString("\nWarning: off")
+	} else {
+		fmt.Fprintf(&b, "\nWarning: above %d%% thinking (thinking_warn_share)", warnShare)
+	}
+	if usage.Estimated {
+		b.WriteString("\nSome counts are estimated from the text; the provider did not report them")
+	}
+	return b.String()
+}
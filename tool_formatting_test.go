@@ -111,6 +111,33 @@ func TestFormatToolCallLongCommand(t *testing.T) {
 	}
 }
 
+func TestToolSummaryDetails(t *testing.T) {
+	if got := formatToolLine("Merge", "", "Merge completed"); got != "Merge\n  ⎿  Merge completed" {
+		t.Errorf("formatToolLine() without a param = %q", got)
+	}
+
+	longCommand := "go test ./... -run TestSomethingWithAVeryLongName -count=1 -v"
+	input := `{"command": "` + longCommand + `"}`
+	details := toolDetails(RunInShell{}, input, `{"exitCode":0}`)
+	if len(details) != 1 || details[0] != "$ "+longCommand {
+		t.Errorf("run_in_shell details = %q, want the full command", details)
+	}
+	if details := toolDetails(ReadFileTool{}, `{"path": "a.go"}`, "x"); details != nil {
+		t.Errorf("read_file details = %q, want none", details)
+	}
+
+	chat := NewChatComponent(100, 20)
+	chat.AddMessage(formatToolCall("run_in_shell", "-", input, `{"exitCode":0}`, nil))
+	chat.SetToolResult(1, "ok", details...)
+	if strings.Contains(chat.Viewport.View(), "$ go test") {
+		t.Errorf("details shown while the output is collapsed")
+	}
+	chat.ToggleToolExpansion()
+	if !strings.Contains(chat.Viewport.View(), "$ "+longCommand) {
+		t.Errorf("expanded output is missing the details:\n%s", chat.Viewport.View())
+	}
+}
+
 // testError implements error interface for testing
 type testError struct {
 	msg string
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+)
+
+// toolResultKind marks a tool output as a structured ToolResult rather than
+// plain text
+const toolResultKind = "asimi.tool_result"
+
+// ToolResult is a tool output carrying images along with text. A tool
+// returns it encoded with String; the session sends the text as the tool
+// response and the images to vision-capable models in a message after it.
+type ToolResult struct {
+	Kind   string            `json:"kind"`
+	Text   string            `json:"text"`
+	Images []ToolResultImage `json:"images,omitempty"`
+}
+
+// ToolResultReturner is implemented by tools whose output is a ToolResult.
+// Only their outputs are decoded, so a file or command printing the same
+// JSON stays plain text.
+type ToolResultReturner interface {
+	ReturnsToolResult() bool
+}
+
+// ToolResultImage is an image file, or its bytes when Data is set
+type ToolResultImage struct {
+	Path     string `json:"path,omitempty"`
+	MIMEType string `json:"mime_type,omitempty"`
+	Data     []byte `json:"data,omitempty"`
+}
+
+// NewToolResult returns a tool output with text and images
+func NewToolResult(text string, images ...ToolResultImage) ToolResult {
+	return ToolResult{Kind: toolResultKind, Text: text, Images: images}
+}
+
+// String encodes the result for returning from a tool's Call
+func (r ToolResult) String() string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return r.Text
+	}
+	return string(data)
+}
+
+// parseToolResult decodes a tool output produced by ToolResult.String
+func parseToolResult(output string) (ToolResult, bool) {
+	if !strings.HasPrefix(output, "{") || !strings.Contains(output, toolResultKind) {
+		return ToolResult{}, false
+	}
+	var r ToolResult
+	if err := json.Unmarshal([]byte(output), &r); err != nil || r.Kind != toolResultKind {
+		return ToolResult{}, false
+	}
+	return r, true
+}
+
+// part loads the image as a content part for the model
+func (img ToolResultImage) part() (llms.ContentPart, error) {
+	data := img.Data
+	if len(data) == 0 {
+		var err error
+		if data, err = os.ReadFile(resolveFileRef(img.Path)); err != nil {
+			return nil, fmt.Errorf("failed to read image: %w", err)
+		}
+	}
+	mimeType := img.MIMEType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(mimeType, "image/") {
+		return nil, fmt.Errorf("%s is not an image (%s)", img.Path, mimeType)
+	}
+	return llms.BinaryPart(mimeType, data), nil
+}
+
+// splitToolResult returns the text of a tool output for the tool response
+// and the image parts to send after it. Images the model can't take are
+// dropped with a note in the text.
+func (s *Session) splitToolResult(name, output string) (string, []llms.ContentPart) {
+	result, ok := parseToolResult(output)
+	if !ok {
+		return output, nil
+	}
+	text := result.Text
+	if len(result.Images) == 0 {
+		return text, nil
+	}
+	if !modelSupportsVision(s.Provider, s.Model) {
+		return text + fmt.Sprintf("\n[%d image(s) omitted: model %s does not accept images]", len(result.Images), s.Model), nil
+	}
+
+	parts := []llms.ContentPart{llms.TextPart(fmt.Sprintf("Images returned by %s:", name))}
+	for _, img := range result.Images {
+		part, err := img.part()
+		if err != nil {
+			text += fmt.Sprintf("\n[image omitted: %v]", err)
+			continue
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 1 {
+		return text, nil
+	}
+	return text, parts
+}
@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 	"sync"
@@ -48,7 +49,7 @@ func (t ReadFileTool) Call(ctx context.Context, input string) (string, error) {
 	// Clean up the path to remove any surrounding quotes
 	params.Path = strings.Trim(params.Path, `"'`)
 
-	content, err := os.ReadFile(params.Path)
+	content, err := os.ReadFile(resolveFileRef(params.Path))
 	if err != nil {
 		return "", err
 	}
@@ -85,33 +86,18 @@ func (t ReadFileTool) Call(ctx context.Context, input string) (string, error) {
 	return strings.Join(selectedLines, "\n"), nil
 }
 
-// String formats a read_file tool call for display
+// Format formats a read_file tool call for display
 func (t ReadFileTool) Format(input, result string, err error) string {
-	// Parse input JSON to extract path
 	var params ReadFileInput
 	json.Unmarshal([]byte(input), &params)
-
-	paramStr := ""
-	if params.Path != "" {
-		paramStr = fmt.Sprintf("(%s)", params.Path)
-	}
-
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("Read File%s", paramStr)
-
-	// Second line: result summary
-	var secondLine string
 	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		lines := strings.Count(result, "\n") + 1
-		if result == "" {
-			lines = 0
-		}
-		secondLine = fmt.Sprintf("  ⎿  Read %d lines", lines)
+		return formatToolLine("Read File", params.Path, formatToolError(err))
 	}
-
-	return firstLine + "\n" + secondLine
+	lines := strings.Count(result, "\n") + 1
+	if result == "" {
+		lines = 0
+	}
+	return formatToolLine("Read File", params.Path, fmt.Sprintf("Read %d lines", lines))
 }
 
 // WriteFileInput is the input for the WriteFileTool
@@ -142,36 +128,25 @@ func (t WriteFileTool) Call(ctx context.Context, input string) (string, error) {
 	params.Path = strings.Trim(params.Path, `"'`)
 	params.Content = strings.Trim(params.Content, `"'`)
 
-	err = os.WriteFile(params.Path, []byte(params.Content), 0644)
+	path, err := checkWritePath(params.Path)
+	if err != nil {
+		return "", err
+	}
+	err = os.WriteFile(path, []byte(params.Content), 0644)
 	if err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("Successfully wrote to %s", params.Path), nil
 }
 
-// String formats a write_file tool call for display
+// Format formats a write_file tool call for display
 func (t WriteFileTool) Format(input, result string, err error) string {
-	// Parse input JSON to extract path
 	var params WriteFileInput
 	json.Unmarshal([]byte(input), &params)
-
-	paramStr := ""
-	if params.Path != "" {
-		paramStr = fmt.Sprintf("(%s)", params.Path)
-	}
-
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("Write File%s", paramStr)
-
-	// Second line: result summary
-	var secondLine string
 	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		secondLine = "  ⎿  File written successfully"
+		return formatToolLine("Write File", params.Path, formatToolError(err))
 	}
-
-	return firstLine + "\n" + secondLine
+	return formatToolLine("Write File", params.Path, "File written successfully")
 }
 
 // ListDirectoryInput is the input for the ListDirectoryTool
@@ -206,7 +181,7 @@ func (t ListDirectoryTool) Call(ctx context.Context, input string) (string, erro
 		params.Path = "."
 	}
 
-	files, err := os.ReadDir(params.Path)
+	files, err := os.ReadDir(resolveFileRef(params.Path))
 	if err != nil {
 		return "", err
 	}
@@ -218,35 +193,22 @@ func (t ListDirectoryTool) Call(ctx context.Context, input string) (string, erro
 	return strings.Join(fileNames, "\n"), nil
 }
 
-// String formats a list_files tool call for display
+// Format formats a list_files tool call for display
 func (t ListDirectoryTool) Format(input, result string, err error) string {
-	// Parse input JSON to extract path
 	var params ListDirectoryInput
 	json.Unmarshal([]byte(input), &params)
-
-	paramStr := ""
-	if params.Path != "" {
-		paramStr = fmt.Sprintf("(%s)", params.Path)
-	} else {
-		paramStr = "(.)"
+	path := params.Path
+	if path == "" {
+		path = "."
 	}
-
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("List Files%s", paramStr)
-
-	// Second line: result summary
-	var secondLine string
 	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		files := strings.Split(strings.TrimSpace(result), "\n")
-		if result == "" {
-			files = []string{}
-		}
-		secondLine = fmt.Sprintf("  ⎿  Found %d items", len(files))
+		return formatToolLine("List Files", path, formatToolError(err))
 	}
-
-	return firstLine + "\n" + secondLine
+	files := strings.Split(strings.TrimSpace(result), "\n")
+	if result == "" {
+		files = []string{}
+	}
+	return formatToolLine("List Files", path, fmt.Sprintf("Found %d items", len(files)))
 }
 
 // ReplaceTextInput is the input for the ReplaceTextTool
@@ -274,7 +236,11 @@ func (t ReplaceTextTool) Call(ctx context.Context, input string) (string, error)
 		return "", fmt.Errorf("invalid input: %w. The input should be a JSON object with 'path', 'old_text', and 'new_text' fields", err)
 	}
 
-	content, err := os.ReadFile(params.Path)
+	path, err := checkWritePath(params.Path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", err
 	}
@@ -295,7 +261,7 @@ func (t ReplaceTextTool) Call(ctx context.Context, input string) (string, error)
 		return fmt.Sprintf("No occurrences of '%s' found in %s", params.OldText, params.Path), nil
 	}
 
-	err = os.WriteFile(params.Path, []byte(newContent), 0644)
+	err = os.WriteFile(path, []byte(newContent), 0644)
 	if err != nil {
 		return "", err
 	}
@@ -303,35 +269,360 @@ func (t ReplaceTextTool) Call(ctx context.Context, input string) (string, error)
 	return fmt.Sprintf("Successfully modified file: %s (%d replacements)", params.Path, occurrences), nil
 }
 
-// String formats a replace_text tool call for display
+// Format formats a replace_text tool call for display
 func (t ReplaceTextTool) Format(input, result string, err error) string {
-	// Parse input JSON to extract path
 	var params ReplaceTextInput
 	json.Unmarshal([]byte(input), &params)
 
-	paramStr := ""
-	if params.Path != "" {
-		paramStr = fmt.Sprintf("(%s)", params.Path)
+	var summary string
+	switch {
+	case err != nil:
+		summary = formatToolError(err)
+	case strings.Contains(result, "No occurrences"):
+		summary = "No matches found"
+	case strings.Contains(result, "No changes"):
+		summary = "No changes needed"
+	default:
+		summary = "Text replaced successfully"
+	}
+	return formatToolLine("Replace Text", params.Path, summary)
+}
+
+// ApplyPatchInput is the input for the ApplyPatchTool
+type ApplyPatchInput struct {
+	Patch string `json:"patch"`
+}
+
+// ApplyPatchTool applies a unified diff or "*** Begin Patch" block to files
+// in the project
+type ApplyPatchTool struct{}
+
+func (t ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t ApplyPatchTool) Description() string {
+	return "Applies a patch to files in the project. The input should be a JSON object with a 'patch' field holding a unified diff or a '*** Begin Patch' block. Hunks are matched by their context, so line numbers may be off; the result reports which hunks applied and which failed."
+}
+
+func (t ApplyPatchTool) Call(ctx context.Context, input string) (string, error) {
+	var params ApplyPatchInput
+	err := json.Unmarshal([]byte(input), &params)
+	if err != nil {
+		return "", fmt.Errorf("invalid input: %w. The input should be a JSON object with a 'patch' field", err)
 	}
 
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("Replace Text%s", paramStr)
+	files, err := parsePatch(params.Patch)
+	if err != nil {
+		return "", err
+	}
 
-	// Second line: result summary
-	var secondLine string
+	wd, err := os.Getwd()
 	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		if strings.Contains(result, "No occurrences") {
-			secondLine = "  ⎿  No matches found"
-		} else if strings.Contains(result, "No changes") {
-			secondLine = "  ⎿  No changes needed"
+		return "", err
+	}
+	return applyPatch(findProjectRoot(wd), files)
+}
+
+// Summarize describes an apply_patch call with the files it touches
+func (t ApplyPatchTool) Summarize(input, result string, err error) ToolSummary {
+	var params ApplyPatchInput
+	json.Unmarshal([]byte(input), &params)
+
+	var summary ToolSummary
+	if files, parseErr := parsePatch(params.Patch); parseErr == nil {
+		if len(files) == 1 {
+			summary.Param = files[0].path
 		} else {
-			secondLine = "  ⎿  Text replaced successfully"
+			summary.Param = fmt.Sprintf("%d files", len(files))
+		}
+		for _, f := range files {
+			summary.Details = append(summary.Details, f.path)
+		}
+	}
+	if strings.Contains(result, "failed") {
+		summary.Status = "Patch partially applied"
+	} else {
+		summary.Status = "Patch applied successfully"
+	}
+	return summary
+}
+
+// Format formats an apply_patch tool call for display
+func (t ApplyPatchTool) Format(input, result string, err error) string {
+	return formatToolSummary("Apply Patch", t.Summarize(input, result, err), err)
+}
+
+// ProjectReplaceInput is the input for the ProjectReplaceTool
+type ProjectReplaceInput struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Glob        string `json:"glob,omitempty"`
+	Regex       bool   `json:"regex,omitempty"`
+	DryRun      bool   `json:"dry_run,omitempty"`
+}
+
+// projectReplaceSamples is how many changed lines a dry run shows per file
+const projectReplaceSamples = 3
+
+// projectReplaceMaxFileSize skips files too large to be source code
+const projectReplaceMaxFileSize = 1 << 20
+
+// fileReplacement is the outcome of a project-wide replacement in one file
+type fileReplacement struct {
+	Path    string
+	Count   int
+	Samples []string // "line: before -> after" for the first changed lines
+	content string
+	mode    os.FileMode
+}
+
+// ProjectReplaceTool replaces text across every matching file in the project
+type ProjectReplaceTool struct{}
+
+func (t ProjectReplaceTool) Name() string {
+	return "project_replace"
+}
+
+func (t ProjectReplaceTool) Description() string {
+	return "Replaces a string or regular expression across all project files matching a glob, skipping ignored files. The input should be a JSON object with 'pattern' and 'replacement' fields, and optional 'glob' (default all files), 'regex' (treat pattern as a Go regular expression, replacement may use $1) and 'dry_run' (report what would change without writing)."
+}
+
+func (t ProjectReplaceTool) Call(ctx context.Context, input string) (string, error) {
+	var params ProjectReplaceInput
+	err := json.Unmarshal([]byte(input), &params)
+	if err != nil {
+		return "", fmt.Errorf("invalid input: %w. The input should be a JSON object with 'pattern' and 'replacement' fields", err)
+	}
+
+	results, err := projectReplace(params)
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No occurrences of '%s' found", params.Pattern), nil
+	}
+
+	var b strings.Builder
+	total := 0
+	for _, r := range results {
+		total += r.Count
+		fmt.Fprintf(&b, "%s: %d replacements\n", r.Path, r.Count)
+		if params.DryRun {
+			for _, sample := range r.Samples {
+				fmt.Fprintf(&b, "  %s\n", sample)
+			}
+		}
+	}
+	if !params.DryRun {
+		// Every new content is computed before the first file is written
+		for i, r := range results {
+			if err := writeFileAtomic(resolveFileRef(r.Path), []byte(r.content), r.mode); err != nil {
+				return "", fmt.Errorf("failed to write %s after writing %d of %d files: %w", r.Path, i, len(results), err)
+			}
+		}
+	}
+	if params.DryRun {
+		fmt.Fprintf(&b, "Dry run: %d replacements in %d files, nothing written", total, len(results))
+	} else {
+		fmt.Fprintf(&b, "Replaced %d occurrences in %d files", total, len(results))
+	}
+	return b.String(), nil
+}
+
+// projectReplace computes the replacement in every matching project file,
+// returning only the files that change
+func projectReplace(params ProjectReplaceInput) ([]fileReplacement, error) {
+	if params.Pattern == "" {
+		return nil, fmt.Errorf("pattern must not be empty")
+	}
+	var re *regexp.Regexp
+	if params.Regex {
+		var err error
+		if re, err = regexp.Compile(params.Pattern); err != nil {
+			return nil, fmt.Errorf("invalid regex: %w", err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	root := findProjectRoot(wd)
+	files, err := getFileTree(root)
+	if err != nil {
+		return nil, err
+	}
+	ignored := projectIgnoreMatcher(root)
+	glob := params.Glob
+	if glob == "" {
+		glob = "**/*"
+	}
+
+	var results []fileReplacement
+	for _, rel := range files {
+		if ignored(rel) || !matchProjectGlob(glob, rel) {
+			continue
+		}
+		path := filepath.Join(root, rel)
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > projectReplaceMaxFileSize {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			continue
+		}
+
+		replace := func(s string) string { return strings.ReplaceAll(s, params.Pattern, params.Replacement) }
+		count := strings.Count(string(data), params.Pattern)
+		if re != nil {
+			replace = func(s string) string { return re.ReplaceAllString(s, params.Replacement) }
+			count = len(re.FindAllStringIndex(string(data), -1))
+		}
+		if count == 0 {
+			continue
+		}
+		content := replace(string(data))
+		if content == string(data) {
+			continue
+		}
+
+		result := fileReplacement{Path: projectRelPath(path), Count: count, content: content, mode: info.Mode().Perm()}
+		for i, line := range strings.Split(string(data), "\n") {
+			if len(result.Samples) == projectReplaceSamples {
+				break
+			}
+			if replaced := replace(line); replaced != line {
+				result.Samples = append(result.Samples, fmt.Sprintf("%d: %s -> %s", i+1, strings.TrimSpace(line), strings.TrimSpace(replaced)))
+			}
 		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// matchProjectGlob matches a slash separated relative path against a glob
+// where ** spans directories and a pattern without a slash matches base names
+func matchProjectGlob(glob, rel string) bool {
+	rel = filepath.ToSlash(rel)
+	if !strings.Contains(glob, "/") {
+		ok, _ := filepath.Match(glob, filepath.Base(rel))
+		return ok
+	}
+	return matchGlobParts(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchGlobParts(glob, parts []string) bool {
+	if len(glob) == 0 {
+		return len(parts) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(parts); i++ {
+			if matchGlobParts(glob[1:], parts[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(parts) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(glob[0], parts[0]); !ok {
+		return false
+	}
+	return matchGlobParts(glob[1:], parts[1:])
+}
+
+// Format formats a project_replace tool call for display
+func (t ProjectReplaceTool) Format(input, result string, err error) string {
+	var params ProjectReplaceInput
+	json.Unmarshal([]byte(input), &params)
+
+	param := ""
+	if params.Pattern != "" {
+		param = fmt.Sprintf("%s → %s", params.Pattern, params.Replacement)
+	}
+	name := "Project Replace"
+	if params.DryRun {
+		name = "Project Replace (dry run)"
+	}
+	if err != nil {
+		return formatToolLine(name, param, formatToolError(err))
 	}
+	lines := strings.Split(result, "\n")
+	return formatToolLine(name, param, lines[len(lines)-1])
+}
+
+// NotesInput is the input for the NotesTool
+type NotesInput struct {
+	Action  string `json:"action"`
+	Content string `json:"content,omitempty"`
+}
+
+// NotesTool reads and updates the project scratchpad in .asimi/notes.md
+type NotesTool struct{}
+
+func (t NotesTool) Name() string {
+	return "notes"
+}
 
-	return firstLine + "\n" + secondLine
+func (t NotesTool) Description() string {
+	return "Reads or updates the project notes in .asimi/notes.md, a scratchpad that persists across turns and sessions. The input should be a JSON object with an 'action' field of 'read', 'append' or 'write', and a 'content' field for append and write."
+}
+
+func (t NotesTool) Call(ctx context.Context, input string) (string, error) {
+	var params NotesInput
+	err := json.Unmarshal([]byte(input), &params)
+	if err != nil {
+		return "", fmt.Errorf("invalid input: %w. The input should be a JSON object with 'action' and 'content' fields", err)
+	}
+
+	switch params.Action {
+	case "read", "":
+		notes, err := readNotes()
+		if err != nil {
+			return "", err
+		}
+		if notes == "" {
+			return "No notes yet", nil
+		}
+		return notes, nil
+	case "append":
+		if strings.TrimSpace(params.Content) == "" {
+			return "", fmt.Errorf("content is required to append a note")
+		}
+		if err := appendNote(params.Content); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Appended to %s", notesPath), nil
+	case "write":
+		if err := writeNotes(params.Content); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Wrote %s", notesPath), nil
+	default:
+		return "", fmt.Errorf("unknown action %q: use read, append or write", params.Action)
+	}
+}
+
+// Format formats a notes tool call for display
+func (t NotesTool) Format(input, result string, err error) string {
+	var params NotesInput
+	json.Unmarshal([]byte(input), &params)
+
+	action := params.Action
+	if action == "" {
+		action = "read"
+	}
+	switch {
+	case err != nil:
+		return formatToolLine("Notes", action, formatToolError(err))
+	case action == "read":
+		return formatToolLine("Notes", action, fmt.Sprintf("Read %d lines", strings.Count(result, "\n")))
+	default:
+		return formatToolLine("Notes", action, "Notes updated")
+	}
 }
 
 // RunInShell is a tool for running shell commands in a persistent shell
@@ -422,48 +713,33 @@ func (t RunInShell) Call(ctx context.Context, input string) (string, error) {
 	return string(outputBytes), nil
 }
 
-// String formats a run_in_shell tool call for display
-func (t RunInShell) Format(input, result string, err error) string {
-	// Parse input JSON to extract command
+// Summarize describes a run_in_shell call with its exit code. Long
+// commands are truncated in the title and shown whole in the details.
+func (t RunInShell) Summarize(input, result string, err error) ToolSummary {
 	var params RunInShellInput
 	json.Unmarshal([]byte(input), &params)
 
-	paramStr := ""
-	if params.Command != "" {
-		cmd := params.Command
-		// Truncate long commands
-		if len(cmd) > 50 {
-			cmd = cmd[:47] + "..."
-		}
-		paramStr = fmt.Sprintf("(%s)", cmd)
+	summary := ToolSummary{Param: params.Command, Status: "Command executed"}
+	if len(params.Command) > 50 {
+		summary.Param = params.Command[:47] + "..."
+		summary.Details = append(summary.Details, "$ "+params.Command)
 	}
-
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("Run In Shell%s", paramStr)
-
-	// Second line: result summary
-	var secondLine string
-	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		// Parse JSON output to get exit code
-		var output map[string]interface{}
-		if json.Unmarshal([]byte(result), &output) == nil {
-			if exitCode, ok := output["exitCode"].(float64); ok {
-				if exitCode == 0 {
-					secondLine = "  ⎿  Command completed successfully"
-				} else {
-					secondLine = fmt.Sprintf("  ⎿  Command failed (exit code %d)", int(exitCode))
-				}
+	var output map[string]interface{}
+	if json.Unmarshal([]byte(result), &output) == nil {
+		if exitCode, ok := output["exitCode"].(float64); ok {
+			if exitCode == 0 {
+				summary.Status = "Command completed successfully"
 			} else {
-				secondLine = "  ⎿  Command executed"
+				summary.Status = fmt.Sprintf("Command failed (exit code %d)", int(exitCode))
 			}
-		} else {
-			secondLine = "  ⎿  Command executed"
 		}
 	}
+	return summary
+}
 
-	return firstLine + "\n" + secondLine
+// Format formats a run_in_shell tool call for display
+func (t RunInShell) Format(input, result string, err error) string {
+	return formatToolSummary("Run In Shell", t.Summarize(input, result, err), err)
 }
 
 type hostShellRunner struct{}
@@ -481,8 +757,17 @@ func (hostShellRunner) Run(ctx context.Context, params RunInShellInput) (RunInSh
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	setProcessGroup(cmd)
+	// Processes left in the background keep the output open
+	cmd.WaitDelay = shellJobWaitDelay
 
 	runErr := cmd.Run()
+	if errors.Is(runErr, exec.ErrWaitDelay) {
+		runErr = nil
+	}
+	if cmd.Process != nil && processGroupAlive(cmd.Process.Pid) {
+		trackShellJob(cmd.Process.Pid, params.Command)
+	}
 
 	// Combine stdout and stderr into a single output field
 	output.Output = stdout.String()
@@ -545,12 +830,24 @@ func (t ReadManyFilesTool) Call(ctx context.Context, input string) (string, erro
 	var allMatches []string
 
 	for _, pattern := range params.Paths {
-		matches, err := filepathx.Glob(pattern)
+		matches, err := filepathx.Glob(resolveFileRef(pattern))
 		if err != nil {
 			// Silently ignore glob errors for now, or maybe log them.
 			// For now, just continue.
 			continue
 		}
+		// Name project files by their path from the root, as they were asked
+		// for, and files found from the working directory by absolute path
+		for i, match := range matches {
+			switch {
+			case isCwdRef(pattern):
+				if abs, err := filepath.Abs(match); err == nil {
+					matches[i] = abs
+				}
+			case !filepath.IsAbs(pattern):
+				matches[i] = projectRelPath(match)
+			}
+		}
 		allMatches = append(allMatches, matches...)
 	}
 
@@ -565,7 +862,7 @@ func (t ReadManyFilesTool) Call(ctx context.Context, input string) (string, erro
 	}
 
 	for _, path := range uniqueMatches {
-		content, err := os.ReadFile(path)
+		content, err := os.ReadFile(resolveFileRef(path))
 		if err != nil {
 			// If we can't read a file, we can skip it and continue.
 			continue
@@ -578,33 +875,26 @@ func (t ReadManyFilesTool) Call(ctx context.Context, input string) (string, erro
 	return contentBuilder.String(), nil
 }
 
-// String formats a read_many_files tool call for display
-func (t ReadManyFilesTool) Format(input, result string, err error) string {
-	// Parse input JSON to extract paths
+// Summarize describes a read_many_files call with the paths it asked for
+func (t ReadManyFilesTool) Summarize(input, result string, err error) ToolSummary {
 	var params ReadManyFilesInput
 	json.Unmarshal([]byte(input), &params)
 
-	paramStr := ""
+	var summary ToolSummary
 	if len(params.Paths) == 1 {
-		paramStr = fmt.Sprintf("(%v)", params.Paths[0])
+		summary.Param = params.Paths[0]
 	} else if len(params.Paths) > 1 {
-		paramStr = fmt.Sprintf("(%d files)", len(params.Paths))
-	}
-
-	// First line: tool name and parameters
-	firstLine := fmt.Sprintf("Read Many Files%s", paramStr)
-
-	// Second line: result summary
-	var secondLine string
-	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		// Count files by counting "---\t" markers
-		fileCount := strings.Count(result, "---\t")
-		secondLine = fmt.Sprintf("  ⎿  Read %d files", fileCount)
+		summary.Param = fmt.Sprintf("%d files", len(params.Paths))
+		summary.Details = params.Paths
 	}
+	// Count files by counting "---\t" markers
+	summary.Status = fmt.Sprintf("Read %d files", strings.Count(result, "---\t"))
+	return summary
+}
 
-	return firstLine + "\n" + secondLine
+// Format formats a read_many_files tool call for display
+func (t ReadManyFilesTool) Format(input, result string, err error) string {
+	return formatToolSummary("Read Many Files", t.Summarize(input, result, err), err)
 }
 
 // MergeToolInput defines the parameters expected by the merge tool.
@@ -776,6 +1066,7 @@ func (t MergeTool) Call(ctx context.Context, input string) (string, error) {
 	return log.String(), nil
 }
 
+// Format formats a merge tool call for display
 func (t MergeTool) Format(input, result string, err error) string {
 	var params MergeToolInput
 	_ = json.Unmarshal([]byte(input), &params)
@@ -788,16 +1079,11 @@ func (t MergeTool) Format(input, result string, err error) string {
 	if mainBranch == "" {
 		mainBranch = "main"
 	}
-
-	firstLine := fmt.Sprintf("Merge (%s -> %s)", branch, mainBranch)
-	var secondLine string
+	param := fmt.Sprintf("%s -> %s", branch, mainBranch)
 	if err != nil {
-		secondLine = fmt.Sprintf("  ⎿  Error: %v", err)
-	} else {
-		secondLine = "  ⎿  Merge completed"
+		return formatToolLine("Merge", param, formatToolError(err))
 	}
-
-	return firstLine + "\n" + secondLine
+	return formatToolLine("Merge", param, "Merge completed")
 }
 
 func runGitCommand(ctx context.Context, dir string, log *bytes.Buffer, args ...string) error {
@@ -873,12 +1159,60 @@ type Tool interface {
 	Format(input, result string, err error) string
 }
 
+// ToolSummary describes a finished tool call beyond its two display lines
+type ToolSummary struct {
+	Param   string   // Main argument, shown in parentheses after the title
+	Status  string   // One-line outcome, e.g. "Read 3 files"
+	Details []string // Extra lines shown above the output when it is expanded
+}
+
+// ToolSummarizer is implemented by tools that describe their calls with a
+// ToolSummary. Their Format usually renders it with formatToolSummary.
+type ToolSummarizer interface {
+	Summarize(input, result string, err error) ToolSummary
+}
+
+// formatToolLine formats a tool call as its title with the main parameter,
+// followed by a line summarizing the result
+func formatToolLine(name, param, summary string) string {
+	if param != "" {
+		name += "(" + param + ")"
+	}
+	return name + "\n  ⎿  " + summary
+}
+
+// formatToolError is the summary line of a failed tool call
+func formatToolError(err error) string {
+	return fmt.Sprintf("Error: %v", err)
+}
+
+// formatToolSummary formats a summarized tool call like formatToolLine
+func formatToolSummary(name string, summary ToolSummary, err error) string {
+	if err != nil {
+		return formatToolLine(name, summary.Param, formatToolError(err))
+	}
+	return formatToolLine(name, summary.Param, summary.Status)
+}
+
+// toolDetails returns the detail lines of a tool call to show with its
+// expanded output, nil when the tool doesn't summarize its calls
+func toolDetails(tool tools.Tool, input, result string) []string {
+	summarizer, ok := tool.(ToolSummarizer)
+	if !ok {
+		return nil
+	}
+	return summarizer.Summarize(input, result, nil).Details
+}
+
 var availableTools = []Tool{
 	ReadFileTool{},
 	WriteFileTool{},
 	ListDirectoryTool{},
 	ReplaceTextTool{},
+	ApplyPatchTool{},
+	ProjectReplaceTool{},
 	RunInShell{},
 	ReadManyFilesTool{},
+	NotesTool{},
 	MergeTool{},
 }
@@ -8,9 +8,11 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
 )
 
 func TestRunInShell(t *testing.T) {
@@ -114,6 +116,28 @@ func TestRunInShellExitCodeWithMarkerInOutput(t *testing.T) {
 	assert.Contains(t, output.Output, "**Exit Code**: 42")
 }
 
+func TestRunInShellBackgroundJobs(t *testing.T) {
+	t.Cleanup(killShellJobs)
+	start := time.Now()
+	output, err := hostShellRunner{}.Run(context.Background(), RunInShellInput{Command: "sleep 30 & echo started"})
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), 10*time.Second, "a background process should not block the command")
+	require.Equal(t, "0", output.ExitCode)
+	require.Contains(t, output.Output, "started")
+
+	jobs := runningShellJobs()
+	require.Len(t, jobs, 1)
+	require.Equal(t, "sleep 30 & echo started", jobs[0].Command)
+	require.Contains(t, formatShellJobs(jobs), "1. pid")
+
+	_, err = killShellJob(2)
+	require.Error(t, err)
+	job, err := killShellJob(1)
+	require.NoError(t, err)
+	require.Equal(t, jobs[0].PID, job.PID)
+	require.Empty(t, shellJobs)
+}
+
 func TestComposeShellCommand(t *testing.T) {
 	command := composeShellCommand("echo test")
 	require.Contains(t, command, "echo test")
@@ -178,6 +202,216 @@ func TestReadFileToolWithOffsetAndLimit(t *testing.T) {
 	}
 }
 
+func TestApplyPatchTool(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+	t.Chdir(root)
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n\nfunc helper() int {\n\treturn 1\n}\n"), 0o644))
+	require.NoError(t, os.WriteFile("old.txt", []byte("bye\n"), 0o644))
+
+	call := func(patch string) (string, error) {
+		input, err := json.Marshal(ApplyPatchInput{Patch: patch})
+		require.NoError(t, err)
+		return ApplyPatchTool{}.Call(context.Background(), string(input))
+	}
+
+	// Line numbers are off and the context has different indentation
+	result, err := call(`--- a/main.go
++++ b/main.go
+@@ -3,3 +3,3 @@
+ func main() {
+-  fmt.Println("hi")
++	fmt.Println("hello")
+ }
+@@ -20,3 +20,3 @@
+ func missing() {
+-	return 1
++	return 2
+ }
+`)
+	require.NoError(t, err)
+	assert.Equal(t, "main.go: 1 of 2 hunks applied; hunk 2 failed (context not found)", result)
+	data, err := os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\tfmt.Println(\"hello\")\n")
+	assert.Contains(t, string(data), "\treturn 1\n")
+
+	result, err = call(`*** Begin Patch
+*** Update File: main.go
+@@ func helper() int {
+-	return 1
++	return 2
+*** Add File: docs/new.md
++# New
+*** Delete File: old.txt
+*** End Patch`)
+	require.NoError(t, err)
+	assert.Equal(t, "main.go: 1 of 1 hunks applied\ndocs/new.md: created\nold.txt: deleted", result)
+	data, err = os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\treturn 2\n")
+	data, err = os.ReadFile(filepath.Join("docs", "new.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# New\n", string(data))
+	assert.NoFileExists(t, "old.txt")
+
+	// The @@ line places the hunk when its context appears more than once
+	require.NoError(t, os.WriteFile("twice.go", []byte("func a() {\n\treturn 0\n}\n\nfunc b() {\n\treturn 0\n}\n"), 0o644))
+	result, err = call("*** Begin Patch\n*** Update File: twice.go\n@@ func b() {\n-\treturn 0\n+\treturn 1\n*** End Patch")
+	require.NoError(t, err)
+	assert.Equal(t, "twice.go: 1 of 1 hunks applied", result)
+	data, err = os.ReadFile("twice.go")
+	require.NoError(t, err)
+	assert.Equal(t, "func a() {\n\treturn 0\n}\n\nfunc b() {\n\treturn 1\n}\n", string(data))
+	_, err = call("*** Begin Patch\n*** Update File: twice.go\n@@ func c() {\n-\treturn 0\n+\treturn 2\n*** End Patch")
+	assert.ErrorContains(t, err, "hunk 1 failed")
+
+	// A move never writes over an existing file
+	_, err = call("*** Begin Patch\n*** Update File: twice.go\n*** Move to: main.go\n@@ func a() {\n-\treturn 0\n+\treturn 3\n*** End Patch")
+	assert.ErrorContains(t, err, "move to main.go failed: file already exists")
+	data, err = os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "package main")
+	data, err = os.ReadFile("twice.go")
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "\treturn 0\n")
+
+	// Removed lines starting with "-- " stay in the hunk its header counts
+	require.NoError(t, os.WriteFile("schema.sql", []byte("create table t (id int);\n-- old comment\n--- separator\nselect 1;\n"), 0o644))
+	result, err = call("--- a/schema.sql\n+++ b/schema.sql\n@@ -1,4 +1,2 @@\n create table t (id int);\n--- old comment\n---- separator\n select 1;\n")
+	require.NoError(t, err)
+	assert.Equal(t, "schema.sql: 1 of 1 hunks applied", result)
+	data, err = os.ReadFile("schema.sql")
+	require.NoError(t, err)
+	assert.Equal(t, "create table t (id int);\nselect 1;\n", string(data))
+
+	// A hunk that doesn't match its header's counts is refused
+	_, err = call("--- a/schema.sql\n+++ b/schema.sql\n@@ -1,3 +1,3 @@\n create table t (id int);\n-select 1;\n+select 2;\n")
+	assert.ErrorContains(t, err, "ends early")
+	_, err = call("--- a/schema.sql\n+++ b/schema.sql\n@@ -1,1 +1,1 @@\n create table t (id int);\n-select 1;\n+select 2;\n")
+	assert.ErrorContains(t, err, "more lines than its header counts")
+
+	// Nothing applied is an error
+	_, err = call("--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,1 @@\n-package nope\n+package yes\n")
+	assert.ErrorContains(t, err, "patch did not apply")
+
+	// Paths outside the project are refused before anything is written
+	_, err = call("*** Begin Patch\n*** Add File: inside.txt\n+ok\n*** Add File: ../outside.txt\n+no\n*** End Patch")
+	assert.ErrorContains(t, err, "outside the project root")
+	assert.NoFileExists(t, "inside.txt")
+	assert.NoFileExists(t, filepath.Join(root, "..", "outside.txt"))
+}
+
+func TestProjectReplaceTool(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+	t.Chdir(root)
+	files := map[string]string{
+		"main.go":          "package main\n\nfunc oldName() {}\n\nfunc main() { oldName() }\n",
+		"pkg/util.go":      "package pkg\n\n// oldName is called from main\n",
+		"README.md":        "Call oldName to start.\n",
+		"generated/gen.go": "package generated\n\nvar _ = oldName\n",
+		".asimiignore":     "generated/\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0o755))
+		require.NoError(t, os.WriteFile(name, []byte(content), 0o644))
+	}
+
+	call := func(params ProjectReplaceInput) string {
+		input, err := json.Marshal(params)
+		require.NoError(t, err)
+		result, err := ProjectReplaceTool{}.Call(context.Background(), string(input))
+		require.NoError(t, err)
+		return result
+	}
+
+	result := call(ProjectReplaceInput{Pattern: "oldName", Replacement: "newName", Glob: "**/*.go", DryRun: true})
+	assert.Equal(t, "main.go: 2 replacements\n"+
+		"  3: func oldName() {} -> func newName() {}\n"+
+		"  5: func main() { oldName() } -> func main() { newName() }\n"+
+		"pkg/util.go: 1 replacements\n"+
+		"  3: // oldName is called from main -> // newName is called from main\n"+
+		"Dry run: 3 replacements in 2 files, nothing written", result)
+	data, err := os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, files["main.go"], string(data))
+
+	require.NoError(t, os.Chmod("main.go", 0o755))
+	result = call(ProjectReplaceInput{Pattern: `old(Name)`, Replacement: "new$1", Regex: true})
+	assert.Equal(t, "README.md: 1 replacements\nmain.go: 2 replacements\npkg/util.go: 1 replacements\nReplaced 4 occurrences in 3 files", result)
+	data, err = os.ReadFile("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc newName() {}\n\nfunc main() { newName() }\n", string(data))
+	info, err := os.Stat("main.go")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o755), info.Mode().Perm(), "the file mode is kept")
+	data, err = os.ReadFile("generated/gen.go")
+	require.NoError(t, err)
+	assert.Equal(t, files["generated/gen.go"], string(data), ".asimiignore'd files are left alone")
+
+	assert.Equal(t, "No occurrences of 'oldName' found", call(ProjectReplaceInput{Pattern: "oldName", Replacement: "x", Glob: "*.md"}))
+
+	// Paths are relative to the project root wherever asimi runs
+	t.Chdir(filepath.Join(root, "pkg"))
+	result = call(ProjectReplaceInput{Pattern: "newName", Replacement: "name"})
+	assert.Equal(t, "README.md: 1 replacements\nmain.go: 2 replacements\npkg/util.go: 1 replacements\nReplaced 4 occurrences in 3 files", result)
+	data, err = os.ReadFile(filepath.Join(root, "main.go"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main\n\nfunc name() {}\n\nfunc main() { name() }\n", string(data))
+}
+
+func TestNotesTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+	call := func(input string) (string, error) {
+		return NotesTool{}.Call(context.Background(), input)
+	}
+
+	result, err := call(`{"action":"read"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "No notes yet", result)
+
+	_, err = call(`{"action":"append","content":"- TODO: split the parser"}`)
+	require.NoError(t, err)
+	_, err = call(`{"action":"append","content":"- found: tests live next to code"}`)
+	require.NoError(t, err)
+	result, err = call(`{"action":"read"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "- TODO: split the parser\n- found: tests live next to code\n", result)
+
+	_, err = call(`{"action":"write","content":"# Plan"}`)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(".asimi", "notes.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "# Plan\n", string(data))
+
+	_, err = call(`{"action":"append"}`)
+	assert.Error(t, err)
+	_, err = call(`{"action":"erase"}`)
+	assert.ErrorContains(t, err, "unknown action")
+
+	// Notes ride along with prompts when enabled
+	sess, err := NewSession(&mockLLMNoTools{}, &Config{LLM: LLMConfig{NotesInContext: true}}, func(any) {})
+	require.NoError(t, err)
+	sess.prepareUserMessage("continue the plan")
+	prompt := sess.messages[len(sess.messages)-1].Parts[0].(llms.TextContent).Text
+	assert.Contains(t, prompt, "# Plan")
+
+	// and leave the context once turned off
+	sess.config.NotesInContext = false
+	sess.prepareUserMessage("next")
+	assert.NotContains(t, sess.GetContextFiles(), notesPath)
+
+	// From a subdirectory the notes are still the project's
+	require.NoError(t, os.Mkdir(".git", 0o755))
+	require.NoError(t, os.Mkdir("sub", 0o755))
+	t.Chdir("sub")
+	result, err = call(`{"action":"read"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "# Plan\n", result)
+	assert.NoDirExists(t, ".asimi")
+}
+
 func TestMergeToolAutoApprove(t *testing.T) {
 	if _, err := exec.LookPath("git"); err != nil {
 		t.Skip("git is required for this test")
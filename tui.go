@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"time"
@@ -67,9 +69,48 @@ type TUIModel struct {
 	// Persistent history store
 	historyStore *HistoryStore
 
+	// Prompt snippets, keyed by name without the leader
+	snippets map[string]string
+
+	// Pending y/n question shown as a toast; called with the answer
+	confirm         func(yes bool) tea.Cmd
+	confirmQuestion string
+
+	// Reverse search through the prompt history, nil when not searching
+	historySearch *historySearch
+
+	// Proposed write waiting for the user to apply, edit or reject it
+	writeReview *writeReviewMsg
+
+	// Write to a file changed outside the session, waiting for the user to allow it
+	externalEdit *externalEditMsg
+
+	// The last prompt failed with a stream error; ctrl+r on an empty prompt resends it
+	retryAfterError bool
+
+	// Why the LLM client could not be created, nil while AI is available
+	llmInitErr error
+
+	// Prompts submitted while streaming, sent in order as each stream completes
+	promptQueue []string
+
+	// Tool calls of the current turn, numbered from 1 in the chat for /replay
+	turnToolCalls []*ToolCall
+
 	// Waiting indicator state
 	waitingForResponse bool
 	waitingStart       time.Time
+	// Whether the current response has produced any output yet
+	responseStarted bool
+
+	// Chat messages already printed to the scrollback in plain mode
+	printedMessages int
+
+	// Whether the program captures the mouse, switched with /mouse
+	mouse bool
+
+	// Latest errors, shown by /errors
+	errorLog errorLog
 }
 
 type promptHistoryEntry struct {
@@ -85,15 +126,19 @@ func NewTUIModel(config *Config) *TUIModel {
 
 	registry := NewCommandRegistry()
 	theme := NewTheme()
+	theme.ApplyConfig(config)
 
 	// Create prompt component with vi mode based on config
 	prompt := NewPromptComponent(80, 5)
 	if config.IsViModeEnabled() {
 		prompt.SetViMode(true)
 	}
+	if config.UI.Placeholder != "" {
+		prompt.SetPlaceholder(config.UI.Placeholder)
+	}
 
 	// Initialize history store
-	historyStore, err := NewHistoryStore()
+	historyStore, err := NewHistoryStore(config.History.StorageDir)
 	if err != nil {
 		slog.Warn("failed to initialize history store", "error", err)
 		historyStore = nil
@@ -111,7 +156,7 @@ func NewTUIModel(config *Config) *TUIModel {
 			maxAgeDays = config.Session.MaxAgeDays
 		}
 		var storeErr error
-		store, storeErr = NewSessionStore(maxSessions, maxAgeDays)
+		store, storeErr = NewSessionStore(maxSessions, maxAgeDays, config.Session.StorageDir)
 		if storeErr != nil {
 			slog.Error("failed to create session store", "error", storeErr)
 		}
@@ -149,6 +194,19 @@ func NewTUIModel(config *Config) *TUIModel {
 		toolCallMessageIndex: make(map[string]int),
 		waitingForResponse:   false,
 		historyStore:         historyStore,
+		snippets:             LoadSnippets(),
+	}
+
+	model.chat.ShowTimestamps = config.LLM.ShowTimestamps
+	model.chat.ScrollLock = config.IsScrollLockEnabled()
+	model.mouse = config.IsMouseEnabled() && !config.UI.Plain
+	if config.UI.Compact && !config.UI.Plain {
+		model.setCompact(true)
+	}
+	if config.UI.Plain {
+		model.chat.Plain = true
+		model.status.Plain = true
+		model.prompt.Style = model.prompt.Style.Border(lipgloss.ASCIIBorder())
 	}
 
 	// Set initial status info - show disconnected state initially
@@ -158,6 +216,33 @@ func NewTUIModel(config *Config) *TUIModel {
 	return model
 }
 
+// applyConfig re-applies the settings that are read when the model is
+// created, after the config was reloaded
+func (m *TUIModel) applyConfig() {
+	m.theme = NewTheme()
+	m.theme.ApplyConfig(m.config)
+	if m.config.IsViModeEnabled() != m.prompt.ViMode {
+		m.prompt.SetViMode(m.config.IsViModeEnabled())
+	}
+	placeholder := m.config.UI.Placeholder
+	if placeholder == "" {
+		placeholder = defaultPlaceholder
+	}
+	m.prompt.SetPlaceholder(placeholder)
+	m.chat.ShowTimestamps = m.config.LLM.ShowTimestamps
+	m.chat.ScrollLock = m.config.IsScrollLockEnabled()
+	if m.config.UI.Compact != m.chat.Compact && !m.chat.Plain {
+		m.setCompact(m.config.UI.Compact)
+	}
+	m.snippets = LoadSnippets()
+	if m.session != nil && m.session.IsReadOnly() != m.config.LLM.ReadOnly {
+		m.session.SetReadOnly(m.config.LLM.ReadOnly)
+	}
+	if m.session != nil && !reflect.DeepEqual(m.session.toolOverrides, m.config.Tools) {
+		m.session.SetToolOverrides(m.config.Tools)
+	}
+}
+
 // initHistory resets prompt history bookkeeping to its initial state and loads persistent history
 func (m *TUIModel) initHistory() {
 	m.promptHistory = make([]promptHistoryEntry, 0)
@@ -190,11 +275,15 @@ func (m *TUIModel) initHistory() {
 	}
 }
 
-// addToRawHistory adds an entry to the raw session history with a timestamp
+// addToRawHistory adds an entry to the raw session history with a timestamp,
+// keeping it with the session too so that it's there on resume
 func (m *TUIModel) addToRawHistory(prefix, content string) {
 	timestamp := time.Now().Format("15:04:05")
 	entry := fmt.Sprintf("[%s] %s: %s", timestamp, prefix, content)
 	m.rawSessionHistory = append(m.rawSessionHistory, entry)
+	if m.session != nil {
+		m.session.AddRawHistory(prefix, entry)
+	}
 }
 
 // SetSession sets the session for the TUI model
@@ -202,6 +291,8 @@ func (m *TUIModel) SetSession(session *Session) {
 	m.session = session
 	m.status.SetSession(session) // Pass session to status component
 	if session != nil {
+		session.SetWriteReviewer(sendWriteReview)
+		session.SetExternalEditConfirmer(sendExternalEditConfirm)
 		m.status.SetProvider(m.config.LLM.Provider, m.config.LLM.Model, true)
 	} else {
 		m.status.SetProvider(m.config.LLM.Provider, m.config.LLM.Model, false)
@@ -244,6 +335,22 @@ func (m *TUIModel) saveSession() {
 	slog.Debug("session auto-save queued")
 }
 
+// saveSessionSync saves the session right away, for when the caller is about
+// to change it and a queued save would otherwise record the new state
+func (m *TUIModel) saveSessionSync() {
+	if m.session == nil || m.sessionStore == nil {
+		return
+	}
+
+	if !m.config.Session.Enabled || !m.config.Session.AutoSave {
+		return
+	}
+
+	if err := m.sessionStore.SaveSessionSync(m.session); err != nil {
+		slog.Warn("failed to save session", "error", err)
+	}
+}
+
 // shutdown performs graceful shutdown of the TUI, ensuring all pending saves complete
 func (m *TUIModel) shutdown() {
 	if m.sessionStore != nil {
@@ -254,12 +361,36 @@ func (m *TUIModel) shutdown() {
 // Init implements bubbletea.Model
 func (m TUIModel) Init() tea.Cmd {
 	// Bubbletea will automatically send a WindowSizeMsg after Init
-	// We don't need to do anything special here
-	return nil
+	return checkRecentSession(m.sessionStore)
 }
 
 // Update implements bubbletea.Model
 func (m TUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	model, cmd := m.update(msg)
+	if updated, ok := model.(TUIModel); ok && updated.chat.Plain {
+		if flush := updated.flushTranscript(); flush != nil {
+			return updated, tea.Batch(cmd, flush)
+		}
+		return updated, cmd
+	}
+	return model, cmd
+}
+
+// flushTranscript prints the chat messages that can no longer change above the
+// program, leaving a linear transcript in the scrollback in plain mode
+func (m *TUIModel) flushTranscript() tea.Cmd {
+	if m.printedMessages > len(m.chat.Messages) {
+		m.printedMessages = len(m.chat.Messages)
+	}
+	if m.streamingActive || m.waitingForResponse || m.printedMessages == len(m.chat.Messages) {
+		return nil
+	}
+	transcript := m.chat.plainContent(m.chat.Messages[m.printedMessages:])
+	m.printedMessages = len(m.chat.Messages)
+	return tea.Println(transcript + "\n")
+}
+
+func (m TUIModel) update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	// Update toast manager to remove expired toasts
 	m.toastManager.Update()
 
@@ -268,6 +399,11 @@ func (m TUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return m.handleKeyMsg(msg)
 
 	case tea.MouseMsg:
+		if m.showCompletionDialog && msg.Button == tea.MouseButtonLeft && msg.Action == tea.MouseActionPress {
+			if model, cmd, handled := m.handleCompletionClick(msg); handled {
+				return model, cmd
+			}
+		}
 		// Handle chat scrolling first (including touch gestures)
 		var chatCmd tea.Cmd
 		if msg.Type == tea.MouseWheelUp || msg.Type == tea.MouseWheelDown ||
@@ -287,10 +423,10 @@ func (m TUIModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 // handleKeyMsg processes keyboard input
 func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
-	// Always handle Ctrl+C first
+	// Always handle Ctrl+C first, unless it cancels a history search
 	var cmd tea.Cmd
 
-	if msg.String() == "ctrl+c" {
+	if msg.String() == "ctrl+c" && m.historySearch == nil {
 		m.saveSession()
 		m.shutdown()
 		return m, tea.Quit
@@ -319,6 +455,40 @@ func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, cmd
 	}
 
+	if m.writeReview != nil {
+		if cmd, ok := m.answerWriteReview(msg.String()); ok {
+			return m, cmd
+		}
+	}
+
+	if m.externalEdit != nil {
+		if cmd, ok := m.answerExternalEdit(msg.String()); ok {
+			return m, cmd
+		}
+	}
+
+	if m.historySearch != nil && m.handleHistorySearchKey(msg) {
+		return m, nil
+	}
+
+	// Answer a pending y/n question. Any other key cancels it and goes on to
+	// the prompt, so typing right away isn't lost.
+	if m.confirm != nil {
+		confirm := m.confirm
+		m.confirm = nil
+		m.toastManager.Clear()
+		switch msg.String() {
+		case "y", "Y":
+			return m, confirm(true)
+		case "n", "N", "esc":
+			return m, confirm(false)
+		}
+		m.toastManager.AddToast("Cancelled: "+m.confirmQuestion, "info", 3000)
+		if cmd := confirm(false); cmd != nil {
+			return m, cmd
+		}
+	}
+
 	// Handle escape key for vi mode transitions BEFORE other escape handling
 	// ESC in Insert mode -> Normal mode
 	if msg.String() == "esc" && m.prompt.IsViInsertMode() {
@@ -350,6 +520,52 @@ func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleCompletionDialog(msg)
 	}
 
+	// Interrupt only the running tool, letting the model continue with the turn
+	if msg.String() == m.interruptToolKey() {
+		if m.session != nil && m.session.scheduler != nil && m.session.scheduler.CancelRunning() {
+			m.toastManager.AddToast("Tool interrupted", "warning", 2000)
+		}
+		return m, nil
+	}
+
+	// Tool call output expansion works in every prompt mode
+	switch msg.String() {
+	case "ctrl+x":
+		m.chat.ToggleToolExpansion()
+		return m, nil
+	case "ctrl+p":
+		return m.handleSwitchSession()
+	case "ctrl+n":
+		// Not ctrl+end, which moves to the end of the prompt
+		m.chat.ScrollToBottom()
+		return m, nil
+	case "pgup":
+		m.chat.ScrollHalfPage(-1)
+		return m, nil
+	case "pgdown":
+		m.chat.ScrollHalfPage(1)
+		return m, nil
+	case "home":
+		// Home and End move the cursor while typing a prompt
+		if m.prompt.Value() == "" {
+			m.chat.ScrollToTop()
+			return m, nil
+		}
+	case "end":
+		if m.prompt.Value() == "" {
+			m.chat.ScrollToBottom()
+			return m, nil
+		}
+	case "alt+e":
+		return m, m.openLastFile()
+	case "alt+up":
+		m.chat.FocusTool(-1)
+		return m, nil
+	case "alt+down":
+		m.chat.FocusTool(1)
+		return m, nil
+	}
+
 	// Handle vi mode key bindings when in normal or visual mode
 	if m.prompt.IsViNormalMode() || m.prompt.IsViVisualMode() {
 		return m.handleViNormalMode(msg)
@@ -361,13 +577,36 @@ func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 
 	// Handle regular key input
+	if msg.String() == m.commandLeader() && !(m.prompt.ViMode && msg.String() == ":") {
+		return m.handleSlashKey(msg)
+	}
+	if msg.String() == m.submitKey() {
+		return m.handleEnterKey()
+	}
 	switch msg.String() {
 	case "ctrl+o":
 		return m.handleToggleRawMode()
+	case loginKey:
+		if m.session == nil {
+			return m, handleLoginCommand(&m, nil)
+		}
+		m.prompt, _ = m.prompt.Update(msg)
+		return m, nil
+	case "ctrl+r":
+		if m.retryAfterError && m.prompt.Value() == "" && len(m.promptHistory) > 0 {
+			return m.retryLastPrompt()
+		}
+		if len(m.promptHistory) > 0 {
+			m.startHistorySearch()
+		}
+		return m, nil
 	case "enter":
-		return m.handleEnterKey()
-	case "/":
-		return m.handleSlashKey(msg)
+		// Enter inserts a newline when another key submits, except for commands
+		if _, isCommand := m.commandName(m.prompt.Value()); isCommand && !strings.Contains(m.prompt.Value(), "\n") {
+			return m.handleEnterKey()
+		}
+		m.prompt.TextArea.InsertString("\n")
+		return m, nil
 	case ":":
 		// In vi mode, colon acts like slash for commands
 		if m.prompt.ViMode {
@@ -377,6 +616,11 @@ func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m, nil
 	case "@":
 		return m.handleAtKey(msg)
+	case " ":
+		// Expand a snippet as soon as its key is completed
+		m.prompt.expandSnippetBeforeCursor(m.snippetLeader(), m.snippets)
+		m.prompt, _ = m.prompt.Update(msg)
+		return m, nil
 	case "up":
 		// Only handle history navigation if we're on the first line
 		if m.prompt.TextArea.Line() == 0 {
@@ -402,6 +646,28 @@ func (m TUIModel) handleKeyMsg(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 }
 
+// handleSwitchSession saves the current session and swaps in the most
+// recently updated other session of the project
+func (m TUIModel) handleSwitchSession() (tea.Model, tea.Cmd) {
+	if m.session == nil || m.sessionStore == nil {
+		m.toastManager.AddToast("Sessions are not available", "error", 3000)
+		return m, nil
+	}
+	if m.streamingActive || m.streamingCancel != nil {
+		m.toastManager.AddToast("Wait for the current response to finish", "error", 3000)
+		return m, nil
+	}
+	m.saveSessionSync()
+	store, currentID := m.sessionStore, m.session.ID
+	return m, func() tea.Msg {
+		session, err := store.PreviousSession(currentID)
+		if err != nil {
+			return sessionResumeErrorMsg{err: err}
+		}
+		return sessionSelectedMsg{session: session}
+	}
+}
+
 // handleToggleRawMode toggles between chat and raw session view
 func (m TUIModel) handleToggleRawMode() (tea.Model, tea.Cmd) {
 	m.rawMode = !m.rawMode
@@ -556,6 +822,137 @@ func (m TUIModel) handleViCommandLineMode(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// numberToolCall prefixes a tool call line with its number in the current turn
+func (m TUIModel) numberToolCall(call *ToolCall, formatted string) string {
+	for i, c := range m.turnToolCalls {
+		if c.ID == call.ID {
+			return fmt.Sprintf("#%d %s", i+1, formatted)
+		}
+	}
+	return formatted
+}
+
+// newChat returns an empty chat of the current size that keeps the display settings
+func (m TUIModel) newChat() ChatComponent {
+	chat := NewChatComponent(m.chat.Width, m.chat.Height)
+	chat.HideReasoning = m.chat.HideReasoning
+	chat.ShowTimestamps = m.chat.ShowTimestamps
+	chat.ScrollLock = m.chat.ScrollLock
+	chat.Plain = m.chat.Plain
+	chat.Compact = m.chat.Compact
+	chat.markdownRenderer = m.chat.markdownRenderer
+	return chat
+}
+
+// toolIcon returns the chat icon for a tool call status, the same glyph
+// the console shows in prompt mode. Plain mode uses ASCII.
+func (m TUIModel) toolIcon(status string) string {
+	return m.theme.ToolStatus(status)
+}
+
+// askConfirm shows a y/n question and calls confirm with the answer on the next key press
+func (m *TUIModel) askConfirm(question string, confirm func(yes bool) tea.Cmd) {
+	m.confirm = confirm
+	m.confirmQuestion = question
+	m.toastManager.AddToast(question+" (y/n)", "info", time.Minute)
+}
+
+// openFileInEditor suspends the TUI to edit path in $EDITOR
+func (m *TUIModel) openFileInEditor(path string) tea.Cmd {
+	return tea.ExecProcess(openInEditor(resolveFileRef(path)), func(err error) tea.Msg {
+		if err != nil {
+			return errMsg{fmt.Errorf("editor exited with error: %w", err)}
+		}
+		return nil
+	})
+}
+
+// openLastFile opens the file the agent last read or wrote in $EDITOR
+func (m *TUIModel) openLastFile() tea.Cmd {
+	if m.session == nil || m.session.LastFile() == "" {
+		m.toastManager.AddToast("No file read or written by the agent yet", "info", 3000)
+		return nil
+	}
+	return m.openFileInEditor(m.session.LastFile())
+}
+
+// snippetLeader returns the configured prefix that marks a snippet key
+func (m TUIModel) snippetLeader() string {
+	if m.config != nil && m.config.LLM.SnippetLeader != "" {
+		return m.config.LLM.SnippetLeader
+	}
+	return ";"
+}
+
+// commandLeader returns the configured character that starts a command
+func (m TUIModel) commandLeader() string {
+	if m.config != nil && validCommandLeader(m.config.UI.CommandLeader) {
+		return m.config.UI.CommandLeader
+	}
+	return "/"
+}
+
+// submitKey returns the key that sends the prompt
+func (m TUIModel) submitKey() string {
+	if m.config != nil {
+		if key, ok := submitKeys[m.config.UI.Submit]; ok {
+			return key
+		}
+	}
+	return "enter"
+}
+
+// commandName maps a leader-prefixed input (or : in vi mode) to the registered /name
+func (m TUIModel) commandName(content string) (string, bool) {
+	if leader := m.commandLeader(); strings.HasPrefix(content, leader) {
+		return "/" + strings.TrimPrefix(content, leader), true
+	}
+	if m.prompt.ViMode && strings.HasPrefix(content, ":") {
+		return "/" + strings.TrimPrefix(content, ":"), true
+	}
+	return content, false
+}
+
+// withLeader renders a registered /name with the given leader
+func withLeader(name, leader string) string {
+	return leader + strings.TrimPrefix(name, "/")
+}
+
+// offerContinue tells the user how to resume a response that was cut off
+func (m *TUIModel) offerContinue() {
+	if m.session == nil || !m.session.CanContinue() {
+		return
+	}
+	m.chat.AddMessage(fmt.Sprintf("💡 Use %s to resume the response", withLeader("/continue", m.commandLeader())))
+}
+
+// offerRetry lets ctrl+r resend the prompt that just failed
+func (m *TUIModel) offerRetry() {
+	if len(m.promptHistory) == 0 {
+		return
+	}
+	m.retryAfterError = true
+	m.chat.AddMessage("💡 Press ctrl+r to retry the last prompt")
+}
+
+// retryLastPrompt resends the last prompt, rolling the session and chat
+// back to before it so a partial answer doesn't linger
+func (m TUIModel) retryLastPrompt() (tea.Model, tea.Cmd) {
+	m.retryAfterError = false
+	m.historyCursor = len(m.promptHistory) - 1
+	m.historySaved = true
+	m.prompt.SetValue(m.promptHistory[m.historyCursor].Prompt)
+	return m.handleEnterKey()
+}
+
+// interruptToolKey returns the configured key that interrupts the running tool
+func (m TUIModel) interruptToolKey() string {
+	if m.config != nil && m.config.LLM.InterruptToolKey != "" {
+		return m.config.LLM.InterruptToolKey
+	}
+	return "ctrl+g"
+}
+
 // handleCtrlZ handles Ctrl+Z to send the application to background
 func (m TUIModel) handleCtrlZ() (tea.Model, tea.Cmd) {
 	// Display message to user
@@ -590,18 +987,24 @@ func (m TUIModel) handleEscape() (tea.Model, tea.Cmd) {
 func (m TUIModel) handleCompletionDialog(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter", "tab":
+		if m.completionMode == "command" && strings.Contains(m.prompt.Value(), " ") {
+			return m.handleArgumentSelection(msg.String() == "tab")
+		}
 		return m.handleCompletionSelection()
 	case "down":
 		m.completions.SelectNext()
+		m.refreshCompletionPreview()
 		return m, nil
 	case "up":
 		m.completions.SelectPrev()
+		m.refreshCompletionPreview()
 		return m, nil
 	default:
 		// Any other key press updates the completion list
 		m.prompt, _ = m.prompt.Update(msg)
 		if m.completionMode == "file" {
-			files, err := getFileTree(".")
+			query, _ := fileCompletionQuery(m.prompt.Value())
+			files, err := fileCompletionCandidates(query)
 			if err == nil {
 				m.updateFileCompletions(files)
 			}
@@ -612,6 +1015,26 @@ func (m TUIModel) handleCompletionDialog(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	}
 }
 
+// handleCompletionClick selects the completion item under a left click and
+// confirms it on a double-click. Clicks outside the items are not handled.
+func (m TUIModel) handleCompletionClick(msg tea.MouseMsg) (tea.Model, tea.Cmd, bool) {
+	dialog := m.completions.View()
+	if dialog == "" {
+		return m, nil, false
+	}
+	top := m.completionDialogTop(lipgloss.Height(dialog), m.prompt.View(), m.renderViModeAndToast())
+	index := m.completions.ItemAt(msg.X, msg.Y-top)
+	if index < 0 {
+		return m, nil, false
+	}
+	if m.completions.Click(index, time.Now()) {
+		model, cmd := m.handleCompletionSelection()
+		return model, cmd, true
+	}
+	m.refreshCompletionPreview()
+	return m, nil, true
+}
+
 // handleCompletionSelection handles when a completion is selected
 func (m TUIModel) handleCompletionSelection() (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
@@ -619,13 +1042,22 @@ func (m TUIModel) handleCompletionSelection() (tea.Model, tea.Cmd) {
 	selected := m.completions.GetSelected()
 	if selected != "" {
 		if m.completionMode == "file" {
-			filePath := selected
-			content, err := os.ReadFile(filePath)
-			if err != nil {
+			filePath := resolveFileRef(selected)
+			if isImageFile(filePath) {
+				if m.session == nil {
+					m.toastManager.AddToast("No LLM configured. Please use /login to configure an API key.", "error", time.Second*3)
+				} else if err := m.session.AttachImage(filePath); err != nil {
+					m.toastManager.AddToast(err.Error(), "error", time.Second*3)
+				} else {
+					m.chat.AddMessage(fmt.Sprintf("Attached image: %s", selected))
+				}
+			} else if content, err := os.ReadFile(filePath); err != nil {
 				m.toastManager.AddToast(fmt.Sprintf("Error reading file: %v", err), "error", time.Second*3)
 			} else if m.session != nil {
-				m.session.AddContextFile(filePath, string(content))
-				m.chat.AddMessage(fmt.Sprintf("Loaded file: %s", filePath))
+				m.session.AddContextFile(selected, string(content))
+				m.chat.AddMessage(fmt.Sprintf("Loaded file: %s", selected))
+			} else {
+				m.showFile(selected, content)
 			}
 			currentValue := m.prompt.Value()
 			lastAt := strings.LastIndex(currentValue, "@")
@@ -651,11 +1083,8 @@ func (m TUIModel) handleCompletionSelection() (tea.Model, tea.Cmd) {
 				m.prompt.SetValue("@" + selected + " ")
 			}
 		} else if m.completionMode == "command" {
-			// Normalize command name (convert : to / if needed)
-			cmdName := selected
-			if strings.HasPrefix(cmdName, ":") {
-				cmdName = "/" + strings.TrimPrefix(cmdName, ":")
-			}
+			// Normalize command name (convert the leader or : to / if needed)
+			cmdName, _ := m.commandName(selected)
 
 			// It's a command completion
 			cmd, exists := m.commandRegistry.GetCommand(cmdName)
@@ -672,6 +1101,26 @@ func (m TUIModel) handleCompletionSelection() (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// handleArgumentSelection takes the selected argument completion. Tab puts
+// it in the prompt to go on typing; enter runs the command with it.
+func (m TUIModel) handleArgumentSelection(fill bool) (tea.Model, tea.Cmd) {
+	selected := m.completions.GetSelected()
+	if fill {
+		if selected != "" {
+			m.prompt.SetValue(selected + " ")
+			m.updateCommandCompletions()
+		}
+		return m, nil
+	}
+	if selected != "" {
+		m.prompt.SetValue(selected)
+	}
+	m.showCompletionDialog = false
+	m.completions.Hide()
+	m.completionMode = ""
+	return m.handleEnterKey()
+}
+
 func (m *TUIModel) startWaitingForResponse() tea.Cmd {
 	if m.waitingForResponse {
 		return nil
@@ -683,6 +1132,29 @@ func (m *TUIModel) startWaitingForResponse() tea.Cmd {
 	return tea.Tick(time.Second, func(time.Time) tea.Msg { return waitingTickMsg{} })
 }
 
+// markResponseStarted records that the model is streaming output
+func (m *TUIModel) markResponseStarted() {
+	m.responseStarted = true
+	m.status.SetNonStreaming(false)
+}
+
+// nonStreamingNotice returns how long to wait for output before noting the
+// model doesn't stream, or 0 when the notice is disabled
+func (m TUIModel) nonStreamingNotice() time.Duration {
+	if m.config != nil && !m.config.LLM.UseStreaming() {
+		// The user asked for whole responses
+		return 0
+	}
+	seconds := 10
+	if m.config != nil && m.config.LLM.NonStreamingNotice != 0 {
+		seconds = m.config.LLM.NonStreamingNotice
+	}
+	if seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func (m *TUIModel) stopWaitingForResponse() {
 	if !m.waitingForResponse {
 		return
@@ -782,16 +1254,10 @@ func (m TUIModel) handleEnterKey() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
-	// Check for command prefix (/ or : in vi mode)
-	isCommand := strings.HasPrefix(content, "/") || (m.prompt.ViMode && strings.HasPrefix(content, ":"))
+	// Check for command prefix (the leader or : in vi mode) and normalize it to /
+	normalizedContent, isCommand := m.commandName(content)
 
 	if isCommand {
-		// Normalize command to use / prefix
-		normalizedContent := content
-		if strings.HasPrefix(content, ":") {
-			normalizedContent = "/" + strings.TrimPrefix(content, ":")
-		}
-
 		parts := strings.Fields(normalizedContent)
 		if len(parts) > 0 {
 			cmdName := parts[0]
@@ -809,7 +1275,15 @@ func (m TUIModel) handleEnterKey() (tea.Model, tea.Cmd) {
 				m.toastManager.AddToast(fmt.Sprintf("Unknown command: %s", cmdName), "error", time.Second*3)
 			}
 		}
+	} else if m.streamingActive || m.streamingCancel != nil {
+		m.promptQueue = append(m.promptQueue, content)
+		m.status.SetQueued(len(m.promptQueue))
+		m.prompt.SetValue("")
+		m.toastManager.AddToast(fmt.Sprintf("Queued (%d)", len(m.promptQueue)), "info", 2*time.Second)
 	} else {
+		content = expandSnippets(content, m.snippetLeader(), m.snippets)
+		m.turnToolCalls = nil
+		m.retryAfterError = false
 		// Clear any lingering toast notifications before handling a new prompt
 		m.toastManager.Clear()
 		refreshGitInfo()
@@ -845,6 +1319,7 @@ func (m TUIModel) handleEnterKey() (tea.Model, tea.Cmd) {
 			m.sessionActive = true
 			m.prompt.SetValue("")
 			// In vi mode, stay in insert mode for continued conversation
+			m.responseStarted = false
 			if waitCmd := m.startWaitingForResponse(); waitCmd != nil {
 				cmds = append(cmds, waitCmd)
 			}
@@ -852,7 +1327,7 @@ func (m TUIModel) handleEnterKey() (tea.Model, tea.Cmd) {
 			m.streamingCancel = cancel
 			m.session.AskStream(ctx, content)
 		} else {
-			m.toastManager.AddToast("No LLM configured. Please use /login to configure an API key.", "error", time.Second*5)
+			m.offerLogin()
 			m.prompt.SetValue("")
 		}
 		m.promptHistory = append(m.promptHistory, promptHistoryEntry{
@@ -874,15 +1349,38 @@ func (m TUIModel) handleEnterKey() (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
-// handleSlashKey handles the slash key for command completion
+// submitNextQueued takes the oldest prompt off the queue and submits it
+func (m TUIModel) submitNextQueued() (tea.Model, tea.Cmd) {
+	next := m.promptQueue[0]
+	m.promptQueue = m.promptQueue[1:]
+	m.status.SetQueued(len(m.promptQueue))
+	return m.submitQueuedPrompt(next)
+}
+
+// submitQueuedPrompt sends a queued prompt as if it were typed, keeping any draft in the prompt
+func (m TUIModel) submitQueuedPrompt(content string) (tea.Model, tea.Cmd) {
+	draft := m.prompt.Value()
+	m.prompt.SetValue(content)
+	model, cmd := m.handleEnterKey()
+	updated := model.(TUIModel)
+	updated.prompt.SetValue(draft)
+	return updated, cmd
+}
+
+// handleSlashKey handles the command leader key (/ by default) for command completion
 func (m TUIModel) handleSlashKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	// Only show command completion if we're at the beginning of the input
 	if m.prompt.Value() == "" {
 		m.prompt, _ = m.prompt.Update(msg)
 		// Show completion dialog with commands
+		leader := m.commandLeader()
+		var commands []string
+		for _, cmd := range m.commandRegistry.order {
+			commands = append(commands, withLeader(cmd, leader))
+		}
 		m.showCompletionDialog = true
 		m.completionMode = "command"
-		m.completions.SetOptions(append([]string(nil), m.commandRegistry.order...))
+		m.completions.SetOptions(commands)
 		m.completions.Show()
 	} else {
 		m.prompt, _ = m.prompt.Update(msg)
@@ -917,7 +1415,7 @@ func (m TUIModel) handleAtKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	// Show completion dialog with files
 	m.showCompletionDialog = true
 	m.completionMode = "file"
-	files, err := getFileTree(".")
+	files, err := fileCompletionCandidates("")
 	if err != nil {
 		m.chat.AddMessage(fmt.Sprintf("Error scanning files: %v", err))
 	} else {
@@ -978,17 +1476,25 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.chat.AddMessage(fmt.Sprintf("Asimi: %s", string(msg)))
 		refreshGitInfo()
 
+	case ToolCallArgsChunkMsg:
+		m.status.SetPreparingTool(msg.Name, msg.ArgsLen)
+		m.waitingStart = time.Now()
+		m.markResponseStarted()
+
 	case ToolCallScheduledMsg:
+		m.status.SetPreparingTool("", 0)
+		m.markResponseStarted()
 		m.addToRawHistory("TOOL_SCHEDULED", fmt.Sprintf("%s with input: %s", msg.Call.Tool.Name(), msg.Call.Input))
 
 		// Add a new message and store its index
-		message := formatToolCall(msg.Call.Tool.Name(), "📋", msg.Call.Input, "", nil)
+		m.turnToolCalls = append(m.turnToolCalls, msg.Call)
+		message := m.numberToolCall(msg.Call, formatToolCall(msg.Call.Tool.Name(), m.toolIcon("scheduled"), msg.Call.Input, "", nil))
 		m.chat.AddMessage(message)
 		m.toolCallMessageIndex[msg.Call.ID] = len(m.chat.Messages) - 1
 
 	case ToolCallExecutingMsg:
 		m.addToRawHistory("TOOL_EXECUTING", fmt.Sprintf("%s with input: %s", msg.Call.Tool.Name(), msg.Call.Input))
-		formatted := formatToolCall(msg.Call.Tool.Name(), "⚙️", msg.Call.Input, "", nil)
+		formatted := m.numberToolCall(msg.Call, formatToolCall(msg.Call.Tool.Name(), m.toolIcon("executing"), msg.Call.Input, "", nil))
 		// Update the existing message if we have its index
 		if idx, exists := m.toolCallMessageIndex[msg.Call.ID]; exists && idx < len(m.chat.Messages) {
 			m.chat.Messages[idx] = formatted
@@ -1000,22 +1506,24 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case ToolCallSuccessMsg:
 		m.addToRawHistory("TOOL_SUCCESS", fmt.Sprintf("%s\nInput: %s\nOutput: %s", msg.Call.Tool.Name(), msg.Call.Input, msg.Call.Result))
-		formatted := formatToolCall(msg.Call.Tool.Name(), "✅", msg.Call.Input, msg.Call.Result, nil)
+		formatted := m.numberToolCall(msg.Call, formatToolCall(msg.Call.Tool.Name(), m.toolIcon("success"), msg.Call.Input, msg.Call.Result, nil))
 		// Update the existing message if we have its index
 		if idx, exists := m.toolCallMessageIndex[msg.Call.ID]; exists && idx < len(m.chat.Messages) {
 			m.chat.Messages[idx] = formatted
-			m.chat.UpdateContent()
+			m.chat.SetToolResult(idx, msg.Call.Result, toolDetails(msg.Call.Tool, msg.Call.Input, msg.Call.Result)...)
 			// Clean up the index mapping
 			delete(m.toolCallMessageIndex, msg.Call.ID)
 		} else {
 			// Fallback: add a new message if we don't have the index
 			m.chat.AddMessage(formatted)
+			m.chat.SetToolResult(len(m.chat.Messages)-1, msg.Call.Result, toolDetails(msg.Call.Tool, msg.Call.Input, msg.Call.Result)...)
 		}
 		refreshGitInfo()
 
 	case ToolCallErrorMsg:
 		m.addToRawHistory("TOOL_ERROR", fmt.Sprintf("%s\nInput: %s\nError: %v", msg.Call.Tool.Name(), msg.Call.Input, msg.Call.Error))
-		formatted := formatToolCall(msg.Call.Tool.Name(), "⁉️", msg.Call.Input, "", msg.Call.Error)
+		m.errorLog.Add("tool "+msg.Call.Tool.Name(), fmt.Sprint(msg.Call.Error), "Input: "+msg.Call.Input)
+		formatted := m.numberToolCall(msg.Call, formatToolCall(msg.Call.Tool.Name(), m.toolIcon("error"), msg.Call.Input, "", msg.Call.Error))
 		// Update the existing message if we have its index
 		if idx, exists := m.toolCallMessageIndex[msg.Call.ID]; exists && idx < len(m.chat.Messages) {
 			m.chat.Messages[idx] = formatted
@@ -1027,9 +1535,30 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.chat.AddMessage(formatted)
 		}
 
+	case responseDetailsMsg:
+		m.addToRawHistory("RESPONSE_DETAILS", string(msg))
+		m.chat.AddMessage(responseDetailsPrefix + string(msg))
+
+	case llmTraceMsg:
+		m.addToRawHistory("LLM_TRACE", string(msg))
+
+	case thinkingWarningMsg:
+		m.addToRawHistory("THINKING_WARNING", string(msg))
+		m.toastManager.AddToast(string(msg), "warning", 6000)
+
+	case toolFallbackMsg:
+		m.addToRawHistory("TOOL_FALLBACK", string(msg))
+		m.toastManager.AddToast(string(msg), "warning", 6000)
+
 	case errMsg:
 		m.addToRawHistory("ERROR", fmt.Sprintf("%v", msg.err))
-		m.chat.AddMessage(fmt.Sprintf("Error: %v", msg.err))
+		llmErr := classifyLLMError(msg.err)
+		m.errorLog.Add("error", llmErr.Error(), msg.err.Error())
+		if llmErr.Kind != LLMErrorUnknown {
+			m.chat.AddMessage(fmt.Sprintf("Error: %s\n💡 %s", llmErr.Message, llmErr.Action))
+		} else {
+			m.chat.AddMessage(fmt.Sprintf("Error: %v", msg.err))
+		}
 
 	case streamStartMsg:
 		// Streaming has started
@@ -1037,9 +1566,22 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		slog.Debug("streamStartMsg", "starting_stream", true)
 		m.streamingActive = true
 
+	case thinkingPhaseStartMsg:
+		m.status.SetPhase(phaseThinking)
+
+	case toolPhaseStartMsg:
+		m.status.SetPhase(phaseTools)
+		m.addToRawHistory("TOOL_PHASE", fmt.Sprintf("%d tool call(s)", msg.count))
+
+	case assistantTextStartMsg:
+		// Each response gets its own message, even when nothing came between them
+		m.status.SetPhase(phaseResponding)
+		m.chat.AddMessage("Asimi: ")
+
 	case streamChunkMsg:
 		// For the first chunk, add a new AI message. For subsequent chunks, append to the last message.
 		m.addToRawHistory("STREAM_CHUNK", string(msg))
+		m.markResponseStarted()
 		// Reset the waiting timer - we received data, so restart the quiet time countdown
 		if m.streamingActive {
 			// Restart the waiting indicator to track quiet time
@@ -1065,6 +1607,14 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.stopStreaming()
 		m.saveSession()
 		refreshGitInfo()
+		if m.session != nil && m.config != nil && m.config.IsDiffstatEnabled() {
+			if stats := m.session.TurnDiffstat(); len(stats) > 0 {
+				m.chat.AddMessage(formatDiffstat(stats))
+			}
+		}
+		if len(m.promptQueue) > 0 {
+			return m.submitNextQueued()
+		}
 
 	case streamInterruptedMsg:
 		// Streaming was interrupted by user
@@ -1072,14 +1622,31 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		slog.Debug("streamInterruptedMsg", "partial_content_length", len(msg.partialContent))
 		m.chat.AddMessage("\nESC")
 		m.stopStreaming()
+		m.offerContinue()
 		refreshGitInfo()
+		if len(m.promptQueue) > 0 {
+			return m.submitNextQueued()
+		}
 
 	case streamErrorMsg:
-		m.addToRawHistory("STREAM_ERROR", fmt.Sprintf("AI streaming error: %v", msg.err))
-		slog.Error("streamErrorMsg", "error", msg.err)
-		m.chat.AddMessage(fmt.Sprintf("LLM Error: %v", msg.err))
+		llmErr := classifyLLMError(msg.err)
+		m.addToRawHistory("STREAM_ERROR", fmt.Sprintf("AI streaming error: %v", llmErr.Err))
+		m.errorLog.Add("llm", llmErr.Error(), fmt.Sprint(llmErr.Err))
+		slog.Error("streamErrorMsg", "error", llmErr.Err, "kind", llmErr.Kind)
+		if llmErr.Action != "" {
+			m.chat.AddMessage(fmt.Sprintf("LLM Error: %s\n💡 %s", llmErr.Message, llmErr.Action))
+			m.toastManager.AddToast(llmErr.Action, "error", 5000)
+		} else {
+			m.chat.AddMessage(fmt.Sprintf("LLM Error: %s", llmErr.Message))
+		}
 		m.stopStreaming()
+		m.offerContinue()
 		refreshGitInfo()
+		// A queued prompt goes next instead of offering to retry this one
+		if len(m.promptQueue) > 0 {
+			return m.submitNextQueued()
+		}
+		m.offerRetry()
 
 	case streamMaxTurnsExceededMsg:
 		// Max turns exceeded, mark session as inactive and show warning
@@ -1088,6 +1655,12 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.chat.AddMessage(fmt.Sprintf("\n⚠️  Conversation ended after reaching maximum turn limit (%d turns)", msg.maxTurns))
 		m.stopStreaming()
 		refreshGitInfo()
+		m.askConfirm(fmt.Sprintf("Continue for %d more turns?", msg.maxTurns), func(yes bool) tea.Cmd {
+			if !yes {
+				return nil
+			}
+			return func() tea.Msg { return submitPromptMsg{prompt: continueTaskPrompt} }
+		})
 
 	case streamMaxTokensReachedMsg:
 		// Max tokens reached, mark session as inactive and show warning
@@ -1106,12 +1679,13 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		helpText := fmt.Sprintf("Active command leader: %s\n", leader)
 		helpText += "Available commands:\n"
 		for _, cmd := range m.commandRegistry.GetAllCommands() {
-			displayName := cmd.Name
-			if leader == ":" && strings.HasPrefix(displayName, "/") {
-				displayName = ":" + strings.TrimPrefix(displayName, "/")
-			}
-			helpText += fmt.Sprintf("  %s - %s\n", displayName, cmd.Description)
+			helpText += fmt.Sprintf("  %s - %s\n", withLeader(cmd.Name, leader), cmd.Description)
 		}
+		helpText += "File references:\n"
+		helpText += "  @path - a path from the project root, wherever asimi runs\n"
+		helpText += "  @./path, @../path - a path from the working directory\n"
+		helpText += "  @/path - an absolute path\n"
+		helpText += "  Tools resolve the relative paths the model passes the same way\n"
 		m.chat.AddMessage(helpText)
 		m.sessionActive = true
 
@@ -1121,6 +1695,11 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.sessionActive = true
 
 	case waitingTickMsg:
+		if m.waitingForResponse && !m.responseStarted {
+			if notice := m.nonStreamingNotice(); notice > 0 && time.Since(m.waitingStart) >= notice {
+				m.status.SetNonStreaming(true)
+			}
+		}
 		if m.waitingForResponse {
 			return m, tea.Tick(time.Second, func(time.Time) tea.Msg { return waitingTickMsg{} })
 		}
@@ -1147,7 +1726,7 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Show code input modal
 			m.codeInputModal = NewCodeInputModal(authURL, verifier)
 			m.config.LLM.Provider = provider
-			m.config.LLM.Model = "claude-3-5-sonnet-latest"
+			m.config.LLM.Model = defaultModelFor(provider)
 			m.toastManager.AddToast("Logged in", "success", 3000)
 		} else {
 			// Other providers use the standard OAuth flow
@@ -1156,6 +1735,7 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	case showOauthFailed:
 		m.addToRawHistory("OAUTH_ERROR", msg.err)
+		m.errorLog.Add("login", msg.err, "")
 		errToast := fmt.Sprintf("OAuth failed: %s", msg.err)
 		m.toastManager.AddToast(errToast, "error", 4000)
 		m.chat.AddMessage(errToast)
@@ -1175,7 +1755,7 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case showModelSelectionMsg:
 		m.modelSelectionModal = NewModelSelectionModal(m.config.LLM.Model)
 		// Fetch models in background
-		return m, m.fetchModelsCommand()
+		return m, m.fetchModelsCommand(false)
 
 	case modelSelectedMsg:
 		m.modelSelectionModal = nil
@@ -1204,12 +1784,17 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 
 	case modelsLoadedMsg:
-		if m.modelSelectionModal != nil {
+		if msg.toChat {
+			m.chat.AddMessage(renderModelList(msg.models, m.config.LLM.Model))
+			m.sessionActive = true
+		} else if m.modelSelectionModal != nil {
 			m.modelSelectionModal.SetModels(msg.models)
 		}
 
 	case modelsLoadErrorMsg:
-		if m.modelSelectionModal != nil {
+		if msg.toChat {
+			m.toastManager.AddToast("Failed to load models: "+msg.error, "error", 4000)
+		} else if m.modelSelectionModal != nil {
 			m.modelSelectionModal.SetError(msg.error)
 		}
 
@@ -1220,29 +1805,169 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case sessionSelectedMsg:
 		m.sessionModal = nil
 		if msg.session != nil {
+			var contextNotes []string
 			if m.session != nil {
-				m.session.Messages = msg.session.Messages
-				m.session.ContextFiles = msg.session.ContextFiles
+				m.session.RestoreFrom(msg.session)
+				if m.config != nil && m.config.LLM.RefreshContextOnResume {
+					contextNotes = m.session.RefreshContextFiles()
+				}
+			}
+			m.chat = m.newChat()
+			m.toolCallMessageIndex = make(map[string]int)
+			m.rawSessionHistory = resumedRawHistory(msg.session)
+			m.addToRawHistory("RESUMED", fmt.Sprintf("Session %s from %s", msg.session.ID, msg.session.LastUpdated.Format("2006-01-02 15:04:05")))
+			// Earlier entries point into the replaced conversation
+			for i := range m.promptHistory {
+				m.promptHistory[i].SessionSnapshot = 0
+				m.promptHistory[i].ChatSnapshot = 0
 			}
-			m.chat = NewChatComponent(m.chat.Width, m.chat.Height)
-			for _, msgContent := range msg.session.Messages {
-				if msgContent.Role == "user" || msgContent.Role == "assistant" {
+			prompts := make(map[int]string, len(msg.session.Prompts))
+			for _, p := range msg.session.Prompts {
+				prompts[p.Index] = p.Text
+			}
+			for i, msgContent := range msg.session.Messages {
+				if msgContent.Role == llms.ChatMessageTypeHuman || msgContent.Role == llms.ChatMessageTypeAI {
 					for _, part := range msgContent.Parts {
 						if textPart, ok := part.(llms.TextContent); ok {
 							prefix := "You: "
-							if msgContent.Role == "assistant" {
+							if msgContent.Role == llms.ChatMessageTypeAI {
 								prefix = "AI: "
+							} else if prompt, ok := prompts[i]; ok {
+								// Resumed turns can be rolled back like new ones
+								delete(prompts, i)
+								m.promptHistory = append(m.promptHistory, promptHistoryEntry{
+									Prompt:          prompt,
+									SessionSnapshot: i,
+									ChatSnapshot:    len(m.chat.Messages),
+								})
 							}
 							m.chat.AddMessage(prefix + textPart.Text)
 						}
 					}
 				}
 			}
+			m.historyCursor = len(m.promptHistory)
+			if len(contextNotes) > 0 {
+				m.chat.AddMessage("📎 Context files re-read from disk:\n- " + strings.Join(contextNotes, "\n- "))
+			}
 			m.sessionActive = true
 			timeStr := formatRelativeTime(msg.session.LastUpdated)
 			m.toastManager.AddToast(fmt.Sprintf("Resumed session from %s", timeStr), "success", 3000)
 		}
 
+	case recentSessionMsg:
+		if !m.sessionActive {
+			store, id := m.sessionStore, msg.session.ID
+			m.askConfirm(fmt.Sprintf("Resume last session from %s?", formatRelativeTime(msg.session.LastUpdated)), func(yes bool) tea.Cmd {
+				if !yes {
+					return nil
+				}
+				return resumeSession(store, id)
+			})
+		}
+
+	case submitPromptMsg:
+		return m.submitQueuedPrompt(msg.prompt)
+
+	case writeReviewMsg:
+		m.showWriteReview(msg)
+
+	case showLoginMsg:
+		handleLoginCommand(&m, nil)
+
+	case contextCommandMsg:
+		if msg.err != nil {
+			m.toastManager.AddToast(msg.err.Error(), "error", 4000)
+			break
+		}
+		if m.session == nil {
+			m.toastManager.AddToast("No active session", "error", 3000)
+			break
+		}
+		path := commandContextPath(msg.command)
+		// Long output is cut to tool_output_limit like the agent's own commands
+		output := spillToolOutput(strings.TrimSuffix(path, ".txt"), "context", strings.TrimRight(msg.output, "\n"), m.session.toolOutputLimit())
+		m.session.AddContextFile(path, fmt.Sprintf("$ %s\n%s\n(%s)", msg.command, output, msg.status))
+		m.chat.AddMessage(fmt.Sprintf("📎 Output of `%s` (%s) is in the context of the next prompt as %s", msg.command, msg.status, path))
+		m.sessionActive = true
+
+	case issueLoadedMsg:
+		if msg.err != nil {
+			m.chat.AddMessage(fmt.Sprintf("Could not load issue #%d: %v", msg.number, msg.err))
+			m.toastManager.AddToast(fmt.Sprintf("Could not load issue #%d", msg.number), "error", 4000)
+			break
+		}
+		if m.session == nil {
+			m.toastManager.AddToast("No active session", "error", 3000)
+			break
+		}
+		m.session.AddContextFile(issueContextPath(msg.number), msg.content)
+		m.chat.AddMessage(fmt.Sprintf("📎 Issue #%d %s is in the context of the next prompt", msg.number, msg.issue.Title))
+		if msg.prompt != "" {
+			return m.submitQueuedPrompt(msg.prompt)
+		}
+
+	case externalEditMsg:
+		m.showExternalEdit(msg)
+
+	case writeReviewRetryMsg:
+		m.toastManager.AddToast(msg.err.Error(), "error", 4000)
+		m.showWriteReview(msg.review)
+
+	case modelCompareMsg:
+		m.stopWaitingForResponse()
+		m.chat.AddMessage(formatModelCompare(msg.prompt, msg.results, m.chat.Width-4, m.chat.Plain))
+		m.sessionActive = true
+
+	case summaryReadyMsg:
+		m.stopWaitingForResponse()
+		if msg.err != nil {
+			m.toastManager.AddToast(fmt.Sprintf("Failed to summarize session: %v", msg.err), "error", 4000)
+			break
+		}
+		m.chat.AddMessage("📝 Session summary:\n\n" + msg.note)
+		note := msg.note
+		m.askConfirm("Append this summary to AGENTS.md?", func(yes bool) tea.Cmd {
+			if !yes {
+				return nil
+			}
+			return func() tea.Msg {
+				if err := appendSessionNote(note, time.Now()); err != nil {
+					return errMsg{fmt.Errorf("failed to update AGENTS.md: %w", err)}
+				}
+				return showContextMsg{content: "Summary appended to AGENTS.md"}
+			}
+		})
+
+	case agentsGeneratedMsg:
+		m.stopWaitingForResponse()
+		if msg.err != nil {
+			m.toastManager.AddToast(fmt.Sprintf("Failed to generate AGENTS.md: %v", msg.err), "error", 4000)
+			break
+		}
+		existing := readProjectContext()
+		content := withSessionNotes(existing, msg.content)
+		diff := renderLineDiff(existing, content)
+		if existing == content || diff == "" {
+			m.toastManager.AddToast("AGENTS.md is already up to date", "info", 3000)
+			break
+		}
+		m.chat.AddMessage(fmt.Sprintf("📝 Proposed AGENTS.md:\n```diff\n%s\n```", diff))
+		session := m.session
+		m.askConfirm("Write this AGENTS.md?", func(yes bool) tea.Cmd {
+			if !yes {
+				return nil
+			}
+			if err := writeAgentsFile(content); err != nil {
+				return func() tea.Msg { return errMsg{fmt.Errorf("failed to write AGENTS.md: %w", err)} }
+			}
+			// Later prompts see the new file rather than the one loaded at startup
+			if session != nil {
+				session.AddContextFile("AGENTS.md", content)
+			}
+			return func() tea.Msg { return showContextMsg{content: "AGENTS.md written"} }
+		})
+
 	case sessionResumeErrorMsg:
 		m.sessionModal = nil
 		m.toastManager.AddToast(fmt.Sprintf("Failed to resume session: %v", msg.err), "error", 4000)
@@ -1250,11 +1975,18 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case llmInitSuccessMsg:
 		// LLM initialization completed successfully
 		m.SetSession(msg.session)
+		m.llmInitErr = nil
+		m.status.SetAIDisabled(false)
 		slog.Info("LLM session initialized successfully")
+		if msg.session != nil && msg.session.Model != "" && !isValidModelFor(msg.session.Provider, msg.session.Model, msg.session.config.BaseURL) {
+			m.toastManager.AddToast(fmt.Sprintf("Model %s does not look like a %s model", msg.session.Model, msg.session.Provider), "warning", 5000)
+		}
 
 	case llmInitErrorMsg:
 		// LLM initialization failed
 		slog.Warn("LLM initialization failed", "error", msg.err)
+		m.llmInitErr = msg.err
+		m.status.SetAIDisabled(true)
 		m.toastManager.AddToast(fmt.Sprintf("Warning: Running without AI capabilities: %v", msg.err), "warning", 5000)
 
 	case markdownRendererReadyMsg:
@@ -1269,14 +2001,12 @@ func (m TUIModel) handleCustomMessages(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, chatCmd
 }
 
-func (m *TUIModel) updateFileCompletions(files []string) {
-	inputValue := m.prompt.Value()
-
+// fileCompletionQuery returns the file reference being typed after the last @
+func fileCompletionQuery(inputValue string) (string, bool) {
 	// Find the last @ character to determine what we're completing
 	lastAt := strings.LastIndex(inputValue, "@")
 	if lastAt == -1 {
-		m.completions.SetOptions([]string{})
-		return
+		return "", false
 	}
 
 	// Extract the text after the last @ for completion
@@ -1286,6 +2016,50 @@ func (m *TUIModel) updateFileCompletions(files []string) {
 	if spaceIndex := strings.Index(searchQuery, " "); spaceIndex != -1 {
 		searchQuery = searchQuery[spaceIndex+1:]
 	}
+	return searchQuery, true
+}
+
+// fileCompletionCandidates lists what a file reference can complete to,
+// following the rules of resolveFileRef: project files by their path from
+// the root, files under the working directory for @./, and the entries of
+// the directory typed so far for @../ and @/abs
+func fileCompletionCandidates(query string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(query, "./"):
+		files, err := getFileTree(".")
+		for i := range files {
+			files[i] = "./" + files[i]
+		}
+		return files, err
+	case filepath.IsAbs(query) || strings.HasPrefix(query, "../"):
+		dir := query[:strings.LastIndex(query, "/")+1]
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		files := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			name := dir + entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			files = append(files, name)
+		}
+		return files, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	return getFileTree(findProjectRoot(wd))
+}
+
+func (m *TUIModel) updateFileCompletions(files []string) {
+	searchQuery, ok := fileCompletionQuery(m.prompt.Value())
+	if !ok {
+		m.completions.SetOptions([]string{})
+		return
+	}
 
 	var filteredFiles []string
 	for _, file := range files {
@@ -1317,6 +2091,17 @@ func (m *TUIModel) updateFileCompletions(files []string) {
 		options = append(options, file)
 	}
 	m.completions.SetOptions(options)
+	m.refreshCompletionPreview()
+}
+
+// refreshCompletionPreview previews the highlighted file completion
+func (m *TUIModel) refreshCompletionPreview() {
+	m.completions.Preview = ""
+	if m.completionMode == "file" {
+		if selected := m.completions.GetSelected(); selected != "" {
+			m.completions.Preview = filePreview(resolveFileRef(selected))
+		}
+	}
 }
 
 // updateCommandCompletions filters commands based on current input
@@ -1327,9 +2112,9 @@ func (m *TUIModel) updateCommandCompletions() {
 	var prefix string
 	var searchQuery string
 
-	if strings.HasPrefix(inputValue, "/") {
-		prefix = "/"
-		searchQuery = strings.ToLower(inputValue[1:])
+	if leader := m.commandLeader(); strings.HasPrefix(inputValue, leader) {
+		prefix = leader
+		searchQuery = strings.ToLower(strings.TrimPrefix(inputValue, leader))
 	} else if strings.HasPrefix(inputValue, ":") {
 		prefix = ":"
 		searchQuery = strings.ToLower(inputValue[1:])
@@ -1338,6 +2123,10 @@ func (m *TUIModel) updateCommandCompletions() {
 		m.completions.SetOptions([]string{})
 		return
 	}
+	if name, args, found := strings.Cut(inputValue[len(prefix):], " "); found {
+		m.completions.SetOptions(m.commandArgCompletions(prefix+name, args))
+		return
+	}
 
 	// Get all command names and filter them
 	var filteredCommands []string
@@ -1348,17 +2137,37 @@ func (m *TUIModel) updateCommandCompletions() {
 		// Check if the command starts with the search query
 		if strings.HasPrefix(strings.ToLower(cmdName), searchQuery) {
 			// Format the command with the appropriate prefix for display
-			if prefix == ":" {
-				filteredCommands = append(filteredCommands, ":"+cmdName)
-			} else {
-				filteredCommands = append(filteredCommands, name)
-			}
+			filteredCommands = append(filteredCommands, prefix+cmdName)
 		}
 	}
 
 	m.completions.SetOptions(filteredCommands)
 }
 
+// commandArgCompletions offers the values for the argument being typed after
+// a command, each as the full command line
+func (m *TUIModel) commandArgCompletions(command, args string) []string {
+	name, _ := m.commandName(command)
+	cmd, ok := m.commandRegistry.GetCommand(strings.ToLower(name))
+	if !ok || cmd.Complete == nil {
+		return nil
+	}
+	typed := strings.Fields(args)
+	if len(typed) == 0 || strings.HasSuffix(args, " ") {
+		typed = append(typed, "")
+	}
+	partial := strings.ToLower(typed[len(typed)-1])
+	line := strings.Join(append([]string{command}, typed[:len(typed)-1]...), " ") + " "
+
+	var options []string
+	for _, value := range cmd.Complete(m, typed) {
+		if strings.HasPrefix(strings.ToLower(value), partial) {
+			options = append(options, line+value)
+		}
+	}
+	return options
+}
+
 // updateComponentDimensions updates the dimensions of all components based on the window size
 func (m *TUIModel) updateComponentDimensions() {
 	// Calculate dimensions for a typical layout:
@@ -1368,8 +2177,16 @@ func (m *TUIModel) updateComponentDimensions() {
 
 	statusHeight := 1
 	promptHeight := 2
-	width := m.width - 2
-	chatHeight := m.height - statusHeight - promptHeight - 4
+	// The prompt border and the vi mode and toast line
+	chrome := 4
+	promptWidth := m.width - 2
+	if m.chat.Compact {
+		chrome = 1
+		promptWidth = m.width
+	}
+	// Below the minimum size View shows a notice, but keep the sizes sane
+	width := max(m.width-2, 1)
+	chatHeight := max(m.height-statusHeight-promptHeight-chrome, 1)
 
 	// Update components
 	m.status.SetWidth(width + 2)
@@ -1378,7 +2195,7 @@ func (m *TUIModel) updateComponentDimensions() {
 	m.chat.SetWidth(width)
 	m.chat.SetHeight(chatHeight)
 
-	m.prompt.SetWidth(width)
+	m.prompt.SetWidth(max(promptWidth, 1))
 	m.prompt.SetHeight(promptHeight)
 
 	// Update status info
@@ -1389,11 +2206,38 @@ func (m *TUIModel) updateComponentDimensions() {
 	}
 }
 
+// setCompact switches between the compact and the regular layout
+func (m *TUIModel) setCompact(compact bool) {
+	m.chat.Compact = compact
+	m.status.Compact = compact
+	m.prompt.SetCompact(compact)
+	m.chat.UpdateContent()
+	if m.width > 0 {
+		m.updateComponentDimensions()
+	}
+}
+
+// minTerminalSize returns the smallest terminal the layout is drawn in
+func (m TUIModel) minTerminalSize() (width, height int) {
+	width, height = 40, 10
+	if m.config != nil && m.config.UI.MinWidth > 0 {
+		width = m.config.UI.MinWidth
+	}
+	if m.config != nil && m.config.UI.MinHeight > 0 {
+		height = m.config.UI.MinHeight
+	}
+	return width, height
+}
+
 // View implements bubbletea.Model
 func (m TUIModel) View() string {
 	if m.width == 0 || m.height == 0 {
 		return "Initializing..."
 	}
+	if minWidth, minHeight := m.minTerminalSize(); !m.chat.Plain && (m.width < minWidth || m.height < minHeight) {
+		return lipgloss.NewStyle().Width(m.width).Render(fmt.Sprintf(
+			"Terminal too small (%dx%d, need %dx%d). Enlarge the window to continue.", m.width, m.height, minWidth, minHeight))
+	}
 
 	viEnabled, viMode, viPending := m.prompt.ViModeStatus()
 	m.status.SetViMode(viEnabled, viMode, viPending)
@@ -1413,8 +2257,17 @@ func (m TUIModel) View() string {
 
 func (m TUIModel) renderMainContent() string {
 	contentHeight := m.height - 6 // Account for prompt and status
+	if m.chat.Compact {
+		contentHeight = m.height - 4
+	}
 
 	switch {
+	case m.chat.Plain:
+		// Finished messages are in the scrollback; show only the live ones
+		if m.printedMessages >= len(m.chat.Messages) {
+			return ""
+		}
+		return m.chat.plainContent(m.chat.Messages[m.printedMessages:])
 	case m.rawMode:
 		return m.renderRawSessionView(m.width, contentHeight)
 	case !m.sessionActive:
@@ -1440,16 +2293,8 @@ func (m TUIModel) overlayCompletionDialog(baseView, promptView, viModeToastLine
 		return baseView
 	}
 
-	promptHeight := lipgloss.Height(promptView)
-	viModeToastHeight := 0
-	if viModeToastLine != "" {
-		viModeToastHeight = 1
-	}
-	statusHeight := 1
-	bottomOffset := promptHeight + viModeToastHeight + statusHeight
-
 	dialogHeight := lipgloss.Height(dialog)
-	yPos := m.height - bottomOffset - dialogHeight
+	yPos := m.completionDialogTop(dialogHeight, promptView, viModeToastLine)
 
 	dialogOverlay := lipgloss.Place(m.width, m.height, lipgloss.Left, lipgloss.Top, baseView)
 	dialogPositioned := lipgloss.Place(m.width, dialogHeight, lipgloss.Left, lipgloss.Top, dialog)
@@ -1468,6 +2313,19 @@ func (m TUIModel) overlayCompletionDialog(baseView, promptView, viModeToastLine
 	return strings.Join(lines, "\n")
 }
 
+// completionDialogTop returns the screen row of the top of the completion
+// dialog, which sits right above the prompt
+func (m TUIModel) completionDialogTop(dialogHeight int, promptView, viModeToastLine string) int {
+	promptHeight := lipgloss.Height(promptView)
+	viModeToastHeight := 0
+	if viModeToastLine != "" {
+		viModeToastHeight = 1
+	}
+	statusHeight := 1
+	bottomOffset := promptHeight + viModeToastHeight + statusHeight
+	return m.height - bottomOffset - dialogHeight
+}
+
 func (m TUIModel) applyModalOverlays(view string) string {
 	result := view
 
@@ -1548,6 +2406,9 @@ func (m TUIModel) renderHomeView(width, height int) string {
 		Width(width)
 
 	subtitle := subtitleStyle.Render("Your AI-powered coding assistant")
+	if m.llmInitErr != nil {
+		subtitle = subtitleStyle.Foreground(lipgloss.Color("#F4DB53")).Render(fmt.Sprintf("AI is disabled: %v", m.llmInitErr))
+	}
 
 	// Create a list of helpful commands based on vi mode
 	var commands []string
@@ -1573,6 +2434,18 @@ func (m TUIModel) renderHomeView(width, height int) string {
 		}
 	}
 
+	if m.llmInitErr != nil {
+		leader := m.commandLeader()
+		commands = []string{
+			fmt.Sprintf("▶ Press %s or use %s to set up a provider", loginKey, withLeader("/login", leader)),
+			fmt.Sprintf("▶ %s shows the uncommitted changes", withLeader("/diff", leader)),
+			fmt.Sprintf("▶ %s <command> runs a shell command", withLeader("/shell", leader)),
+			"▶ Use @ to browse files (e.g., @main.go)",
+			fmt.Sprintf("▶ %s lists the other commands", withLeader("/help", leader)),
+			"▶ Press Ctrl+C to quit",
+		}
+	}
+
 	// Style for commands
 	commandStyle := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#F4DB53")). // Terminal7 warning/chat border
@@ -1681,5 +2554,12 @@ func (m TUIModel) renderRawSessionView(width, height int) string {
 func (m *TUIModel) stopStreaming() {
 	m.streamingActive = false
 	m.streamingCancel = nil
+	m.status.SetPhase(phaseIdle)
 	m.stopWaitingForResponse()
+	// The cancelled tool call no longer waits for the answer
+	if m.writeReview != nil || m.externalEdit != nil {
+		m.writeReview = nil
+		m.externalEdit = nil
+		m.toastManager.Clear()
+	}
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -592,3 +593,35 @@ func TestHistoryNavigation_RapidNavigation(t *testing.T) {
 	require.Equal(t, "current", model.prompt.Value())
 	require.False(t, model.historySaved)
 }
+
+// TestStreamErrorMsg_RetryLastPrompt tests that ctrl+r resends the prompt that failed
+func TestStreamErrorMsg_RetryLastPrompt(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.chat.Messages = []string{}
+	model.chat.UpdateContent()
+
+	model.promptHistory = append(model.promptHistory, promptHistoryEntry{
+		Prompt:          "first",
+		SessionSnapshot: model.session.GetMessageSnapshot(),
+		ChatSnapshot:    0,
+	})
+	model.historyCursor = len(model.promptHistory)
+	model.chat.AddMessage("You: first")
+	model.chat.AddMessage("Asimi: partial answ")
+
+	newModel, _ := model.handleCustomMessages(streamErrorMsg{err: errors.New("connection reset")})
+	updatedModel, ok := newModel.(TUIModel)
+	require.True(t, ok)
+	require.True(t, updatedModel.retryAfterError)
+
+	newModel, _ = updatedModel.Update(tea.KeyMsg{Type: tea.KeyCtrlR})
+	updatedModel, ok = newModel.(TUIModel)
+	require.True(t, ok)
+	updatedModel.cancelStreaming()
+
+	require.False(t, updatedModel.retryAfterError)
+	require.Nil(t, updatedModel.historySearch, "ctrl+r should retry rather than search")
+	require.Equal(t, "You: first", updatedModel.chat.Messages[0])
+	require.NotContains(t, strings.Join(updatedModel.chat.Messages, "\n"), "partial answ")
+	require.Len(t, updatedModel.promptHistory, 1)
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
 	gogit "github.com/go-git/go-git/v5"
 	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/fake"
 )
 
@@ -87,6 +94,92 @@ func TestCommandCompletionOrderDefaultsToHelp(t *testing.T) {
 	require.Equal(t, "/help", model.completions.Options[0])
 }
 
+func TestCommandArgumentCompletion(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.prompt.SetViMode(false)
+	model.config.Profiles = map[string]map[string]any{"work": {}, "home": {}, "fast": {}}
+	model.session.ContextFiles = map[string]string{"main.go": "", "README.md": ""}
+	complete := func(value string) []string {
+		model.prompt.SetValue(value)
+		model.showCompletionDialog = true
+		model.completionMode = "command"
+		model.completions.Show()
+		model.updateCommandCompletions()
+		return model.completions.Options
+	}
+
+	require.Equal(t, []string{"/profile fast", "/profile home", "/profile work"}, complete("/profile "))
+	require.Equal(t, []string{"/profile work"}, complete("/profile W"))
+	require.Equal(t, []string{"/stream on", "/stream off"}, complete("/stream "))
+	require.Equal(t, []string{"/window drop main.go"}, complete("/window drop m"))
+	require.Empty(t, complete("/stream on "))
+	require.Empty(t, complete("/note "))
+
+	// Tab fills the prompt and offers the next argument
+	complete("/window d")
+	updated, _ := model.handleCompletionDialog(tea.KeyMsg{Type: tea.KeyTab})
+	m := updated.(TUIModel)
+	require.Equal(t, "/window drop ", m.prompt.Value())
+	require.Equal(t, []string{"/window drop README.md", "/window drop main.go"}, m.completions.Options)
+
+	// Enter runs the command with the selected argument
+	m.completions.SelectNext()
+	updated, _ = m.handleCompletionDialog(tea.KeyMsg{Type: tea.KeyEnter})
+	m = updated.(TUIModel)
+	require.False(t, m.showCompletionDialog)
+	require.NotContains(t, m.session.ContextFiles, "main.go")
+	require.Contains(t, m.session.ContextFiles, "README.md")
+}
+
+func TestCustomCommandLeader(t *testing.T) {
+	require.True(t, validCommandLeader("!"))
+	require.False(t, validCommandLeader("x"))
+	require.False(t, validCommandLeader("!!"))
+	require.False(t, validCommandLeader(" "))
+
+	config := mockConfig()
+	config.UI.CommandLeader = "!"
+	model := NewTUIModel(config)
+	model.prompt.SetViMode(false)
+
+	updated, _ := model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'!'}})
+	model2 := updated.(TUIModel)
+	require.True(t, model2.showCompletionDialog)
+	require.Equal(t, "!help", model2.completions.Options[0])
+
+	name, isCommand := model2.commandName("!help")
+	require.True(t, isCommand)
+	require.Equal(t, "/help", name)
+	_, isCommand = model2.commandName("/usr/bin is on my PATH")
+	require.False(t, isCommand)
+}
+
+func TestSubmitKeyAndPlaceholder(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.config.UI.Submit = "alt+enter"
+	model.prompt.SetViMode(false)
+	model.prompt.SetPlaceholder("Ask away")
+	require.Equal(t, "Ask away", model.prompt.TextArea.Placeholder)
+
+	model.prompt.SetValue("first line")
+	updated, _ := model.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEnter})
+	m := updated.(TUIModel)
+	require.Equal(t, "first line\n", m.prompt.Value())
+	require.False(t, m.sessionActive)
+
+	m.prompt.TextArea.InsertString("second line")
+	updated, _ = m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEnter, Alt: true})
+	m = updated.(TUIModel)
+	require.Empty(t, m.prompt.Value())
+	require.Contains(t, m.chat.Messages, "You: first line\nsecond line")
+
+	// Commands still run on enter
+	m.prompt.SetValue("/help")
+	updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyEnter})
+	require.NotNil(t, cmd)
+	require.Empty(t, updated.(TUIModel).prompt.Value())
+}
+
 // TestTUIModelKeyMsg tests quitting the application with 'q' and Ctrl+C
 func TestTUIModelKeyMsg(t *testing.T) {
 	testCases := []struct {
@@ -184,6 +277,185 @@ func TestTUIModelSubmit(t *testing.T) {
 	}
 }
 
+func TestTUIModelQueuesPromptsWhileStreaming(t *testing.T) {
+	model := NewTUIModel(mockConfig())
+	model.historyStore = nil
+	model.streamingActive = true
+
+	model.prompt.SetValue("first follow-up")
+	updated, _ := model.handleEnterKey()
+	model2 := updated.(TUIModel)
+	model2.prompt.SetValue("second follow-up")
+	updated, _ = model2.handleEnterKey()
+	model2 = updated.(TUIModel)
+	require.Equal(t, []string{"first follow-up", "second follow-up"}, model2.promptQueue)
+	require.Empty(t, model2.prompt.Value())
+
+	// Completing the stream submits the next queued prompt and keeps the draft
+	model2.prompt.SetValue("draft")
+	updated, _ = model2.handleCustomMessages(streamCompleteMsg{})
+	model2 = updated.(TUIModel)
+	require.Equal(t, []string{"second follow-up"}, model2.promptQueue)
+	require.Contains(t, model2.chat.Messages[len(model2.chat.Messages)-1], "first follow-up")
+	require.Equal(t, "draft", model2.prompt.Value())
+
+	// So do a failed and an interrupted stream
+	model2.promptQueue = append(model2.promptQueue, "third follow-up")
+	updated, _ = model2.handleCustomMessages(streamErrorMsg{err: errors.New("boom")})
+	model2 = updated.(TUIModel)
+	require.Equal(t, []string{"third follow-up"}, model2.promptQueue)
+	require.Contains(t, model2.chat.Messages[len(model2.chat.Messages)-1], "second follow-up")
+	updated, _ = model2.handleCustomMessages(streamInterruptedMsg{})
+	model2 = updated.(TUIModel)
+	require.Empty(t, model2.promptQueue)
+	require.Contains(t, model2.chat.Messages[len(model2.chat.Messages)-1], "third follow-up")
+
+	model2.promptQueue = []string{"fourth follow-up"}
+	handleQueueCommand(&model2, []string{"clear"})
+	require.Empty(t, model2.promptQueue)
+}
+
+func TestReplayCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	calls := make(chan string, 2)
+	tool := &mockTool{
+		name: "read_file",
+		callFunc: func(ctx context.Context, input string) (string, error) {
+			calls <- input
+			return "contents", nil
+		},
+	}
+	scheduled := make(chan ToolCallScheduledMsg, 1)
+	model.session.scheduler = NewCoreToolScheduler(func(msg any) {
+		if m, ok := msg.(ToolCallScheduledMsg); ok {
+			scheduled <- m
+		}
+	})
+
+	call := &ToolCall{ID: "call-1", Tool: tool, Input: `{"path":"a.go"}`}
+	updated, _ := model.handleCustomMessages(ToolCallScheduledMsg{Call: call})
+	model2 := updated.(TUIModel)
+	require.True(t, strings.HasPrefix(model2.chat.Messages[len(model2.chat.Messages)-1], "#1 "))
+
+	model2.session.toolCatalog["read_file"] = tool
+
+	require.Nil(t, handleReplayCommand(&model2, []string{"2"}))
+	require.Len(t, calls, 0)
+
+	msg := handleReplayCommand(&model2, []string{"1"})().(showContextMsg)
+	require.Equal(t, `{"path":"a.go"}`, <-calls)
+	replayed := <-scheduled
+	require.NotEqual(t, call.ID, replayed.Call.ID)
+	require.Equal(t, "Replayed #1 read_file:\ncontents", msg.content)
+
+	// Replays go through the session's checks, like read-only mode
+	write := &ToolCall{ID: "call-2", Tool: WriteFileTool{}, Input: `{"path":"a.go","content":"x"}`}
+	updated, _ = model2.handleCustomMessages(ToolCallScheduledMsg{Call: write})
+	model2 = updated.(TUIModel)
+	model2.session.SetReadOnly(true)
+	require.Nil(t, handleReplayCommand(&model2, []string{"2"}))
+	require.Len(t, scheduled, 0)
+}
+
+func TestToolCallLifecycleGlyphs(t *testing.T) {
+	model, _ := newTestModel(t)
+	call := &ToolCall{ID: "call-1", Tool: ReadFileTool{}, Input: `{"path":"a.go"}`}
+	glyphs := model.theme.ToolGlyphs
+
+	steps := []struct {
+		msg   tea.Msg
+		glyph string
+	}{
+		{ToolCallScheduledMsg{Call: call}, glyphs.Scheduled},
+		{ToolCallExecutingMsg{Call: call}, glyphs.Executing},
+		{ToolCallSuccessMsg{Call: call}, glyphs.Success},
+	}
+	count := -1
+	for _, step := range steps {
+		updated, _ := model.handleCustomMessages(step.msg)
+		*model = updated.(TUIModel)
+		if count < 0 {
+			count = len(model.chat.Messages)
+		}
+		// Each status re-renders the same message with its circle
+		require.Len(t, model.chat.Messages, count)
+		require.Contains(t, model.chat.Messages[count-1], step.glyph+" ")
+	}
+}
+
+func TestNonStreamingNotice(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.startWaitingForResponse()
+	model.waitingStart = time.Now().Add(-11 * time.Second)
+	model.status.waitingSince = model.waitingStart
+
+	updated, _ := model.handleCustomMessages(waitingTickMsg{})
+	model2 := updated.(TUIModel)
+	require.Contains(t, model2.status.renderMiddleSection(), "non-streaming model")
+
+	updated, _ = model2.handleCustomMessages(streamChunkMsg("Hello"))
+	model2 = updated.(TUIModel)
+	require.NotContains(t, model2.status.renderMiddleSection(), "non-streaming model")
+
+	model.config.LLM.NonStreamingNotice = -1
+	model.responseStarted = false
+	model.status.SetNonStreaming(false)
+	updated, _ = model.handleCustomMessages(waitingTickMsg{})
+	require.NotContains(t, updated.(TUIModel).status.renderMiddleSection(), "non-streaming model")
+}
+
+func TestPlainModeTranscript(t *testing.T) {
+	config := mockConfig()
+	config.UI.Plain = true
+	model := NewTUIModel(config)
+	require.Equal(t, "[x]", model.toolIcon("success"))
+	require.Equal(t, " 12% main", asciiOnly("🪣 12% main"))
+
+	updated, cmd := model.Update(showContextMsg{content: "**Context** ready"})
+	model2 := updated.(TUIModel)
+	require.NotNil(t, cmd)
+	require.Equal(t, len(model2.chat.Messages), model2.printedMessages)
+	require.Empty(t, model2.renderMainContent())
+
+	// Messages stay live until the stream completes
+	model2.streamingActive = true
+	updated, _ = model2.Update(streamChunkMsg("partial"))
+	model2 = updated.(TUIModel)
+	require.Contains(t, model2.renderMainContent(), "Asimi: partial")
+	updated, _ = model2.Update(streamCompleteMsg{})
+	model2 = updated.(TUIModel)
+	require.Equal(t, len(model2.chat.Messages), model2.printedMessages)
+}
+
+func TestRerunCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	handleRerunCommand(model, nil)
+	require.NotContains(t, model.chat.Messages[len(model.chat.Messages)-1], "Re-running")
+
+	for _, command := range []string{"go vet ./...", "go test ./..."} {
+		model.session.messages = append(model.session.messages, llms.MessageContent{
+			Role: llms.ChatMessageTypeAI,
+			Parts: []llms.ContentPart{llms.ToolCall{
+				ID:           command,
+				FunctionCall: &llms.FunctionCall{Name: "run_in_shell", Arguments: `{"command":"` + command + `"}`},
+			}},
+		})
+	}
+	inputs := make(chan string, 1)
+	model.session.toolCatalog["run_in_shell"] = &mockTool{
+		name: "run_in_shell",
+		callFunc: func(ctx context.Context, input string) (string, error) {
+			inputs <- input
+			return `{"output":"ok","exitCode":"0"}`, nil
+		},
+	}
+	model.session.scheduler = NewCoreToolScheduler(nil)
+
+	handleRerunCommand(model, nil)
+	require.Equal(t, "Re-running: go test ./...", model.chat.Messages[len(model.chat.Messages)-1])
+	require.Equal(t, `{"command":"go test ./..."}`, <-inputs)
+}
+
 func TestTUIModelKeyboardInteraction(t *testing.T) {
 	testCases := []struct {
 		name   string
@@ -339,6 +611,147 @@ func TestChatComponent(t *testing.T) {
 	require.Equal(t, 15, chat.Height)
 }
 
+func TestChatComponentScrollLock(t *testing.T) {
+	chat := NewChatComponent(60, 5)
+	chat.ScrollLock = true
+	for i := 0; i < 20; i++ {
+		chat.AddMessage(fmt.Sprintf("line %d", i))
+	}
+	require.True(t, chat.Viewport.AtBottom())
+
+	// Scrolling up holds the view while messages stream in
+	chat, _ = chat.Update(tea.MouseMsg{Type: tea.MouseWheelUp, Button: tea.MouseButtonWheelUp})
+	chat, _ = chat.Update(tea.MouseMsg{Type: tea.MouseWheelUp, Button: tea.MouseButtonWheelUp})
+	offset := chat.Viewport.YOffset
+	require.NotContains(t, chat.View(), newMessagesHint)
+	chat.AddMessage("AI: streaming")
+	chat.ReplaceLastMessage("AI: streaming more")
+	require.Equal(t, offset, chat.Viewport.YOffset)
+	require.Contains(t, chat.View(), newMessagesHint)
+
+	// Clicking the hint jumps back and resumes auto-scrolling
+	chat, _ = chat.Update(tea.MouseMsg{X: 1, Y: 4, Type: tea.MouseLeft, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress})
+	require.True(t, chat.Viewport.AtBottom())
+	require.NotContains(t, chat.View(), newMessagesHint)
+	chat.AddMessage("AI: done")
+	require.True(t, chat.Viewport.AtBottom())
+
+	// The user's own message always scrolls to the bottom
+	chat, _ = chat.Update(tea.MouseMsg{Type: tea.MouseWheelUp, Button: tea.MouseButtonWheelUp})
+	chat.AddMessage("You: next question")
+	require.True(t, chat.Viewport.AtBottom())
+
+	// Without the lock new messages scroll to the bottom
+	chat.ScrollLock = false
+	chat, _ = chat.Update(tea.MouseMsg{Type: tea.MouseWheelUp, Button: tea.MouseButtonWheelUp})
+	chat.AddMessage("AI: answer")
+	require.True(t, chat.Viewport.AtBottom())
+}
+
+func TestChatScrollKeys(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.prompt.SetViMode(false)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 80, Height: 30})
+	m := updated.(TUIModel)
+	for i := 0; i < 100; i++ {
+		m.chat.AddMessage(fmt.Sprintf("line %d", i))
+	}
+	press := func(key tea.KeyType) {
+		updated, _ := m.handleKeyMsg(tea.KeyMsg{Type: key})
+		m = updated.(TUIModel)
+	}
+	bottom := m.chat.Viewport.YOffset
+
+	press(tea.KeyPgUp)
+	require.Less(t, m.chat.Viewport.YOffset, bottom)
+	require.True(t, m.chat.UserScrolled)
+	press(tea.KeyPgDown)
+	require.Equal(t, bottom, m.chat.Viewport.YOffset)
+	require.False(t, m.chat.UserScrolled)
+
+	press(tea.KeyHome)
+	require.Equal(t, 0, m.chat.Viewport.YOffset)
+	press(tea.KeyEnd)
+	require.Equal(t, bottom, m.chat.Viewport.YOffset)
+
+	// While typing, Home and End stay with the prompt
+	m.prompt.SetValue("draft")
+	press(tea.KeyHome)
+	require.Equal(t, bottom, m.chat.Viewport.YOffset)
+
+	// ctrl+end moves to the end of the prompt while ctrl+n jumps to the newest messages
+	press(tea.KeyPgUp)
+	press(tea.KeyCtrlEnd)
+	require.Less(t, m.chat.Viewport.YOffset, bottom)
+	m.prompt.TextArea.InsertString("!")
+	require.Equal(t, "draft!", m.prompt.Value())
+	press(tea.KeyCtrlN)
+	require.Equal(t, bottom, m.chat.Viewport.YOffset)
+}
+
+func TestChatComponentToolResultExpansion(t *testing.T) {
+	chat := NewChatComponent(80, 20)
+	chat.AddMessage("✅ Read File(main.go)\n  ⎿  Read 3 lines")
+	chat.SetToolResult(1, "package main\n\nfunc main() {}")
+
+	require.Contains(t, chat.Viewport.View(), "3 lines hidden")
+	require.NotContains(t, chat.Viewport.View(), "func main() {}")
+
+	require.True(t, chat.ToggleToolExpansion())
+	require.Contains(t, chat.Viewport.View(), "func main() {}")
+
+	require.True(t, chat.ToggleToolExpansion())
+	require.NotContains(t, chat.Viewport.View(), "func main() {}")
+
+	chat.TruncateTo(1)
+	require.False(t, chat.ToggleToolExpansion())
+}
+
+func TestChatComponentWrapsLongLines(t *testing.T) {
+	chat := NewChatComponent(30, 10)
+	chat.AddMessage("see https://example.com/" + strings.Repeat("a", 80))
+	require.Greater(t, chat.Viewport.TotalLineCount(), 5)
+
+	for _, line := range strings.Split(chat.Viewport.View(), "\n") {
+		require.LessOrEqual(t, lipgloss.Width(line), 30)
+	}
+}
+
+func TestChatComponentHideReasoning(t *testing.T) {
+	chat := NewChatComponent(80, 20)
+	chat.AddMessage("Asimi: <thinking>\nweighing options\n</thinking>\n\nUse a map.")
+	require.Contains(t, chat.Viewport.View(), "weighing options")
+
+	chat.HideReasoning = true
+	chat.UpdateContent()
+	require.NotContains(t, chat.Viewport.View(), "weighing options")
+	require.Contains(t, chat.Viewport.View(), "Use a map.")
+	require.Contains(t, chat.Messages[len(chat.Messages)-1], "weighing options")
+
+	chat.HideReasoning = false
+	chat.UpdateContent()
+	require.Contains(t, chat.Viewport.View(), "weighing options")
+}
+
+func TestChatComponentTimestampsAndSeparators(t *testing.T) {
+	chat := NewChatComponent(40, 20)
+	chat.AddMessage("You: first question")
+	chat.AddMessage("Asimi: answer")
+	chat.AddMessage("You: second question")
+	require.Len(t, chat.timestamps, len(chat.Messages))
+
+	view := chat.Viewport.View()
+	require.Equal(t, 2, strings.Count(view, strings.Repeat("─", 40)))
+	require.NotContains(t, view, chat.timestamps[1].Format("15:04:05"))
+
+	chat.ShowTimestamps = true
+	chat.UpdateContent()
+	require.Contains(t, chat.Viewport.View(), chat.timestamps[1].Format("15:04:05"))
+
+	chat.TruncateTo(2)
+	require.Len(t, chat.timestamps, 2)
+}
+
 // TestCompletionDialog tests the completion dialog
 func TestCompletionDialog(t *testing.T) {
 	dialog := NewCompletionDialog()
@@ -475,6 +888,35 @@ func TestCompletionDialogScrolling(t *testing.T) {
 	require.Equal(t, 0, dialog.Offset)
 }
 
+func TestCompletionDialogMouseClick(t *testing.T) {
+	model := NewTUIModel(mockConfig())
+	model.prompt.SetViMode(false)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 100, Height: 40})
+	updated, _ = updated.(TUIModel).handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'/'}})
+	model2 := updated.(TUIModel)
+	require.True(t, model2.showCompletionDialog)
+
+	dialog := model2.completions.View()
+	top := model2.completionDialogTop(lipgloss.Height(dialog), model2.prompt.View(), model2.renderViModeAndToast())
+	click := func(m TUIModel, y int) TUIModel {
+		updated, _ := m.Update(tea.MouseMsg{X: 2, Y: y, Button: tea.MouseButtonLeft, Action: tea.MouseActionPress})
+		return updated.(TUIModel)
+	}
+
+	// The first row below the border is the first option
+	model2 = click(model2, top+1+2)
+	require.Equal(t, 2, model2.completions.Selected)
+	require.True(t, model2.showCompletionDialog)
+
+	// Clicking the border selects nothing
+	model2 = click(model2, top)
+	require.Equal(t, 2, model2.completions.Selected)
+
+	// A second click on the same item confirms it
+	model2 = click(model2, top+1+2)
+	require.False(t, model2.showCompletionDialog)
+}
+
 // TestStatusComponent tests the status component
 func TestStatusComponent(t *testing.T) {
 	originalManager := defaultGitInfoManager
@@ -783,3 +1225,251 @@ func TestShowHelpMsgUsesActiveLeader(t *testing.T) {
 	require.Contains(t, slashHelp, "Active command leader: /")
 	require.Contains(t, slashHelp, "/help - Show help information")
 }
+
+func TestFileCompletionPreview(t *testing.T) {
+	dir := t.TempDir()
+	var content strings.Builder
+	for i := 1; i <= 40; i++ {
+		fmt.Fprintf(&content, "line %d\n", i)
+	}
+	path := filepath.Join(dir, "long.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content.String()), 0644))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+
+	preview := filePreview(path)
+	require.Contains(t, preview, "line 15")
+	require.NotContains(t, preview, "line 16")
+	require.Equal(t, "long.txt\nsub/", filePreview(dir))
+
+	model := NewTUIModel(mockConfig())
+	model.completionMode = "file"
+	model.completions.SetOptions([]string{path, dir})
+	model.refreshCompletionPreview()
+	require.Contains(t, model.completions.Preview, "line 1")
+	model.completions.SelectNext()
+	model.refreshCompletionPreview()
+	require.Contains(t, model.completions.Preview, "sub/")
+}
+
+func TestSwitchSessionShortcut(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Chdir(t.TempDir())
+	store, err := NewSessionStore(50, 30, "")
+	require.NoError(t, err)
+	defer store.Close()
+
+	model, _ := newTestModel(t)
+	model.config.Session = SessionConfig{Enabled: true, AutoSave: true}
+	model.sessionStore = store
+	model.session.prepareUserMessage("task A")
+	model.saveSessionSync()
+	firstID := model.session.ID
+	require.NotEmpty(t, firstID)
+
+	handleNewSessionCommand(model, nil)
+	model.session.prepareUserMessage("task B")
+
+	switchSession := func(m TUIModel) TUIModel {
+		updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlP})
+		require.NotNil(t, cmd)
+		updated, _ = updated.(TUIModel).Update(cmd())
+		return updated.(TUIModel)
+	}
+
+	switched := switchSession(*model)
+	require.Equal(t, firstID, switched.session.ID)
+	require.Contains(t, switched.chat.Messages, "You: task A")
+	secondID := ""
+	sessions, err := store.ListSessions(0)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	for _, s := range sessions {
+		if s.ID != firstID {
+			secondID = s.ID
+		}
+	}
+
+	// Switching again goes back to the session we left
+	switched = switchSession(switched)
+	require.Equal(t, secondID, switched.session.ID)
+	require.Contains(t, switched.chat.Messages, "You: task B")
+}
+
+func TestMaxTurnsOffersToContinue(t *testing.T) {
+	model, _ := newTestModel(t)
+	require.Equal(t, defaultMaxTurns, model.session.config.MaxTurns)
+
+	updated, _ := model.Update(streamMaxTurnsExceededMsg{maxTurns: 25})
+	m := updated.(TUIModel)
+	require.NotNil(t, m.confirm)
+
+	_, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	require.NotNil(t, cmd)
+	require.Equal(t, submitPromptMsg{prompt: continueTaskPrompt}, cmd())
+
+	updated, _ = model.Update(streamMaxTurnsExceededMsg{maxTurns: 25})
+	_, cmd = updated.(TUIModel).handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'n'}})
+	require.Nil(t, cmd)
+}
+
+func TestSummaryConfirmCancelledByOtherKey(t *testing.T) {
+	t.Chdir(t.TempDir())
+	model, _ := newTestModel(t)
+	model.prompt.SetViMode(false)
+
+	updated, _ := model.Update(summaryReadyMsg{note: "- Added caching"})
+	m := updated.(TUIModel)
+	require.NotNil(t, m.confirm)
+
+	// A key that isn't an answer cancels the question rather than leaving it hanging
+	updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'x'}})
+	m = updated.(TUIModel)
+	require.Nil(t, cmd)
+	require.Nil(t, m.confirm)
+	require.Equal(t, "Cancelled: Append this summary to AGENTS.md?", m.toastManager.Toasts[len(m.toastManager.Toasts)-1].Message)
+	_, err := os.Stat("AGENTS.md")
+	require.True(t, os.IsNotExist(err), "nothing is written without a yes")
+}
+
+func TestTerminalTooSmall(t *testing.T) {
+	model, _ := newTestModel(t)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 30, Height: 6})
+	m := updated.(TUIModel)
+	// The notice wraps to the narrow window
+	view := strings.Join(strings.Fields(m.View()), " ")
+	require.Contains(t, view, "Terminal too small (30x6, need 40x10)")
+
+	// The layout comes back live once the window grows
+	updated, _ = m.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	m = updated.(TUIModel)
+	require.NotContains(t, m.View(), "Terminal too small")
+
+	m.config.UI.MinWidth = 100
+	require.Contains(t, strings.Join(strings.Fields(m.View()), " "), "need 100x10")
+}
+
+func TestCompactLayout(t *testing.T) {
+	model, _ := newTestModel(t)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	m := updated.(TUIModel)
+	m.sessionActive = true
+	m.chat.AddMessage("You: hi")
+	m.chat.AddMessage("Asimi: hello")
+	m.chat.AddMessage("You: again")
+	regularChat := m.chat.Height
+	require.Contains(t, m.prompt.View(), "╭")
+	require.Contains(t, m.chat.Viewport.View(), "───")
+
+	handleCompactUICommand(&m, []string{"on"})
+	require.True(t, m.config.UI.Compact)
+	require.Greater(t, m.chat.Height, regularChat, "the chat gets the rows the chrome gave up")
+	require.NotContains(t, m.prompt.View(), "╭")
+	require.NotContains(t, m.chat.Viewport.View(), "───")
+	require.LessOrEqual(t, lipgloss.Height(m.View()), 24)
+
+	handleCompactUICommand(&m, nil)
+	require.False(t, m.chat.Compact)
+	require.Equal(t, regularChat, m.chat.Height)
+	require.Contains(t, m.prompt.View(), "╭")
+}
+
+func TestNoAIMode(t *testing.T) {
+	model := NewTUIModel(mockConfig())
+	model.prompt.SetViMode(false)
+	updated, _ := model.Update(tea.WindowSizeMsg{Width: 120, Height: 40})
+	updated, _ = updated.(TUIModel).handleCustomMessages(llmInitErrorMsg{err: errors.New("no API key")})
+	m := updated.(TUIModel)
+
+	require.True(t, m.status.AIDisabled)
+	require.Contains(t, m.status.View(), "AI off")
+	require.Contains(t, m.renderHomeView(120, 30), "AI is disabled: no API key")
+
+	// A prompt offers to log in
+	m.prompt.SetValue("hello")
+	updated, _ = m.handleEnterKey()
+	m = updated.(TUIModel)
+	require.NotNil(t, m.confirm)
+	updated, cmd := m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'y'}})
+	require.NotNil(t, cmd)
+	updated, _ = updated.(TUIModel).Update(cmd())
+	require.NotNil(t, updated.(TUIModel).providerModal)
+
+	// So does the login key
+	m.providerModal = nil
+	updated, _ = m.handleKeyMsg(tea.KeyMsg{Type: tea.KeyCtrlL})
+	require.NotNil(t, updated.(TUIModel).providerModal)
+
+	// Local commands still work
+	msg := handleShellCommand(&m, []string{"echo", "hi"})()
+	out, ok := msg.(showContextMsg)
+	require.True(t, ok)
+	require.Contains(t, out.content, "$ echo hi\n```\nhi\n```\nexit 0")
+}
+
+func TestContextCmdCommand(t *testing.T) {
+	model, _ := newTestModel(t)
+	cmd := handleContextCmdCommand(model, []string{`"echo`, "built;", "echo", "oops", `>&2"`})
+	require.NotNil(t, cmd)
+	msg := cmd().(contextCommandMsg)
+	require.Equal(t, "echo built; echo oops >&2", msg.command)
+
+	updated, _ := model.Update(msg)
+	m := updated.(TUIModel)
+	path := commandContextPath(msg.command)
+	require.Equal(t, "cmd-echo-built-echo-oops-2.txt", path)
+	// Only stdout goes into the context
+	require.Equal(t, "$ echo built; echo oops >&2\nbuilt\n(exit 0)", m.session.ContextFiles[path])
+	require.Contains(t, m.chat.Messages[len(m.chat.Messages)-1], "is in the context of the next prompt as "+path)
+
+	msg = handleContextCmdCommand(&m, []string{"exit", "3"})().(contextCommandMsg)
+	require.Equal(t, "exit 3", msg.status)
+
+	// Slugs are cut on rune boundaries
+	require.Equal(t, "cmd-"+strings.Repeat("ש", 40)+".txt", commandContextPath(strings.Repeat("ש", 50)))
+
+	// Long output is cut to tool_output_limit
+	t.Chdir(t.TempDir())
+	m.session.config.ToolOutputLimit = 100
+	updated, _ = m.Update(contextCommandMsg{command: "seq 1000", output: strings.Repeat("line\n", 1000), status: "exit 0"})
+	m = updated.(TUIModel)
+	require.Less(t, len(m.session.ContextFiles["cmd-seq-1000.txt"]), 400)
+	require.Contains(t, m.session.ContextFiles["cmd-seq-1000.txt"], "The full output (4999 bytes) was saved to")
+}
+
+func TestOpenFileInEditor(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	require.NoError(t, os.WriteFile("main.go", []byte("package main\n"), 0o644))
+	model, _ := newTestModel(t)
+
+	// Nothing to open before the agent touches a file
+	require.Nil(t, model.openLastFile())
+	require.Nil(t, handleOpenCommand(model, nil))
+
+	model.session.processToolCalls(context.Background(), []llms.ToolCall{{
+		ID:           "1",
+		FunctionCall: &llms.FunctionCall{Name: "read_file", Arguments: `{"path":"main.go"}`},
+	}})
+	require.Equal(t, "main.go", model.session.LastFile())
+	require.NotNil(t, model.openLastFile())
+
+	require.NotNil(t, handleOpenCommand(model, []string{"@main.go"}))
+	require.Nil(t, handleOpenCommand(model, []string{"@missing.go"}))
+}
+
+func TestWriteReviewClearedOnCancel(t *testing.T) {
+	model, _ := newTestModel(t)
+	model.showWriteReview(writeReviewMsg{review: writeReview{Path: "main.go", Proposed: "package main\n"}, reply: make(chan writeReviewReply, 1)})
+	require.NotNil(t, model.writeReview)
+
+	updated, _ := model.Update(streamInterruptedMsg{})
+	model2 := updated.(TUIModel)
+	require.Nil(t, model2.writeReview, "a cancelled write should not wait for review")
+
+	model.showExternalEdit(externalEditMsg{path: "main.go", reply: make(chan bool, 1)})
+	require.NotNil(t, model.externalEdit)
+	updated, _ = model.Update(streamInterruptedMsg{})
+	model2 = updated.(TUIModel)
+	require.Nil(t, model2.externalEdit, "a cancelled write should not wait for approval")
+	require.Empty(t, model2.toastManager.Toasts)
+}
@@ -5,10 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	gogit "github.com/go-git/go-git/v5"
 )
@@ -17,21 +19,13 @@ var claudeVersionPattern = regexp.MustCompile(`\d+(\.\d+)?`)
 
 func getFileTree(root string) ([]string, error) {
 	var files []string
-	// Directories to ignore at any level
-	ignoreDirs := map[string]bool{
-		".git":    true,
-		"vendor":  true,
-		".asimi":  true,
-		"archive": true,
-	}
-
 	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
 
 		if info.IsDir() {
-			if ignoreDirs[info.Name()] {
+			if slices.Contains(ignoredDirs, info.Name()) {
 				return filepath.SkipDir
 			}
 			return nil
@@ -55,6 +49,45 @@ func getFileTree(root string) ([]string, error) {
 	return files, nil
 }
 
+// resolveFileRef resolves a file reference from the prompt (@path) or a tool
+// call. Paths starting with ./ or ../ are relative to the working directory,
+// absolute paths are used as they are, and any other path is relative to the
+// project root, so references don't depend on where asimi was started.
+func resolveFileRef(ref string) string {
+	if ref == "" || filepath.IsAbs(ref) {
+		return filepath.Clean(ref)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return filepath.Clean(ref)
+	}
+	if isCwdRef(ref) {
+		return filepath.Join(wd, ref)
+	}
+	return filepath.Join(findProjectRoot(wd), ref)
+}
+
+// isCwdRef reports whether a file reference is explicitly relative to the
+// working directory
+func isCwdRef(ref string) bool {
+	return ref == "." || ref == ".." ||
+		strings.HasPrefix(ref, "./") || strings.HasPrefix(ref, "../")
+}
+
+// projectRelPath returns path relative to the project root when it is
+// inside it, and path unchanged otherwise
+func projectRelPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(findProjectRoot(wd), path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return path
+	}
+	return rel
+}
+
 // findProjectRoot returns the nearest ancestor directory (including start)
 // that contains a project marker like .git or go.mod. Falls back to start.
 func findProjectRoot(start string) string {
@@ -71,6 +104,135 @@ func findProjectRoot(start string) string {
 	}
 }
 
+// projectDataDir returns the directory keeping a project's data, creating
+// it. An empty dir means the default, sub under
+// ~/.local/share/asimi/repo/<slug>. Otherwise "~" and environment variables
+// are expanded, a relative dir is taken from the project root and used as
+// is, and an absolute one gets a directory per project.
+func projectDataDir(dir, home, root, slug, sub string) (string, error) {
+	if dir == "" {
+		dir = filepath.Join(home, ".local", "share", "asimi", "repo", filepath.FromSlash(slug), sub)
+	} else if dir = expandHome(os.ExpandEnv(dir), home); filepath.IsAbs(dir) {
+		dir = filepath.Join(dir, filepath.FromSlash(slug))
+	} else {
+		dir = filepath.Join(root, dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// expandHome replaces a leading "~" in path with home
+func expandHome(path, home string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return path
+}
+
+// additionalWriteDirs are the directories outside the project root the
+// agent may write to, from permission.additional_directories
+var additionalWriteDirs []string
+
+// setAdditionalWriteDirs sets the directories outside the project root the
+// agent may write to. "~" is the home directory and relative paths are taken
+// from the project root.
+func setAdditionalWriteDirs(dirs []string) {
+	additionalWriteDirs = dirs
+}
+
+// checkWritePath resolves a file reference like resolveFileRef and refuses
+// it when it escapes the project root and the additional directories
+func checkWritePath(ref string) (string, error) {
+	path := resolveFileRef(ref)
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("refusing to write %s: can't tell the project root: %w", ref, err)
+	}
+	root := findProjectRoot(wd)
+	if !isWritable(root, path) {
+		return "", fmt.Errorf("refusing to write outside project root %s: %s (allow it with permission.additional_directories)", root, ref)
+	}
+	return path, nil
+}
+
+// isWritable reports whether the agent may write path: it is inside root or
+// one of the additional write directories
+func isWritable(root, path string) bool {
+	if isWithinDir(root, path) {
+		return true
+	}
+	for _, dir := range additionalWriteDirs {
+		if home, err := os.UserHomeDir(); err == nil {
+			dir = expandHome(dir, home)
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+		if isWithinDir(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWithinDir reports whether path is dir or below it, following symlinks
+// in the part of both that exists
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(realPath(dir), realPath(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// realPath resolves the symlinks in the longest existing prefix of path
+func realPath(path string) string {
+	path = filepath.Clean(path)
+	var rest []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		if filepath.Dir(dir) == dir {
+			return path
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, so an interrupted write never leaves a truncated file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	// Flush before the rename so a crash can't leave an empty file in place of path
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
 // getCurrentGitBranch returns the current git branch name
 func getCurrentGitBranch() string {
 	return defaultGitInfoManager.CurrentBranch()
@@ -381,6 +543,16 @@ func summarizeStatus(status gogit.Status) string {
 	return result
 }
 
+// asciiOnly drops the non-ASCII runes, such as emoji icons, from s
+func asciiOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return -1
+		}
+		return r
+	}, s)
+}
+
 // shortenProviderModel shortens provider and model names for display
 func shortenProviderModel(provider, model string) string {
 	// Shorten common provider names
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -164,3 +165,77 @@ func TestShortenProviderModel(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveFileRef(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, os.Mkdir(filepath.Join(root, ".git"), 0o755))
+	sub := filepath.Join(root, "pkg", "sub")
+	require.NoError(t, os.MkdirAll(sub, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "main.go"), []byte("package main\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "util.go"), []byte("package sub\n"), 0o644))
+	t.Chdir(sub)
+
+	require.Equal(t, filepath.Join(root, "main.go"), resolveFileRef("main.go"))
+	require.Equal(t, filepath.Join(sub, "util.go"), resolveFileRef("./util.go"))
+	require.Equal(t, filepath.Join(root, "pkg", "x.go"), resolveFileRef("../x.go"))
+	require.Equal(t, "/etc/hosts", resolveFileRef("/etc/hosts"))
+	require.Equal(t, "pkg/sub/util.go", projectRelPath(resolveFileRef("./util.go")))
+
+	// Tools find project files from a subdirectory
+	out, err := ReadFileTool{}.Call(context.Background(), `{"path": "main.go"}`)
+	require.NoError(t, err)
+	require.Equal(t, "package main\n", out)
+	out, err = ReadManyFilesTool{}.Call(context.Background(), `{"paths": ["pkg/**/*.go"]}`)
+	require.NoError(t, err)
+	require.Contains(t, out, "---\tpkg/sub/util.go---")
+
+	// Completions follow the same rules
+	files, err := fileCompletionCandidates("")
+	require.NoError(t, err)
+	require.Contains(t, files, "main.go")
+	require.Contains(t, files, "pkg/sub/util.go")
+	files, err = fileCompletionCandidates("./u")
+	require.NoError(t, err)
+	require.Equal(t, []string{"./util.go"}, files)
+	files, err = fileCompletionCandidates(root + "/m")
+	require.NoError(t, err)
+	require.Contains(t, files, root+"/main.go")
+	require.Contains(t, files, root+"/pkg/")
+}
+
+func TestCheckWritePath(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "project")
+	extra := filepath.Join(base, "extra")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, ".git"), 0o755))
+	require.NoError(t, os.MkdirAll(extra, 0o755))
+	require.NoError(t, os.Symlink(base, filepath.Join(root, "escape")))
+	t.Chdir(root)
+
+	_, err := checkWritePath("src/new.go")
+	require.NoError(t, err)
+	for _, ref := range []string{"../outside.txt", "/etc/passwd", filepath.Join(extra, "a.txt"), "escape/extra/a.txt"} {
+		_, err := checkWritePath(ref)
+		require.ErrorContains(t, err, "refusing to write outside project root", ref)
+	}
+	_, err = WriteFileTool{}.Call(context.Background(), `{"path": "../outside.txt", "content": "x"}`)
+	require.ErrorContains(t, err, "refusing to write outside project root")
+	require.NoFileExists(t, filepath.Join(base, "outside.txt"))
+
+	setAdditionalWriteDirs([]string{"../extra"})
+	t.Cleanup(func() { setAdditionalWriteDirs(nil) })
+	path, err := checkWritePath(filepath.Join(extra, "a.txt"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(extra, "a.txt"), path)
+	_, err = checkWritePath("../outside.txt")
+	require.Error(t, err)
+
+	// Without a working directory there's no root to check against
+	gone := filepath.Join(base, "gone")
+	require.NoError(t, os.Mkdir(gone, 0o755))
+	t.Chdir(gone)
+	require.NoError(t, os.Remove(gone))
+	_, err = checkWritePath("a.txt")
+	require.ErrorContains(t, err, "can't tell the project root")
+}